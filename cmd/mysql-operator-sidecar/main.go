@@ -20,12 +20,14 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	logf "github.com/presslabs/controller-util/log"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2/klogr"
 
 	"github.com/bitpoke/mysql-operator/pkg/sidecar"
+	"github.com/bitpoke/mysql-operator/pkg/util/constants"
 )
 
 var log = logf.Log.WithName("sidecar")
@@ -99,7 +101,10 @@ func main() {
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			err := sidecar.RunTakeBackupCommand(cfg, args[0], args[1])
-			if err != nil {
+			if sidecar.IsTimeout(err) {
+				log.Error(err, "take backup command timed out")
+				os.Exit(constants.BackupTimeoutExitCode)
+			} else if err != nil {
 				log.Error(err, "take backup command failed")
 				os.Exit(1)
 
@@ -108,6 +113,168 @@ func main() {
 	}
 	cmd.AddCommand(takeBackupCmd)
 
+	takeLogicalBackupCmd := &cobra.Command{
+		Use:   "take-logical-backup-to",
+		Short: "Dump databases from node and push the dumps to rclone path.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 3 {
+				return fmt.Errorf("require at least three arguments. source host, destination bucket and databases")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := sidecar.RunTakeLogicalBackupCommand(cfg, args[0], args[1], args[2:])
+			if sidecar.IsTimeout(err) {
+				log.Error(err, "take logical backup command timed out")
+				os.Exit(constants.BackupTimeoutExitCode)
+			} else if err != nil {
+				log.Error(err, "take logical backup command failed")
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(takeLogicalBackupCmd)
+
+	restoreLogicalBackupCmd := &cobra.Command{
+		Use:   "restore-logical-backup",
+		Short: "Load a database from a logical backup into a running node.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 3 {
+				return fmt.Errorf("require three arguments. destination host, source bucket and database")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := sidecar.RunRestoreLogicalBackupCommand(cfg, args[0], args[1], args[2]); err != nil {
+				log.Error(err, "restore logical backup command failed")
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(restoreLogicalBackupCmd)
+
+	restoreBackupCmd := &cobra.Command{
+		Use:   "restore-backup",
+		Short: "Restore and prepare a backup from bucket into an empty data dir.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := sidecar.RunRestoreBackupCommand(cfg); err != nil {
+				log.Error(err, "restore backup command failed")
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(restoreBackupCmd)
+
+	purgeTrashCmd := &cobra.Command{
+		Use:   "purge-trash",
+		Short: "Remove from the trash the backups soft deleted before the retention period.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("require two arguments. trash bucket and retention period")
+			}
+			if _, err := time.ParseDuration(args[1]); err != nil {
+				return fmt.Errorf("invalid retention period: %s", err)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			retention, _ := time.ParseDuration(args[1])
+			if err := sidecar.RunPurgeTrashCommand(cfg, args[0], retention); err != nil {
+				log.Error(err, "purge trash command failed")
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(purgeTrashCmd)
+
+	deleteBackupCmd := &cobra.Command{
+		Use:   "delete-backup",
+		Short: "Remove a backup from bucket, or move it to the trash.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 || len(args) > 2 {
+				return fmt.Errorf("require one or two arguments. the backup and the trash url")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			trashURL := ""
+			if len(args) == 2 {
+				trashURL = args[1]
+			}
+			if err := sidecar.RunDeleteBackupCommand(cfg, args[0], trashURL); err != nil {
+				log.Error(err, "delete backup command failed")
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(deleteBackupCmd)
+
+	listBackupsCmd := &cobra.Command{
+		Use:   "list-backups",
+		Short: "List the backups from bucket into the backup catalog config map.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("require two arguments. the bucket and the catalog config map")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := sidecar.RunListBackupsCommand(cfg, args[0], args[1]); err != nil {
+				log.Error(err, "list backups command failed")
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(listBackupsCmd)
+
+	readManifestCmd := &cobra.Command{
+		Use:   "read-manifest",
+		Short: "Read the manifest uploaded next to a backup into a config map.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("require two arguments. the backup URL and the manifest config map")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := sidecar.RunReadManifestCommand(cfg, args[0], args[1]); err != nil {
+				log.Error(err, "read manifest command failed")
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(readManifestCmd)
+
+	runSQLHookCmd := &cobra.Command{
+		Use:   "run-sql-hook",
+		Short: "Execute the SQL statements of a backup hook on a node.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("require at least two arguments. the host and the statements")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := sidecar.RunSQLHookCommand(cfg, args[0], args[1:]); err != nil {
+				log.Error(err, "run sql hook command failed")
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(runSQLHookCmd)
+
+	preStopCmd := &cobra.Command{
+		Use:   "pre-stop",
+		Short: "Take over the master before the node is stopped, called by the pre-stop hook.",
+		Run: func(cmd *cobra.Command, args []string) {
+			// the failures are logged by the command
+			if err := sidecar.RunPreStopCommand(cfg); err != nil {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(preStopCmd)
+
 	if err := cmd.Execute(); err != nil {
 		log.Error(err, "failed to execute command", "cmd", cmd)
 		os.Exit(1)
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"log"
 
 	"github.com/spf13/cobra"
@@ -79,6 +80,26 @@ func main() {
 	}
 	cmd.AddCommand(fipCmd)
 
+	crCmd := &cobra.Command{
+		Use:   "check-recovery",
+		Short: "Fail if the failed host must not be recovered, which aborts the failover",
+		Run: func(cmd *cobra.Command, args []string) {
+			// check command line args
+			if len(args) != 2 {
+				log.Fatal("see usage: <cluster.name> <failed host>")
+			}
+
+			err = orchelper.CheckRecovery(c, args[0], args[1])
+			if errors.Is(err, orchelper.ErrRecoveryBlocked) {
+				log.Fatal("recovery is blocked: ", err)
+			} else if err != nil {
+				// the recovery is not blocked when it can't be checked
+				log.Print("failed to check recovery: ", err)
+			}
+		},
+	}
+	cmd.AddCommand(crCmd)
+
 	evWarningType := false
 	evCmd := &cobra.Command{
 		Use:   "event",
@@ -77,12 +77,40 @@ case "$1" in
         shift 1
         exec $SIDECAR_BIN $VERBOSE take-backup-to "$@"
         ;;
+    take-logical-backup-to)
+        shift 1
+        exec $SIDECAR_BIN $VERBOSE take-logical-backup-to "$@"
+        ;;
+    restore-logical-backup)
+        shift 1
+        exec $SIDECAR_BIN $VERBOSE restore-logical-backup "$@"
+        ;;
     schedule-backup)
         shift 1
         exec $SIDECAR_BIN $VERBOSE schedule-backup "$@"
         ;;
+    restore-backup)
+        shift 1
+        exec $SIDECAR_BIN $VERBOSE restore-backup "$@"
+        ;;
+    purge-trash)
+        shift 1
+        exec $SIDECAR_BIN $VERBOSE purge-trash "$@"
+        ;;
+    delete-backup)
+        shift 1
+        exec $SIDECAR_BIN $VERBOSE delete-backup "$@"
+        ;;
+    list-backups)
+        shift 1
+        exec $SIDECAR_BIN $VERBOSE list-backups "$@"
+        ;;
+    run-sql-hook)
+        shift 1
+        exec $SIDECAR_BIN $VERBOSE run-sql-hook "$@"
+        ;;
     *)
-        echo "Usage: $0 {clone-and-init|config-and-serve|take-backup-to|schedule-backup}"
+        echo "Usage: $0 {clone-and-init|config-and-serve|take-backup-to|take-logical-backup-to|restore-logical-backup|schedule-backup|restore-backup|purge-trash|delete-backup|list-backups|run-sql-hook}"
         echo "Now runs your command."
         echo "$@"
 
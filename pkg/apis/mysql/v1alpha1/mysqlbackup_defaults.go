@@ -20,6 +20,14 @@ package v1alpha1
 // nolint: golint
 func SetDefaults_MysqlBackup(b *MysqlBackup) {
 	if len(b.Spec.RemoteDeletePolicy) == 0 {
-		b.Spec.RemoteDeletePolicy = Retain
+		b.Spec.RemoteDeletePolicy = SoftDelete
+	}
+
+	if len(b.Spec.Type) == 0 {
+		b.Spec.Type = FullBackup
+	}
+
+	if len(b.Spec.Method) == 0 {
+		b.Spec.Method = XtrabackupMethod
 	}
 }
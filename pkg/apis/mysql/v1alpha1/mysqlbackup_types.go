@@ -44,8 +44,138 @@ type MysqlBackupSpec struct {
 	// default it's used softDelete.
 	// +optional
 	RemoteDeletePolicy DeletePolicy `json:"remoteDeletePolicy,omitempty"`
+
+	// Type of the backup, can be `full`, `incremental` or `logical`. An incremental backup
+	// contains only the changes made since the base backup. A logical backup is a mysqldump of
+	// each of the backed up databases, which can be restored one at a time into a running
+	// cluster. Defaults to `full`.
+	// +kubebuilder:validation:Enum=full;incremental;logical
+	// +optional
+	Type BackupType `json:"type,omitempty"`
+
+	// Databases is the list of databases dumped by a logical backup. When not set, the databases
+	// of the MysqlDatabase resources of the cluster are dumped.
+	// +optional
+	Databases []string `json:"databases,omitempty"`
+
+	// BaseBackupName is the name of the MysqlBackup on which an incremental backup is based.
+	// It can be either a full or an incremental backup of the same cluster.
+	// +optional
+	BaseBackupName string `json:"baseBackupName,omitempty"`
+
+	// Verify specifies whether the backup is restored to check it's usable, once completed.
+	// Defaults to the cluster's BackupVerify.
+	// +optional
+	Verify *bool `json:"verify,omitempty"`
+
+	// VerifyQuery is the sanity query run on the restored data. Defaults to the cluster's
+	// BackupVerifyQuery.
+	// +optional
+	VerifyQuery string `json:"verifyQuery,omitempty"`
+
+	// Encryption configures the client-side encryption of the backup. Default is used the one
+	// specified in the cluster.
+	// +optional
+	Encryption *BackupEncryption `json:"encryption,omitempty"`
+
+	// Method of taking the backup, can be `xtrabackup` or `volumeSnapshot`. A volume snapshot
+	// backup is a CSI VolumeSnapshot of the data volume of a replica, taken while the replica is
+	// locked for backup. It's available only for clusters with persistent volumes and is not
+	// uploaded to the BackupURL. Defaults to `xtrabackup`.
+	// +kubebuilder:validation:Enum=xtrabackup;volumeSnapshot
+	// +optional
+	Method BackupMethod `json:"method,omitempty"`
+
+	// VolumeSnapshotClassName is the VolumeSnapshotClass used for volume snapshot backups. When
+	// not set the default class of the CSI driver is used.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+
+	// Hooks are the actions run before and after the backup is taken. Default is used the one
+	// specified in the cluster.
+	// +optional
+	Hooks *BackupHooks `json:"hooks,omitempty"`
+
+	// ActiveDeadlineSeconds is the duration in seconds the backup job may run, retries included,
+	// before it's stopped and the backup fails with the Timeout reason. Default is used the one
+	// specified in the cluster.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// BackoffLimit is the number of times the backup is retried before it fails. Default is
+	// used the one specified in the cluster, else 6 as for any job.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// Cancel stops the backup when set to true. The running backup job is deleted and the
+	// backup fails with the Cancelled reason.
+	// +optional
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+// BackupHooks defines the actions run around a backup. The hooks of a backup that is not taken
+// by a job, such as a volume snapshot backup, are not run.
+type BackupHooks struct {
+	// PreBackup is run before the backup is started. The backup is not taken if it fails.
+	// +optional
+	PreBackup *BackupHook `json:"preBackup,omitempty"`
+
+	// PostBackup is run, by a separate job, after the backup was uploaded successfully. A failure
+	// doesn't fail the backup but is reported as the HookFailed condition.
+	// +optional
+	PostBackup *BackupHook `json:"postBackup,omitempty"`
+}
+
+// BackupHook defines an action run around a backup, as SQL statements, containers or both, in
+// which case the SQL statements are executed first.
+type BackupHook struct {
+	// SQL is the list of statements executed, in order and in the same session, on the node
+	// from which the backup is taken.
+	// +optional
+	SQL []string `json:"sql,omitempty"`
+
+	// Containers are run in the backup job, before the backup, one after another, or in the
+	// post backup hooks job, in parallel. The BACKUP_NAME, BACKUP_URL and BACKUP_SOURCE_NODE
+	// environment variables are set in each container.
+	// +optional
+	Containers []core.Container `json:"containers,omitempty"`
 }
 
+// BackupMethod defines how a backup is taken
+type BackupMethod string
+
+const (
+	// XtrabackupMethod streams the data with xtrabackup from a node to the backup URL
+	XtrabackupMethod BackupMethod = "xtrabackup"
+	// VolumeSnapshotMethod takes a CSI VolumeSnapshot of the data volume of a node
+	VolumeSnapshotMethod BackupMethod = "volumeSnapshot"
+)
+
+// BackupEncryption defines the keys used to encrypt backups
+type BackupEncryption struct {
+	// SecretName is the name of the secret that holds the encryption keys. The keys of the secret
+	// are the key IDs and the values are 256-bit keys, raw, hex or base64 encoded. Keep the old
+	// keys in the secret after a rotation to still be able to restore the old backups.
+	SecretName string `json:"secretName"`
+
+	// KeyID is the ID of the key, from the secret, used to encrypt new backups.
+	KeyID string `json:"keyID"`
+}
+
+// BackupType defines the types of backups
+type BackupType string
+
+const (
+	// FullBackup is a backup that contains all data
+	FullBackup BackupType = "full"
+	// IncrementalBackup is a backup that contains only the changes made since its base backup
+	IncrementalBackup BackupType = "incremental"
+	// LogicalBackup is a backup that contains a SQL dump of each of the selected databases
+	LogicalBackup BackupType = "logical"
+)
+
 // BackupCondition defines condition struct for backup resource
 type BackupCondition struct {
 	// type of cluster condition, values in (\"Ready\")
@@ -69,6 +199,10 @@ const (
 	BackupComplete BackupConditionType = "Complete"
 	// BackupFailed means backup has failed
 	BackupFailed BackupConditionType = "Failed"
+	// BackupVerified means the backup was restored and the sanity query succeeded
+	BackupVerified BackupConditionType = "Verified"
+	// BackupHookFailed means a pre or post backup hook has failed
+	BackupHookFailed BackupConditionType = "HookFailed"
 )
 
 // DeletePolicy defines the types of policies for backup deletions are
@@ -81,6 +215,9 @@ const (
 	// Retain when used it will delete only the MysqlBackup resource from Kuberentes and will keep the backup
 	// on remote storage.
 	Retain DeletePolicy = "retain"
+	// SoftDelete when used it will move the backup to the trash location of the bucket then will remove the
+	// MysqlBackup resource from Kubernetes. The backup is purged from the trash after a grace period.
+	SoftDelete DeletePolicy = "softDelete"
 )
 
 // MysqlBackupStatus defines the observed state of MysqlBackup
@@ -90,10 +227,94 @@ type MysqlBackupStatus struct {
 	Completed bool `json:"completed,omitempty"`
 	// Conditions represents the backup resource conditions list.
 	Conditions []BackupCondition `json:"conditions,omitempty"`
+
+	// FromLSN is the log sequence number from which the backup starts, 0 for full backups
+	// +optional
+	FromLSN int64 `json:"fromLSN,omitempty"`
+	// ToLSN is the log sequence number at which the backup ends, the starting point for
+	// an incremental backup based on this one
+	// +optional
+	ToLSN int64 `json:"toLSN,omitempty"`
+
+	// Size is the size in bytes of the stored backup, after compression
+	// +optional
+	Size int64 `json:"size,omitempty"`
+	// SHA256 is the hex encoded SHA-256 checksum of the stored backup, computed while it's
+	// uploaded and verified when the backup is restored
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+	// StartTime is the time when the backup job started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// FinishTime is the time when the backup job finished, either successfully or not
+	// +optional
+	FinishTime *metav1.Time `json:"finishTime,omitempty"`
+	// SourceNode is the hostname of the node from which the backup is taken
+	// +optional
+	SourceNode string `json:"sourceNode,omitempty"`
+	// SourceNodeReason is the reason for which the source node was selected, e.g.
+	// LeastLaggedReplica or MasterFallback
+	// +optional
+	SourceNodeReason string `json:"sourceNodeReason,omitempty"`
+	// ServerUUID is the UUID of the MySQL server from which the backup was taken. The
+	// incremental backups must be taken from the server of their base backup.
+	// +optional
+	ServerUUID string `json:"serverUUID,omitempty"`
+	// GTIDSet is the set of transactions contained by the backup, as reported by xtrabackup
+	// +optional
+	GTIDSet string `json:"gtidSet,omitempty"`
+	// MysqlVersion is the version of the MySQL server from which the backup was taken
+	// +optional
+	MysqlVersion string `json:"mysqlVersion,omitempty"`
+	// CompressCommand is the command used to compress the backup
+	// +optional
+	CompressCommand string `json:"compressCommand,omitempty"`
+	// EncryptionKeyID is the ID of the key with which the backup was encrypted, empty if the
+	// backup is not encrypted
+	// +optional
+	EncryptionKeyID string `json:"encryptionKeyID,omitempty"`
+	// VolumeSnapshotName is the name of the VolumeSnapshot of a volume snapshot backup
+	// +optional
+	VolumeSnapshotName string `json:"volumeSnapshotName,omitempty"`
+	// Databases is the list of databases contained by a logical backup
+	// +optional
+	Databases []string `json:"databases,omitempty"`
+	// DatabaseChecksums maps the databases of a logical backup to the SHA-256 checksums of their
+	// dumps, as uploaded to the bucket
+	// +optional
+	DatabaseChecksums map[string]string `json:"databaseChecksums,omitempty"`
+	// Progress is the progress of the backup while it's streamed from the source node
+	// +optional
+	Progress *BackupProgress `json:"progress,omitempty"`
+}
+
+// BackupProgress is the progress of a running backup
+type BackupProgress struct {
+	// BytesStreamed is the number of bytes sent by the source node so far, before compression
+	BytesStreamed int64 `json:"bytesStreamed"`
+	// Throughput is the average number of bytes streamed per second
+	Throughput int64 `json:"throughput"`
+	// DataSize is the size of the data directory of the source node, an estimate of the total
+	// number of bytes to stream
+	// +optional
+	DataSize int64 `json:"dataSize,omitempty"`
+	// EstimatedCompletionTime is when the backup is expected to finish at the current throughput
+	// +optional
+	EstimatedCompletionTime *metav1.Time `json:"estimatedCompletionTime,omitempty"`
+	// LastUpdateTime is the time when the progress was reported
+	LastUpdateTime metav1.Time `json:"lastUpdateTime"`
 }
 
 // MysqlBackup is the Schema for the mysqlbackups API
 // +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName"
+// +kubebuilder:printcolumn:name="Completed",type="boolean",JSONPath=".status.completed",description="Whether the backup is in a final state"
+// +kubebuilder:printcolumn:name="Verified",type="string",JSONPath=".status.conditions[?(@.type == 'Verified')].status",description="Whether the backup was restored successfully"
+// +kubebuilder:printcolumn:name="Size",type="integer",JSONPath=".status.size",description="The size in bytes of the stored backup"
+// +kubebuilder:printcolumn:name="Source",type="string",JSONPath=".status.sourceNode",priority=1
+// +kubebuilder:printcolumn:name="GTID Set",type="string",JSONPath=".status.gtidSet",priority=1
+// +kubebuilder:printcolumn:name="Finished",type="date",JSONPath=".status.finishTime",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 //
 type MysqlBackup struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -70,6 +70,28 @@ type MysqlClusterSpec struct {
 	InitBucketURI        string `json:"initBucketURI,omitempty"`
 	InitBucketSecretName string `json:"initBucketSecretName,omitempty"`
 
+	// A list of incremental backups URLs that are applied, in this order, on top of the
+	// backup from InitBucketURL.
+	// +optional
+	InitBucketIncrementalURLs []string `json:"initBucketIncrementalURLs,omitempty"`
+
+	// InitBucketChecksums maps the URLs of the backups from InitBucketURL and
+	// InitBucketIncrementalURLs to their SHA-256 checksums, against which they are verified.
+	// +optional
+	InitBucketChecksums map[string]string `json:"initBucketChecksums,omitempty"`
+
+	// InitRestorePoint is used together with InitBucketURL to restore the cluster to a point in time
+	// by replaying archived binary logs on top of the initial backup.
+	// +optional
+	InitRestorePoint *RestorePoint `json:"initRestorePoint,omitempty"`
+
+	// InitVolumeSnapshotName is the name of a VolumeSnapshot, usually taken by a volume snapshot
+	// backup, from which the data volumes of the nodes are created when they don't exist yet. It
+	// applies to the first node of a new cluster as well as to new replicas. Requires
+	// VolumeSpec.PersistentVolumeClaim.
+	// +optional
+	InitVolumeSnapshotName string `json:"initVolumeSnapshotName,omitempty"`
+
 	// The number of pods from that set that must still be available after the
 	// eviction, even in the absence of the evicted pod
 	// Defaults to 50%
@@ -91,6 +113,16 @@ type MysqlClusterSpec struct {
 	// +optional
 	BackupRemoteDeletePolicy DeletePolicy `json:"backupRemoteDeletePolicy,omitempty"`
 
+	// BackupTrashPrefix is the path, relative to the location of the backup, where the backups
+	// deleted with the softDelete policy are moved. Defaults to `trash`.
+	// +optional
+	BackupTrashPrefix string `json:"backupTrashPrefix,omitempty"`
+
+	// BackupTrashRetention is the grace period after which the soft deleted backups are purged
+	// from the trash. Defaults to 168h (7 days).
+	// +optional
+	BackupTrashRetention *metav1.Duration `json:"backupTrashRetention,omitempty"`
+
 	// Represents the name of the secret that contains credentials to connect to
 	// the storage provider to store backups.
 	// +optional
@@ -100,6 +132,71 @@ type MysqlClusterSpec struct {
 	// +optional
 	BackupScheduleJobsHistoryLimit *int `json:"backupScheduleJobsHistoryLimit,omitempty"`
 
+	// BackupRetention defines which of the scheduled backups are kept, by hourly, daily, weekly
+	// and monthly tiers, or by age. When set, BackupScheduleJobsHistoryLimit is ignored.
+	// +optional
+	BackupRetention *BackupRetention `json:"backupRetention,omitempty"`
+
+	// BackupSchedules are additional backup schedules, each with its own destination, credentials
+	// and retention. They are independent of BackupSchedule, which keeps working as before.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	BackupSchedules []BackupSchedule `json:"backupSchedules,omitempty"`
+
+	// Set to true to continuously upload the binary logs closed on the master node to
+	// `<BackupURL>/binlogs/<cluster name>/`. Those are needed for point-in-time recovery.
+	// +optional
+	BackupBinlogs bool `json:"backupBinlogs,omitempty"`
+
+	// BinlogRetention is how long the binary logs are kept on the nodes when BackupBinlogs is set.
+	// MySQL doesn't expire them then, the master purges only those already uploaded.
+	// Defaults to 336h (14 days).
+	// +optional
+	BinlogRetention *metav1.Duration `json:"binlogRetention,omitempty"`
+
+	// Set to true to verify that every completed backup can be restored. A job restores the
+	// backup, starts MySQL on the restored data and runs BackupVerifyQuery. The result is
+	// set as the `Verified` condition of the backup. It can be overridden per backup.
+	// +optional
+	BackupVerify bool `json:"backupVerify,omitempty"`
+
+	// BackupVerifyQuery is the sanity query run on the restored data when a backup is verified.
+	// Defaults to counting the tables from information_schema.
+	// +optional
+	BackupVerifyQuery string `json:"backupVerifyQuery,omitempty"`
+
+	// Set to true to periodically list the BackupURL and import the backups that have no
+	// MysqlBackup, e.g. after the namespace was recreated. The backups are imported as completed
+	// MysqlBackups labeled with `backups.mysql.presslabs.org/imported`, with the details from the
+	// manifest uploaded next to each backup, when found.
+	// +optional
+	BackupCatalogSync bool `json:"backupCatalogSync,omitempty"`
+
+	// BackupEncryption enables the client-side encryption of backups and archived binlogs, before
+	// they are uploaded. The keys are used also to decrypt the backups from which the cluster is
+	// initialized.
+	// +optional
+	BackupEncryption *BackupEncryption `json:"backupEncryption,omitempty"`
+
+	// BackupHooks are the actions run before and after each backup of the cluster. They can be
+	// overridden per MysqlBackup.
+	// +optional
+	BackupHooks *BackupHooks `json:"backupHooks,omitempty"`
+
+	// BackupActiveDeadlineSeconds is the duration in seconds a backup of the cluster may run
+	// before it fails, such that a hung backup doesn't block the next scheduled ones. It can be
+	// overridden per MysqlBackup.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	BackupActiveDeadlineSeconds *int64 `json:"backupActiveDeadlineSeconds,omitempty"`
+
+	// BackupBackoffLimit is the number of times a backup of the cluster is retried before it
+	// fails. It can be overridden per MysqlBackup.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackupBackoffLimit *int32 `json:"backupBackoffLimit,omitempty"`
+
 	// A map[string]string that will be passed to my.cnf file.
 	// +optional
 	MysqlConf MysqlConf `json:"mysqlConf,omitempty"`
@@ -132,6 +229,28 @@ type MysqlClusterSpec struct {
 	// +optional
 	ReadOnly bool `json:"readOnly,omitempty"`
 
+	// Switchover requests a planned change of the master, done through a graceful master
+	// takeover in orchestrator. The result is reported in .status.switchover.
+	// +optional
+	Switchover *Switchover `json:"switchover,omitempty"`
+
+	// PromotionRules are registered in orchestrator for the nodes of the cluster to prefer or
+	// to forbid their promotion as master on failover. The first rule that matches a node
+	// applies, the nodes matched by no rule are neutral.
+	// +optional
+	PromotionRules []PromotionRule `json:"promotionRules,omitempty"`
+
+	// ReplicationSource makes the cluster a standby of an external MySQL server, usually the
+	// master service of a cluster from another region. The master of the standby replicates
+	// from the source and the cluster is kept read only until it's promoted.
+	// +optional
+	ReplicationSource *ReplicationSource `json:"replicationSource,omitempty"`
+
+	// Durability configures how the transactions committed on the master are acknowledged by the
+	// replicas. The replication is asynchronous by default.
+	// +optional
+	Durability *Durability `json:"durability,omitempty"`
+
 	// Set a custom offset for Server IDs.  ServerID for each node will be the index of the statefulset, plus offset
 	// +optional
 	ServerIDOffset *int `json:"serverIDOffset,omitempty"`
@@ -170,11 +289,246 @@ type MysqlClusterSpec struct {
 	// +optional
 	XtrabackupTargetDir string `json:"xtrabackupTargetDir,omitempty"`
 
+	// BackupBandwidthLimit is the maximum rate, in bytes per second, at which a node streams
+	// its data to the backup jobs, e.g. `50Mi`. Unlimited by default.
+	// +optional
+	BackupBandwidthLimit *resource.Quantity `json:"backupBandwidthLimit,omitempty"`
+
+	// CloneBandwidthLimit is the maximum rate, in bytes per second, at which a node streams
+	// its data to a new node that clones from it. It's independent from the backup limit, such
+	// that nodes can be recovered faster than the backups are taken. Unlimited by default.
+	// +optional
+	CloneBandwidthLimit *resource.Quantity `json:"cloneBandwidthLimit,omitempty"`
+
+	// BackupStorage configures the client used to upload the backups to, and to download them
+	// from, the bucket. rclone is used by default.
+	// +optional
+	BackupStorage *BackupStorage `json:"backupStorage,omitempty"`
+
+	// BackupCandidate configures how the node from which the backups are taken is selected. By
+	// default it's the first healthy replica, or the master when there is none.
+	// +optional
+	BackupCandidate *BackupCandidate `json:"backupCandidate,omitempty"`
+
 	// InitFileExtraSQL is a list of extra sql commands to append to init_file.
 	// +optional
 	InitFileExtraSQL []string `json:"initFileExtraSQL,omitempty"`
 }
 
+// BackupStorageBackend defines the client used to access the backups bucket
+type BackupStorageBackend string
+
+const (
+	// RcloneStorageBackend runs rclone, it supports all the providers
+	RcloneStorageBackend BackupStorageBackend = "rclone"
+	// NativeStorageBackend uploads the backups in parts, in parallel, and verifies their
+	// checksums. It supports S3 compatible storages, GCS and Azure Blob Storage and uses rclone
+	// for the other providers.
+	NativeStorageBackend BackupStorageBackend = "native"
+)
+
+// BackupStorage defines how the backups are uploaded to, and downloaded from, the bucket
+type BackupStorage struct {
+	// Backend is the client used to access the bucket. The native backend reads the same
+	// credentials as rclone, from the backup secret, and falls back to rclone when they are
+	// not set, e.g. when S3 is accessed with the role of the pod.
+	// +kubebuilder:validation:Enum=rclone;native
+	// +optional
+	Backend BackupStorageBackend `json:"backend,omitempty"`
+
+	// PartSize is the size of the parts of the native multipart uploads, at least 5Mi. Each
+	// part uploaded in parallel is buffered in memory. Defaults to 16Mi.
+	// +optional
+	PartSize *resource.Quantity `json:"partSize,omitempty"`
+
+	// Concurrency is the number of parts uploaded in parallel by the native backend.
+	// Defaults to 4.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Concurrency int32 `json:"concurrency,omitempty"`
+}
+
+// PromotionRuleType is the preference for promoting a node as master
+// +kubebuilder:validation:Enum=prefer;neutral;must_not
+type PromotionRuleType string
+
+const (
+	// PreferPromotion makes orchestrator prefer the node when promoting a new master
+	PreferPromotion PromotionRuleType = "prefer"
+	// NeutralPromotion has no preference for the node
+	NeutralPromotion PromotionRuleType = "neutral"
+	// MustNotPromotion forbids orchestrator to promote the node as master
+	MustNotPromotion PromotionRuleType = "must_not"
+)
+
+// PromotionRule sets the promotion preference of the nodes selected by ordinal or by pod
+// labels
+type PromotionRule struct {
+	// Rule is the promotion preference of the selected nodes
+	Rule PromotionRuleType `json:"rule"`
+
+	// Ordinals selects the nodes by their ordinal in the statefulset
+	// +optional
+	Ordinals []int32 `json:"ordinals,omitempty"`
+
+	// PodSelector selects the nodes by the labels of their pods
+	// +optional
+	PodSelector map[string]string `json:"podSelector,omitempty"`
+}
+
+// DurabilityMode defines when a transaction committed on the master is acknowledged
+// +kubebuilder:validation:Enum=async;semiSync
+type DurabilityMode string
+
+const (
+	// AsyncDurability acknowledges the transactions without waiting for the replicas, so a
+	// master crash can lose the transactions not yet replicated
+	AsyncDurability DurabilityMode = "async"
+	// SemiSyncDurability acknowledges the transactions after they are received by the replicas,
+	// using the MySQL semi-synchronous replication plugins
+	SemiSyncDurability DurabilityMode = "semiSync"
+)
+
+// Durability defines the durability mode of the cluster
+type Durability struct {
+	// Mode is the durability mode, async or semiSync. Defaults to async.
+	// +optional
+	Mode DurabilityMode `json:"mode,omitempty"`
+
+	// WaitForReplicaCount is the number of replicas that should receive a transaction before
+	// it's acknowledged by the master, in semiSync mode. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	WaitForReplicaCount int32 `json:"waitForReplicaCount,omitempty"`
+
+	// Timeout is how long the master waits for the replicas before it falls back to the
+	// asynchronous replication, in semiSync mode. Defaults to 10s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// ReplicationSource defines the external MySQL server from which a standby cluster replicates
+type ReplicationSource struct {
+	// Host is the address of the source, e.g. the master service of the primary cluster
+	Host string `json:"host"`
+
+	// Port is the MySQL port of the source. Defaults to 3306.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// SecretName is the name of the secret with the replication credentials, in the
+	// REPLICATION_USER and REPLICATION_PASSWORD keys. The user should exist on the source and
+	// have the REPLICATION SLAVE privilege.
+	SecretName string `json:"secretName"`
+
+	// TLS enables the encryption of the replication connection to the source
+	// +optional
+	TLS *ReplicationSourceTLS `json:"tls,omitempty"`
+
+	// Promoted detaches the standby from the source and makes it writable. The cluster keeps
+	// being read only until the replication from the source is stopped.
+	// +optional
+	Promoted bool `json:"promoted,omitempty"`
+}
+
+// ReplicationSourceTLS defines the TLS settings of the replication connection to the source
+type ReplicationSourceTLS struct {
+	// SecretName is the name of the secret with the CA certificate in the ca.crt key and,
+	// optionally, the client certificate and key in the tls.crt and tls.key keys
+	SecretName string `json:"secretName"`
+
+	// VerifyServerCert enables the verification of the source hostname against its certificate
+	// +optional
+	VerifyServerCert bool `json:"verifyServerCert,omitempty"`
+}
+
+// Switchover defines a planned change of the master
+type Switchover struct {
+	// ID identifies the switchover request. A switchover is done once for each ID, so a new
+	// switchover is requested by changing it.
+	ID string `json:"id"`
+
+	// TargetPod is the name of the pod promoted as master, e.g. my-cluster-mysql-1. When empty
+	// the best candidate is selected by orchestrator.
+	// +optional
+	TargetPod string `json:"targetPod,omitempty"`
+}
+
+// SwitchoverPhase is the phase of a switchover
+type SwitchoverPhase string
+
+const (
+	// SwitchoverPending is the phase of the switchovers that wait for the cluster to be ready
+	SwitchoverPending SwitchoverPhase = "Pending"
+	// SwitchoverRunning is the phase of the switchovers that wait for the new master to be
+	// writable
+	SwitchoverRunning SwitchoverPhase = "Running"
+	// SwitchoverSucceeded is the phase of the switchovers whose new master is writable
+	SwitchoverSucceeded SwitchoverPhase = "Succeeded"
+	// SwitchoverFailed is the phase of the switchovers that were rejected or timed out
+	SwitchoverFailed SwitchoverPhase = "Failed"
+)
+
+// SwitchoverStatus is the status of the last switchover requested for the cluster
+type SwitchoverStatus struct {
+	// ID is the ID of the switchover request
+	ID string `json:"id"`
+	// Phase is the phase of the switchover
+	Phase SwitchoverPhase `json:"phase,omitempty"`
+	// Message describes the phase of the switchover
+	// +optional
+	Message string `json:"message,omitempty"`
+	// FromMaster is the hostname of the master before the switchover
+	// +optional
+	FromMaster string `json:"fromMaster,omitempty"`
+	// ToMaster is the hostname of the node promoted as master
+	// +optional
+	ToMaster string `json:"toMaster,omitempty"`
+	// StartTime is the time when the master takeover started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time when the switchover succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// BackupCandidatePolicy defines how the node from which the backups are taken is selected
+type BackupCandidatePolicy string
+
+const (
+	// FirstHealthyReplicaPolicy selects the first healthy replica, in the order of the nodes
+	// from the cluster status
+	FirstHealthyReplicaPolicy BackupCandidatePolicy = "FirstHealthyReplica"
+	// LeastLaggedReplicaPolicy selects the healthy replica with the smallest replication lag
+	LeastLaggedReplicaPolicy BackupCandidatePolicy = "LeastLaggedReplica"
+	// DedicatedReplicaPolicy takes the backups only from the preferred replicas, which are
+	// removed from the replicas service such that they don't serve reads
+	DedicatedReplicaPolicy BackupCandidatePolicy = "DedicatedReplica"
+)
+
+// BackupCandidate defines the selection of the node from which the backups are taken
+type BackupCandidate struct {
+	// Policy is the policy for selecting a healthy replica. Defaults to FirstHealthyReplica.
+	// +kubebuilder:validation:Enum=FirstHealthyReplica;LeastLaggedReplica;DedicatedReplica
+	// +optional
+	Policy BackupCandidatePolicy `json:"policy,omitempty"`
+
+	// PreferredPod is the name of the pod, e.g. my-cluster-mysql-2, from which the backups are
+	// taken while it's a healthy replica.
+	// +optional
+	PreferredPod string `json:"preferredPod,omitempty"`
+
+	// PreferredPodSelector selects by labels the pods from which the backups are taken while
+	// they are healthy replicas.
+	// +optional
+	PreferredPodSelector map[string]string `json:"preferredPodSelector,omitempty"`
+
+	// NeverMaster fails the backups when there is no replica to take them from, instead of
+	// taking them from the master. It's implied by the DedicatedReplica policy.
+	// +optional
+	NeverMaster bool `json:"neverMaster,omitempty"`
+}
+
 // MysqlConf defines type for extra cluster configs. It's a simple map between
 // string and string.
 type MysqlConf map[string]intstr.IntOrString
@@ -294,6 +648,85 @@ type QueryLimits struct {
 	IgnoreUser []string `json:"ignoreUser,omitempty"`
 }
 
+// BackupRetention defines a grandfather-father-son retention policy for scheduled backups. The
+// latest successful backup of a period satisfies the tier of that period and is labeled with it.
+// The backups that satisfy no tier and are not within KeepWithin are deleted.
+type BackupRetention struct {
+	// Hourly is the number of most recent hours for which to keep the latest backup.
+	// +optional
+	Hourly int32 `json:"hourly,omitempty"`
+
+	// Daily is the number of most recent days for which to keep the latest backup.
+	// +optional
+	Daily int32 `json:"daily,omitempty"`
+
+	// Weekly is the number of most recent weeks for which to keep the latest backup.
+	// +optional
+	Weekly int32 `json:"weekly,omitempty"`
+
+	// Monthly is the number of most recent months for which to keep the latest backup.
+	// +optional
+	Monthly int32 `json:"monthly,omitempty"`
+
+	// KeepWithin keeps all the backups newer than this duration, e.g. `72h`, regardless of
+	// their number.
+	// +optional
+	KeepWithin *metav1.Duration `json:"keepWithin,omitempty"`
+}
+
+// BackupSchedule defines a recurrent backup of the cluster.
+type BackupSchedule struct {
+	// Name identifies the schedule. It's used in the names of the backups and set as the
+	// `schedule` label on them.
+	// +kubebuilder:validation:Pattern=^[a-z0-9]([-a-z0-9]*[a-z0-9])?$
+	// +kubebuilder:validation:MaxLength=20
+	Name string `json:"name"`
+
+	// Schedule is the interval, in crontab format, to take backups at.
+	Schedule string `json:"schedule"`
+
+	// BackupURL is the location where to put the backups. Defaults to the cluster BackupURL.
+	// +optional
+	BackupURL string `json:"backupURL,omitempty"`
+
+	// BackupSecretName is the name of the secret that contains the credentials to connect to the
+	// storage provider. Defaults to the cluster BackupSecretName.
+	// +optional
+	BackupSecretName string `json:"backupSecretName,omitempty"`
+
+	// JobsHistoryLimit is the number of backups of this schedule to keep.
+	// +optional
+	JobsHistoryLimit *int `json:"jobsHistoryLimit,omitempty"`
+
+	// Retention defines which of the backups of this schedule are kept. When set,
+	// JobsHistoryLimit is ignored.
+	// +optional
+	Retention *BackupRetention `json:"retention,omitempty"`
+
+	// RemoteDeletePolicy specifies how to treat the data from remote storage when the backups
+	// are deleted. Defaults to softDelete.
+	// +optional
+	RemoteDeletePolicy DeletePolicy `json:"remoteDeletePolicy,omitempty"`
+}
+
+// RestorePoint defines the location of the archived binary logs and where to stop
+// replaying them.
+type RestorePoint struct {
+	// BinlogsURL is the location of the archived binary logs of the source cluster,
+	// usually `<BackupURL>/binlogs/<cluster name>`.
+	BinlogsURL string `json:"binlogsURL"`
+
+	// StopDatetime stops the replay at the first event having a timestamp equal or
+	// later than it (--stop-datetime flag). Format: `YYYY-MM-DD hh:mm:ss`.
+	// +optional
+	StopDatetime string `json:"stopDatetime,omitempty"`
+
+	// StopGTIDSet limits the replay to the transactions from this GTID set
+	// (--include-gtids flag), e.g. `3E11FA47-71CA-11E1-9E33-C80AA9429562:1-500`.
+	// +optional
+	StopGTIDSet string `json:"stopGTIDSet,omitempty"`
+}
+
 // ClusterCondition defines type for cluster conditions.
 type ClusterCondition struct {
 	// type of cluster condition, values in (\"Ready\")
@@ -328,12 +761,23 @@ const (
 	// ClusterConditionFailoverInProgress indicates if there is a current failover in progress
 	// done by the Orchestrator
 	ClusterConditionFailoverInProgress ClusterConditionType = "FailoverInProgress"
+
+	// ClusterConditionSwitchoverInProgress indicates if there is a switchover, requested in
+	// .spec.switchover, in progress
+	ClusterConditionSwitchoverInProgress ClusterConditionType = "SwitchoverInProgress"
+
+	// ClusterConditionStandby indicates if the cluster is a standby that replicates from the
+	// replication source
+	ClusterConditionStandby ClusterConditionType = "Standby"
 )
 
 // NodeStatus defines type for status of a node into cluster.
 type NodeStatus struct {
 	Name       string          `json:"name"`
 	Conditions []NodeCondition `json:"conditions,omitempty"`
+	// ReplicationLagSeconds is the replication lag of a replica, as seen by orchestrator
+	// +optional
+	ReplicationLagSeconds *int64 `json:"replicationLagSeconds,omitempty"`
 }
 
 // NodeCondition defines type for representing node conditions.
@@ -356,6 +800,9 @@ const (
 	NodeConditionMaster NodeConditionType = "Master"
 	// NodeConditionReadOnly repesents if the node is read only or not
 	NodeConditionReadOnly NodeConditionType = "ReadOnly"
+	// NodeConditionSemiSync represents if the semi-synchronous replication is active on the
+	// node: the master waits for the replicas or the replica acknowledges the transactions.
+	NodeConditionSemiSync NodeConditionType = "SemiSync"
 )
 
 // MysqlClusterStatus defines the observed state of MysqlCluster
@@ -366,6 +813,22 @@ type MysqlClusterStatus struct {
 	Conditions []ClusterCondition `json:"conditions,omitempty"`
 	// Nodes contains informations from orchestrator
 	Nodes []NodeStatus `json:"nodes,omitempty"`
+	// Switchover is the status of the last switchover requested in .spec.switchover
+	// +optional
+	Switchover *SwitchoverStatus `json:"switchover,omitempty"`
+	// BackupTrashes are the trashes, other than the ones of the cluster's backup destinations,
+	// where backups of the cluster were soft deleted. They are purged along with the others.
+	// +optional
+	BackupTrashes []BackupTrashLocation `json:"backupTrashes,omitempty"`
+}
+
+// BackupTrashLocation is a location where soft deleted backups are moved
+type BackupTrashLocation struct {
+	// URL is the location of the trash
+	URL string `json:"url"`
+	// SecretName is the name of the secret with the credentials to access the trash
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
 }
 
 // MysqlCluster is the Schema for the mysqlclusters API
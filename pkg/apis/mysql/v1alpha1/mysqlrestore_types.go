@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MysqlRestoreConditionType defines the condition types of a MysqlRestore resource
+type MysqlRestoreConditionType string
+
+const (
+	// MysqlRestoreScaledDown means that all the cluster nodes were stopped.
+	MysqlRestoreScaledDown MysqlRestoreConditionType = "ScaledDown"
+	// MysqlRestoreVolumesDeleted means that the data volumes of the cluster were removed.
+	MysqlRestoreVolumesDeleted MysqlRestoreConditionType = "VolumesDeleted"
+	// MysqlRestoreMasterRestored means that the first node was cloned from the backup and is ready.
+	MysqlRestoreMasterRestored MysqlRestoreConditionType = "MasterRestored"
+	// MysqlRestoreComplete means that the cluster was restored and all the replicas are ready.
+	MysqlRestoreComplete MysqlRestoreConditionType = "Complete"
+	// MysqlRestoreFailed means that the restore can not be performed.
+	MysqlRestoreFailed MysqlRestoreConditionType = "Failed"
+)
+
+// MysqlRestoreCondition defines the condition struct for a MysqlRestore resource
+type MysqlRestoreCondition struct {
+	// Type of MysqlRestore condition.
+	Type MysqlRestoreConditionType `json:"type"`
+	// Status of the condition, one of True, False, Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+	// The last time this condition was updated.
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+	// Last time the condition transitioned from one status to another.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	// The reason for the condition's last transition.
+	Reason string `json:"reason"`
+	// A human readable message indicating details about the transition.
+	Message string `json:"message"`
+}
+
+// MysqlRestoreSpec defines the desired state of MysqlRestore
+type MysqlRestoreSpec struct {
+	// ClusterName is the name of the MysqlCluster, from the same namespace, that is restored.
+	// All the existing data of the cluster is lost, unless a database is restored from a
+	// logical backup.
+	ClusterName string `json:"clusterName"`
+
+	// BackupName is the name of a completed MysqlBackup from which to restore. When the backup is
+	// incremental the whole chain of base backups is restored. Either BackupName or BackupURL
+	// should be specified.
+	// +optional
+	BackupName string `json:"backupName,omitempty"`
+
+	// BackupURL is the location of a full backup from which to restore, used when BackupName is
+	// not specified.
+	// +optional
+	BackupURL string `json:"backupURL,omitempty"`
+
+	// BackupSecretName is the name of the secret that contains the credentials to access the
+	// bucket. Defaults to the secret of the backup.
+	// +optional
+	BackupSecretName string `json:"backupSecretName,omitempty"`
+
+	// RestorePoint is used to restore the cluster to a point in time by replaying archived
+	// binary logs on top of the backup.
+	// +optional
+	RestorePoint *RestorePoint `json:"restorePoint,omitempty"`
+
+	// Database is the database loaded from a logical backup. It's loaded on the master of the
+	// running cluster, replacing the tables from the backup, the other databases are not touched.
+	// It can be omitted when the backup contains a single database.
+	// +optional
+	Database string `json:"database,omitempty"`
+}
+
+// MysqlRestoreStatus defines the observed state of MysqlRestore
+type MysqlRestoreStatus struct {
+	// Conditions represents the MysqlRestore resource conditions list.
+	Conditions []MysqlRestoreCondition `json:"conditions,omitempty"`
+
+	// OriginalReplicas is the number of replicas the cluster had before the restore began, the
+	// cluster is scaled back to it after the first node is restored.
+	// +optional
+	OriginalReplicas *int32 `json:"originalReplicas,omitempty"`
+
+	// OriginalInitSource is the initialization source the cluster had before the restore began,
+	// it's set back on the cluster after the first node is restored.
+	// +optional
+	OriginalInitSource *MysqlRestoreInitSource `json:"originalInitSource,omitempty"`
+}
+
+// MysqlRestoreInitSource holds the fields of a MysqlCluster spec from which its nodes are
+// initialized
+type MysqlRestoreInitSource struct {
+	// +optional
+	InitBucketURL string `json:"initBucketURL,omitempty"`
+	// +optional
+	InitBucketURI string `json:"initBucketURI,omitempty"`
+	// +optional
+	InitBucketSecretName string `json:"initBucketSecretName,omitempty"`
+	// +optional
+	InitBucketIncrementalURLs []string `json:"initBucketIncrementalURLs,omitempty"`
+	// +optional
+	InitBucketChecksums map[string]string `json:"initBucketChecksums,omitempty"`
+	// +optional
+	InitRestorePoint *RestorePoint `json:"initRestorePoint,omitempty"`
+	// +optional
+	InitVolumeSnapshotName string `json:"initVolumeSnapshotName,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName"
+// +kubebuilder:printcolumn:name="Backup",type="string",JSONPath=".spec.backupName"
+// +kubebuilder:printcolumn:name="Complete",type="string",JSONPath=".status.conditions[?(@.type == 'Complete')].status",description="The restore status"
+// +kubebuilder:printcolumn:name="Failed",type="string",JSONPath=".status.conditions[?(@.type == 'Failed')].status",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// MysqlRestore is the Schema for the MySQL restore API. It replaces the data of a
+// MysqlCluster with the data from a backup.
+type MysqlRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              MysqlRestoreSpec   `json:"spec,omitempty"`
+	Status            MysqlRestoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MysqlRestoreList contains a list of MysqlRestore
+type MysqlRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MysqlRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MysqlRestore{}, &MysqlRestoreList{})
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+)
+
+// the reasons for which a node is selected as the source of a backup
+const (
+	healthyReplicaReason     = "HealthyReplica"
+	leastLaggedReplicaReason = "LeastLaggedReplica"
+	preferredReplicaReason   = "PreferredReplica"
+	dedicatedReplicaReason   = "DedicatedReplica"
+	masterFallbackReason     = "MasterFallback"
+	// baseBackupSourceReason is the reason of the incremental backups, which are taken from the
+	// node of their base backup
+	baseBackupSourceReason = "BaseBackupSource"
+
+	// noBackupCandidateReason is the reason of the failed condition of the backups that have
+	// no node to be taken from
+	noBackupCandidateReason = "NoBackupCandidate"
+
+	// incrementalSourceUnhealthyReason is the reason of the pending condition of the incremental
+	// backups whose base backup node is not healthy
+	incrementalSourceUnhealthyReason = "BaseBackupSourceUnhealthy"
+)
+
+// errNoBackupCandidate is returned when the backup candidate policy of the cluster doesn't
+// allow any of its nodes to be selected
+var errNoBackupCandidate = errors.New("no backup candidate")
+
+// getBackupCandidate returns the hostname of the node from which the backup is taken, according
+// to the backup candidate policy of the cluster, and the reason for which it was selected
+func getBackupCandidate(ctx context.Context, c client.Client, cluster *mysqlcluster.MysqlCluster,
+	backup *mysqlbackup.MysqlBackup) (string, string, error) {
+	preferred, err := getPreferredBackupPods(ctx, c, cluster)
+	if err != nil {
+		return "", "", err
+	}
+
+	node, reason, err := selectBackupCandidate(cluster, preferred)
+	if err != nil {
+		return "", "", err
+	}
+
+	log.V(1).Info("selected backup candidate", "node", node, "reason", reason, "backup", backup)
+	return node, reason, nil
+}
+
+// getPreferredBackupPods returns the names of the pods of the cluster that are preferred for
+// taking backups
+func getPreferredBackupPods(ctx context.Context, c client.Client, cluster *mysqlcluster.MysqlCluster) (map[string]bool, error) {
+	preferred := map[string]bool{}
+
+	candidate := cluster.Spec.BackupCandidate
+	if candidate == nil {
+		return preferred, nil
+	}
+
+	if len(candidate.PreferredPod) > 0 {
+		preferred[candidate.PreferredPod] = true
+	}
+
+	if len(candidate.PreferredPodSelector) == 0 {
+		return preferred, nil
+	}
+
+	pods := &core.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(cluster.Namespace),
+		client.MatchingLabels(cluster.GetSelectorLabels())); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %s", err)
+	}
+
+	for _, pod := range pods.Items {
+		if cluster.IsPreferredBackupPod(pod.Name, pod.Labels) {
+			preferred[pod.Name] = true
+		}
+	}
+
+	return preferred, nil
+}
+
+// selectBackupCandidate selects, by the policy of the cluster, one of its healthy replicas,
+// preferring the given pods. It falls back to the master, unless the policy forbids it.
+func selectBackupCandidate(cluster *mysqlcluster.MysqlCluster, preferred map[string]bool) (string, string, error) {
+	policy := cluster.GetBackupCandidatePolicy()
+
+	replicas := []api.NodeStatus{}
+	preferredReplicas := []api.NodeStatus{}
+	for _, node := range cluster.Status.Nodes {
+		if !isHealthyReplica(cluster, node.Name) {
+			continue
+		}
+
+		replicas = append(replicas, node)
+		if preferred[mysqlcluster.GetPodNameForHost(node.Name)] {
+			preferredReplicas = append(preferredReplicas, node)
+		}
+	}
+
+	if len(preferredReplicas) > 0 {
+		reason := preferredReplicaReason
+		if policy == api.DedicatedReplicaPolicy {
+			reason = dedicatedReplicaReason
+		}
+		return pickReplica(policy, preferredReplicas), reason, nil
+	}
+
+	if policy == api.DedicatedReplicaPolicy {
+		if len(preferred) == 0 {
+			if candidate := cluster.Spec.BackupCandidate; candidate != nil && len(candidate.PreferredPodSelector) > 0 {
+				return "", "", fmt.Errorf("%w: no pod matches the selector %s", errNoBackupCandidate,
+					labels.SelectorFromSet(candidate.PreferredPodSelector))
+			}
+			return "", "", fmt.Errorf("%w: the %s policy requires a preferred pod or pod selector",
+				errNoBackupCandidate, policy)
+		}
+		return "", "", fmt.Errorf("%w: no dedicated backup replica is healthy", errNoBackupCandidate)
+	}
+
+	if len(replicas) > 0 {
+		reason := healthyReplicaReason
+		if policy == api.LeastLaggedReplicaPolicy {
+			reason = leastLaggedReplicaReason
+		}
+		return pickReplica(policy, replicas), reason, nil
+	}
+
+	if cluster.Spec.BackupCandidate != nil && cluster.Spec.BackupCandidate.NeverMaster {
+		return "", "", fmt.Errorf("%w: no healthy replica and backups from the master are not allowed",
+			errNoBackupCandidate)
+	}
+
+	log.Info("no healthy slave node found so returns the master node", "master_node", cluster.GetMasterHost(),
+		"key", cluster)
+	return cluster.GetMasterHost(), masterFallbackReason, nil
+}
+
+// isHealthyNode returns true if the node is the master or a healthy replica
+func isHealthyNode(cluster *mysqlcluster.MysqlCluster, node string) bool {
+	master := cluster.GetNodeCondition(node, api.NodeConditionMaster)
+	if master != nil && master.Status == core.ConditionTrue {
+		return true
+	}
+	return isHealthyReplica(cluster, node)
+}
+
+// isHealthyReplica returns true if the node is not the master, is replicating and is not lagged
+func isHealthyReplica(cluster *mysqlcluster.MysqlCluster, node string) bool {
+	master := cluster.GetNodeCondition(node, api.NodeConditionMaster)
+	replicating := cluster.GetNodeCondition(node, api.NodeConditionReplicating)
+	lagged := cluster.GetNodeCondition(node, api.NodeConditionLagged)
+
+	if master == nil || replicating == nil || lagged == nil {
+		return false
+	}
+
+	return master.Status != core.ConditionTrue &&
+		replicating.Status == core.ConditionTrue &&
+		lagged.Status != core.ConditionTrue
+}
+
+// pickReplica returns the hostname of the replica selected by the policy, either the first one
+// or the least lagged one. Replicas with an unknown lag come last.
+func pickReplica(policy api.BackupCandidatePolicy, replicas []api.NodeStatus) string {
+	if policy != api.LeastLaggedReplicaPolicy {
+		return replicas[0].Name
+	}
+
+	sorted := append([]api.NodeStatus{}, replicas...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		lagI, lagJ := sorted[i].ReplicationLagSeconds, sorted[j].ReplicationLagSeconds
+		if lagI == nil || lagJ == nil {
+			return lagI != nil
+		}
+		return *lagI < *lagJ
+	})
+	return sorted[0].Name
+}
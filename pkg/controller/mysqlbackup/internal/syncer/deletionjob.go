@@ -17,8 +17,10 @@ limitations under the License.
 package syncer
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/imdario/mergo"
 	"github.com/presslabs/controller-util/mergo/transformers"
@@ -35,11 +37,10 @@ import (
 	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
 	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
 	"github.com/bitpoke/mysql-operator/pkg/options"
-	"github.com/bitpoke/mysql-operator/pkg/util/constants"
 )
 
 const (
-	// RemoteStorageFinalizer is the finalizer name used when hardDelete policy is used
+	// RemoteStorageFinalizer is the finalizer name used when delete or softDelete policy is used
 	RemoteStorageFinalizer = "backups.mysql.presslabs.org/remote-storage-cleanup"
 
 	// RemoteDeletionFailedEvent is the event that is set on the cluster when the cleanup job fails
@@ -47,6 +48,7 @@ const (
 )
 
 type deletionJobSyncer struct {
+	c        client.Client
 	backup   *mysqlbackup.MysqlBackup
 	cluster  *mysqlcluster.MysqlCluster
 	opt      *options.Options
@@ -67,6 +69,7 @@ func NewDeleteJobSyncer(c client.Client, s *runtime.Scheme, backup *mysqlbackup.
 	}
 
 	jobSyncer := deletionJobSyncer{
+		c:        c,
 		cluster:  cluster,
 		backup:   backup,
 		opt:      opt,
@@ -81,12 +84,13 @@ func NewDeleteJobSyncer(c client.Client, s *runtime.Scheme, backup *mysqlbackup.
 
 // nolint: gocyclo
 func (s *deletionJobSyncer) SyncFn(job *batch.Job) error {
-	if s.backup.Spec.RemoteDeletePolicy == api.Retain {
+	// the volume snapshots are owned by the backup, unless they are retained
+	if s.backup.Spec.RemoteDeletePolicy == api.Retain || s.backup.IsVolumeSnapshot() {
 		// do nothing
 		return syncer.ErrIgnore
 	}
 
-	// it's hard delete policy then set finalizer on backup
+	// it's delete or soft delete policy then set finalizer on backup
 	addFinalizer(s.backup.Unwrap(), RemoteStorageFinalizer)
 
 	if s.backup.DeletionTimestamp == nil {
@@ -106,6 +110,10 @@ func (s *deletionJobSyncer) SyncFn(job *batch.Job) error {
 
 	// check if the job is created and if not create it
 	if job.ObjectMeta.CreationTimestamp.IsZero() {
+		if err := s.registerTrash(); err != nil {
+			return err
+		}
+
 		job.Labels = map[string]string{
 			"backup":      s.backup.Name,
 			"cleanup-job": "true",
@@ -138,6 +146,36 @@ func (s *deletionJobSyncer) SyncFn(job *batch.Job) error {
 	return nil
 }
 
+// registerTrash records in the cluster status the trash where the backup is moved, when it's not
+// one of the cluster's trashes, such that it's purged as well
+func (s *deletionJobSyncer) registerTrash() error {
+	if s.backup.Spec.RemoteDeletePolicy != api.SoftDelete || s.cluster == nil {
+		return nil
+	}
+
+	trashURL := s.backup.GetTrashLocation(s.cluster.GetBackupTrashPrefix())
+	if s.cluster.HasBackupTrash(trashURL) {
+		return nil
+	}
+
+	secretName := s.backup.Spec.BackupSecretName
+	if len(secretName) == 0 {
+		secretName = s.cluster.Spec.BackupSecretName
+	}
+
+	cluster := s.cluster.Unwrap()
+	patch := client.MergeFromWithOptions(cluster.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	cluster.Status.BackupTrashes = append(cluster.Status.BackupTrashes, api.BackupTrashLocation{
+		URL:        trashURL,
+		SecretName: secretName,
+	})
+
+	if err := s.c.Status().Patch(context.TODO(), cluster, patch); err != nil {
+		return fmt.Errorf("failed to register the backup trash %s: %s", trashURL, err)
+	}
+	return nil
+}
+
 func (s *deletionJobSyncer) ensurePodSpec() core.PodSpec {
 	// get the service account, the same as the one used by the cluster if the cluster exists otherwise use
 	// the default one. This may cause some issues when using workload identity in case when the cluster is removed
@@ -159,14 +197,17 @@ func (s *deletionJobSyncer) ensurePodSpec() core.PodSpec {
 }
 
 func (s *deletionJobSyncer) ensureContainers() []core.Container {
-	rcloneCommand := []string{"rclone", fmt.Sprintf("--config=%s", constants.RcloneConfigFile)}
+	args := []string{"delete-backup", s.backup.Spec.BackupURL}
 
-	if s.cluster != nil && len(s.cluster.Spec.RcloneExtraArgs) > 0 {
-		rcloneCommand = append(rcloneCommand, s.cluster.Spec.RcloneExtraArgs...)
+	if s.backup.Spec.RemoteDeletePolicy == api.SoftDelete {
+		// the backup is moved to the trash from where it's purged later by the cluster's trash purge job
+		trashPrefix := mysqlcluster.DefaultBackupTrashPrefix
+		if s.cluster != nil {
+			trashPrefix = s.cluster.GetBackupTrashPrefix()
+		}
+		args = append(args, s.backup.GetTrashURL(trashPrefix, time.Now()))
 	}
 
-	rcloneCommand = append(rcloneCommand, "delete", bucketForRclone(s.backup.Spec.BackupURL))
-
 	image := s.opt.SidecarMysql57Image
 	if s.cluster != nil {
 		image = s.cluster.GetSidecarImage()
@@ -176,7 +217,17 @@ func (s *deletionJobSyncer) ensureContainers() []core.Container {
 		Name:            "delete",
 		Image:           image,
 		ImagePullPolicy: s.opt.ImagePullPolicy,
-		Args:            rcloneCommand,
+		Args:            args,
+	}
+
+	if s.cluster != nil {
+		if len(s.cluster.Spec.RcloneExtraArgs) > 0 {
+			container.Env = append(container.Env, core.EnvVar{
+				Name:  "RCLONE_EXTRA_ARGS",
+				Value: strings.Join(s.cluster.Spec.RcloneExtraArgs, " "),
+			})
+		}
+		container.Env = append(container.Env, s.cluster.GetBackupStorageEnv()...)
 	}
 
 	// if backups secret name is specified use it otherwise don't set anything
@@ -200,10 +251,6 @@ func (s *deletionJobSyncer) recordWEventOnCluster(reason, msg string) {
 	}
 }
 
-func bucketForRclone(name string) string {
-	return strings.Replace(name, "://", ":", 1)
-}
-
 func getJobStatus(job *batch.Job) (bool, bool) {
 	completed := false
 	if completCond := jobCondition(batch.JobComplete, job); completCond != nil {
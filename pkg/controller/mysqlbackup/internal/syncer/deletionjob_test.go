@@ -17,6 +17,7 @@ limitations under the License.
 package syncer
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"time"
@@ -29,6 +30,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
 	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
@@ -97,6 +100,53 @@ var _ = Describe("MysqlBackup remove job syncer", func() {
 		Expect(backup.Finalizers).ToNot(ContainElement(RemoteStorageFinalizer))
 	})
 
+	It("should move the backup to the trash when soft deleted", func() {
+		backup.Spec.BackupURL = "gs://bucket/backups/backup.xbackup.gz"
+		backup.Spec.RemoteDeletePolicy = api.SoftDelete
+		cluster.Spec.BackupTrashPrefix = "deleted/"
+
+		containers := syncer.ensureContainers()
+		Expect(containers).To(HaveLen(1))
+
+		args := containers[0].Args
+		Expect(args).To(HaveLen(3))
+		Expect(args[:2]).To(Equal([]string{"delete-backup", "gs://bucket/backups/backup.xbackup.gz"}))
+		Expect(args[2]).To(MatchRegexp(`^gs://bucket/backups/deleted/\d{8}T\d{6}Z/backup.xbackup.gz$`))
+	})
+
+	It("should register the trash of the backup when the cluster doesn't purge it", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cluster.Unwrap()).Build()
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(cluster.Unwrap()), cluster.Unwrap())).To(Succeed())
+		syncer.c = c
+
+		cluster.Spec.BackupURL = "gs://bucket/backups/"
+		cluster.Spec.BackupSecretName = "backup-secret"
+		cluster.Spec.BackupRemoteDeletePolicy = api.Delete
+
+		backup.Spec.BackupURL = "gs://bucket/manual/backup.xbackup.gz"
+		backup.Spec.RemoteDeletePolicy = api.SoftDelete
+		deletionTime := metav1.NewTime(time.Now())
+		backup.DeletionTimestamp = &deletionTime
+
+		delJob := &batch.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: backup.Name + "-job", Namespace: backup.Namespace},
+		}
+		Expect(syncer.SyncFn(delJob)).To(Succeed())
+
+		trashes := []api.BackupTrashLocation{
+			{URL: "gs://bucket/manual/trash", SecretName: "backup-secret"},
+		}
+		Expect(cluster.Status.BackupTrashes).To(Equal(trashes))
+
+		stored := &api.MysqlCluster{}
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(cluster.Unwrap()), stored)).To(Succeed())
+		Expect(stored.Status.BackupTrashes).To(Equal(trashes))
+
+		// the trash is registered only once
+		Expect(syncer.registerTrash()).To(Succeed())
+		Expect(cluster.Status.BackupTrashes).To(HaveLen(1))
+	})
+
 	It("should create the job and update backup finalizer", func() {
 		delJob := &batch.Job{
 			ObjectMeta: metav1.ObjectMeta{Name: backup.Name + "-job", Namespace: backup.Namespace},
@@ -17,31 +17,64 @@ limitations under the License.
 package syncer
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/presslabs/controller-util/syncer"
 	batch "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
 	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
 	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqldatabase"
 	"github.com/bitpoke/mysql-operator/pkg/options"
+	"github.com/bitpoke/mysql-operator/pkg/util/constants"
 )
 
 var log = logf.Log.WithName("mysqlbackup.syncer.job")
 
+const (
+	backupContainerName = "backup"
+
+	// preBackupHook and postBackupHook prefix the names of the containers that execute the SQL
+	// statements of the backup hooks
+	preBackupHook  = "pre-backup"
+	postBackupHook = "post-backup"
+
+	encryptionKeysVolumeName = "encryption-keys"
+
+	// progressRequestTimeout is how long to wait for the source node to report the progress
+	progressRequestTimeout = 5 * time.Second
+)
+
 type jobSyncer struct {
 	job     *batch.Job
 	backup  *mysqlbackup.MysqlBackup
 	cluster *mysqlcluster.MysqlCluster
+	c       client.Client
 
 	opt *options.Options
+
+	// incrementalLSN is the LSN from which an incremental backup starts
+	incrementalLSN int64
+
+	// databases is the list of databases dumped by a logical backup
+	databases []string
+
+	// getProgress returns the progress of the backup streamed by the sidecar of a node
+	getProgress func(ctx context.Context, host, user, password string) (*mysqlbackup.Progress, error)
 }
 
 // NewJobSyncer returns a syncer for backup jobs
@@ -57,19 +90,31 @@ func NewJobSyncer(c client.Client, s *runtime.Scheme, backup *mysqlbackup.MysqlB
 		job:     obj,
 		backup:  backup,
 		cluster: cluster,
+		c:       c,
 		opt:     opt,
+
+		getProgress: mysqlbackup.GetProgress,
 	}
 
 	return syncer.NewObjectSyncer("Job", backup.Unwrap(), obj, c, sync.SyncFn)
 }
 
 func (s *jobSyncer) SyncFn() error {
+	// volume snapshot backups are taken without a job
+	if s.backup.IsVolumeSnapshot() {
+		return syncer.ErrIgnore
+	}
+
 	if s.backup.Status.Completed {
 		log.V(1).Info("backup already completed", "backup", s.backup, "key", s.cluster)
 		// skip doing anything
 		return syncer.ErrIgnore
 	}
 
+	if s.backup.Spec.Cancel {
+		return s.cancel()
+	}
+
 	if len(s.backup.GetBackupURL(s.cluster)) == 0 {
 		return fmt.Errorf("can't get backupURL")
 	}
@@ -80,39 +125,172 @@ func (s *jobSyncer) SyncFn() error {
 		return nil
 	}
 
+	var base *mysqlbackup.MysqlBackup
+	if s.backup.IsIncremental() {
+		var err error
+		if base, err = s.getBaseBackup(); err != nil {
+			return err
+		}
+		s.incrementalLSN = base.Status.ToLSN
+	}
+
+	if s.backup.IsLogical() {
+		databases, err := s.getDatabases()
+		if err != nil {
+			return err
+		}
+		s.databases = databases
+	}
+
 	s.job.Labels = map[string]string{
 		"cluster": s.backup.Spec.ClusterName,
 	}
 
+	node, reason, err := s.getBackupSource(base)
+	if err != nil {
+		return err
+	}
+	s.backup.Status.SourceNode = node
+	s.backup.Status.SourceNodeReason = reason
+
+	s.job.Spec.ActiveDeadlineSeconds = s.backup.Spec.ActiveDeadlineSeconds
+	s.job.Spec.BackoffLimit = s.backup.Spec.BackoffLimit
+
 	s.job.Spec.Template.Spec = s.ensurePodSpec(s.job.Spec.Template.Spec)
 	return nil
 }
 
-// getBackupCandidate returns the hostname of the first not-lagged and
-// replicating slave node, else returns the master node.
-func (s *jobSyncer) getBackupCandidate() string {
-	for _, node := range s.cluster.Status.Nodes {
-		master := s.cluster.GetNodeCondition(node.Name, api.NodeConditionMaster)
-		replicating := s.cluster.GetNodeCondition(node.Name, api.NodeConditionReplicating)
-		lagged := s.cluster.GetNodeCondition(node.Name, api.NodeConditionLagged)
-
-		if master == nil || replicating == nil || lagged == nil {
-			continue
+// cancel deletes the backup job, if it was created, and marks the backup as failed
+func (s *jobSyncer) cancel() error {
+	if !s.job.ObjectMeta.CreationTimestamp.IsZero() {
+		err := s.c.Delete(context.TODO(), s.job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete backup job: %s", err)
 		}
+	}
+
+	now := metav1.Now()
+	s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionTrue, "Cancelled", "the backup was cancelled")
+	s.backup.Status.Completed = true
+	s.backup.Status.FinishTime = &now
+
+	return syncer.ErrIgnore
+}
 
-		isMaster := master.Status == core.ConditionTrue
-		isReplicating := replicating.Status == core.ConditionTrue
-		isLagged := lagged.Status == core.ConditionTrue
+// getBaseBackup returns the base backup of an incremental backup. An error is returned
+// while the base backup is not completed.
+func (s *jobSyncer) getBaseBackup() (*mysqlbackup.MysqlBackup, error) {
+	if len(s.backup.Spec.BaseBackupName) == 0 {
+		s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionTrue, "BaseBackupMissing",
+			"incremental backups require .spec.baseBackupName")
+		s.backup.Status.Completed = true
+		return nil, syncer.ErrIgnore
+	}
+
+	base := &api.MysqlBackup{}
+	key := types.NamespacedName{Name: s.backup.Spec.BaseBackupName, Namespace: s.backup.Namespace}
+	if err := s.c.Get(context.TODO(), key, base); err != nil {
+		return nil, fmt.Errorf("failed to get base backup %s: %s", key, err)
+	}
+
+	baseBackup := mysqlbackup.New(base)
+	if cond := baseBackup.GetBackupCondition(api.BackupFailed); cond != nil && cond.Status == core.ConditionTrue {
+		s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionTrue, "BaseBackupFailed",
+			fmt.Sprintf("base backup %s failed", key))
+		s.backup.Status.Completed = true
+		return nil, syncer.ErrIgnore
+	}
+
+	if baseBackup.IsVolumeSnapshot() || baseBackup.IsLogical() {
+		s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionTrue, "BaseBackupNotSupported",
+			fmt.Sprintf("base backup %s is not an xtrabackup backup", key))
+		s.backup.Status.Completed = true
+		return nil, syncer.ErrIgnore
+	}
+
+	if !base.Status.Completed || base.Status.ToLSN == 0 {
+		return nil, fmt.Errorf("base backup %s is not completed yet", key)
+	}
 
-		// select a node that is not master is replicating and is not lagged
-		if !isMaster && isReplicating && !isLagged {
-			return node.Name
+	return baseBackup, nil
+}
+
+// getDatabases returns the databases dumped by a logical backup, the ones from the backup spec
+// or else the databases of the MysqlDatabase resources of the cluster
+func (s *jobSyncer) getDatabases() ([]string, error) {
+	if len(s.backup.Spec.Databases) > 0 {
+		return s.backup.Spec.Databases, nil
+	}
+
+	// the MysqlDatabases can reference the cluster from any namespace
+	dbs := &api.MysqlDatabaseList{}
+	if err := s.c.List(context.TODO(), dbs); err != nil {
+		return nil, fmt.Errorf("failed to list databases: %s", err)
+	}
+
+	databases := []string{}
+	for i := range dbs.Items {
+		db := mysqldatabase.Wrap(&dbs.Items[i])
+		if db.GetClusterKey() == s.cluster.GetNamespacedName() && db.DeletionTimestamp == nil {
+			databases = append(databases, db.Spec.Database)
 		}
 	}
 
-	log.Info("no healthy slave node found so returns the master node", "master_node", s.cluster.GetMasterHost(),
-		"key", s.cluster, "backup", s.backup)
-	return s.cluster.GetMasterHost()
+	if len(databases) == 0 {
+		s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionTrue, "NoDatabases",
+			"logical backups require .spec.databases or MysqlDatabases of the cluster")
+		s.backup.Status.Completed = true
+		return nil, syncer.ErrIgnore
+	}
+
+	sort.Strings(databases)
+	return databases, nil
+}
+
+// getBackupSource returns the node from which the backup is taken and the reason for which it
+// was selected. The incremental backups are taken from the node of their base backup.
+func (s *jobSyncer) getBackupSource(base *mysqlbackup.MysqlBackup) (string, string, error) {
+	if base == nil {
+		return s.getBackupCandidate()
+	}
+
+	node := base.Status.SourceNode
+	if len(node) == 0 {
+		now := metav1.Now()
+		s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionTrue, "BaseBackupSourceUnknown",
+			fmt.Sprintf("the node from which base backup %s was taken is not known", base.Name))
+		s.backup.Status.Completed = true
+		s.backup.Status.FinishTime = &now
+		return "", "", syncer.ErrIgnore
+	}
+
+	// the backup is retried, by the periodic requeue of the running backups, until the node is healthy
+	if !isHealthyNode(s.cluster, node) {
+		s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionFalse, incrementalSourceUnhealthyReason,
+			fmt.Sprintf("waiting for node %s, from which base backup %s was taken, to be healthy", node, base.Name))
+		return "", "", syncer.ErrIgnore
+	}
+
+	if cond := s.backup.GetBackupCondition(api.BackupFailed); cond != nil && cond.Reason == incrementalSourceUnhealthyReason {
+		s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionFalse, baseBackupSourceReason,
+			fmt.Sprintf("node %s is healthy", node))
+	}
+
+	return node, baseBackupSourceReason, nil
+}
+
+// getBackupCandidate selects the node from which the backup is taken. Backups that have no
+// node to be taken from are marked as failed.
+func (s *jobSyncer) getBackupCandidate() (string, string, error) {
+	node, reason, err := getBackupCandidate(context.TODO(), s.c, s.cluster, s.backup)
+	if errors.Is(err, errNoBackupCandidate) {
+		now := metav1.Now()
+		s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionTrue, noBackupCandidateReason, err.Error())
+		s.backup.Status.Completed = true
+		s.backup.Status.FinishTime = &now
+		return "", "", syncer.ErrIgnore
+	}
+	return node, reason, err
 }
 
 // nolint: gocyclo
@@ -126,14 +304,21 @@ func (s *jobSyncer) ensurePodSpec(in core.PodSpec) core.PodSpec {
 		{Name: s.opt.ImagePullSecretName},
 	}
 
-	in.Containers[0].Name = "backup"
+	in.Containers[0].Name = backupContainerName
 	in.Containers[0].Image = s.cluster.GetSidecarImage()
 	in.Containers[0].ImagePullPolicy = s.opt.ImagePullPolicy
 	in.Containers[0].Args = []string{
 		"take-backup-to",
-		s.getBackupCandidate(),
+		s.backup.Status.SourceNode,
 		s.backup.GetBackupURL(s.cluster),
 	}
+	if s.backup.IsLogical() {
+		in.Containers[0].Args = append([]string{
+			"take-logical-backup-to",
+			s.backup.Status.SourceNode,
+			s.backup.GetBackupURL(s.cluster),
+		}, s.databases...)
+	}
 
 	in.ImagePullSecrets = s.cluster.Spec.PodSpec.ImagePullSecrets
 	in.ServiceAccountName = s.cluster.Spec.PodSpec.ServiceAccountName
@@ -186,6 +371,14 @@ func (s *jobSyncer) ensurePodSpec(in core.PodSpec) core.PodSpec {
 		},
 	}
 
+	// the databases are dumped through a regular MySQL connection
+	if s.backup.IsLogical() {
+		in.Containers[0].Env = append(in.Containers[0].Env,
+			secretKeyEnv("OPERATOR_USER", s.cluster.GetNameForResource(mysqlcluster.Secret)),
+			secretKeyEnv("OPERATOR_PASSWORD", s.cluster.GetNameForResource(mysqlcluster.Secret)),
+		)
+	}
+
 	hasBackupCompressCommand := len(s.cluster.Spec.BackupCompressCommand) > 0
 	hasBackupDecompressCommand := len(s.cluster.Spec.BackupDecompressCommand) > 0
 	if hasBackupCompressCommand && hasBackupDecompressCommand {
@@ -197,12 +390,20 @@ func (s *jobSyncer) ensurePodSpec(in core.PodSpec) core.PodSpec {
 		log.Info("backupDecompressCommand is not defined, falling back to gzip")
 	}
 
+	if s.incrementalLSN > 0 {
+		in.Containers[0].Env = append(in.Containers[0].Env, core.EnvVar{
+			Name:  "BACKUP_INCREMENTAL_LSN",
+			Value: strconv.FormatInt(s.incrementalLSN, 10),
+		})
+	}
+
 	if len(s.cluster.Spec.RcloneExtraArgs) > 0 {
 		in.Containers[0].Env = append(in.Containers[0].Env, core.EnvVar{
 			Name:  "RCLONE_EXTRA_ARGS",
 			Value: strings.Join(s.cluster.Spec.RcloneExtraArgs, " "),
 		})
 	}
+	in.Containers[0].Env = append(in.Containers[0].Env, s.cluster.GetBackupStorageEnv()...)
 
 	if len(s.backup.Spec.BackupSecretName) != 0 {
 		in.Containers[0].EnvFrom = []core.EnvFromSource{
@@ -215,25 +416,284 @@ func (s *jobSyncer) ensurePodSpec(in core.PodSpec) core.PodSpec {
 			},
 		}
 	}
+
+	in.Volumes = nil
+	in.Containers[0].VolumeMounts = nil
+	if enc := s.backup.Spec.Encryption; enc != nil {
+		in.Containers[0].Env = append(in.Containers[0].Env, core.EnvVar{
+			Name:  "BACKUP_ENCRYPTION_KEY_ID",
+			Value: enc.KeyID,
+		})
+
+		// only the key used for encryption is needed to take the backup
+		volume := encryptionKeysVolume(enc)
+		volume.Secret.Items = []core.KeyToPath{
+			{Key: enc.KeyID, Path: enc.KeyID},
+		}
+		in.Volumes = append(in.Volumes, volume)
+		in.Containers[0].VolumeMounts = append(in.Containers[0].VolumeMounts, encryptionKeysVolumeMount())
+	}
+
+	return s.ensureHooks(in)
+}
+
+// ensureHooks adds the containers of the pre backup hooks to the pod, as init containers that
+// run before the backup. The post backup hooks are run by a separate job, once the backup is
+// completed, such that their failure doesn't retry the backup.
+func (s *jobSyncer) ensureHooks(in core.PodSpec) core.PodSpec {
+	in.InitContainers = nil
+
+	if hooks := s.backup.Spec.Hooks; hooks != nil && hooks.PreBackup != nil {
+		in.InitContainers = hookContainers(s.backup, s.cluster, s.opt, preBackupHook, hooks.PreBackup)
+	}
+
 	return in
 }
 
+// hookContainers returns the containers that run the hook, the one that executes the SQL
+// statements first
+func hookContainers(backup *mysqlbackup.MysqlBackup, cluster *mysqlcluster.MysqlCluster, opt *options.Options,
+	stage string, hook *api.BackupHook) []core.Container {
+	containers := []core.Container{}
+
+	if len(hook.SQL) > 0 {
+		secretName := cluster.GetNameForResource(mysqlcluster.Secret)
+		containers = append(containers, core.Container{
+			Name:            fmt.Sprintf("%s-sql", stage),
+			Image:           cluster.GetSidecarImage(),
+			ImagePullPolicy: opt.ImagePullPolicy,
+			Args:            append([]string{"run-sql-hook", backup.Status.SourceNode}, hook.SQL...),
+			Env: []core.EnvVar{
+				secretKeyEnv("OPERATOR_USER", secretName),
+				secretKeyEnv("OPERATOR_PASSWORD", secretName),
+			},
+		})
+	}
+
+	for _, hc := range hook.Containers {
+		container := *hc.DeepCopy()
+		container.Env = append(container.Env,
+			core.EnvVar{Name: "BACKUP_NAME", Value: backup.Name},
+			core.EnvVar{Name: "BACKUP_URL", Value: backup.GetBackupURL(cluster)},
+			core.EnvVar{Name: "BACKUP_SOURCE_NODE", Value: backup.Status.SourceNode},
+		)
+		containers = append(containers, container)
+	}
+
+	return containers
+}
+
+// failedContainer returns the status of the first container of the pods that failed, if any
+func failedContainer(pods []core.Pod) *core.ContainerStatus {
+	for _, pod := range pods {
+		for _, cs := range podContainerStatuses(pod) {
+			if cs.State.Terminated != nil && cs.State.Terminated.ExitCode != 0 {
+				return cs.DeepCopy()
+			}
+		}
+	}
+	return nil
+}
+
+// secretKeyEnv returns the env var with the value of the same key from the secret
+func secretKeyEnv(key, secretName string) core.EnvVar {
+	return core.EnvVar{
+		Name: key,
+		ValueFrom: &core.EnvVarSource{
+			SecretKeyRef: &core.SecretKeySelector{
+				LocalObjectReference: core.LocalObjectReference{
+					Name: secretName,
+				},
+				Key: key,
+			},
+		},
+	}
+}
+
+// encryptionKeysVolume returns the volume with the keys used to encrypt and decrypt backups
+func encryptionKeysVolume(enc *api.BackupEncryption) core.Volume {
+	return core.Volume{
+		Name: encryptionKeysVolumeName,
+		VolumeSource: core.VolumeSource{
+			Secret: &core.SecretVolumeSource{
+				SecretName: enc.SecretName,
+			},
+		},
+	}
+}
+
+func encryptionKeysVolumeMount() core.VolumeMount {
+	return core.VolumeMount{
+		Name:      encryptionKeysVolumeName,
+		MountPath: constants.BackupEncryptionKeysPath,
+		ReadOnly:  true,
+	}
+}
+
 func (s *jobSyncer) updateStatus(job *batch.Job) {
+	s.backup.Status.StartTime = job.Status.StartTime
+	defer s.updateProgress(job)
+
 	// check for completion condition
 	if cond := jobCondition(batch.JobComplete, job); cond != nil {
 		s.backup.UpdateStatusCondition(api.BackupComplete, cond.Status, cond.Reason, cond.Message)
 
 		if cond.Status == core.ConditionTrue {
 			s.backup.Status.Completed = true
+			s.backup.Status.FinishTime = job.Status.CompletionTime
+			s.updateStatusFromManifest(job)
 		}
 	}
 
 	// check for failed condition
 	if cond := jobCondition(batch.JobFailed, job); cond != nil {
-		s.backup.UpdateStatusCondition(api.BackupFailed, cond.Status, cond.Reason, cond.Message)
+		if cond.Status == core.ConditionTrue {
+			s.updateStatusFromHooks(job)
+		}
+
+		reason, message := cond.Reason, cond.Message
+		if cond.Status == core.ConditionTrue && s.isTimedOut(job, cond) {
+			reason = "Timeout"
+		}
+		s.backup.UpdateStatusCondition(api.BackupFailed, cond.Status, reason, message)
 
 		if cond.Status == core.ConditionTrue {
 			s.backup.Status.Completed = true
+			// failed jobs have no completion time
+			finishTime := cond.LastTransitionTime
+			s.backup.Status.FinishTime = &finishTime
+		}
+	}
+}
+
+// updateProgress reports the progress of a running backup, as streamed by the sidecar of the
+// source node. The progress is removed once the backup is completed.
+func (s *jobSyncer) updateProgress(job *batch.Job) {
+	if s.backup.Status.Completed {
+		s.backup.Status.Progress = nil
+		return
+	}
+
+	// logical backups are not streamed by the sidecar server
+	if job.Status.Active == 0 || s.backup.IsLogical() || len(s.backup.Status.SourceNode) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), progressRequestTimeout)
+	defer cancel()
+
+	secret := &core.Secret{}
+	key := types.NamespacedName{
+		Name:      s.cluster.GetNameForResource(mysqlcluster.Secret),
+		Namespace: s.cluster.Namespace,
+	}
+	if err := s.c.Get(ctx, key, secret); err != nil {
+		log.V(1).Info("failed to get the backup credentials", "backup", s.backup, "error", err)
+		return
+	}
+
+	progress, err := s.getProgress(ctx, s.backup.Status.SourceNode,
+		string(secret.Data["BACKUP_USER"]), string(secret.Data["BACKUP_PASSWORD"]))
+	if err != nil {
+		log.V(1).Info("failed to get backup progress", "backup", s.backup, "error", err)
+		return
+	}
+
+	s.backup.Status.Progress = progress.ToStatus(time.Now())
+}
+
+// updateStatusFromHooks sets the HookFailed condition when the job failed because of a pre
+// backup hook
+func (s *jobSyncer) updateStatusFromHooks(job *batch.Job) {
+	if s.backup.Spec.Hooks == nil || s.backup.Spec.Hooks.PreBackup == nil {
+		return
+	}
+
+	pods, err := getJobPods(s.c, job)
+	if err != nil {
+		log.Error(err, "failed to list backup pods", "backup", s.backup)
+		return
+	}
+
+	if failed := failedContainer(pods); failed != nil && failed.Name != backupContainerName {
+		s.backup.UpdateStatusCondition(api.BackupHookFailed, core.ConditionTrue, "PreBackupHookFailed",
+			fmt.Sprintf("container %s exited with code %d: %s", failed.Name,
+				failed.State.Terminated.ExitCode, failed.State.Terminated.Message))
+	}
+}
+
+// isTimedOut returns true if the job failed because it exceeded its active deadline or because
+// the backup container was stopped for making no progress
+func (s *jobSyncer) isTimedOut(job *batch.Job, cond *batch.JobCondition) bool {
+	if cond.Reason == "DeadlineExceeded" {
+		return true
+	}
+
+	pods, err := getJobPods(s.c, job)
+	if err != nil {
+		log.Error(err, "failed to list backup pods", "backup", s.backup)
+		return false
+	}
+
+	for _, pod := range pods {
+		for _, cs := range podContainerStatuses(pod) {
+			if cs.Name == backupContainerName && cs.State.Terminated != nil &&
+				cs.State.Terminated.ExitCode == constants.BackupTimeoutExitCode {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// getJobPods returns the pods of the job
+func getJobPods(c client.Client, job *batch.Job) ([]core.Pod, error) {
+	pods := &core.PodList{}
+	if err := c.List(context.TODO(), pods, client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// podContainerStatuses returns the statuses of both the init and regular containers of a pod,
+// the pre backup hooks are init containers
+func podContainerStatuses(pod core.Pod) []core.ContainerStatus {
+	return append(append([]core.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...)
+}
+
+// updateStatusFromManifest fills the backup status with the details reported by the
+// backup container in its termination message
+func (s *jobSyncer) updateStatusFromManifest(job *batch.Job) {
+	pods, err := getJobPods(s.c, job)
+	if err != nil {
+		log.Error(err, "failed to list backup pods", "backup", s.backup)
+		return
+	}
+
+	for _, pod := range pods {
+		for _, cs := range podContainerStatuses(pod) {
+			if cs.Name != backupContainerName || cs.State.Terminated == nil || cs.State.Terminated.ExitCode != 0 {
+				continue
+			}
+
+			manifest, err := mysqlbackup.ParseManifest(cs.State.Terminated.Message)
+			if err != nil {
+				log.Info("failed to parse backup manifest", "backup", s.backup, "error", err)
+				continue
+			}
+
+			s.backup.UpdateStatusFromManifest(manifest)
+			if manifest.Truncated {
+				// the fields left out are read from the manifest uploaded next to the backup
+				if s.backup.Annotations == nil {
+					s.backup.Annotations = map[string]string{}
+				}
+				s.backup.Annotations[ManifestTruncatedAnnotation] = "true"
+			}
+			return
 		}
 	}
 }
@@ -17,11 +17,16 @@ limitations under the License.
 package syncer
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	syncerpkg "github.com/presslabs/controller-util/syncer"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
@@ -64,12 +69,16 @@ var _ = Describe("MysqlBackup job syncer", func() {
 		syncer = &jobSyncer{
 			backup:  backup,
 			cluster: cluster,
+			c:       c,
 			opt:     options.GetOptions(),
 		}
 	})
 
 	It("should return the master if status is empty/unknown", func() {
-		Expect(syncer.getBackupCandidate()).To(Equal(cluster.GetPodHostname(0)))
+		node, reason, err := syncer.getBackupCandidate()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(node).To(Equal(cluster.GetPodHostname(0)))
+		Expect(reason).To(Equal(masterFallbackReason))
 	})
 
 	It("should return the healthy replica", func() {
@@ -83,7 +92,10 @@ var _ = Describe("MysqlBackup job syncer", func() {
 				Conditions: testutil.NodeConditions(false, true, false, true),
 			},
 		}
-		Expect(syncer.getBackupCandidate()).To(Equal(cluster.GetPodHostname(1)))
+		node, reason, err := syncer.getBackupCandidate()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(node).To(Equal(cluster.GetPodHostname(1)))
+		Expect(reason).To(Equal(healthyReplicaReason))
 	})
 
 	It("should return the master if replicas are not healthy", func() {
@@ -97,7 +109,10 @@ var _ = Describe("MysqlBackup job syncer", func() {
 				Conditions: testutil.NodeConditions(false, false, false, true),
 			},
 		}
-		Expect(syncer.getBackupCandidate()).To(Equal(cluster.GetPodHostname(0)))
+		node, reason, err := syncer.getBackupCandidate()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(node).To(Equal(cluster.GetPodHostname(0)))
+		Expect(reason).To(Equal(masterFallbackReason))
 	})
 
 	It("should return the master if replicas are not healthy, even when master is not pod 0", func() {
@@ -111,6 +126,423 @@ var _ = Describe("MysqlBackup job syncer", func() {
 				Conditions: testutil.NodeConditions(true, false, false, false),
 			},
 		}
-		Expect(syncer.getBackupCandidate()).To(Equal(cluster.GetPodHostname(1)))
+		node, _, err := syncer.getBackupCandidate()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(node).To(Equal(cluster.GetPodHostname(1)))
+	})
+
+	Context("with a backup candidate policy", func() {
+		var lag = func(seconds int64) *int64 { return &seconds }
+
+		BeforeEach(func() {
+			three := int32(3)
+			cluster.Spec.Replicas = &three
+			cluster.Status.Nodes = []api.NodeStatus{
+				{
+					Name:       cluster.GetPodHostname(0),
+					Conditions: testutil.NodeConditions(true, false, false, false),
+				},
+				{
+					Name:                  cluster.GetPodHostname(1),
+					Conditions:            testutil.NodeConditions(false, true, false, true),
+					ReplicationLagSeconds: lag(10),
+				},
+				{
+					Name:                  cluster.GetPodHostname(2),
+					Conditions:            testutil.NodeConditions(false, true, false, true),
+					ReplicationLagSeconds: lag(2),
+				},
+			}
+		})
+
+		It("should return the least lagged replica", func() {
+			cluster.Spec.BackupCandidate = &api.BackupCandidate{Policy: api.LeastLaggedReplicaPolicy}
+
+			node, reason, err := syncer.getBackupCandidate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node).To(Equal(cluster.GetPodHostname(2)))
+			Expect(reason).To(Equal(leastLaggedReplicaReason))
+
+			// replicas with an unknown lag are selected last
+			cluster.Status.Nodes[2].ReplicationLagSeconds = nil
+			node, _, _ = syncer.getBackupCandidate()
+			Expect(node).To(Equal(cluster.GetPodHostname(1)))
+		})
+
+		It("should return the preferred replica while it's healthy", func() {
+			cluster.Spec.BackupCandidate = &api.BackupCandidate{PreferredPod: mysqlcluster.GetPodNameForHost(cluster.GetPodHostname(2))}
+
+			node, reason, err := syncer.getBackupCandidate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node).To(Equal(cluster.GetPodHostname(2)))
+			Expect(reason).To(Equal(preferredReplicaReason))
+
+			cluster.Status.Nodes[2].Conditions = testutil.NodeConditions(false, false, false, true)
+			node, reason, err = syncer.getBackupCandidate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node).To(Equal(cluster.GetPodHostname(1)))
+			Expect(reason).To(Equal(healthyReplicaReason))
+		})
+
+		It("should fail the backup when the dedicated replica is not healthy", func() {
+			cluster.Spec.BackupCandidate = &api.BackupCandidate{
+				Policy:       api.DedicatedReplicaPolicy,
+				PreferredPod: mysqlcluster.GetPodNameForHost(cluster.GetPodHostname(2)),
+			}
+
+			node, reason, err := syncer.getBackupCandidate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node).To(Equal(cluster.GetPodHostname(2)))
+			Expect(reason).To(Equal(dedicatedReplicaReason))
+
+			cluster.Status.Nodes[2].Conditions = testutil.NodeConditions(false, false, false, true)
+			_, _, err = syncer.getBackupCandidate()
+			Expect(err).To(Equal(syncerpkg.ErrIgnore))
+			Expect(backup.Status.Completed).To(BeTrue())
+			Expect(backup.Unwrap()).To(testutil.BackupHaveCondition(api.BackupFailed, core.ConditionTrue))
+			Expect(backup.GetBackupCondition(api.BackupFailed).Reason).To(Equal(noBackupCandidateReason))
+		})
+
+		It("should fail the backup when no pod matches the dedicated replica selector", func() {
+			cluster.Spec.BackupCandidate = &api.BackupCandidate{
+				Policy:               api.DedicatedReplicaPolicy,
+				PreferredPodSelector: map[string]string{"backups": "yes"},
+			}
+
+			_, _, err := syncer.getBackupCandidate()
+			Expect(err).To(Equal(syncerpkg.ErrIgnore))
+			Expect(backup.GetBackupCondition(api.BackupFailed).Message).To(ContainSubstring(
+				"no pod matches the selector backups=yes"))
+		})
+
+		It("should fail the backup instead of taking it from the master", func() {
+			cluster.Spec.BackupCandidate = &api.BackupCandidate{NeverMaster: true}
+			cluster.Status.Nodes = cluster.Status.Nodes[:1]
+
+			_, _, err := syncer.getBackupCandidate()
+			Expect(err).To(Equal(syncerpkg.ErrIgnore))
+			Expect(backup.GetBackupCondition(api.BackupFailed).Reason).To(Equal(noBackupCandidateReason))
+		})
+	})
+
+	It("should record the start and finish time of a failed job", func() {
+		started := metav1.Now()
+		failed := metav1.NewTime(started.Add(time.Minute))
+		job := &batch.Job{
+			Status: batch.JobStatus{
+				StartTime: &started,
+				Conditions: []batch.JobCondition{
+					{
+						Type:               batch.JobFailed,
+						Status:             core.ConditionTrue,
+						LastTransitionTime: failed,
+					},
+				},
+			},
+		}
+
+		syncer.updateStatus(job)
+		Expect(backup.Status.Completed).To(Equal(true))
+		Expect(backup.Status.StartTime).To(Equal(&started))
+		Expect(backup.Status.FinishTime).To(Equal(&failed))
+	})
+
+	It("should report the progress of a running backup", func() {
+		secret := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cluster.GetNameForResource(mysqlcluster.Secret),
+				Namespace: cluster.Namespace,
+			},
+			Data: map[string][]byte{
+				"BACKUP_USER":     []byte("sys_backups"),
+				"BACKUP_PASSWORD": []byte("pass"),
+			},
+		}
+		Expect(c.Create(context.TODO(), secret)).To(Succeed())
+		defer func() { _ = c.Delete(context.TODO(), secret) }()
+
+		backup.Status.SourceNode = cluster.GetPodHostname(1)
+		syncer.getProgress = func(_ context.Context, host, user, password string) (*mysqlbackup.Progress, error) {
+			Expect(host).To(Equal(cluster.GetPodHostname(1)))
+			Expect(user).To(Equal("sys_backups"))
+			Expect(password).To(Equal("pass"))
+			return &mysqlbackup.Progress{StartTime: time.Now().Add(-time.Minute), Bytes: 60 * 1024, DataSize: 120 * 1024}, nil
+		}
+
+		syncer.updateStatus(&batch.Job{Status: batch.JobStatus{Active: 1}})
+		Expect(backup.Status.Progress).ToNot(BeNil())
+		Expect(backup.Status.Progress.BytesStreamed).To(Equal(int64(60 * 1024)))
+		Expect(backup.Status.Progress.Throughput).To(BeNumerically("~", 1024, 10))
+		Expect(backup.Status.Progress.EstimatedCompletionTime).ToNot(BeNil())
+
+		// the progress is removed once the backup completes
+		syncer.updateStatus(&batch.Job{
+			Status: batch.JobStatus{
+				Conditions: []batch.JobCondition{{Type: batch.JobComplete, Status: core.ConditionTrue}},
+			},
+		})
+		Expect(backup.Status.Progress).To(BeNil())
+	})
+
+	It("should fail with the Timeout reason when the job exceeds its deadline", func() {
+		job := &batch.Job{
+			Status: batch.JobStatus{
+				Conditions: []batch.JobCondition{
+					{
+						Type:    batch.JobFailed,
+						Status:  core.ConditionTrue,
+						Reason:  "DeadlineExceeded",
+						Message: "Job was active longer than specified deadline",
+					},
+				},
+			},
+		}
+
+		syncer.updateStatus(job)
+		Expect(backup.Status.Completed).To(Equal(true))
+		Expect(backup.GetBackupCondition(api.BackupFailed).Reason).To(Equal("Timeout"))
+	})
+
+	It("should set the deadline and the retries of the job", func() {
+		deadline := int64(3600)
+		retries := int32(2)
+		backup.Spec.ActiveDeadlineSeconds = &deadline
+		backup.Spec.BackoffLimit = &retries
+		syncer.job = &batch.Job{}
+
+		Expect(syncer.SyncFn()).To(Succeed())
+		Expect(syncer.job.Spec.ActiveDeadlineSeconds).To(Equal(&deadline))
+		Expect(syncer.job.Spec.BackoffLimit).To(Equal(&retries))
+	})
+
+	It("should not start a cancelled backup", func() {
+		backup.Spec.Cancel = true
+		syncer.job = &batch.Job{}
+
+		Expect(syncer.SyncFn()).ToNot(Succeed())
+		Expect(backup.Status.Completed).To(Equal(true))
+		Expect(backup.GetBackupCondition(api.BackupFailed).Reason).To(Equal("Cancelled"))
+		Expect(syncer.job.Spec.Template.Spec.Containers).To(BeEmpty())
+	})
+
+	It("should mount only the encryption key used for the backup", func() {
+		backup.Spec.Encryption = &api.BackupEncryption{
+			SecretName: "backup-keys",
+			KeyID:      "2021-01",
+		}
+
+		podSpec := syncer.ensurePodSpec(core.PodSpec{})
+		Expect(podSpec.Containers[0].Env).To(ContainElement(core.EnvVar{
+			Name:  "BACKUP_ENCRYPTION_KEY_ID",
+			Value: "2021-01",
+		}))
+		Expect(podSpec.Volumes).To(HaveLen(1))
+		Expect(podSpec.Volumes[0].Secret.SecretName).To(Equal("backup-keys"))
+		Expect(podSpec.Volumes[0].Secret.Items).To(ConsistOf(core.KeyToPath{Key: "2021-01", Path: "2021-01"}))
+		Expect(podSpec.Containers[0].VolumeMounts).To(ConsistOf(encryptionKeysVolumeMount()))
+	})
+
+	Describe("incremental backups", func() {
+		var (
+			base *api.MysqlBackup
+		)
+
+		BeforeEach(func() {
+			base = &api.MysqlBackup{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("base-%d", rand.Int31()), Namespace: backup.Namespace},
+				Spec: api.MysqlBackupSpec{
+					ClusterName: cluster.Name,
+				},
+			}
+			Expect(c.Create(context.TODO(), base)).To(Succeed())
+
+			backup.Spec.Type = api.IncrementalBackup
+			backup.Spec.BaseBackupName = base.Name
+		})
+
+		AfterEach(func() {
+			Expect(c.Delete(context.TODO(), base)).To(Succeed())
+		})
+
+		It("should wait for the base backup to complete", func() {
+			_, err := syncer.getBaseBackup()
+			Expect(err).To(HaveOccurred())
+			Expect(backup.Status.Completed).To(Equal(false))
+		})
+
+		It("should start from the base backup LSN", func() {
+			base.Status.Completed = true
+			base.Status.ToLSN = 1626007
+			Expect(c.Status().Update(context.TODO(), base)).To(Succeed())
+
+			baseBackup, err := syncer.getBaseBackup()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(baseBackup.Status.ToLSN).To(Equal(int64(1626007)))
+
+			syncer.incrementalLSN = 1626007
+			podSpec := syncer.ensurePodSpec(core.PodSpec{})
+			Expect(podSpec.Containers[0].Env).To(ContainElement(core.EnvVar{
+				Name:  "BACKUP_INCREMENTAL_LSN",
+				Value: "1626007",
+			}))
+		})
+
+		It("should fail when the base backup is not specified", func() {
+			backup.Spec.BaseBackupName = ""
+			_, err := syncer.getBaseBackup()
+			Expect(err).To(HaveOccurred())
+			Expect(backup.Status.Completed).To(Equal(true))
+			Expect(backup.GetBackupCondition(api.BackupFailed).Reason).To(Equal("BaseBackupMissing"))
+		})
+
+		It("should be taken from the node of the base backup", func() {
+			cluster.Status.Nodes = []api.NodeStatus{
+				{
+					Name:       cluster.GetPodHostname(0),
+					Conditions: testutil.NodeConditions(true, false, false, false),
+				},
+				{
+					Name:       cluster.GetPodHostname(1),
+					Conditions: testutil.NodeConditions(false, true, false, true),
+				},
+			}
+			base.Status.SourceNode = cluster.GetPodHostname(0)
+
+			node, reason, err := syncer.getBackupSource(mysqlbackup.New(base))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node).To(Equal(cluster.GetPodHostname(0)))
+			Expect(reason).To(Equal(baseBackupSourceReason))
+		})
+
+		It("should wait while the node of the base backup is not healthy", func() {
+			cluster.Status.Nodes = []api.NodeStatus{
+				{
+					Name:       cluster.GetPodHostname(0),
+					Conditions: testutil.NodeConditions(true, false, false, false),
+				},
+				{
+					Name:       cluster.GetPodHostname(1),
+					Conditions: testutil.NodeConditions(false, true, true, true),
+				},
+			}
+			base.Status.SourceNode = cluster.GetPodHostname(1)
+
+			_, _, err := syncer.getBackupSource(mysqlbackup.New(base))
+			Expect(err).To(HaveOccurred())
+			Expect(backup.Status.Completed).To(Equal(false))
+			cond := backup.GetBackupCondition(api.BackupFailed)
+			Expect(cond.Status).To(Equal(core.ConditionFalse))
+			Expect(cond.Reason).To(Equal(incrementalSourceUnhealthyReason))
+		})
+	})
+	Describe("logical backups", func() {
+		BeforeEach(func() {
+			backup.Spec.Type = api.LogicalBackup
+			backup.Status.SourceNode = cluster.GetPodHostname(1)
+		})
+
+		It("should dump the databases from the backup spec", func() {
+			backup.Spec.Databases = []string{"shop", "blog"}
+
+			Expect(syncer.getDatabases()).To(Equal([]string{"shop", "blog"}))
+		})
+
+		It("should dump the databases of the cluster", func() {
+			db := &api.MysqlDatabase{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("db-%d", rand.Int31()), Namespace: backup.Namespace},
+				Spec: api.MysqlDatabaseSpec{
+					ClusterRef: api.ClusterReference{LocalObjectReference: core.LocalObjectReference{Name: cluster.Name}},
+					Database:   "shop",
+				},
+			}
+			Expect(c.Create(context.TODO(), db)).To(Succeed())
+			defer func() { Expect(c.Delete(context.TODO(), db)).To(Succeed()) }()
+
+			databases, err := syncer.getDatabases()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(databases).To(Equal([]string{"shop"}))
+
+			syncer.databases = databases
+			podSpec := syncer.ensurePodSpec(core.PodSpec{})
+			Expect(podSpec.Containers[0].Args).To(Equal([]string{
+				"take-logical-backup-to", cluster.GetPodHostname(1), backup.GetBackupURL(cluster), "shop",
+			}))
+			Expect(podSpec.Containers[0].Env).To(ContainElement(
+				secretKeyEnv("OPERATOR_USER", cluster.GetNameForResource(mysqlcluster.Secret))))
+		})
+
+		It("should fail when there are no databases to dump", func() {
+			_, err := syncer.getDatabases()
+			Expect(err).To(HaveOccurred())
+			Expect(backup.Status.Completed).To(Equal(true))
+			Expect(backup.GetBackupCondition(api.BackupFailed).Reason).To(Equal("NoDatabases"))
+		})
+	})
+
+	Describe("backup hooks", func() {
+		BeforeEach(func() {
+			backup.Status.SourceNode = cluster.GetPodHostname(1)
+			backup.Spec.Hooks = &api.BackupHooks{
+				PreBackup: &api.BackupHook{
+					SQL: []string{"FLUSH TABLES"},
+				},
+				PostBackup: &api.BackupHook{
+					Containers: []core.Container{
+						{Name: "notify", Image: "curlimages/curl"},
+					},
+				},
+			}
+		})
+
+		It("should run the pre hooks before the backup", func() {
+			podSpec := syncer.ensurePodSpec(core.PodSpec{})
+
+			Expect(podSpec.InitContainers).To(HaveLen(1))
+			Expect(podSpec.InitContainers[0].Name).To(Equal("pre-backup-sql"))
+			Expect(podSpec.InitContainers[0].Args).To(Equal([]string{
+				"run-sql-hook", cluster.GetPodHostname(1), "FLUSH TABLES",
+			}))
+
+			// the post hooks are run by a separate job
+			Expect(podSpec.Containers).To(HaveLen(1))
+			Expect(podSpec.Containers[0].Name).To(Equal(backupContainerName))
+		})
+
+		It("should fail the backup when a pre hook fails", func() {
+			job := &batch.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("job-%d", rand.Int31()), Namespace: backup.Namespace},
+				Status: batch.JobStatus{
+					Conditions: []batch.JobCondition{
+						{Type: batch.JobFailed, Status: core.ConditionTrue},
+					},
+				},
+			}
+
+			pod := &core.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s-pod", job.Name),
+					Namespace: job.Namespace,
+					Labels:    map[string]string{"job-name": job.Name},
+				},
+				Spec: core.PodSpec{
+					Containers: []core.Container{{Name: backupContainerName, Image: "sidecar"}},
+				},
+			}
+			Expect(c.Create(context.TODO(), pod)).To(Succeed())
+			defer func() { Expect(c.Delete(context.TODO(), pod)).To(Succeed()) }()
+
+			pod.Status.InitContainerStatuses = []core.ContainerStatus{
+				{
+					Name:  "pre-backup-sql",
+					State: core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 7}},
+				},
+			}
+			Expect(c.Status().Update(context.TODO(), pod)).To(Succeed())
+
+			syncer.updateStatus(job)
+			Expect(backup.Status.Completed).To(Equal(true))
+			Expect(backup.GetBackupCondition(api.BackupFailed).Status).To(Equal(core.ConditionTrue))
+			Expect(backup.GetBackupCondition(api.BackupHookFailed).Reason).To(Equal("PreBackupHookFailed"))
+		})
 	})
 })
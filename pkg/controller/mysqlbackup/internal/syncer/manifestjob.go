@@ -0,0 +1,255 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/presslabs/controller-util/syncer"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+)
+
+const (
+	// ManifestTruncatedAnnotation is set on the backups whose manifest didn't fit in the
+	// termination message of the backup job, until the manifest uploaded next to the backup is
+	// read into the status
+	ManifestTruncatedAnnotation = "backups.mysql.presslabs.org/manifest-truncated"
+
+	manifestContainerName = "manifest"
+)
+
+type manifestJobSyncer struct {
+	backup  *mysqlbackup.MysqlBackup
+	cluster *mysqlcluster.MysqlCluster
+	c       client.Client
+	scheme  *runtime.Scheme
+
+	opt *options.Options
+}
+
+// NewManifestJobSyncer returns a syncer that fills the status of the backups whose manifest was
+// truncated from the manifest uploaded next to the backup. It's read by a job, which writes it
+// in a config map that only the job may write, and the job resources are removed once read.
+func NewManifestJobSyncer(c client.Client, s *runtime.Scheme, backup *mysqlbackup.MysqlBackup,
+	cluster *mysqlcluster.MysqlCluster, opt *options.Options) syncer.Interface {
+	sync := &manifestJobSyncer{
+		backup:  backup,
+		cluster: cluster,
+		c:       c,
+		scheme:  s,
+		opt:     opt,
+	}
+
+	return syncer.NewExternalSyncer("ManifestJob", backup.Unwrap(), nil, sync.sync)
+}
+
+func (s *manifestJobSyncer) sync(ctx context.Context, _ interface{}) (controllerutil.OperationResult, error) {
+	if _, ok := s.backup.Annotations[ManifestTruncatedAnnotation]; !ok {
+		return controllerutil.OperationResultNone, nil
+	}
+
+	cm := &core.ConfigMap{}
+	err := s.c.Get(ctx, s.key(), cm)
+	if k8serrors.IsNotFound(err) {
+		return controllerutil.OperationResultCreated, s.createJob(ctx)
+	} else if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	if data := cm.Data[mysqlbackup.ManifestConfigMapKey]; len(data) > 0 {
+		manifest, err := mysqlbackup.ParseManifest(data)
+		if err != nil {
+			log.Info("failed to parse backup manifest", "backup", s.backup, "error", err)
+		} else {
+			s.backup.UpdateStatusFromManifest(manifest)
+		}
+		return controllerutil.OperationResultUpdated, s.cleanup(ctx)
+	}
+
+	job := &batch.Job{}
+	err = s.c.Get(ctx, s.key(), job)
+	if k8serrors.IsNotFound(err) {
+		return controllerutil.OperationResultCreated, s.createJob(ctx)
+	} else if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	if _, failed := getJobStatus(job); failed {
+		// the status keeps the fields from the truncated manifest
+		log.Info("failed to read the manifest of the backup", "backup", s.backup)
+		return controllerutil.OperationResultNone, s.cleanup(ctx)
+	}
+
+	return controllerutil.OperationResultNone, nil
+}
+
+func (s *manifestJobSyncer) key() types.NamespacedName {
+	return types.NamespacedName{Name: s.backup.GetNameForManifestJob(), Namespace: s.backup.Namespace}
+}
+
+func (s *manifestJobSyncer) objectMeta() metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      s.backup.GetNameForManifestJob(),
+		Namespace: s.backup.Namespace,
+		Labels: map[string]string{
+			"cluster": s.backup.Spec.ClusterName,
+			"backup":  s.backup.Name,
+		},
+	}
+}
+
+// serviceAccountName returns the service account of the job, the one of the cluster to keep
+// the access to the bucket or a dedicated one
+func (s *manifestJobSyncer) serviceAccountName() string {
+	if sa := s.cluster.Spec.PodSpec.ServiceAccountName; len(sa) > 0 {
+		return sa
+	}
+	return s.backup.GetNameForManifestJob()
+}
+
+// getJobResources returns the config map in which the job writes the manifest, the role that
+// allows the job to write only that config map, its binding and the job itself
+func (s *manifestJobSyncer) getJobResources() []client.Object {
+	objects := []client.Object{
+		&core.ConfigMap{ObjectMeta: s.objectMeta()},
+		&rbac.Role{
+			ObjectMeta: s.objectMeta(),
+			Rules: []rbac.PolicyRule{
+				{
+					APIGroups:     []string{""},
+					Resources:     []string{"configmaps"},
+					ResourceNames: []string{s.backup.GetNameForManifestJob()},
+					Verbs:         []string{"get", "patch"},
+				},
+			},
+		},
+		&rbac.RoleBinding{
+			ObjectMeta: s.objectMeta(),
+			RoleRef: rbac.RoleRef{
+				APIGroup: rbac.GroupName,
+				Kind:     "Role",
+				Name:     s.backup.GetNameForManifestJob(),
+			},
+			Subjects: []rbac.Subject{
+				{
+					Kind:      rbac.ServiceAccountKind,
+					Name:      s.serviceAccountName(),
+					Namespace: s.backup.Namespace,
+				},
+			},
+		},
+	}
+
+	if len(s.cluster.Spec.PodSpec.ServiceAccountName) == 0 {
+		objects = append(objects, &core.ServiceAccount{ObjectMeta: s.objectMeta()})
+	}
+
+	job := &batch.Job{ObjectMeta: s.objectMeta()}
+	job.Spec.Template.Spec = s.ensurePodSpec(job.Spec.Template.Spec)
+	return append(objects, job)
+}
+
+// createJob creates the job that reads the manifest and the resources it uses, owned by the
+// backup
+func (s *manifestJobSyncer) createJob(ctx context.Context) error {
+	for _, obj := range s.getJobResources() {
+		if err := controllerutil.SetControllerReference(s.backup.Unwrap(), obj, s.scheme); err != nil {
+			return err
+		}
+		if err := s.c.Create(ctx, obj); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanup removes the job that read the manifest and the resources it used
+func (s *manifestJobSyncer) cleanup(ctx context.Context) error {
+	background := metav1.DeletePropagationBackground
+	for _, obj := range s.getJobResources() {
+		if err := s.c.Delete(ctx, obj, &client.DeleteOptions{PropagationPolicy: &background}); err != nil &&
+			!k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	delete(s.backup.Annotations, ManifestTruncatedAnnotation)
+	return nil
+}
+
+func (s *manifestJobSyncer) ensurePodSpec(in core.PodSpec) core.PodSpec {
+	in.RestartPolicy = core.RestartPolicyNever
+	in.ImagePullSecrets = s.cluster.Spec.PodSpec.ImagePullSecrets
+	in.ServiceAccountName = s.serviceAccountName()
+
+	container := core.Container{
+		Name:            manifestContainerName,
+		Image:           s.cluster.GetSidecarImage(),
+		ImagePullPolicy: s.opt.ImagePullPolicy,
+		Args: []string{
+			"read-manifest",
+			s.backup.Spec.BackupURL,
+			s.backup.GetNameForManifestJob(),
+		},
+		Env: []core.EnvVar{
+			{
+				Name: "MY_NAMESPACE",
+				ValueFrom: &core.EnvVarSource{
+					FieldRef: &core.ObjectFieldSelector{
+						APIVersion: "v1",
+						FieldPath:  "metadata.namespace",
+					},
+				},
+			},
+		},
+	}
+
+	if len(s.cluster.Spec.RcloneExtraArgs) > 0 {
+		container.Env = append(container.Env, core.EnvVar{
+			Name:  "RCLONE_EXTRA_ARGS",
+			Value: strings.Join(s.cluster.Spec.RcloneExtraArgs, " "),
+		})
+	}
+	container.Env = append(container.Env, s.cluster.GetBackupStorageEnv()...)
+
+	if len(s.backup.Spec.BackupSecretName) != 0 {
+		container.EnvFrom = []core.EnvFromSource{
+			{
+				SecretRef: &core.SecretEnvSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: s.backup.Spec.BackupSecretName,
+					},
+				},
+			},
+		}
+	}
+
+	in.Containers = []core.Container{container}
+	return in
+}
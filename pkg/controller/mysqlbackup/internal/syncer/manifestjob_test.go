@@ -0,0 +1,172 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+)
+
+var _ = Describe("MysqlBackup manifest job syncer", func() {
+	var (
+		cluster *mysqlcluster.MysqlCluster
+		backup  *mysqlbackup.MysqlBackup
+		mSyncer *manifestJobSyncer
+	)
+
+	BeforeEach(func() {
+		clusterName := fmt.Sprintf("cluster-%d", rand.Int31())
+		name := fmt.Sprintf("backup-%d", rand.Int31())
+		ns := "default"
+
+		cluster = mysqlcluster.New(&api.MysqlCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: ns},
+			Spec:       api.MysqlClusterSpec{SecretName: "a-secret"},
+		})
+
+		backup = mysqlbackup.New(&api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   ns,
+				Annotations: map[string]string{ManifestTruncatedAnnotation: "true"},
+			},
+			Spec: api.MysqlBackupSpec{
+				ClusterName:      clusterName,
+				BackupURL:        "gs://bucket/backup.logical",
+				BackupSecretName: "backup-secret",
+			},
+		})
+		Expect(c.Create(context.TODO(), backup.Unwrap())).To(Succeed())
+
+		mSyncer = &manifestJobSyncer{
+			backup:  backup,
+			cluster: cluster,
+			c:       c,
+			scheme:  scheme.Scheme,
+			opt:     options.GetOptions(),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(mSyncer.cleanup(context.TODO())).To(Succeed())
+		Expect(c.Delete(context.TODO(), backup.Unwrap())).To(Succeed())
+	})
+
+	It("should skip the backups with a complete manifest", func() {
+		delete(backup.Annotations, ManifestTruncatedAnnotation)
+		Expect(mSyncer.sync(context.TODO(), nil)).To(BeEquivalentTo("unchanged"))
+
+		err := c.Get(context.TODO(), mSyncer.key(), &batch.Job{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should run a job that reads the manifest in a config map", func() {
+		_, err := mSyncer.sync(context.TODO(), nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		job := &batch.Job{}
+		Expect(c.Get(context.TODO(), mSyncer.key(), job)).To(Succeed())
+		Expect(job.OwnerReferences).To(HaveLen(1))
+		podSpec := job.Spec.Template.Spec
+		Expect(podSpec.ServiceAccountName).To(Equal(backup.GetNameForManifestJob()))
+		Expect(podSpec.Containers[0].Args).To(Equal([]string{
+			"read-manifest", "gs://bucket/backup.logical", backup.GetNameForManifestJob(),
+		}))
+		Expect(podSpec.Containers[0].EnvFrom[0].SecretRef.Name).To(Equal("backup-secret"))
+
+		role := &rbac.Role{}
+		Expect(c.Get(context.TODO(), mSyncer.key(), role)).To(Succeed())
+		Expect(role.Rules[0].ResourceNames).To(Equal([]string{backup.GetNameForManifestJob()}))
+		Expect(c.Get(context.TODO(), mSyncer.key(), &core.ServiceAccount{})).To(Succeed())
+		Expect(c.Get(context.TODO(), mSyncer.key(), &core.ConfigMap{})).To(Succeed())
+
+		// nothing happens until the job writes the manifest
+		_, err = mSyncer.sync(context.TODO(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(backup.Annotations).To(HaveKey(ManifestTruncatedAnnotation))
+	})
+
+	It("should bind the role to the service account of the cluster", func() {
+		cluster.Spec.PodSpec.ServiceAccountName = "workload-identity"
+		_, err := mSyncer.sync(context.TODO(), nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		binding := &rbac.RoleBinding{}
+		Expect(c.Get(context.TODO(), mSyncer.key(), binding)).To(Succeed())
+		Expect(binding.Subjects[0].Name).To(Equal("workload-identity"))
+
+		err = c.Get(context.TODO(), mSyncer.key(), &core.ServiceAccount{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should update the status from the manifest and remove the job", func() {
+		_, err := mSyncer.sync(context.TODO(), nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		data, err := json.Marshal(&mysqlbackup.Manifest{
+			Databases:         []string{"shop", "blog"},
+			DatabaseChecksums: map[string]string{"shop": "shop-sum", "blog": "blog-sum"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		cm := &core.ConfigMap{}
+		Expect(c.Get(context.TODO(), mSyncer.key(), cm)).To(Succeed())
+		cm.Data = map[string]string{mysqlbackup.ManifestConfigMapKey: string(data)}
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+		_, err = mSyncer.sync(context.TODO(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(backup.Status.Databases).To(Equal([]string{"shop", "blog"}))
+		Expect(backup.Status.DatabaseChecksums).To(HaveKeyWithValue("blog", "blog-sum"))
+		Expect(backup.Annotations).ToNot(HaveKey(ManifestTruncatedAnnotation))
+
+		err = c.Get(context.TODO(), mSyncer.key(), &core.ConfigMap{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		err = c.Get(context.TODO(), mSyncer.key(), &rbac.Role{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should remove the job when it fails to read the manifest", func() {
+		_, err := mSyncer.sync(context.TODO(), nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		job := &batch.Job{}
+		Expect(c.Get(context.TODO(), mSyncer.key(), job)).To(Succeed())
+		job.Status.Conditions = []batch.JobCondition{{Type: batch.JobFailed, Status: core.ConditionTrue}}
+		Expect(c.Status().Update(context.TODO(), job)).To(Succeed())
+
+		_, err = mSyncer.sync(context.TODO(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(backup.Annotations).ToNot(HaveKey(ManifestTruncatedAnnotation))
+	})
+})
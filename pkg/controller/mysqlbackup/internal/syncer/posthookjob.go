@@ -0,0 +1,139 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"fmt"
+
+	"github.com/presslabs/controller-util/syncer"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+)
+
+type postHookJobSyncer struct {
+	job     *batch.Job
+	backup  *mysqlbackup.MysqlBackup
+	cluster *mysqlcluster.MysqlCluster
+	c       client.Client
+
+	opt *options.Options
+}
+
+// NewPostHookJobSyncer returns a syncer for the job that runs the post backup hooks once the
+// backup is completed. It's separated from the backup job such that a failed hook doesn't
+// retry the backup.
+func NewPostHookJobSyncer(c client.Client, s *runtime.Scheme, backup *mysqlbackup.MysqlBackup,
+	cluster *mysqlcluster.MysqlCluster, opt *options.Options) syncer.Interface {
+	obj := &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backup.GetNameForPostHookJob(),
+			Namespace: backup.Namespace,
+		},
+	}
+
+	sync := &postHookJobSyncer{
+		job:     obj,
+		backup:  backup,
+		cluster: cluster,
+		c:       c,
+		opt:     opt,
+	}
+
+	return syncer.NewObjectSyncer("PostHookJob", backup.Unwrap(), obj, c, sync.SyncFn)
+}
+
+func (s *postHookJobSyncer) SyncFn() error {
+	hooks := s.backup.Spec.Hooks
+	if hooks == nil || hooks.PostBackup == nil || (len(hooks.PostBackup.SQL) == 0 && len(hooks.PostBackup.Containers) == 0) {
+		return syncer.ErrIgnore
+	}
+
+	// the hooks are run only after the backup was taken successfully
+	if cond := s.backup.GetBackupCondition(api.BackupComplete); cond == nil || cond.Status != core.ConditionTrue {
+		return syncer.ErrIgnore
+	}
+
+	// check if job is already created an just update the status
+	if !s.job.ObjectMeta.CreationTimestamp.IsZero() {
+		s.updateStatus(s.job)
+		return nil
+	}
+
+	// the hooks are run only once, the job may be removed after it finished
+	if cond := s.backup.GetBackupCondition(api.BackupHookFailed); cond != nil {
+		return syncer.ErrIgnore
+	}
+
+	s.job.Labels = map[string]string{
+		"cluster":       s.backup.Spec.ClusterName,
+		"backup":        s.backup.Name,
+		"post-hook-job": "true",
+	}
+
+	// a failed hook is not retried
+	backoffLimit := int32(0)
+	s.job.Spec.BackoffLimit = &backoffLimit
+	s.job.Spec.Template.Spec = s.ensurePodSpec(s.job.Spec.Template.Spec)
+
+	s.backup.UpdateStatusCondition(api.BackupHookFailed, core.ConditionUnknown, "PostBackupHookStarted",
+		"the post backup hooks are running")
+	return nil
+}
+
+func (s *postHookJobSyncer) ensurePodSpec(in core.PodSpec) core.PodSpec {
+	in.RestartPolicy = core.RestartPolicyNever
+	in.ImagePullSecrets = s.cluster.Spec.PodSpec.ImagePullSecrets
+	in.ServiceAccountName = s.cluster.Spec.PodSpec.ServiceAccountName
+
+	in.Affinity = s.cluster.Spec.PodSpec.BackupAffinity
+	in.NodeSelector = s.cluster.Spec.PodSpec.BackupNodeSelector
+	in.PriorityClassName = s.cluster.Spec.PodSpec.BackupPriorityClassName
+	in.Tolerations = s.cluster.Spec.PodSpec.BackupTolerations
+
+	in.Containers = hookContainers(s.backup, s.cluster, s.opt, postBackupHook, s.backup.Spec.Hooks.PostBackup)
+	return in
+}
+
+func (s *postHookJobSyncer) updateStatus(job *batch.Job) {
+	completed, failed := getJobStatus(job)
+	if completed {
+		s.backup.UpdateStatusCondition(api.BackupHookFailed, core.ConditionFalse, "PostBackupHookSucceeded",
+			"the post backup hooks succeeded")
+		return
+	}
+	if !failed {
+		return
+	}
+
+	message := "the post backup hooks failed"
+	pods, err := getJobPods(s.c, job)
+	if err != nil {
+		log.Error(err, "failed to list post backup hook pods", "backup", s.backup)
+	} else if cs := failedContainer(pods); cs != nil {
+		message = fmt.Sprintf("container %s exited with code %d: %s", cs.Name,
+			cs.State.Terminated.ExitCode, cs.State.Terminated.Message)
+	}
+	s.backup.UpdateStatusCondition(api.BackupHookFailed, core.ConditionTrue, "PostBackupHookFailed", message)
+}
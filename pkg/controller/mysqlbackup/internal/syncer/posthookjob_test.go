@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/presslabs/controller-util/syncer"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+)
+
+var _ = Describe("MysqlBackup post hook job syncer", func() {
+	var (
+		cluster *mysqlcluster.MysqlCluster
+		backup  *mysqlbackup.MysqlBackup
+		hSyncer *postHookJobSyncer
+	)
+
+	BeforeEach(func() {
+		clusterName := fmt.Sprintf("cluster-%d", rand.Int31())
+		name := fmt.Sprintf("backup-%d", rand.Int31())
+		ns := "default"
+
+		cluster = mysqlcluster.New(&api.MysqlCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: ns},
+			Spec:       api.MysqlClusterSpec{SecretName: "a-secret"},
+		})
+
+		backup = mysqlbackup.New(&api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+			Spec: api.MysqlBackupSpec{
+				ClusterName: clusterName,
+				BackupURL:   "gs://bucket/backup.xbackup.gz",
+				Hooks: &api.BackupHooks{
+					PostBackup: &api.BackupHook{
+						SQL: []string{"DO 1"},
+						Containers: []core.Container{
+							{Name: "notify", Image: "curlimages/curl"},
+						},
+					},
+				},
+			},
+			Status: api.MysqlBackupStatus{SourceNode: cluster.GetPodHostname(1)},
+		})
+
+		hSyncer = &postHookJobSyncer{
+			job:     &batch.Job{},
+			backup:  backup,
+			cluster: cluster,
+			c:       c,
+			opt:     options.GetOptions(),
+		}
+	})
+
+	It("should skip backups without post hooks", func() {
+		backup.UpdateStatusCondition(api.BackupComplete, core.ConditionTrue, "", "")
+		backup.Spec.Hooks.PostBackup = nil
+		Expect(hSyncer.SyncFn()).To(Equal(syncer.ErrIgnore))
+	})
+
+	It("should skip backups that are not completed successfully", func() {
+		Expect(hSyncer.SyncFn()).To(Equal(syncer.ErrIgnore))
+
+		backup.UpdateStatusCondition(api.BackupFailed, core.ConditionTrue, "", "")
+		Expect(hSyncer.SyncFn()).To(Equal(syncer.ErrIgnore))
+	})
+
+	It("should run the post hooks once the backup is completed", func() {
+		backup.UpdateStatusCondition(api.BackupComplete, core.ConditionTrue, "", "")
+		Expect(hSyncer.SyncFn()).To(Succeed())
+
+		Expect(*hSyncer.job.Spec.BackoffLimit).To(Equal(int32(0)))
+		containers := hSyncer.job.Spec.Template.Spec.Containers
+		Expect(containers).To(HaveLen(2))
+		Expect(containers[0].Name).To(Equal("post-backup-sql"))
+		Expect(containers[0].Args).To(Equal([]string{"run-sql-hook", cluster.GetPodHostname(1), "DO 1"}))
+		Expect(containers[1].Name).To(Equal("notify"))
+		Expect(containers[1].Env).To(ContainElement(core.EnvVar{Name: "BACKUP_NAME", Value: backup.Name}))
+
+		Expect(backup.GetBackupCondition(api.BackupHookFailed).Status).To(Equal(core.ConditionUnknown))
+
+		// the hooks are not run again
+		hSyncer.job = &batch.Job{}
+		Expect(hSyncer.SyncFn()).To(Equal(syncer.ErrIgnore))
+	})
+
+	It("should report the failed post hooks without failing the backup", func() {
+		backup.UpdateStatusCondition(api.BackupComplete, core.ConditionTrue, "", "")
+
+		job := &batch.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("job-%d", rand.Int31()), Namespace: backup.Namespace},
+			Status: batch.JobStatus{
+				Conditions: []batch.JobCondition{
+					{Type: batch.JobFailed, Status: core.ConditionTrue},
+				},
+			},
+		}
+
+		pod := &core.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-pod", job.Name),
+				Namespace: job.Namespace,
+				Labels:    map[string]string{"job-name": job.Name},
+			},
+			Spec: core.PodSpec{
+				Containers: []core.Container{{Name: "notify", Image: "curlimages/curl"}},
+			},
+		}
+		Expect(c.Create(context.TODO(), pod)).To(Succeed())
+		defer func() { Expect(c.Delete(context.TODO(), pod)).To(Succeed()) }()
+
+		pod.Status.ContainerStatuses = []core.ContainerStatus{
+			{
+				Name:  "notify",
+				State: core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 7}},
+			},
+		}
+		Expect(c.Status().Update(context.TODO(), pod)).To(Succeed())
+
+		hSyncer.updateStatus(job)
+		Expect(backup.GetBackupCondition(api.BackupComplete).Status).To(Equal(core.ConditionTrue))
+		Expect(backup.GetBackupCondition(api.BackupFailed)).To(BeNil())
+
+		cond := backup.GetBackupCondition(api.BackupHookFailed)
+		Expect(cond.Status).To(Equal(core.ConditionTrue))
+		Expect(cond.Reason).To(Equal("PostBackupHookFailed"))
+		Expect(cond.Message).To(ContainSubstring("container notify exited with code 7"))
+	})
+})
@@ -0,0 +1,372 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/presslabs/controller-util/syncer"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+	"github.com/bitpoke/mysql-operator/pkg/util/constants"
+)
+
+const (
+	verifyRestoreContainerName = "restore"
+	verifyContainerName        = "verify"
+	verifyDataVolumeName       = "data"
+
+	// the query result is truncated to keep the condition message short
+	verifyResultMaxLen = 1024
+)
+
+// verifyScript starts MySQL on the restored data, without networking and grant tables, runs the
+// sanity query, then stops MySQL. The result of the query is written as termination message.
+var verifyScript = fmt.Sprintf(`set -e
+mysqld --datadir=%[1]s --socket=/tmp/mysqld.sock --pid-file=/tmp/mysqld.pid \
+    --skip-networking --skip-grant-tables --skip-slave-start --skip-log-bin &
+pid=$!
+
+for i in $(seq 1 600); do
+    if mysqladmin --socket=/tmp/mysqld.sock ping >/dev/null 2>&1; then
+        break
+    fi
+    if ! kill -0 $pid 2>/dev/null; then
+        echo "mysqld exited before the sanity query could run" | tee /dev/termination-log
+        exit 1
+    fi
+    sleep 1
+done
+
+set +e
+mysql --socket=/tmp/mysqld.sock -NB -e "$VERIFY_QUERY" > /tmp/result 2>&1
+rc=$?
+cat /tmp/result
+head -c %[2]d /tmp/result > /dev/termination-log
+
+kill $pid
+wait $pid
+exit $rc
+`, constants.DataVolumeMountPath, verifyResultMaxLen)
+
+type verifyJobSyncer struct {
+	job     *batch.Job
+	backup  *mysqlbackup.MysqlBackup
+	cluster *mysqlcluster.MysqlCluster
+	c       client.Client
+
+	opt *options.Options
+
+	// chain holds the backups that are restored, the full backup being the first
+	chain []*mysqlbackup.MysqlBackup
+}
+
+// NewVerifyJobSyncer returns a syncer for the job that restores a completed backup and runs a
+// sanity query on it, to check that the backup is usable
+func NewVerifyJobSyncer(c client.Client, s *runtime.Scheme, backup *mysqlbackup.MysqlBackup,
+	cluster *mysqlcluster.MysqlCluster, opt *options.Options) syncer.Interface {
+	obj := &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backup.GetNameForVerificationJob(),
+			Namespace: backup.Namespace,
+		},
+	}
+
+	sync := &verifyJobSyncer{
+		job:     obj,
+		backup:  backup,
+		cluster: cluster,
+		c:       c,
+		opt:     opt,
+	}
+
+	return syncer.NewObjectSyncer("VerifyJob", backup.Unwrap(), obj, c, sync.SyncFn)
+}
+
+func (s *verifyJobSyncer) SyncFn() error {
+	if !s.backup.ShouldVerify(s.cluster) {
+		return syncer.ErrIgnore
+	}
+
+	// the verification is done only once
+	if cond := s.backup.GetBackupCondition(api.BackupVerified); cond != nil && cond.Status != core.ConditionUnknown {
+		return syncer.ErrIgnore
+	}
+
+	// only successful backups are verified
+	if cond := s.backup.GetBackupCondition(api.BackupComplete); cond == nil || cond.Status != core.ConditionTrue {
+		return syncer.ErrIgnore
+	}
+
+	// check if job is already created an just update the status
+	if !s.job.ObjectMeta.CreationTimestamp.IsZero() {
+		s.updateStatus(s.job)
+		return nil
+	}
+
+	chain, err := s.backup.GetChain(context.TODO(), s.c)
+	if errors.Is(err, mysqlbackup.ErrInvalidChain) {
+		s.backup.UpdateStatusCondition(api.BackupVerified, core.ConditionFalse, "InvalidBackupChain", err.Error())
+		return syncer.ErrIgnore
+	} else if err != nil {
+		return fmt.Errorf("failed to get the base backups: %s", err)
+	}
+	s.chain = chain
+
+	s.job.Labels = map[string]string{
+		"cluster":    s.backup.Spec.ClusterName,
+		"backup":     s.backup.Name,
+		"verify-job": "true",
+	}
+
+	s.job.Spec.Template.Spec = s.ensurePodSpec(s.job.Spec.Template.Spec)
+
+	s.backup.UpdateStatusCondition(api.BackupVerified, core.ConditionUnknown, "VerificationStarted",
+		"the backup is being restored")
+	return nil
+}
+
+func (s *verifyJobSyncer) ensurePodSpec(in core.PodSpec) core.PodSpec {
+	if len(in.InitContainers) == 0 {
+		in.InitContainers = make([]core.Container, 1)
+	}
+	if len(in.Containers) == 0 {
+		in.Containers = make([]core.Container, 1)
+	}
+
+	in.RestartPolicy = core.RestartPolicyNever
+	in.ImagePullSecrets = s.cluster.Spec.PodSpec.ImagePullSecrets
+	in.ServiceAccountName = s.cluster.Spec.PodSpec.ServiceAccountName
+
+	in.Affinity = s.cluster.Spec.PodSpec.BackupAffinity
+	in.NodeSelector = s.cluster.Spec.PodSpec.BackupNodeSelector
+	in.PriorityClassName = s.cluster.Spec.PodSpec.BackupPriorityClassName
+	in.Tolerations = s.cluster.Spec.PodSpec.BackupTolerations
+
+	// mount volumes with mysql gid
+	mysqlUID := int64(999)
+	in.SecurityContext = &core.PodSecurityContext{
+		FSGroup:   &mysqlUID,
+		RunAsUser: &mysqlUID,
+	}
+
+	in.Volumes = []core.Volume{
+		{
+			Name: verifyDataVolumeName,
+			VolumeSource: core.VolumeSource{
+				EmptyDir: &core.EmptyDirVolumeSource{},
+			},
+		},
+	}
+	dataMount := []core.VolumeMount{
+		{
+			Name:      verifyDataVolumeName,
+			MountPath: constants.DataVolumeMountPath,
+		},
+	}
+
+	// the backup is restored by the sidecar into the data volume
+	restore := &in.InitContainers[0]
+	restore.Name = verifyRestoreContainerName
+	restore.Image = s.cluster.GetSidecarImage()
+	restore.ImagePullPolicy = s.opt.ImagePullPolicy
+	restore.Args = []string{"restore-backup"}
+	restore.VolumeMounts = append([]core.VolumeMount{}, dataMount...)
+	restore.Env = s.getRestoreEnv()
+	if enc := s.backup.Spec.Encryption; enc != nil {
+		in.Volumes = append(in.Volumes, encryptionKeysVolume(enc))
+		restore.VolumeMounts = append(restore.VolumeMounts, encryptionKeysVolumeMount())
+	}
+	restore.EnvFrom = nil
+	if len(s.backup.Spec.BackupSecretName) != 0 {
+		restore.EnvFrom = []core.EnvFromSource{
+			{
+				SecretRef: &core.SecretEnvSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: s.backup.Spec.BackupSecretName,
+					},
+				},
+			},
+		}
+	}
+
+	// then MySQL is started on the restored data to run the sanity query
+	verify := &in.Containers[0]
+	verify.Name = verifyContainerName
+	verify.Image = s.cluster.GetMysqlImage()
+	verify.ImagePullPolicy = s.opt.ImagePullPolicy
+	verify.Command = []string{"bash", "-c", verifyScript}
+	verify.VolumeMounts = dataMount
+	verify.Env = []core.EnvVar{
+		{
+			Name:  "VERIFY_QUERY",
+			Value: s.backup.GetVerifyQuery(s.cluster),
+		},
+	}
+
+	return in
+}
+
+// isEncrypted returns true when the backup, or one of its base backups, is encrypted
+func (s *verifyJobSyncer) isEncrypted() bool {
+	if s.backup.Spec.Encryption != nil {
+		return true
+	}
+	for _, b := range s.chain {
+		if len(b.Status.EncryptionKeyID) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *verifyJobSyncer) getRestoreEnv() []core.EnvVar {
+	env := []core.EnvVar{
+		{
+			Name:  "INIT_BUCKET_URI",
+			Value: s.chain[0].Spec.BackupURL,
+		},
+		{
+			Name:  "MY_MYSQL_VERSION",
+			Value: s.cluster.GetMySQLSemVer().String(),
+		},
+	}
+
+	// the backups are verified against the checksums from their status, when recorded
+	checksums := []string{}
+	for _, b := range s.chain {
+		if len(b.Status.SHA256) > 0 {
+			checksums = append(checksums, fmt.Sprintf("%s=%s", b.Spec.BackupURL, b.Status.SHA256))
+		}
+	}
+	if len(checksums) > 0 {
+		env = append(env, core.EnvVar{
+			Name:  "INIT_BUCKET_CHECKSUMS",
+			Value: strings.Join(checksums, " "),
+		})
+	}
+
+	if s.isEncrypted() {
+		env = append(env, core.EnvVar{
+			Name:  "BACKUP_ENCRYPTION_REQUIRED",
+			Value: "true",
+		})
+	}
+
+	if len(s.chain) > 1 {
+		urls := []string{}
+		for _, b := range s.chain[1:] {
+			urls = append(urls, b.Spec.BackupURL)
+		}
+		env = append(env, core.EnvVar{
+			Name:  "INIT_BUCKET_INCREMENTAL_URIS",
+			Value: strings.Join(urls, " "),
+		})
+	}
+
+	if len(s.cluster.Spec.BackupCompressCommand) > 0 && len(s.cluster.Spec.BackupDecompressCommand) > 0 {
+		env = append(env, core.EnvVar{
+			Name:  "BACKUP_DECOMPRESS_COMMAND",
+			Value: strings.Join(s.cluster.Spec.BackupDecompressCommand, " "),
+		})
+	}
+
+	if len(s.cluster.Spec.RcloneExtraArgs) > 0 {
+		env = append(env, core.EnvVar{
+			Name:  "RCLONE_EXTRA_ARGS",
+			Value: strings.Join(s.cluster.Spec.RcloneExtraArgs, " "),
+		})
+	}
+	env = append(env, s.cluster.GetBackupStorageEnv()...)
+
+	if len(s.cluster.Spec.XbstreamExtraArgs) > 0 {
+		env = append(env, core.EnvVar{
+			Name:  "XBSTREAM_EXTRA_ARGS",
+			Value: strings.Join(s.cluster.Spec.XbstreamExtraArgs, " "),
+		})
+	}
+
+	if len(s.cluster.Spec.XtrabackupPrepareExtraArgs) > 0 {
+		env = append(env, core.EnvVar{
+			Name:  "XTRABACKUP_PREPARE_EXTRA_ARGS",
+			Value: strings.Join(s.cluster.Spec.XtrabackupPrepareExtraArgs, " "),
+		})
+	}
+
+	return env
+}
+
+func (s *verifyJobSyncer) updateStatus(job *batch.Job) {
+	completed, failed := getJobStatus(job)
+	if !completed && !failed {
+		return
+	}
+
+	result := s.getVerifyResult(job)
+	if completed {
+		s.backup.UpdateStatusCondition(api.BackupVerified, core.ConditionTrue, "VerificationSucceeded",
+			fmt.Sprintf("sanity query result: %s", result))
+		return
+	}
+
+	message := "the verification job failed"
+	if len(result) > 0 {
+		message = fmt.Sprintf("%s: %s", message, result)
+	}
+	s.backup.UpdateStatusCondition(api.BackupVerified, core.ConditionFalse, "VerificationFailed", message)
+}
+
+// getVerifyResult returns the termination message of the last verify container, which holds
+// the output of the sanity query
+func (s *verifyJobSyncer) getVerifyResult(job *batch.Job) string {
+	pods := &core.PodList{}
+	if err := s.c.List(context.TODO(), pods, client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name}); err != nil {
+		log.Error(err, "failed to list verification pods", "backup", s.backup)
+		return ""
+	}
+
+	var (
+		result   string
+		finished metav1.Time
+	)
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name != verifyContainerName || cs.State.Terminated == nil {
+				continue
+			}
+			if cs.State.Terminated.FinishedAt.Before(&finished) {
+				continue
+			}
+			finished = cs.State.Terminated.FinishedAt
+			result = strings.TrimSpace(cs.State.Terminated.Message)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"fmt"
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/presslabs/controller-util/syncer"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+)
+
+var _ = Describe("MysqlBackup verify job syncer", func() {
+	var (
+		cluster *mysqlcluster.MysqlCluster
+		backup  *mysqlbackup.MysqlBackup
+		vSyncer *verifyJobSyncer
+	)
+
+	BeforeEach(func() {
+		clusterName := fmt.Sprintf("cluster-%d", rand.Int31())
+		name := fmt.Sprintf("backup-%d", rand.Int31())
+		ns := "default"
+
+		cluster = mysqlcluster.New(&api.MysqlCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: ns},
+			Spec: api.MysqlClusterSpec{
+				SecretName:   "a-secret",
+				BackupVerify: true,
+			},
+		})
+
+		backup = mysqlbackup.New(&api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+			Spec: api.MysqlBackupSpec{
+				ClusterName:      clusterName,
+				BackupURL:        "gs://bucket/inc.xbackup.gz",
+				BackupSecretName: "secret",
+				VerifyQuery:      "SELECT COUNT(*) FROM db.t",
+			},
+		})
+
+		vSyncer = &verifyJobSyncer{
+			job:     &batch.Job{},
+			backup:  backup,
+			cluster: cluster,
+			c:       c,
+			opt:     options.GetOptions(),
+		}
+	})
+
+	It("should skip backups that are not verified", func() {
+		cluster.Spec.BackupVerify = false
+		Expect(vSyncer.SyncFn()).To(Equal(syncer.ErrIgnore))
+	})
+
+	It("should skip backups that are not completed", func() {
+		Expect(vSyncer.SyncFn()).To(Equal(syncer.ErrIgnore))
+		Expect(backup.GetBackupCondition(api.BackupVerified)).To(BeNil())
+	})
+
+	It("should restore the whole chain and run the query", func() {
+		full := mysqlbackup.New(&api.MysqlBackup{
+			Spec:   api.MysqlBackupSpec{BackupURL: "gs://bucket/full.xbackup.gz"},
+			Status: api.MysqlBackupStatus{SHA256: "abc"},
+		})
+		vSyncer.chain = []*mysqlbackup.MysqlBackup{full, backup}
+
+		spec := vSyncer.ensurePodSpec(core.PodSpec{})
+		Expect(spec.RestartPolicy).To(Equal(core.RestartPolicyNever))
+
+		Expect(spec.InitContainers).To(HaveLen(1))
+		Expect(spec.InitContainers[0].Args).To(Equal([]string{"restore-backup"}))
+		Expect(spec.InitContainers[0].Env).To(ContainElement(
+			core.EnvVar{Name: "INIT_BUCKET_URI", Value: "gs://bucket/full.xbackup.gz"}))
+		Expect(spec.InitContainers[0].Env).To(ContainElement(
+			core.EnvVar{Name: "INIT_BUCKET_INCREMENTAL_URIS", Value: "gs://bucket/inc.xbackup.gz"}))
+		Expect(spec.InitContainers[0].Env).To(ContainElement(
+			core.EnvVar{Name: "INIT_BUCKET_CHECKSUMS", Value: "gs://bucket/full.xbackup.gz=abc"}))
+		Expect(spec.InitContainers[0].EnvFrom[0].SecretRef.Name).To(Equal("secret"))
+
+		Expect(spec.Containers).To(HaveLen(1))
+		Expect(spec.Containers[0].Image).To(Equal(cluster.GetMysqlImage()))
+		Expect(spec.Containers[0].Env).To(ConsistOf(
+			core.EnvVar{Name: "VERIFY_QUERY", Value: "SELECT COUNT(*) FROM db.t"}))
+	})
+
+	It("should require the encryption when a backup of the chain is encrypted", func() {
+		full := mysqlbackup.New(&api.MysqlBackup{
+			Spec:   api.MysqlBackupSpec{BackupURL: "gs://bucket/full.xbackup.gz"},
+			Status: api.MysqlBackupStatus{EncryptionKeyID: "key-1"},
+		})
+		vSyncer.chain = []*mysqlbackup.MysqlBackup{full, backup}
+
+		spec := vSyncer.ensurePodSpec(core.PodSpec{})
+		Expect(spec.InitContainers[0].Env).To(ContainElement(
+			core.EnvVar{Name: "BACKUP_ENCRYPTION_REQUIRED", Value: "true"}))
+	})
+
+	It("should mark the backup as not verified when the job fails", func() {
+		job := &batch.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: backup.GetNameForVerificationJob(), Namespace: backup.Namespace},
+			Status: batch.JobStatus{
+				Conditions: []batch.JobCondition{
+					{Type: batch.JobFailed, Status: core.ConditionTrue},
+				},
+			},
+		}
+		vSyncer.updateStatus(job)
+
+		cond := backup.GetBackupCondition(api.BackupVerified)
+		Expect(cond).ToNot(BeNil())
+		Expect(cond.Status).To(Equal(core.ConditionFalse))
+		Expect(cond.Reason).To(Equal("VerificationFailed"))
+	})
+})
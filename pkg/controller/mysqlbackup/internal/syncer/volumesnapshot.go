@@ -0,0 +1,347 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/presslabs/controller-util/syncer"
+	core "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+)
+
+const (
+	// VolumeSnapshotCutAnnotation is set on the volume snapshot backups once their snapshot is
+	// known to be cut while the source node was locked
+	VolumeSnapshotCutAnnotation = "backups.mysql.presslabs.org/volume-snapshot-cut"
+	// volumeSnapshotSourceAnnotation is the node whose data volume is snapshotted, recorded on
+	// the snapshot such that its lock is found even if the backup status was not saved
+	volumeSnapshotSourceAnnotation = "backups.mysql.presslabs.org/source-node"
+	// snapshotLockRequestTimeout is the timeout of the requests to the sidecar holding the lock
+	snapshotLockRequestTimeout = 30 * time.Second
+)
+
+// VolumeSnapshotGVK is the kind of the CSI snapshots, which are handled as unstructured objects
+var VolumeSnapshotGVK = schema.GroupVersionKind{
+	Group:   "snapshot.storage.k8s.io",
+	Version: "v1",
+	Kind:    "VolumeSnapshot",
+}
+
+type volumeSnapshotSyncer struct {
+	snapshot *unstructured.Unstructured
+	backup   *mysqlbackup.MysqlBackup
+	cluster  *mysqlcluster.MysqlCluster
+	c        client.Client
+	scheme   *runtime.Scheme
+
+	// requestLock locks, reports or releases the lock held by the sidecar of a node
+	requestLock func(ctx context.Context, method, host, user, password, backup string) (*mysqlbackup.SnapshotLock, error)
+}
+
+// NewVolumeSnapshotSyncer returns a syncer that takes a volume snapshot backup: the sidecar of
+// a node locks it for backup, the GTID set is recorded and a VolumeSnapshot of the node's data
+// volume is created. The node is unlocked, in a later reconciliation, once the snapshot is cut.
+func NewVolumeSnapshotSyncer(c client.Client, s *runtime.Scheme, backup *mysqlbackup.MysqlBackup,
+	cluster *mysqlcluster.MysqlCluster) syncer.Interface {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(VolumeSnapshotGVK)
+	obj.SetName(backup.GetNameForVolumeSnapshot())
+	obj.SetNamespace(backup.Namespace)
+
+	sync := &volumeSnapshotSyncer{
+		snapshot:    obj,
+		backup:      backup,
+		cluster:     cluster,
+		c:           c,
+		scheme:      s,
+		requestLock: mysqlbackup.RequestSnapshotLock,
+	}
+
+	return syncer.NewExternalSyncer("VolumeSnapshot", backup.Unwrap(), obj, sync.sync)
+}
+
+func (s *volumeSnapshotSyncer) sync(ctx context.Context, _ interface{}) (controllerutil.OperationResult, error) {
+	if !s.backup.IsVolumeSnapshot() || s.backup.Status.Completed {
+		return controllerutil.OperationResultNone, nil
+	}
+
+	if s.backup.IsIncremental() {
+		s.fail("IncrementalNotSupported", "volume snapshot backups are always full backups")
+		return controllerutil.OperationResultNone, nil
+	}
+
+	if s.cluster.Spec.VolumeSpec.PersistentVolumeClaim == nil {
+		s.fail("VolumeSnapshotNotSupported", "volume snapshot backups require a cluster with persistent volumes")
+		return controllerutil.OperationResultNone, nil
+	}
+
+	key := types.NamespacedName{Name: s.snapshot.GetName(), Namespace: s.snapshot.GetNamespace()}
+	err := s.c.Get(ctx, key, s.snapshot)
+	if meta.IsNoMatchError(err) {
+		s.fail("VolumeSnapshotNotSupported", "the VolumeSnapshot CRDs are not installed")
+		return controllerutil.OperationResultNone, nil
+	} else if k8serrors.IsNotFound(err) {
+		node, reason, cErr := getBackupCandidate(ctx, s.c, s.cluster, s.backup)
+		if errors.Is(cErr, errNoBackupCandidate) {
+			s.fail(noBackupCandidateReason, cErr.Error())
+			return controllerutil.OperationResultNone, nil
+		} else if cErr != nil {
+			return controllerutil.OperationResultNone, cErr
+		}
+
+		if err = s.takeSnapshot(ctx, node, reason); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		return controllerutil.OperationResultCreated, nil
+	} else if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	if _, cut := s.backup.Annotations[VolumeSnapshotCutAnnotation]; !cut {
+		if cut, err = s.checkSnapshotCut(ctx); err != nil || !cut {
+			return controllerutil.OperationResultNone, err
+		}
+	}
+
+	s.updateStatus()
+	return controllerutil.OperationResultNone, nil
+}
+
+// takeSnapshot locks the backup candidate and creates the snapshot of its data volume. The node
+// is kept locked, by its sidecar, until the snapshot is cut.
+func (s *volumeSnapshotSyncer) takeSnapshot(ctx context.Context, node, reason string) error {
+	podName := mysqlcluster.GetPodNameForHost(node)
+
+	// a lock already held for this backup, e.g. when the snapshot failed to be created, is reused
+	lock, err := s.lockRequest(ctx, http.MethodPost, node)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s for backup: %s", node, err)
+	}
+
+	// the snapshot is taken anew, e.g. if it was removed meanwhile, so its cut is checked again
+	delete(s.backup.Annotations, VolumeSnapshotCutAnnotation)
+
+	start := metav1.NewTime(lock.LockTime)
+	s.backup.Status.StartTime = &start
+	s.backup.Status.SourceNode = node
+	s.backup.Status.SourceNodeReason = reason
+	s.backup.Status.GTIDSet = lock.GTIDSet
+	s.backup.Status.MysqlVersion = lock.Version
+	s.backup.Status.VolumeSnapshotName = s.snapshot.GetName()
+
+	s.snapshot.SetLabels(map[string]string{
+		"cluster": s.backup.Spec.ClusterName,
+		"backup":  s.backup.Name,
+	})
+	s.snapshot.SetAnnotations(map[string]string{
+		volumeSnapshotSourceAnnotation: node,
+	})
+	source := map[string]interface{}{
+		"persistentVolumeClaimName": s.cluster.GetDataVolumeClaimName(podName),
+	}
+	if err = unstructured.SetNestedMap(s.snapshot.Object, source, "spec", "source"); err != nil {
+		s.releaseLock(ctx, node)
+		return err
+	}
+	if len(s.backup.Spec.VolumeSnapshotClassName) > 0 {
+		if err = unstructured.SetNestedField(s.snapshot.Object, s.backup.Spec.VolumeSnapshotClassName,
+			"spec", "volumeSnapshotClassName"); err != nil {
+			s.releaseLock(ctx, node)
+			return err
+		}
+	}
+
+	// the snapshot is removed with the backup only if the remote data should be deleted
+	if s.backup.Spec.RemoteDeletePolicy != api.Retain {
+		if err = controllerutil.SetControllerReference(s.backup.Unwrap(), s.snapshot, s.scheme); err != nil {
+			s.releaseLock(ctx, node)
+			return err
+		}
+	}
+
+	if err = s.c.Create(ctx, s.snapshot); err != nil {
+		s.releaseLock(ctx, node)
+		return fmt.Errorf("failed to create volume snapshot: %s", err)
+	}
+
+	return nil
+}
+
+// checkSnapshotCut unlocks the node once the snapshot is taken by the storage, even if the
+// snapshot is not yet ready to use. The lock is held by the sidecar of the node, which tells
+// whether it was held when the snapshot was cut. A snapshot cut after the lock was released,
+// or lost, is not consistent, so it's removed and the backup fails. Returns true if the
+// snapshot is cut while the node was locked.
+func (s *volumeSnapshotSyncer) checkSnapshotCut(ctx context.Context) (bool, error) {
+	node := s.snapshot.GetAnnotations()[volumeSnapshotSourceAnnotation]
+	if len(node) == 0 {
+		node = s.backup.Status.SourceNode
+	}
+
+	if message, found, _ := unstructured.NestedString(s.snapshot.Object, "status", "error", "message"); found {
+		s.releaseLock(ctx, node)
+		s.failSnapshot(fmt.Sprintf("volume snapshot failed: %s", message))
+		return false, nil
+	}
+
+	var cutTime *time.Time
+	if creationTime, _, _ := unstructured.NestedString(s.snapshot.Object, "status", "creationTime"); len(creationTime) > 0 {
+		if t, err := time.Parse(time.RFC3339, creationTime); err == nil {
+			// the creation time is truncated to seconds, so the snapshot may be cut up to a
+			// second later
+			t = t.Add(time.Second)
+			cutTime = &t
+		}
+	}
+
+	if len(node) == 0 {
+		s.failSnapshot("the node locked for the volume snapshot is not known")
+		return false, nil
+	}
+
+	lock, err := s.lockRequest(ctx, http.MethodGet, node)
+	if errors.Is(err, mysqlbackup.ErrSnapshotLockNotFound) {
+		// the sidecar restarted, so the node was unlocked at an unknown time
+		s.failSnapshot("the lock of the node was lost before the volume snapshot was taken")
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get the lock of %s: %s", node, err)
+	}
+
+	// the status is recorded from the lock in case it was not saved when the snapshot was created
+	s.setStatusFromLock(node, lock)
+
+	if lock.IsLocked() {
+		if cutTime == nil {
+			// wait for the snapshot to be cut
+			return false, nil
+		}
+		if _, err = s.lockRequest(ctx, http.MethodDelete, node); err != nil {
+			return false, fmt.Errorf("failed to unlock %s: %s", node, err)
+		}
+	} else if cutTime == nil || cutTime.After(*lock.ReleaseTime) {
+		s.failSnapshot("the node was unlocked before the volume snapshot was taken")
+		return false, nil
+	}
+
+	if s.backup.Annotations == nil {
+		s.backup.Annotations = map[string]string{}
+	}
+	s.backup.Annotations[VolumeSnapshotCutAnnotation] = "true"
+	return true, nil
+}
+
+// setStatusFromLock records the source node and its GTID set, if missing from the status
+func (s *volumeSnapshotSyncer) setStatusFromLock(node string, lock *mysqlbackup.SnapshotLock) {
+	if len(s.backup.Status.SourceNode) > 0 {
+		return
+	}
+
+	start := metav1.NewTime(lock.LockTime)
+	s.backup.Status.StartTime = &start
+	s.backup.Status.SourceNode = node
+	s.backup.Status.GTIDSet = lock.GTIDSet
+	s.backup.Status.MysqlVersion = lock.Version
+	s.backup.Status.VolumeSnapshotName = s.snapshot.GetName()
+}
+
+// lockRequest calls the sidecar of node for the lock of this backup
+func (s *volumeSnapshotSyncer) lockRequest(ctx context.Context, method, node string) (*mysqlbackup.SnapshotLock, error) {
+	secret := &core.Secret{}
+	key := types.NamespacedName{
+		Name:      s.cluster.GetNameForResource(mysqlcluster.Secret),
+		Namespace: s.cluster.Namespace,
+	}
+	if err := s.c.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("failed to get the backup credentials: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, snapshotLockRequestTimeout)
+	defer cancel()
+
+	return s.requestLock(ctx, method, node, string(secret.Data["BACKUP_USER"]),
+		string(secret.Data["BACKUP_PASSWORD"]), s.backup.Name)
+}
+
+// releaseLock unlocks the node, a failure is only logged since the sidecar releases the lock
+// once it expires
+func (s *volumeSnapshotSyncer) releaseLock(ctx context.Context, node string) {
+	if len(node) == 0 {
+		return
+	}
+	if _, err := s.lockRequest(ctx, http.MethodDelete, node); err != nil &&
+		!errors.Is(err, mysqlbackup.ErrSnapshotLockNotFound) {
+		log.Error(err, "failed to unlock node", "node", node, "backup", s.backup)
+	}
+}
+
+// failSnapshot fails the backup and removes its snapshot, which is not consistent
+func (s *volumeSnapshotSyncer) failSnapshot(message string) {
+	s.fail("VolumeSnapshotFailed", message)
+	if err := s.c.Delete(context.Background(), s.snapshot); err != nil && !k8serrors.IsNotFound(err) {
+		log.Error(err, "failed to delete the volume snapshot", "backup", s.backup)
+	}
+}
+
+func (s *volumeSnapshotSyncer) updateStatus() {
+	if message, found, _ := unstructured.NestedString(s.snapshot.Object, "status", "error", "message"); found {
+		s.fail("VolumeSnapshotFailed", message)
+		return
+	}
+
+	ready, _, _ := unstructured.NestedBool(s.snapshot.Object, "status", "readyToUse")
+	if !ready {
+		return
+	}
+
+	if size, found, _ := unstructured.NestedString(s.snapshot.Object, "status", "restoreSize"); found {
+		if q, err := resource.ParseQuantity(size); err == nil {
+			s.backup.Status.Size = q.Value()
+		}
+	}
+
+	now := metav1.Now()
+	s.backup.Status.Completed = true
+	s.backup.Status.FinishTime = &now
+	s.backup.UpdateStatusCondition(api.BackupComplete, core.ConditionTrue, "VolumeSnapshotReady",
+		fmt.Sprintf("volume snapshot %s is ready to use", s.snapshot.GetName()))
+}
+
+func (s *volumeSnapshotSyncer) fail(reason, message string) {
+	now := metav1.Now()
+	s.backup.Status.Completed = true
+	s.backup.Status.FinishTime = &now
+	s.backup.UpdateStatusCondition(api.BackupFailed, core.ConditionTrue, reason, message)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+)
+
+var _ = Describe("MysqlBackup volume snapshot syncer", func() {
+	var (
+		backup   *mysqlbackup.MysqlBackup
+		sSyncer  *volumeSnapshotSyncer
+		locked   time.Time
+		lock     *mysqlbackup.SnapshotLock
+		lockErr  error
+		requests []string
+	)
+
+	BeforeEach(func() {
+		name := fmt.Sprintf("backup-%d", rand.Int31())
+		ns := "default"
+
+		backup = mysqlbackup.New(&api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+			Spec: api.MysqlBackupSpec{
+				ClusterName: "cluster",
+				Method:      api.VolumeSnapshotMethod,
+			},
+			Status: api.MysqlBackupStatus{
+				SourceNode: "cluster-mysql-0.mysql.default",
+			},
+		})
+
+		locked = time.Now().Add(-time.Hour).Truncate(time.Second)
+		snapshot := &unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+		snapshot.SetName(name)
+		snapshot.SetNamespace(ns)
+		snapshot.SetCreationTimestamp(metav1.NewTime(locked))
+
+		cluster := mysqlcluster.New(&api.MysqlCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: ns},
+		})
+		secret := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: cluster.GetNameForResource(mysqlcluster.Secret), Namespace: ns},
+			Data: map[string][]byte{
+				"BACKUP_USER":     []byte("backup"),
+				"BACKUP_PASSWORD": []byte("pass"),
+			},
+		}
+
+		lock = &mysqlbackup.SnapshotLock{GTIDSet: "uuid:1-10", LockTime: locked}
+		lockErr = nil
+		requests = nil
+
+		sSyncer = &volumeSnapshotSyncer{
+			snapshot: snapshot,
+			backup:   backup,
+			cluster:  cluster,
+			c:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build(),
+			requestLock: func(_ context.Context, method, host, user, password, b string) (*mysqlbackup.SnapshotLock, error) {
+				Expect(host).To(Equal("cluster-mysql-0.mysql.default"))
+				Expect(user).To(Equal("backup"))
+				Expect(password).To(Equal("pass"))
+				Expect(b).To(Equal(name))
+				requests = append(requests, method)
+				if lockErr != nil {
+					return nil, lockErr
+				}
+				if method == http.MethodDelete && lock.IsLocked() {
+					released := time.Now()
+					lock.ReleaseTime = &released
+				}
+				l := *lock
+				return &l, nil
+			},
+		}
+	})
+
+	setCutTime := func(t time.Time) {
+		Expect(unstructured.SetNestedField(sSyncer.snapshot.Object, t.UTC().Format(time.RFC3339),
+			"status", "creationTime")).To(Succeed())
+	}
+
+	release := func(t time.Time) {
+		lock.ReleaseTime = &t
+	}
+
+	It("should wait for the snapshot to be cut while the node is locked", func() {
+		Expect(sSyncer.checkSnapshotCut(context.TODO())).To(BeFalse())
+		Expect(backup.Status.Completed).To(BeFalse())
+		Expect(requests).To(Equal([]string{http.MethodGet}))
+	})
+
+	It("should unlock the node once the snapshot is cut", func() {
+		setCutTime(locked.Add(10 * time.Second))
+		Expect(sSyncer.checkSnapshotCut(context.TODO())).To(BeTrue())
+		Expect(backup.GetBackupCondition(api.BackupFailed)).To(BeNil())
+		Expect(backup.Annotations).To(HaveKey(VolumeSnapshotCutAnnotation))
+		Expect(requests).To(Equal([]string{http.MethodGet, http.MethodDelete}))
+	})
+
+	It("should accept the snapshots cut before the lock was released", func() {
+		setCutTime(locked.Add(10 * time.Second))
+		release(locked.Add(time.Minute))
+		Expect(sSyncer.checkSnapshotCut(context.TODO())).To(BeTrue())
+		Expect(backup.GetBackupCondition(api.BackupFailed)).To(BeNil())
+	})
+
+	It("should fail the snapshots not cut while the node was locked", func() {
+		release(locked.Add(time.Minute))
+		Expect(sSyncer.checkSnapshotCut(context.TODO())).To(BeFalse())
+		Expect(backup.Status.Completed).To(BeTrue())
+		Expect(backup.GetBackupCondition(api.BackupFailed).Status).To(Equal(core.ConditionTrue))
+	})
+
+	It("should fail the snapshots cut after the lock was released", func() {
+		setCutTime(locked.Add(2 * time.Minute))
+		release(locked.Add(time.Minute))
+		Expect(sSyncer.checkSnapshotCut(context.TODO())).To(BeFalse())
+		Expect(backup.GetBackupCondition(api.BackupFailed).Status).To(Equal(core.ConditionTrue))
+	})
+
+	It("should fail the snapshots whose lock was lost", func() {
+		setCutTime(locked.Add(10 * time.Second))
+		lockErr = mysqlbackup.ErrSnapshotLockNotFound
+		Expect(sSyncer.checkSnapshotCut(context.TODO())).To(BeFalse())
+		Expect(backup.GetBackupCondition(api.BackupFailed).Status).To(Equal(core.ConditionTrue))
+	})
+
+	It("should retry when the sidecar can't be reached", func() {
+		setCutTime(locked.Add(10 * time.Second))
+		lockErr = fmt.Errorf("connection refused")
+		_, err := sSyncer.checkSnapshotCut(context.TODO())
+		Expect(err).To(HaveOccurred())
+		Expect(backup.Status.Completed).To(BeFalse())
+	})
+
+	It("should find the locked node from the snapshot", func() {
+		backup.Status.SourceNode = ""
+		sSyncer.snapshot.SetAnnotations(map[string]string{volumeSnapshotSourceAnnotation: "cluster-mysql-0.mysql.default"})
+		setCutTime(locked.Add(10 * time.Second))
+		Expect(sSyncer.checkSnapshotCut(context.TODO())).To(BeTrue())
+		Expect(backup.Status.SourceNode).To(Equal("cluster-mysql-0.mysql.default"))
+		Expect(backup.Status.GTIDSet).To(Equal("uuid:1-10"))
+	})
+
+	It("should fail the snapshots with errors", func() {
+		Expect(unstructured.SetNestedField(sSyncer.snapshot.Object, "out of quota",
+			"status", "error", "message")).To(Succeed())
+		Expect(sSyncer.checkSnapshotCut(context.TODO())).To(BeFalse())
+		Expect(backup.GetBackupCondition(api.BackupFailed).Message).To(ContainSubstring("out of quota"))
+		Expect(requests).To(Equal([]string{http.MethodDelete}))
+	})
+})
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/presslabs/controller-util/syncer"
 	batchv1 "k8s.io/api/batch/v1"
@@ -44,6 +45,15 @@ import (
 
 const (
 	controllerName = "mysqlbackup-controller"
+
+	// volumeSnapshotPollInterval is how often an in progress volume snapshot backup is checked
+	volumeSnapshotPollInterval = 10 * time.Second
+	// volumeSnapshotLockPollInterval is how often a volume snapshot is checked while the node
+	// is locked, waiting for the snapshot to be cut
+	volumeSnapshotLockPollInterval = time.Second
+
+	// progressPollInterval is how often the progress of a running backup is updated
+	progressPollInterval = 30 * time.Second
 )
 
 var log = logf.Log.WithName(controllerName)
@@ -101,7 +111,11 @@ type ReconcileMysqlBackup struct {
 
 // Automatically generate RBAC rules to allow the Controller to read and write Deployments
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps;serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=mysql.presslabs.org,resources=mysqlbackups;mysqlbackups/status;mysqlbackups/finalizers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=mysql.presslabs.org,resources=mysqldatabases,verbs=get;list;watch
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create;delete
 
 // Reconcile reads that state of the cluster for a MysqlBackup object and makes changes based on the state read
 // and what is in the MysqlBackup.Spec
@@ -154,6 +168,10 @@ func (r *ReconcileMysqlBackup) Reconcile(ctx context.Context, request reconcile.
 	syncers := []syncer.Interface{
 		backupSyncer.NewDeleteJobSyncer(r.Client, r.scheme, backup, cluster, r.opt, r.recorder),
 		backupSyncer.NewJobSyncer(r.Client, r.scheme, backup, cluster, r.opt),
+		backupSyncer.NewManifestJobSyncer(r.Client, r.scheme, backup, cluster, r.opt),
+		backupSyncer.NewVerifyJobSyncer(r.Client, r.scheme, backup, cluster, r.opt),
+		backupSyncer.NewPostHookJobSyncer(r.Client, r.scheme, backup, cluster, r.opt),
+		backupSyncer.NewVolumeSnapshotSyncer(r.Client, r.scheme, backup, cluster),
 	}
 
 	if err = r.sync(context.TODO(), syncers); err != nil {
@@ -164,6 +182,20 @@ func (r *ReconcileMysqlBackup) Reconcile(ctx context.Context, request reconcile.
 		return reconcile.Result{}, err
 	}
 
+	// the volume snapshots are not watched, so they are polled until ready, and more often
+	// until cut since the node is locked meanwhile
+	if backup.IsVolumeSnapshot() && !backup.Status.Completed {
+		if _, cut := backup.Annotations[backupSyncer.VolumeSnapshotCutAnnotation]; !cut {
+			return reconcile.Result{RequeueAfter: volumeSnapshotLockPollInterval}, nil
+		}
+		return reconcile.Result{RequeueAfter: volumeSnapshotPollInterval}, nil
+	}
+
+	// the progress of running backups is reported by the source node, so it's polled
+	if !backup.Status.Completed && !backup.IsLogical() {
+		return reconcile.Result{RequeueAfter: progressPollInterval}, nil
+	}
+
 	return reconcile.Result{}, nil
 }
 
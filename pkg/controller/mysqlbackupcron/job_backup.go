@@ -19,14 +19,46 @@ package mysqlbackupcron
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sort"
+	"strings"
 	"time"
 
+	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+)
+
+const (
+	// backupScheduleLabel is the label set on the backups taken by a schedule from BackupSchedules
+	backupScheduleLabel = "schedule"
+
+	// deferredBackupAnnotationPrefix prefixes the annotations set on the cluster while the backup
+	// of a schedule is deferred, e.g. backups.mysql.presslabs.org/deferred-daily. The value is
+	// the time when the backup was deferred.
+	deferredBackupAnnotationPrefix = "backups.mysql.presslabs.org/deferred-"
+)
+
+// the reasons for which a scheduled backup is missed
+const (
+	failoverInProgressReason = "FailoverInProgress"
+	clusterNotReadyReason    = "ClusterNotReady"
+	createFailedReason       = "CreateFailed"
+)
+
+var (
+	// backupDeferTimeout is for how long a scheduled backup is deferred while the cluster is not
+	// healthy, before it's missed
+	backupDeferTimeout = 10 * time.Minute
+	// backupDeferInterval is how often the cluster is checked while the backup is deferred
+	backupDeferInterval = 30 * time.Second
 )
 
 // The job structure contains the context to schedule a backup
@@ -34,11 +66,19 @@ type job struct {
 	ClusterName string
 	Namespace   string
 
+	// ScheduleName is the name of the schedule from BackupSchedules, it's empty for the default
+	// BackupSchedule
+	ScheduleName     string
+	BackupURL        string
+	BackupSecretName string
+
 	// kubernetes client
-	c client.Client
+	c        client.Client
+	recorder record.EventRecorder
 
 	BackupScheduleJobsHistoryLimit *int
 	BackupRemoteDeletePolicy       api.DeletePolicy
+	BackupRetention                *api.BackupRetention
 }
 
 func (j *job) Run() {
@@ -49,8 +89,21 @@ func (j *job) Run() {
 	})
 	log.Info("scheduled backup job started")
 
+	cluster := mysqlcluster.New(&api.MysqlCluster{})
+	key := types.NamespacedName{Name: j.ClusterName, Namespace: j.Namespace}
+	if err := j.c.Get(context.TODO(), key, cluster.Unwrap()); err != nil {
+		log.Error(err, "failed to get cluster")
+		return
+	}
+
+	// the deferred backup is retried by the reconciler, the tick is skipped to not take it twice
+	if _, deferred := cluster.Annotations[j.deferredBackupAnnotation()]; deferred {
+		log.Info("the previous backup of the schedule is deferred", "schedule", j.ScheduleName)
+		return
+	}
+
 	// run garbage collector if needed
-	if j.BackupScheduleJobsHistoryLimit != nil {
+	if j.BackupScheduleJobsHistoryLimit != nil || j.BackupRetention != nil {
 		defer j.backupGC()
 	}
 
@@ -60,10 +113,132 @@ func (j *job) Run() {
 		return
 	}
 
-	// create the backup
+	if reason := getUnhealthyReason(cluster); len(reason) > 0 {
+		log.Info("cluster is not healthy, deferring the backup", "reason", reason, "retry_in", backupDeferInterval)
+		if err := j.deferBackup(cluster); err != nil {
+			log.Error(err, "failed to defer the backup")
+			j.missBackup(cluster, reason, fmt.Sprintf("the cluster was not healthy: %s", reason))
+		}
+		return
+	}
+
+	j.takeBackup(cluster)
+}
+
+// takeBackup creates the backup, which is reported as missed if it can't be created
+func (j *job) takeBackup(cluster *mysqlcluster.MysqlCluster) {
 	if _, err := j.createBackup(); err != nil {
-		log.Error(err, "failed to create backup")
+		log.Error(err, "failed to create backup", "key", cluster.GetNamespacedName())
+		j.missBackup(cluster, createFailedReason, fmt.Sprintf("failed to create backup: %s", err))
+	}
+}
+
+// retryDeferredBackup takes the deferred backup of the schedule once the cluster is healthy, or
+// misses it after backupDeferTimeout. It's called by the reconciler, which retries it after
+// backupDeferInterval while it returns true.
+func (j *job) retryDeferredBackup(cluster *mysqlcluster.MysqlCluster) (bool, error) {
+	value, deferred := cluster.Annotations[j.deferredBackupAnnotation()]
+	if !deferred {
+		return false, nil
+	}
+
+	reason := getUnhealthyReason(cluster)
+	since, err := time.Parse(time.RFC3339, value)
+	if len(reason) > 0 && err == nil && time.Since(since) < backupDeferTimeout {
+		return true, nil
+	}
+
+	// the annotation is removed first, such that the backup is not taken twice
+	if err := removeDeferredBackupAnnotations(j.c, cluster, j.deferredBackupAnnotation()); err != nil {
+		return false, err
+	}
+
+	if len(reason) > 0 {
+		j.missBackup(cluster, reason, fmt.Sprintf("the cluster was not healthy for %s: %s", backupDeferTimeout, reason))
+		return false, nil
+	}
+
+	log.Info("cluster is healthy, taking the deferred backup", "key", cluster.GetNamespacedName(), "schedule", j.ScheduleName)
+	j.takeBackup(cluster)
+	if j.BackupScheduleJobsHistoryLimit != nil || j.BackupRetention != nil {
+		j.backupGC()
+	}
+
+	return false, nil
+}
+
+// deferBackup records on the cluster that the backup of the schedule is deferred
+func (j *job) deferBackup(cluster *mysqlcluster.MysqlCluster) error {
+	patch := client.MergeFrom(cluster.Unwrap().DeepCopy())
+	if cluster.Annotations == nil {
+		cluster.Annotations = map[string]string{}
+	}
+	cluster.Annotations[j.deferredBackupAnnotation()] = time.Now().Format(time.RFC3339)
+	return j.c.Patch(context.TODO(), cluster.Unwrap(), patch)
+}
+
+// deferredBackupAnnotation returns the annotation set on the cluster while the backup of the
+// schedule is deferred
+func (j *job) deferredBackupAnnotation() string {
+	return deferredBackupAnnotationPrefix + j.scheduleName()
+}
+
+// removeDeferredBackupAnnotations removes the given deferred backup annotations from the cluster
+func removeDeferredBackupAnnotations(c client.Client, cluster *mysqlcluster.MysqlCluster, annotations ...string) error {
+	patch := client.MergeFrom(cluster.Unwrap().DeepCopy())
+	for _, annotation := range annotations {
+		delete(cluster.Annotations, annotation)
+	}
+	return c.Patch(context.TODO(), cluster.Unwrap(), patch)
+}
+
+// staleDeferredBackupAnnotations returns the deferred backup annotations of the cluster that
+// don't belong to any of the given jobs, e.g. of the schedules that were removed
+func staleDeferredBackupAnnotations(cluster *mysqlcluster.MysqlCluster, jobs []scheduledJob) []string {
+	current := map[string]bool{}
+	for _, sj := range jobs {
+		current[sj.job.deferredBackupAnnotation()] = true
+	}
+
+	stale := []string{}
+	for annotation := range cluster.Annotations {
+		if strings.HasPrefix(annotation, deferredBackupAnnotationPrefix) && !current[annotation] {
+			stale = append(stale, annotation)
+		}
 	}
+	return stale
+}
+
+// getUnhealthyReason returns the reason for which backups should not be taken from the
+// cluster, or an empty string if they can be taken
+func getUnhealthyReason(cluster *mysqlcluster.MysqlCluster) string {
+	fip := cluster.GetClusterCondition(api.ClusterConditionFailoverInProgress)
+	if fip != nil && fip.Status == core.ConditionTrue {
+		return failoverInProgressReason
+	}
+
+	if !cluster.IsClusterReady() {
+		return clusterNotReadyReason
+	}
+
+	return ""
+}
+
+// missBackup reports a scheduled backup that was not taken, with an event on the cluster and
+// the missed backups metric
+func (j *job) missBackup(cluster *mysqlcluster.MysqlCluster, reason, message string) {
+	schedule := j.scheduleName()
+	missedBackups.WithLabelValues(j.Namespace, j.ClusterName, schedule, reason).Inc()
+	j.recorder.Eventf(cluster.Unwrap(), core.EventTypeWarning, "BackupMissed",
+		"the %s scheduled backup was missed, %s", schedule, message)
+}
+
+// scheduleName returns the name of the schedule, default for the default BackupSchedule
+func (j *job) scheduleName() string {
+	if len(j.ScheduleName) == 0 {
+		return "default"
+	}
+	return j.ScheduleName
 }
 
 func (j *job) scheduledBackupsRunningCount() int {
@@ -81,7 +256,11 @@ func (j *job) scheduledBackupsRunningCount() int {
 }
 
 func (j *job) createBackup() (*api.MysqlBackup, error) {
-	backupName := fmt.Sprintf("%s-auto-%s", j.ClusterName, time.Now().Format("2006-01-02t15-04-05"))
+	prefix := j.ClusterName
+	if len(j.ScheduleName) > 0 {
+		prefix = fmt.Sprintf("%s-%s", j.ClusterName, j.ScheduleName)
+	}
+	backupName := fmt.Sprintf("%s-auto-%s", prefix, time.Now().Format("2006-01-02t15-04-05"))
 
 	backup := &api.MysqlBackup{
 		ObjectMeta: metav1.ObjectMeta{
@@ -91,6 +270,8 @@ func (j *job) createBackup() (*api.MysqlBackup, error) {
 		},
 		Spec: api.MysqlBackupSpec{
 			ClusterName:        j.ClusterName,
+			BackupURL:          j.BackupURL,
+			BackupSecretName:   j.BackupSecretName,
 			RemoteDeletePolicy: j.BackupRemoteDeletePolicy,
 		},
 	}
@@ -101,16 +282,30 @@ func (j *job) backupSelector() *client.ListOptions {
 	selector := &client.ListOptions{}
 
 	client.InNamespace(j.Namespace).ApplyToList(selector)
-	client.MatchingLabels(j.recurrentBackupLabels()).ApplyToList(selector)
+
+	labelSelector := labels.SelectorFromSet(j.recurrentBackupLabels())
+	if len(j.ScheduleName) == 0 {
+		// the backups of the other schedules are not accounted to the default one
+		req, err := labels.NewRequirement(backupScheduleLabel, selection.DoesNotExist, nil)
+		if err != nil {
+			panic(err)
+		}
+		labelSelector = labelSelector.Add(*req)
+	}
+	selector.LabelSelector = labelSelector
 
 	return selector
 }
 
 func (j *job) recurrentBackupLabels() map[string]string {
-	return map[string]string{
+	l := map[string]string{
 		"recurrent": "true",
 		"cluster":   j.ClusterName,
 	}
+	if len(j.ScheduleName) > 0 {
+		l[backupScheduleLabel] = j.ScheduleName
+	}
+	return l
 }
 
 func (j *job) backupGC() {
@@ -124,6 +319,11 @@ func (j *job) backupGC() {
 	// sort backups by creation time before removing extra backups
 	sort.Sort(byTimestamp(backupsList.Items))
 
+	if j.BackupRetention != nil {
+		j.retentionGC(backupsList.Items)
+		return
+	}
+
 	for i, backup := range backupsList.Items {
 		if i >= *j.BackupScheduleJobsHistoryLimit {
 			// delete the backup
@@ -134,6 +334,48 @@ func (j *job) backupGC() {
 	}
 }
 
+// retentionGC deletes the backups that are not kept by the retention policy and labels the
+// remaining ones with the tiers they satisfy
+func (j *job) retentionGC(backups []api.MysqlBackup) {
+	retained := retainedBackups(backups, j.BackupRetention, time.Now())
+
+	for i := range backups {
+		backup := &backups[i]
+		tiers, keep := retained[backup.Name]
+		if !keep {
+			if err := j.c.Delete(context.TODO(), backup); err != nil {
+				log.Error(err, "failed to delete a backup", "backup", backup)
+			}
+			continue
+		}
+
+		if err := j.updateTierLabels(backup, tiers); err != nil {
+			log.Error(err, "failed to update backup retention labels", "backup", backup)
+		}
+	}
+}
+
+func (j *job) updateTierLabels(backup *api.MysqlBackup, tiers []string) error {
+	tierLabels := map[string]string{}
+	for k, v := range backup.Labels {
+		tierLabels[k] = v
+	}
+	for _, tier := range backupTiers {
+		delete(tierLabels, backupTierLabel(tier.name))
+	}
+	for _, tier := range tiers {
+		tierLabels[backupTierLabel(tier)] = "true"
+	}
+
+	if reflect.DeepEqual(tierLabels, backup.Labels) {
+		return nil
+	}
+
+	patch := client.MergeFrom(backup.DeepCopy())
+	backup.Labels = tierLabels
+	return j.c.Patch(context.TODO(), backup, patch)
+}
+
 type byTimestamp []api.MysqlBackup
 
 func (a byTimestamp) Len() int      { return len(a) }
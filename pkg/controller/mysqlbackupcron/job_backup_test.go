@@ -25,14 +25,18 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
 	"github.com/bitpoke/mysql-operator/pkg/controller/internal/testutil"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
 )
 
 const timeout = time.Second * 2
@@ -67,6 +71,7 @@ var _ = Describe("MysqlBackupCron cron job", func() {
 			ClusterName:                    clusterName,
 			Namespace:                      namespace,
 			c:                              c,
+			recorder:                       record.NewFakeRecorder(10),
 			BackupScheduleJobsHistoryLimit: &limit,
 		}
 	})
@@ -150,4 +155,122 @@ var _ = Describe("MysqlBackupCron cron job", func() {
 			Eventually(j.scheduledBackupsRunningCount).Should(Equal(0))
 		})
 	})
+
+	When("the cluster is not healthy", func() {
+		var (
+			cluster  *api.MysqlCluster
+			recorder *record.FakeRecorder
+		)
+
+		getCluster := func() *mysqlcluster.MysqlCluster {
+			cl := mysqlcluster.New(&api.MysqlCluster{})
+			Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(cluster), cl.Unwrap())).To(Succeed())
+			return cl
+		}
+
+		BeforeEach(func() {
+			cluster = &api.MysqlCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace},
+				Spec:       api.MysqlClusterSpec{SecretName: "the-secret"},
+			}
+			Expect(c.Create(context.TODO(), cluster)).To(Succeed())
+
+			recorder = record.NewFakeRecorder(10)
+			j.recorder = recorder
+		})
+
+		AfterEach(func() {
+			c.DeleteAllOf(context.TODO(), &api.MysqlBackup{}, client.InNamespace(namespace),
+				client.MatchingLabels{"cluster": clusterName})
+			c.Delete(context.TODO(), cluster)
+		})
+
+		It("should defer the backup", func() {
+			j.Run()
+
+			Eventually(func() map[string]string {
+				return getCluster().Annotations
+			}, timeout).Should(HaveKey(deferredBackupAnnotationPrefix + "default"))
+			Expect(j.scheduledBackupsRunningCount()).To(Equal(0))
+			Expect(recorder.Events).ToNot(Receive())
+
+			// the next tick doesn't take the deferred backup
+			Eventually(func() bool {
+				cl := getCluster()
+				cl.Status.Conditions = []api.ClusterCondition{{
+					Type:               api.ClusterConditionReady,
+					Status:             core.ConditionTrue,
+					LastTransitionTime: metav1.Now(),
+				}}
+				return c.Status().Update(context.TODO(), cl.Unwrap()) == nil
+			}, timeout).Should(BeTrue())
+			j.Run()
+			Consistently(j.scheduledBackupsRunningCount).Should(Equal(0))
+		})
+
+		It("should miss the deferred backup after the timeout and report it", func() {
+			missed := missedBackups.WithLabelValues(namespace, clusterName, "default", clusterNotReadyReason)
+			before := promtestutil.ToFloat64(missed)
+
+			cl := getCluster()
+			Expect(j.deferBackup(cl)).To(Succeed())
+			cl.Annotations[j.deferredBackupAnnotation()] = time.Now().Add(-backupDeferTimeout).Format(time.RFC3339)
+
+			deferred, err := j.retryDeferredBackup(cl)
+			Expect(err).To(Succeed())
+			Expect(deferred).To(BeFalse())
+
+			Expect(recorder.Events).To(Receive(ContainSubstring("BackupMissed")))
+			Expect(promtestutil.ToFloat64(missed)).To(Equal(before + 1))
+			Expect(j.scheduledBackupsRunningCount()).To(Equal(0))
+			Eventually(func() map[string]string {
+				return getCluster().Annotations
+			}, timeout).ShouldNot(HaveKey(j.deferredBackupAnnotation()))
+		})
+
+		It("should keep the backup deferred while the cluster is not healthy", func() {
+			cl := getCluster()
+			Expect(j.deferBackup(cl)).To(Succeed())
+
+			deferred, err := j.retryDeferredBackup(cl)
+			Expect(err).To(Succeed())
+			Expect(deferred).To(BeTrue())
+			Expect(recorder.Events).ToNot(Receive())
+		})
+
+		It("should take the deferred backup once the cluster is ready", func() {
+			cl := getCluster()
+			Expect(j.deferBackup(cl)).To(Succeed())
+
+			cl.Status.Conditions = []api.ClusterCondition{{
+				Type:               api.ClusterConditionReady,
+				Status:             core.ConditionTrue,
+				LastTransitionTime: metav1.Now(),
+			}}
+			deferred, err := j.retryDeferredBackup(cl)
+			Expect(err).To(Succeed())
+			Expect(deferred).To(BeFalse())
+
+			Eventually(j.scheduledBackupsRunningCount).Should(Equal(1))
+			Expect(recorder.Events).ToNot(Receive())
+			Eventually(func() map[string]string {
+				return getCluster().Annotations
+			}, timeout).ShouldNot(HaveKey(j.deferredBackupAnnotation()))
+		})
+
+		It("should drop the deferred backups of the removed schedules", func() {
+			cl := mysqlcluster.New(&api.MysqlCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						deferredBackupAnnotationPrefix + "default": "2021-01-02T10:00:00Z",
+						deferredBackupAnnotationPrefix + "daily":   "2021-01-02T10:00:00Z",
+						"other":                                    "value",
+					},
+				},
+			})
+
+			Expect(staleDeferredBackupAnnotations(cl, []scheduledJob{{job: j}})).To(
+				ConsistOf(deferredBackupAnnotationPrefix + "daily"))
+		})
+	})
 })
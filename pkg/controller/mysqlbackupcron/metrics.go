@@ -0,0 +1,37 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlbackupcron
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// missedBackups counts the scheduled backups that were not taken, served with the metrics of
+// the controller manager
+var missedBackups = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mysql_operator",
+		Name:      "missed_scheduled_backups_total",
+		Help:      "The number of scheduled backups that were not taken, by cluster, schedule and reason.",
+	},
+	[]string{"namespace", "cluster", "schedule", "reason"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(missedBackups)
+}
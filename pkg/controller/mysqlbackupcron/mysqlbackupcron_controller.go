@@ -36,6 +36,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	mysqlv1alpha1 "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
 	"github.com/bitpoke/mysql-operator/pkg/options"
 )
 
@@ -134,73 +135,132 @@ func (r *ReconcileMysqlBackup) Reconcile(ctx context.Context, request reconcile.
 		return reconcile.Result{}, err
 	}
 
-	// if Spec.BackupSchedule is not set, here are two cases:
-	// 	1. change to empty string, call unregisterCluster, it will remove the cron job
-	// 	2. remain empty string, call unregisterCluster, it will do nothing
-	if len(cluster.Spec.BackupSchedule) == 0 {
-		r.unregisterCluster(request.NamespacedName)
-		return reconcile.Result{}, nil
+	jobs := []scheduledJob{}
+
+	// if Spec.BackupSchedule is not set the default schedule is not registered, and it's
+	// removed from cron if it was registered before
+	if len(cluster.Spec.BackupSchedule) > 0 {
+		schedule, err := defaultParser.Parse(cluster.Spec.BackupSchedule)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to parse schedule: %s", err)
+		}
+
+		jobs = append(jobs, scheduledJob{
+			schedule: schedule,
+			job: &job{
+				ClusterName:                    cluster.Name,
+				Namespace:                      cluster.Namespace,
+				c:                              r.Client,
+				recorder:                       r.recorder,
+				BackupScheduleJobsHistoryLimit: cluster.Spec.BackupScheduleJobsHistoryLimit,
+				BackupRemoteDeletePolicy:       cluster.Spec.BackupRemoteDeletePolicy,
+				BackupRetention:                cluster.Spec.BackupRetention,
+			},
+		})
 	}
 
-	schedule, err := defaultParser.Parse(cluster.Spec.BackupSchedule)
-	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to parse schedule: %s", err)
+	for _, bs := range cluster.Spec.BackupSchedules {
+		schedule, err := defaultParser.Parse(bs.Schedule)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to parse schedule %q: %s", bs.Name, err)
+		}
+
+		jobs = append(jobs, scheduledJob{
+			schedule: schedule,
+			job: &job{
+				ClusterName:                    cluster.Name,
+				Namespace:                      cluster.Namespace,
+				c:                              r.Client,
+				recorder:                       r.recorder,
+				ScheduleName:                   bs.Name,
+				BackupURL:                      bs.BackupURL,
+				BackupSecretName:               bs.BackupSecretName,
+				BackupScheduleJobsHistoryLimit: bs.JobsHistoryLimit,
+				BackupRemoteDeletePolicy:       bs.RemoteDeletePolicy,
+				BackupRetention:                bs.Retention,
+			},
+		})
+	}
+
+	log.V(1).Info("register cluster in cronjob", "key", cluster, "schedules", len(jobs))
+
+	r.updateClusterSchedules(request.NamespacedName, jobs)
+
+	return r.retryDeferredBackups(mysqlcluster.New(cluster), jobs)
+}
+
+// retryDeferredBackups retries the deferred backups of the cluster, and requeues the cluster
+// while any of them is still deferred. The deferred backups of removed schedules are dropped.
+func (r *ReconcileMysqlBackup) retryDeferredBackups(cluster *mysqlcluster.MysqlCluster, jobs []scheduledJob) (reconcile.Result, error) {
+	if stale := staleDeferredBackupAnnotations(cluster, jobs); len(stale) > 0 {
+		log.Info("drop the deferred backups of removed schedules", "key", cluster.GetNamespacedName(), "annotations", stale)
+		if err := removeDeferredBackupAnnotations(r.Client, cluster, stale...); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	result := reconcile.Result{}
+	for _, sj := range jobs {
+		deferred, err := sj.job.retryDeferredBackup(cluster)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if deferred {
+			result.RequeueAfter = backupDeferInterval
+		}
 	}
 
-	log.V(1).Info("register cluster in cronjob", "key", cluster, "schedule", schedule)
+	return result, nil
+}
 
-	r.updateClusterSchedule(cluster, schedule)
-	return reconcile.Result{}, nil
+// scheduledJob is a backup job together with the schedule to run it at
+type scheduledJob struct {
+	schedule cron.Schedule
+	job      *job
 }
 
-// updateClusterSchedule creates/updates a cron job for specified cluster.
-func (r *ReconcileMysqlBackup) updateClusterSchedule(cluster *mysqlv1alpha1.MysqlCluster, schedule cron.Schedule) {
+// updateClusterSchedules creates/updates the cron jobs of the specified cluster, one for each
+// schedule, and removes the cron jobs of the schedules that no longer exist.
+func (r *ReconcileMysqlBackup) updateClusterSchedules(clusterKey types.NamespacedName, jobs []scheduledJob) {
 	r.lockJobRegister.Lock()
 	defer r.lockJobRegister.Unlock()
 
+	registered := map[string]bool{}
 	for _, entry := range r.cron.Entries() {
 		j, ok := entry.Job.(*job)
-		if ok && j.ClusterName == cluster.Name && j.Namespace == cluster.Namespace {
-
-			log.V(1).Info("cluster already added to cron.", "key", cluster)
-
-			// change scheduler for already added crons
-			if !reflect.DeepEqual(entry.Schedule, schedule) {
-				log.Info("update cluster scheduler", "key", cluster, "scheduler", cluster.Spec.BackupSchedule)
-				r.cron.Remove(entry.ID)
-				break
-			}
+		if !ok || j.ClusterName != clusterKey.Name || j.Namespace != clusterKey.Namespace {
+			continue
+		}
 
-			// update backups limit for already added crons
-			if !reflect.DeepEqual(cluster.Spec.BackupScheduleJobsHistoryLimit, j.BackupScheduleJobsHistoryLimit) {
-				newValFmt := "inf"
-				if cluster.Spec.BackupScheduleJobsHistoryLimit != nil {
-					newValFmt = fmt.Sprintf("%d", cluster.Spec.BackupScheduleJobsHistoryLimit)
-				}
-				log.Info("update cluster backup limit", "key", cluster, "limit_val", newValFmt)
-				r.cron.Remove(entry.ID)
-				break
+		keep := false
+		for _, sj := range jobs {
+			if sj.job.ScheduleName != j.ScheduleName {
+				continue
 			}
 
-			// update backup remote delete policy for already added crons
-			if !reflect.DeepEqual(cluster.Spec.BackupRemoteDeletePolicy, j.BackupRemoteDeletePolicy) {
-				log.Info("update cluster backup remote delete policy", "key", cluster, "policy", cluster.Spec.BackupRemoteDeletePolicy)
-				r.cron.Remove(entry.ID)
-				break
+			// the job holds the settings of the schedule, so any change of the schedule or of the
+			// settings re-registers it
+			if reflect.DeepEqual(entry.Schedule, sj.schedule) && reflect.DeepEqual(j, sj.job) && !registered[j.ScheduleName] {
+				keep = true
 			}
+			break
+		}
 
-			// nothing to change for this cluster, return
-			return
+		if !keep {
+			log.Info("update cluster scheduler", "key", clusterKey, "schedule", j.ScheduleName)
+			r.cron.Remove(entry.ID)
+			continue
 		}
+
+		log.V(1).Info("cluster already added to cron.", "key", clusterKey, "schedule", j.ScheduleName)
+		registered[j.ScheduleName] = true
 	}
 
-	r.cron.Schedule(schedule, &job{
-		ClusterName:                    cluster.Name,
-		Namespace:                      cluster.Namespace,
-		c:                              r.Client,
-		BackupScheduleJobsHistoryLimit: cluster.Spec.BackupScheduleJobsHistoryLimit,
-		BackupRemoteDeletePolicy:       cluster.Spec.BackupRemoteDeletePolicy,
-	})
+	for _, sj := range jobs {
+		if !registered[sj.job.ScheduleName] {
+			r.cron.Schedule(sj.schedule, sj.job)
+		}
+	}
 }
 
 func (r *ReconcileMysqlBackup) unregisterCluster(clusterKey types.NamespacedName) {
@@ -224,6 +224,38 @@ var _ = Describe("MysqlBackupCron controller", func() {
 			Expect(cron.Entries()).To(HaveLen(1))
 		})
 
+		It("should register an entry for each backup schedule", func() {
+			cluster.Spec.BackupSchedules = []api.BackupSchedule{
+				{Name: "hourly", Schedule: "0 0 * * * *", BackupURL: "s3://minio/backups"},
+				{Name: "daily", Schedule: "0 0 0 * * *", BackupURL: "gs://offsite/", BackupSecretName: "offsite"},
+			}
+			Expect(c.Update(context.TODO(), cluster)).To(Succeed())
+			Eventually(requests, timeout).Should(Receive(Equal(expectedRequest)))
+
+			Expect(cron.Entries()).To(HaveLen(3))
+			Expect(cron.Entries()).To(haveCronJob(cluster.Name, schedule))
+			Expect(cron.Entries()).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"Job": PointTo(MatchFields(IgnoreExtras, Fields{
+					"ClusterName":      Equal(cluster.Name),
+					"ScheduleName":     Equal("daily"),
+					"BackupURL":        Equal("gs://offsite/"),
+					"BackupSecretName": Equal("offsite"),
+				})),
+			})))
+
+			// removing a schedule keeps the others
+			cluster.Spec.BackupSchedules = cluster.Spec.BackupSchedules[:1]
+			Expect(c.Update(context.TODO(), cluster)).To(Succeed())
+			Eventually(requests, timeout).Should(Receive(Equal(expectedRequest)))
+
+			Expect(cron.Entries()).To(HaveLen(2))
+			Expect(cron.Entries()).ToNot(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"Job": PointTo(MatchFields(IgnoreExtras, Fields{
+					"ScheduleName": Equal("daily"),
+				})),
+			})))
+		})
+
 		When("backup is executed once per second", func() {
 			var (
 				timeout = 5 * time.Second
@@ -0,0 +1,153 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlbackupcron
+
+import (
+	"fmt"
+	"time"
+
+	core "k8s.io/api/core/v1"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+)
+
+// backupTierLabelPrefix is the prefix of the labels set on the backups kept by a retention tier,
+// e.g. backups.mysql.presslabs.org/daily=true
+const backupTierLabelPrefix = "backups.mysql.presslabs.org/"
+
+// backupTier is a tier of a grandfather-father-son retention policy
+type backupTier struct {
+	name string
+	// count returns how many periods of this tier are kept
+	count func(r *api.BackupRetention) int32
+	// period returns the period of this tier in which the time falls
+	period func(t time.Time) string
+}
+
+var backupTiers = []backupTier{
+	{
+		name:   "hourly",
+		count:  func(r *api.BackupRetention) int32 { return r.Hourly },
+		period: func(t time.Time) string { return t.Format("2006-01-02T15") },
+	},
+	{
+		name:   "daily",
+		count:  func(r *api.BackupRetention) int32 { return r.Daily },
+		period: func(t time.Time) string { return t.Format("2006-01-02") },
+	},
+	{
+		name:  "weekly",
+		count: func(r *api.BackupRetention) int32 { return r.Weekly },
+		period: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%d", year, week)
+		},
+	},
+	{
+		name:   "monthly",
+		count:  func(r *api.BackupRetention) int32 { return r.Monthly },
+		period: func(t time.Time) string { return t.Format("2006-01") },
+	},
+}
+
+func backupTierLabel(tier string) string {
+	return backupTierLabelPrefix + tier
+}
+
+// retainedBackups returns the backups to keep, by name, together with the tiers they satisfy. The
+// backups must be sorted from the newest to the oldest. Only successful backups satisfy tiers,
+// the backups which are still running and the failures newer than the latest successful backup
+// are kept as well, as the base backups of the kept incremental backups, which are needed to
+// restore them.
+func retainedBackups(backups []api.MysqlBackup, r *api.BackupRetention, now time.Time) map[string][]string {
+	retained := map[string][]string{}
+
+	succeeded := []*api.MysqlBackup{}
+	for i := range backups {
+		backup := &backups[i]
+		created := backup.CreationTimestamp.Time
+
+		if r.KeepWithin != nil && created.After(now.Add(-r.KeepWithin.Duration)) {
+			retained[backup.Name] = []string{}
+		}
+
+		switch {
+		case !backup.Status.Completed:
+			retained[backup.Name] = []string{}
+		case isBackupSucceeded(backup):
+			succeeded = append(succeeded, backup)
+		case len(succeeded) == 0:
+			// keep the latest failures for inspection
+			retained[backup.Name] = []string{}
+		}
+	}
+
+	for _, tier := range backupTiers {
+		count := tier.count(r)
+		lastPeriod := ""
+		for _, backup := range succeeded {
+			if count <= 0 {
+				break
+			}
+
+			period := tier.period(backup.CreationTimestamp.UTC())
+			if period == lastPeriod {
+				continue
+			}
+
+			// the newest backup of the period is kept
+			retained[backup.Name] = append(retained[backup.Name], tier.name)
+			lastPeriod = period
+			count--
+		}
+	}
+
+	keepBaseBackups(backups, retained)
+
+	return retained
+}
+
+// keepBaseBackups adds to the retained backups the whole chain of base backups of each retained
+// incremental backup
+func keepBaseBackups(backups []api.MysqlBackup, retained map[string][]string) {
+	byName := map[string]*api.MysqlBackup{}
+	for i := range backups {
+		byName[backups[i].Name] = &backups[i]
+	}
+
+	for name := range retained {
+		backup := byName[name]
+		// stop at the first base which is already retained, its chain is kept by it
+		for backup != nil && backup.Spec.BaseBackupName != "" {
+			base := backup.Spec.BaseBackupName
+			if _, ok := retained[base]; ok {
+				break
+			}
+			retained[base] = []string{}
+			backup = byName[base]
+		}
+	}
+}
+
+func isBackupSucceeded(backup *api.MysqlBackup) bool {
+	for _, cond := range backup.Status.Conditions {
+		if cond.Type == api.BackupComplete {
+			return cond.Status == core.ConditionTrue
+		}
+	}
+	return false
+}
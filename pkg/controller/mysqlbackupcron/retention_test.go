@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlbackupcron
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+)
+
+var _ = Describe("MysqlBackupCron retention policy", func() {
+	var (
+		now     time.Time
+		backups []api.MysqlBackup
+	)
+
+	newBackup := func(age time.Duration, completed bool, status core.ConditionStatus) api.MysqlBackup {
+		backup := api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              fmt.Sprintf("bk-%s", age),
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+			},
+		}
+		backup.Status.Completed = completed
+		if completed {
+			backup.Status.Conditions = []api.BackupCondition{
+				{Type: api.BackupComplete, Status: status},
+			}
+		}
+		return backup
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2021, 3, 15, 12, 30, 0, 0, time.UTC)
+
+		// a successful backup every 6 hours, for 60 days, newest first
+		backups = []api.MysqlBackup{}
+		for age := time.Duration(0); age < 60*24*time.Hour; age += 6 * time.Hour {
+			backups = append(backups, newBackup(age, true, core.ConditionTrue))
+		}
+	})
+
+	It("should keep the newest backup of each period", func() {
+		retained := retainedBackups(backups, &api.BackupRetention{
+			Hourly:  2,
+			Daily:   3,
+			Weekly:  2,
+			Monthly: 2,
+		}, now)
+
+		Expect(retained).To(HaveKeyWithValue("bk-0s", ConsistOf("hourly", "daily", "weekly", "monthly")))
+		Expect(retained).To(HaveKeyWithValue("bk-6h0m0s", ConsistOf("hourly")))
+		// the newest backup of the previous day and of the previous week, on Sunday 14 March
+		Expect(retained).To(HaveKeyWithValue("bk-18h0m0s", ConsistOf("daily", "weekly")))
+		Expect(retained).To(HaveKeyWithValue("bk-42h0m0s", ConsistOf("daily")))
+		// the newest backup of February, on the 28th at 18:30
+		Expect(retained).To(HaveKeyWithValue("bk-354h0m0s", ConsistOf("monthly")))
+		Expect(retained).To(HaveLen(5))
+	})
+
+	It("should keep the backups within the given duration", func() {
+		retained := retainedBackups(backups, &api.BackupRetention{
+			KeepWithin: &metav1.Duration{Duration: 25 * time.Hour},
+		}, now)
+
+		Expect(retained).To(HaveLen(5))
+		Expect(retained).To(HaveKeyWithValue("bk-24h0m0s", BeEmpty()))
+	})
+
+	It("should keep running backups and the latest failures", func() {
+		backups = append([]api.MysqlBackup{
+			newBackup(-2*time.Hour, false, ""),
+			newBackup(-time.Hour, true, core.ConditionFalse),
+		}, backups...)
+		backups = append(backups, newBackup(90*24*time.Hour, true, core.ConditionFalse))
+
+		retained := retainedBackups(backups, &api.BackupRetention{Daily: 1}, now)
+
+		Expect(retained).To(HaveKey("bk--2h0m0s"))
+		Expect(retained).To(HaveKey("bk--1h0m0s"))
+		Expect(retained).To(HaveKeyWithValue("bk-0s", ConsistOf("daily")))
+		Expect(retained).To(HaveLen(3))
+	})
+
+	It("should keep the base backups of the retained incremental backups", func() {
+		// backups[i] is taken i*6 hours ago
+		backups[7].Spec.BaseBackupName = "bk-66h0m0s"
+		backups[11].Spec.BaseBackupName = "bk-186h0m0s"
+		// an incremental backup which is not retained
+		backups[1].Spec.BaseBackupName = "bk-66h0m0s"
+
+		retained := retainedBackups(backups, &api.BackupRetention{
+			Daily:  3,
+			Weekly: 3,
+		}, now)
+
+		Expect(retained).To(HaveKeyWithValue("bk-42h0m0s", ConsistOf("daily")))
+		Expect(retained).To(HaveKeyWithValue("bk-66h0m0s", BeEmpty()))
+		// the newest backup of the week before, on Sunday 7 March
+		Expect(retained).To(HaveKeyWithValue("bk-186h0m0s", ConsistOf("weekly")))
+		Expect(retained).ToNot(HaveKey("bk-6h0m0s"))
+		Expect(retained).To(HaveLen(5))
+	})
+})
@@ -0,0 +1,494 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlcluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/imdario/mergo"
+	"github.com/presslabs/controller-util/mergo/transformers"
+	"github.com/presslabs/controller-util/syncer"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+)
+
+const (
+	// backupCatalogSchedule is how often the bucket is listed for backups to import
+	backupCatalogSchedule = "@hourly"
+
+	// backupCatalogContainerName is the name of the container that lists the bucket
+	backupCatalogContainerName = "catalog"
+
+	// ImportedBackupLabel is the label set on the backups imported from the bucket
+	ImportedBackupLabel = "backups.mysql.presslabs.org/imported"
+
+	// backupCatalogJobLabel is set on the catalog jobs, which are annotated with it once imported
+	backupCatalogJobLabel = "backups.mysql.presslabs.org/catalog"
+)
+
+// NewBackupCatalogSyncer returns the syncer for the cron job that lists the backups from the
+// bucket of the cluster into the catalog config map
+func NewBackupCatalogSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster,
+	opt *options.Options) syncer.Interface {
+	cronJob := &batch.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetNameForResource(mysqlcluster.BackupCatalogCronJob),
+			Namespace: cluster.Namespace,
+		},
+	}
+
+	return syncer.NewObjectSyncer("BackupCatalogCronJob", cluster.Unwrap(), cronJob, c, func() error {
+		cronJob.Labels = map[string]string{
+			"cluster": cluster.Name,
+		}
+
+		historyLimit := int32(1)
+		cronJob.Spec.Schedule = backupCatalogSchedule
+		cronJob.Spec.ConcurrencyPolicy = batch.ForbidConcurrent
+		cronJob.Spec.SuccessfulJobsHistoryLimit = &historyLimit
+		cronJob.Spec.FailedJobsHistoryLimit = &historyLimit
+		cronJob.Spec.JobTemplate.Labels = backupCatalogJobLabels(cluster)
+
+		return mergo.Merge(&cronJob.Spec.JobTemplate.Spec.Template.Spec, ensureBackupCatalogPodSpec(cluster, opt),
+			mergo.WithTransformers(transformers.PodSpec))
+	})
+}
+
+// NewBackupCatalogConfigMapSyncer returns the syncer for the config map in which the catalog job
+// writes the backups found in the bucket. The data is written only by the job.
+func NewBackupCatalogConfigMapSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster) syncer.Interface {
+	cm := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetNameForResource(mysqlcluster.BackupCatalogConfigMap),
+			Namespace: cluster.Namespace,
+		},
+	}
+
+	return syncer.NewObjectSyncer("BackupCatalogConfigMap", cluster.Unwrap(), cm, c, func() error {
+		cm.Labels = map[string]string{
+			"cluster": cluster.Name,
+		}
+		return nil
+	})
+}
+
+// NewBackupCatalogRoleSyncer returns the syncer for the role that allows the catalog job to
+// write only the catalog config map
+func NewBackupCatalogRoleSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster) syncer.Interface {
+	role := &rbac.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetNameForResource(mysqlcluster.BackupCatalogRole),
+			Namespace: cluster.Namespace,
+		},
+	}
+
+	return syncer.NewObjectSyncer("BackupCatalogRole", cluster.Unwrap(), role, c, func() error {
+		role.Labels = map[string]string{
+			"cluster": cluster.Name,
+		}
+		role.Rules = []rbac.PolicyRule{
+			{
+				APIGroups:     []string{""},
+				Resources:     []string{"configmaps"},
+				ResourceNames: []string{cluster.GetNameForResource(mysqlcluster.BackupCatalogConfigMap)},
+				Verbs:         []string{"get", "patch"},
+			},
+		}
+		return nil
+	})
+}
+
+// NewBackupCatalogServiceAccountSyncer returns the syncer for the service account of the catalog
+// job, used when the cluster has none
+func NewBackupCatalogServiceAccountSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster) syncer.Interface {
+	sa := &core.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetNameForResource(mysqlcluster.BackupCatalogServiceAccount),
+			Namespace: cluster.Namespace,
+		},
+	}
+
+	return syncer.NewObjectSyncer("BackupCatalogServiceAccount", cluster.Unwrap(), sa, c, func() error {
+		sa.Labels = map[string]string{
+			"cluster": cluster.Name,
+		}
+		return nil
+	})
+}
+
+// NewBackupCatalogRoleBindingSyncer returns the syncer that binds the catalog role to the service
+// account of the catalog job
+func NewBackupCatalogRoleBindingSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster) syncer.Interface {
+	binding := &rbac.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetNameForResource(mysqlcluster.BackupCatalogRole),
+			Namespace: cluster.Namespace,
+		},
+	}
+
+	return syncer.NewObjectSyncer("BackupCatalogRoleBinding", cluster.Unwrap(), binding, c, func() error {
+		binding.Labels = map[string]string{
+			"cluster": cluster.Name,
+		}
+
+		// the role of a binding can't be changed, but it's always the same
+		binding.RoleRef = rbac.RoleRef{
+			APIGroup: rbac.GroupName,
+			Kind:     "Role",
+			Name:     cluster.GetNameForResource(mysqlcluster.BackupCatalogRole),
+		}
+		binding.Subjects = []rbac.Subject{
+			{
+				Kind:      rbac.ServiceAccountKind,
+				Name:      backupCatalogServiceAccount(cluster),
+				Namespace: cluster.Namespace,
+			},
+		}
+		return nil
+	})
+}
+
+// NewBackupCatalogCleanupSyncer returns the syncer that removes the catalog resources that are not
+// used: all of them when the catalog sync is disabled, and the service account of the catalog job
+// when the cluster has one
+func NewBackupCatalogCleanupSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster) syncer.Interface {
+	cleaner := &backupCatalogCleaner{c: c, cluster: cluster}
+	return syncer.NewExternalSyncer("BackupCatalogCleanup", cluster.Unwrap(), nil, cleaner.sync)
+}
+
+type backupCatalogCleaner struct {
+	c       client.Client
+	cluster *mysqlcluster.MysqlCluster
+}
+
+func (s *backupCatalogCleaner) sync(ctx context.Context, _ interface{}) (controllerutil.OperationResult, error) {
+	objects := []client.Object{}
+	if backupCatalogServiceAccount(s.cluster) != s.cluster.GetNameForResource(mysqlcluster.BackupCatalogServiceAccount) {
+		objects = append(objects, &core.ServiceAccount{})
+	}
+	if !isBackupCatalogEnabled(s.cluster) {
+		objects = append(objects, &batch.CronJob{}, &rbac.RoleBinding{}, &rbac.Role{}, &core.ConfigMap{})
+	}
+
+	// all the catalog resources have the same name
+	key := client.ObjectKey{
+		Name:      s.cluster.GetNameForResource(mysqlcluster.BackupCatalogCronJob),
+		Namespace: s.cluster.Namespace,
+	}
+	background := metav1.DeletePropagationBackground
+
+	result := controllerutil.OperationResultNone
+	for _, obj := range objects {
+		if err := s.c.Get(ctx, key, obj); apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return result, err
+		}
+
+		// the jobs of the cron job are removed along with it
+		if err := s.c.Delete(ctx, obj, &client.DeleteOptions{PropagationPolicy: &background}); err != nil &&
+			!apierrors.IsNotFound(err) {
+			return result, err
+		}
+		result = controllerutil.OperationResultUpdated
+	}
+
+	return result, nil
+}
+
+// isBackupCatalogEnabled returns true if the backups from the bucket of the cluster are imported
+func isBackupCatalogEnabled(cluster *mysqlcluster.MysqlCluster) bool {
+	return cluster.Spec.BackupCatalogSync && len(cluster.Spec.BackupURL) > 0
+}
+
+// backupCatalogServiceAccount returns the service account of the catalog job, the one of the
+// cluster to keep the access to the bucket, or a dedicated one
+func backupCatalogServiceAccount(cluster *mysqlcluster.MysqlCluster) string {
+	if sa := cluster.Spec.PodSpec.ServiceAccountName; len(sa) > 0 {
+		return sa
+	}
+	return cluster.GetNameForResource(mysqlcluster.BackupCatalogServiceAccount)
+}
+
+func backupCatalogJobLabels(cluster *mysqlcluster.MysqlCluster) map[string]string {
+	return map[string]string{
+		"cluster":             cluster.Name,
+		backupCatalogJobLabel: "true",
+	}
+}
+
+func ensureBackupCatalogPodSpec(cluster *mysqlcluster.MysqlCluster, opt *options.Options) core.PodSpec {
+	container := core.Container{
+		Name:            backupCatalogContainerName,
+		Image:           cluster.GetSidecarImage(),
+		ImagePullPolicy: opt.ImagePullPolicy,
+		Args: []string{
+			"list-backups",
+			cluster.Spec.BackupURL,
+			cluster.GetNameForResource(mysqlcluster.BackupCatalogConfigMap),
+		},
+		Env: []core.EnvVar{
+			{
+				Name: "MY_NAMESPACE",
+				ValueFrom: &core.EnvVarSource{
+					FieldRef: &core.ObjectFieldSelector{
+						APIVersion: "v1",
+						FieldPath:  "metadata.namespace",
+					},
+				},
+			},
+		},
+	}
+
+	if len(cluster.Spec.RcloneExtraArgs) > 0 {
+		container.Env = append(container.Env, core.EnvVar{
+			Name:  "RCLONE_EXTRA_ARGS",
+			Value: strings.Join(cluster.Spec.RcloneExtraArgs, " "),
+		})
+	}
+	container.Env = append(container.Env, cluster.GetBackupStorageEnv()...)
+
+	if len(cluster.Spec.BackupSecretName) > 0 {
+		container.EnvFrom = []core.EnvFromSource{
+			{
+				SecretRef: &core.SecretEnvSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: cluster.Spec.BackupSecretName,
+					},
+				},
+			},
+		}
+	}
+
+	return core.PodSpec{
+		RestartPolicy:      core.RestartPolicyNever,
+		Containers:         []core.Container{container},
+		ImagePullSecrets:   cluster.Spec.PodSpec.ImagePullSecrets,
+		ServiceAccountName: backupCatalogServiceAccount(cluster),
+	}
+}
+
+// NewBackupCatalogImportSyncer returns the syncer that creates MysqlBackups for the backups
+// listed by the completed catalog jobs
+func NewBackupCatalogImportSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster) syncer.Interface {
+	importer := &backupCatalogImporter{c: c, cluster: cluster}
+	return syncer.NewExternalSyncer("BackupCatalogImport", cluster.Unwrap(), nil, importer.sync)
+}
+
+type backupCatalogImporter struct {
+	c       client.Client
+	cluster *mysqlcluster.MysqlCluster
+}
+
+func (s *backupCatalogImporter) sync(ctx context.Context, _ interface{}) (controllerutil.OperationResult, error) {
+	jobs := &batch.JobList{}
+	if err := s.c.List(ctx, jobs, client.InNamespace(s.cluster.Namespace),
+		client.MatchingLabels(backupCatalogJobLabels(s.cluster))); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	result := controllerutil.OperationResultNone
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Status.Succeeded == 0 || job.Annotations[backupCatalogJobLabel] == "imported" {
+			continue
+		}
+
+		catalog, err := s.getCatalog(ctx)
+		if err != nil {
+			return result, err
+		}
+
+		count, err := s.importCatalog(ctx, catalog)
+		if err != nil {
+			return result, err
+		}
+		if count > 0 {
+			log.Info("imported backups from the catalog", "key", s.cluster.GetNamespacedName(), "count", count)
+			result = controllerutil.OperationResultUpdated
+		}
+
+		// mark the job as imported to not process it again
+		patch := client.MergeFrom(job.DeepCopy())
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		job.Annotations[backupCatalogJobLabel] = "imported"
+		if err = s.c.Patch(ctx, job, patch); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// getCatalog returns the catalog written by the job in the catalog config map
+func (s *backupCatalogImporter) getCatalog(ctx context.Context) (*mysqlbackup.Catalog, error) {
+	cm := &core.ConfigMap{}
+	key := client.ObjectKey{
+		Name:      s.cluster.GetNameForResource(mysqlcluster.BackupCatalogConfigMap),
+		Namespace: s.cluster.Namespace,
+	}
+	if err := s.c.Get(ctx, key, cm); err != nil {
+		return nil, err
+	}
+
+	data, ok := cm.Data[mysqlbackup.CatalogConfigMapKey]
+	if !ok {
+		// nothing was listed yet
+		return &mysqlbackup.Catalog{}, nil
+	}
+
+	return mysqlbackup.ParseCatalog(data)
+}
+
+// importCatalog creates a completed MysqlBackup for each backup from the catalog that is not
+// known in the namespace. The backups are listed oldest first such that the base of an
+// incremental backup is imported before it.
+func (s *backupCatalogImporter) importCatalog(ctx context.Context, catalog *mysqlbackup.Catalog) (int, error) {
+	existing := &api.MysqlBackupList{}
+	if err := s.c.List(ctx, existing, client.InNamespace(s.cluster.Namespace)); err != nil {
+		return 0, err
+	}
+
+	known := map[string]bool{}
+	backups := []api.MysqlBackup{}
+	for _, backup := range existing.Items {
+		known[backup.Name] = true
+		if backup.Spec.ClusterName == s.cluster.Name {
+			backups = append(backups, backup)
+		}
+	}
+
+	count := 0
+	for _, entry := range catalog.Entries {
+		if name, _ := mysqlbackup.ParseBackupFileName(entry.Name); known[name] {
+			continue
+		}
+
+		backup := newImportedBackup(s.cluster, entry, backups)
+		if backup == nil {
+			continue
+		}
+
+		err := s.c.Create(ctx, backup)
+		if apierrors.IsAlreadyExists(err) {
+			continue
+		} else if err != nil {
+			return count, err
+		}
+
+		known[backup.Name] = true
+		backups = append(backups, *backup)
+		count++
+	}
+
+	return count, nil
+}
+
+// newImportedBackup returns the completed MysqlBackup of a backup found in the bucket, or nil if
+// the name of the backup is not a valid resource name
+func newImportedBackup(cluster *mysqlcluster.MysqlCluster, entry mysqlbackup.CatalogEntry,
+	backups []api.MysqlBackup) *api.MysqlBackup {
+	name, logical := mysqlbackup.ParseBackupFileName(entry.Name)
+	if errs := validation.IsDNS1123Subdomain(name); len(name) == 0 || len(errs) > 0 {
+		log.Info("skip importing backup with invalid name", "key", cluster.GetNamespacedName(), "file", entry.Name)
+		return nil
+	}
+
+	finishTime := metav1.NewTime(entry.ModTime)
+	backup := mysqlbackup.New(&api.MysqlBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cluster.Namespace,
+			Labels:    importedBackupLabels(cluster, name),
+		},
+		Spec: api.MysqlBackupSpec{
+			ClusterName:      cluster.Name,
+			BackupURL:        fmt.Sprintf("%s/%s", strings.TrimSuffix(cluster.Spec.BackupURL, "/"), entry.Name),
+			BackupSecretName: cluster.Spec.BackupSecretName,
+		},
+		Status: api.MysqlBackupStatus{
+			Completed:  true,
+			FinishTime: &finishTime,
+		},
+	})
+
+	if logical {
+		backup.Spec.Type = api.LogicalBackup
+	}
+
+	if entry.Manifest != nil {
+		backup.UpdateStatusFromManifest(entry.Manifest)
+
+		// the base of an incremental backup is the one that ends where it starts
+		if entry.Manifest.FromLSN > 0 {
+			backup.Spec.Type = api.IncrementalBackup
+			for _, base := range backups {
+				if base.Status.ToLSN == entry.Manifest.FromLSN {
+					backup.Spec.BaseBackupName = base.Name
+				}
+			}
+		}
+	}
+
+	if backup.Status.Size == 0 {
+		backup.Status.Size = entry.Size
+	}
+
+	backup.UpdateStatusCondition(api.BackupComplete, core.ConditionTrue, "Imported",
+		fmt.Sprintf("imported from %s", backup.Spec.BackupURL))
+
+	return backup.Unwrap()
+}
+
+// importedBackupLabels returns the labels of an imported backup. The backups taken by a schedule
+// are labeled as such to be garbage collected along with the other backups of the schedule.
+func importedBackupLabels(cluster *mysqlcluster.MysqlCluster, name string) map[string]string {
+	labels := map[string]string{
+		"cluster":           cluster.Name,
+		ImportedBackupLabel: "true",
+	}
+
+	for _, bs := range cluster.Spec.BackupSchedules {
+		if strings.HasPrefix(name, fmt.Sprintf("%s-%s-auto-", cluster.Name, bs.Name)) {
+			labels["recurrent"] = "true"
+			labels["schedule"] = bs.Name
+			return labels
+		}
+	}
+
+	if strings.HasPrefix(name, fmt.Sprintf("%s-auto-", cluster.Name)) {
+		labels["recurrent"] = "true"
+	}
+
+	return labels
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlcluster
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/controller/internal/testutil"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+)
+
+var _ = Describe("Backup catalog syncer", func() {
+	var (
+		cluster *mysqlcluster.MysqlCluster
+		t0      = time.Date(2021, 1, 2, 10, 0, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		cluster = mysqlcluster.New(&api.MysqlCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "cl", Namespace: "default"},
+			Spec: api.MysqlClusterSpec{
+				BackupURL:         "gs://bucket/prefix/",
+				BackupSecretName:  "backup-secret",
+				BackupCatalogSync: true,
+				BackupSchedules: []api.BackupSchedule{
+					{Name: "daily", Schedule: "0 0 0 * * *"},
+				},
+			},
+		})
+	})
+
+	It("should label the imported backups", func() {
+		Expect(importedBackupLabels(cluster, "manual")).To(Equal(map[string]string{
+			"cluster":           "cl",
+			ImportedBackupLabel: "true",
+		}))
+		Expect(importedBackupLabels(cluster, "cl-auto-2021-01-02")).To(HaveKeyWithValue("recurrent", "true"))
+		Expect(importedBackupLabels(cluster, "cl-auto-2021-01-02")).ToNot(HaveKey("schedule"))
+		Expect(importedBackupLabels(cluster, "cl-daily-auto-2021-01-02")).To(HaveKeyWithValue("schedule", "daily"))
+	})
+
+	It("should import a backup as completed", func() {
+		backup := newImportedBackup(cluster, mysqlbackup.CatalogEntry{
+			Name:    "cl-auto-2021-01-02.xbackup.gz",
+			Size:    1024,
+			ModTime: t0,
+		}, nil)
+
+		Expect(backup).ToNot(BeNil())
+		Expect(backup.Name).To(Equal("cl-auto-2021-01-02"))
+		Expect(backup.Spec.ClusterName).To(Equal("cl"))
+		Expect(backup.Spec.BackupURL).To(Equal("gs://bucket/prefix/cl-auto-2021-01-02.xbackup.gz"))
+		Expect(backup.Spec.BackupSecretName).To(Equal("backup-secret"))
+		Expect(backup.Status.Completed).To(BeTrue())
+		Expect(backup.Status.Size).To(Equal(int64(1024)))
+		Expect(backup.Status.FinishTime.Time).To(Equal(t0))
+		Expect(backup).To(testutil.BackupHaveCondition(api.BackupComplete, core.ConditionTrue))
+	})
+
+	It("should import logical and incremental backups", func() {
+		logical := newImportedBackup(cluster, mysqlbackup.CatalogEntry{Name: "dump.logical", ModTime: t0}, nil)
+		Expect(logical.Spec.Type).To(Equal(api.LogicalBackup))
+
+		base := api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "base"},
+			Status:     api.MysqlBackupStatus{ToLSN: 42},
+		}
+		incremental := newImportedBackup(cluster, mysqlbackup.CatalogEntry{
+			Name:     "next.xbackup.gz",
+			ModTime:  t0,
+			Manifest: &mysqlbackup.Manifest{FromLSN: 42, ToLSN: 84},
+		}, []api.MysqlBackup{base})
+		Expect(incremental.Spec.Type).To(Equal(api.IncrementalBackup))
+		Expect(incremental.Spec.BaseBackupName).To(Equal("base"))
+		Expect(incremental.Status.ToLSN).To(Equal(int64(84)))
+	})
+
+	It("should skip backups with invalid names", func() {
+		Expect(newImportedBackup(cluster, mysqlbackup.CatalogEntry{Name: "Invalid_Name.xbackup.gz"}, nil)).To(BeNil())
+	})
+
+	It("should import from the catalog config map only the unknown backups", func() {
+		catalog := &mysqlbackup.Catalog{
+			Entries: []mysqlbackup.CatalogEntry{
+				{Name: "known.xbackup.gz", ModTime: t0},
+				{Name: "new.xbackup.gz", ModTime: t0.Add(time.Hour)},
+			},
+		}
+		data, err := catalog.Encode()
+		Expect(err).ToNot(HaveOccurred())
+
+		fc := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&core.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      cluster.GetNameForResource(mysqlcluster.BackupCatalogConfigMap),
+					Namespace: cluster.Namespace,
+				},
+				Data: map[string]string{mysqlbackup.CatalogConfigMapKey: string(data)},
+			},
+			&api.MysqlBackup{
+				ObjectMeta: metav1.ObjectMeta{Name: "known", Namespace: cluster.Namespace},
+				Spec:       api.MysqlBackupSpec{ClusterName: "other"},
+			},
+		).Build()
+		importer := &backupCatalogImporter{c: fc, cluster: cluster}
+
+		listed, err := importer.getCatalog(context.TODO())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(listed.Entries).To(HaveLen(2))
+
+		count, err := importer.importCatalog(context.TODO(), listed)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(count).To(Equal(1))
+
+		known := &api.MysqlBackup{}
+		Expect(fc.Get(context.TODO(), client.ObjectKey{Name: "known", Namespace: cluster.Namespace}, known)).To(Succeed())
+		Expect(known.Spec.ClusterName).To(Equal("other"))
+
+		imported := &api.MysqlBackup{}
+		Expect(fc.Get(context.TODO(), client.ObjectKey{Name: "new", Namespace: cluster.Namespace}, imported)).To(Succeed())
+		Expect(imported.Labels).To(HaveKeyWithValue(ImportedBackupLabel, "true"))
+	})
+
+	It("should run the catalog job with a dedicated service account unless the cluster has one", func() {
+		podSpec := ensureBackupCatalogPodSpec(cluster, options.GetOptions())
+		Expect(podSpec.ServiceAccountName).To(Equal("cl-mysql-backup-catalog"))
+
+		cluster.Spec.PodSpec.ServiceAccountName = "workload-identity"
+		podSpec = ensureBackupCatalogPodSpec(cluster, options.GetOptions())
+		Expect(podSpec.ServiceAccountName).To(Equal("workload-identity"))
+	})
+
+	It("should remove the catalog resources that are not used", func() {
+		meta := metav1.ObjectMeta{
+			Name:      cluster.GetNameForResource(mysqlcluster.BackupCatalogCronJob),
+			Namespace: cluster.Namespace,
+		}
+		fc := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&batch.CronJob{ObjectMeta: meta},
+			&core.ConfigMap{ObjectMeta: meta},
+			&rbac.Role{ObjectMeta: meta},
+			&rbac.RoleBinding{ObjectMeta: meta},
+			&core.ServiceAccount{ObjectMeta: meta},
+		).Build()
+		cleaner := &backupCatalogCleaner{c: fc, cluster: cluster}
+		key := client.ObjectKeyFromObject(&core.ConfigMap{ObjectMeta: meta})
+
+		Expect(cleaner.sync(context.TODO(), nil)).To(Equal(controllerutil.OperationResultNone))
+		Expect(fc.Get(context.TODO(), key, &core.ServiceAccount{})).To(Succeed())
+
+		// the service account of the cluster is used instead
+		cluster.Spec.PodSpec.ServiceAccountName = "workload-identity"
+		Expect(cleaner.sync(context.TODO(), nil)).To(Equal(controllerutil.OperationResultUpdated))
+		Expect(apierrors.IsNotFound(fc.Get(context.TODO(), key, &core.ServiceAccount{}))).To(BeTrue())
+		Expect(fc.Get(context.TODO(), key, &batch.CronJob{})).To(Succeed())
+
+		cluster.Spec.BackupCatalogSync = false
+		Expect(cleaner.sync(context.TODO(), nil)).To(Equal(controllerutil.OperationResultUpdated))
+		Expect(apierrors.IsNotFound(fc.Get(context.TODO(), key, &batch.CronJob{}))).To(BeTrue())
+		Expect(apierrors.IsNotFound(fc.Get(context.TODO(), key, &core.ConfigMap{}))).To(BeTrue())
+		Expect(apierrors.IsNotFound(fc.Get(context.TODO(), key, &rbac.Role{}))).To(BeTrue())
+		Expect(apierrors.IsNotFound(fc.Get(context.TODO(), key, &rbac.RoleBinding{}))).To(BeTrue())
+	})
+})
@@ -0,0 +1,126 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlcluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/imdario/mergo"
+	"github.com/presslabs/controller-util/mergo/transformers"
+	"github.com/presslabs/controller-util/syncer"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+)
+
+// backupTrashPurgeSchedule is how often the trash is checked for expired backups
+const backupTrashPurgeSchedule = "@hourly"
+
+// NewBackupTrashPurgeSyncer returns the syncer for the cron job that purges the soft deleted
+// backups of the cluster once their retention period is over
+func NewBackupTrashPurgeSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster,
+	opt *options.Options) syncer.Interface {
+	cronJob := &batch.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetNameForResource(mysqlcluster.BackupTrashPurgeCronJob),
+			Namespace: cluster.Namespace,
+		},
+	}
+
+	return syncer.NewObjectSyncer("BackupTrashPurgeCronJob", cluster.Unwrap(), cronJob, c, func() error {
+		cronJob.Labels = map[string]string{
+			"cluster": cluster.Name,
+		}
+
+		historyLimit := int32(1)
+		cronJob.Spec.Schedule = backupTrashPurgeSchedule
+		cronJob.Spec.ConcurrencyPolicy = batch.ForbidConcurrent
+		cronJob.Spec.SuccessfulJobsHistoryLimit = &historyLimit
+		cronJob.Spec.FailedJobsHistoryLimit = &historyLimit
+
+		return mergo.Merge(&cronJob.Spec.JobTemplate.Spec.Template.Spec, ensureTrashPurgePodSpec(cluster, opt),
+			mergo.WithTransformers(transformers.PodSpec))
+	})
+}
+
+func ensureTrashPurgePodSpec(cluster *mysqlcluster.MysqlCluster, opt *options.Options) core.PodSpec {
+	containers := []core.Container{}
+	for i, trash := range cluster.GetBackupTrashes() {
+		containers = append(containers, trashPurgeContainer(cluster, i, trash, opt))
+	}
+
+	return core.PodSpec{
+		RestartPolicy:      core.RestartPolicyNever,
+		Containers:         containers,
+		ImagePullSecrets:   cluster.Spec.PodSpec.ImagePullSecrets,
+		ServiceAccountName: cluster.Spec.PodSpec.ServiceAccountName,
+	}
+}
+
+// trashPurgeContainer returns the container that purges the given trash, the trashes of the
+// backup schedules are purged by containers named after the schedule and the other trashes, from
+// the cluster status, by containers named after their index
+func trashPurgeContainer(cluster *mysqlcluster.MysqlCluster, index int, trash mysqlcluster.BackupTrash,
+	opt *options.Options) core.Container {
+	name := "purge"
+	if len(trash.Schedule) > 0 {
+		name = fmt.Sprintf("purge-%s", trash.Schedule)
+	} else if index > 0 {
+		name = fmt.Sprintf("purge-trash-%d", index)
+	}
+
+	container := core.Container{
+		Name:            name,
+		Image:           cluster.GetSidecarImage(),
+		ImagePullPolicy: opt.ImagePullPolicy,
+		Args: []string{
+			"purge-trash",
+			trash.URL,
+			cluster.GetBackupTrashRetention().String(),
+		},
+	}
+
+	if len(cluster.Spec.RcloneExtraArgs) > 0 {
+		container.Env = []core.EnvVar{
+			{
+				Name:  "RCLONE_EXTRA_ARGS",
+				Value: strings.Join(cluster.Spec.RcloneExtraArgs, " "),
+			},
+		}
+	}
+	container.Env = append(container.Env, cluster.GetBackupStorageEnv()...)
+
+	if len(trash.SecretName) > 0 {
+		container.EnvFrom = []core.EnvFromSource{
+			{
+				SecretRef: &core.SecretEnvSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: trash.SecretName,
+					},
+				},
+			},
+		}
+	}
+
+	return container
+}
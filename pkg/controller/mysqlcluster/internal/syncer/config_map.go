@@ -20,7 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
-	"strings"
+	"strconv"
 
 	"github.com/go-ini/ini"
 	core "k8s.io/api/core/v1"
@@ -56,45 +56,14 @@ func NewConfigMapSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlc
 			"my.cnf": data,
 		}
 
-		if cluster.Spec.PodSpec.MysqlLifecycle == nil {
-			cm.Data[shPreStopFile] = buildBashPreStop()
-		}
-
 		return nil
 	})
 }
 
-func buildBashPreStop() string {
-	data := `#!/bin/bash
-set -ex
-
-current=$(date "+%Y-%m-%d %H:%M:%S")
-echo "[${current}]preStop is ongoing"
-read_only_status=$(mysql --defaults-file=ConfClientPathHolder -NB -e 'SELECT @@read_only')
-replica_status=$(mysql --defaults-file=ConfClientPathHolder -NB -e 'show slave status\G')
-# orchestrator will isolate old master during failover
-has_replica_hosts=$(mysql --defaults-file=ConfClientPathHolder -NB -e 'show slave hosts\G')
-replica_status_count=$(echo -n "$replica_status" | wc -l )
-has_replica_count=$(echo -n "$has_replica_hosts" | wc -l )
-echo "hostname=$(hostname) readonly=${read_only_status} show_slave_status=${replica_status_count}"
-echo "has_replica_hosts=${has_replica_count}"
-if [ ${read_only_status} -eq 0  ] && [ ${replica_status_count} -eq 0 ] && [ ${has_replica_count} -gt 0 ]
-then
-		masterhostname=$( curl  -s "${ORCH_HTTP_API}/master/${ORCH_CLUSTER_ALIAS}" |  awk -F":" '{print $3}' | awk -F'"' '{print $2}' )
-        echo "master from orchestrator: ${masterhostname}"
-        if [ "${MY_FQDN}" == "${masterhostname}" ]
-        then
-                curl  -s "${ORCH_HTTP_API}/graceful-master-takeover-auto/${ORCH_CLUSTER_ALIAS}"
-				echo "graceful-master-takeover-auto is ongoing, sleep 5 seconds in order to make sure service can work well."
-				sleep 5
-        fi
-fi
-`
-	return strings.Replace(data, "ConfClientPathHolder", confClientPath, -1)
-}
-
 func buildMysqlConfData(cluster *mysqlcluster.MysqlCluster) (string, error) {
-	cfg := ini.Empty()
+	// don't quote the values that contain `;`, like the plugins list, MySQL reads the quotes
+	// as part of the value
+	cfg := ini.Empty(ini.LoadOptions{IgnoreInlineComment: true})
 	sec := cfg.Section("mysqld")
 
 	if cluster.GetMySQLSemVer().Major == 5 {
@@ -105,8 +74,9 @@ func buildMysqlConfData(cluster *mysqlcluster.MysqlCluster) (string, error) {
 
 	// boolean configs
 	addBConfigsToSection(sec, mysqlMasterSlaveBooleanConfigs)
-	// add custom configs, would overwrite common configs
-	addKVConfigsToSection(sec, convertMapToKVConfig(mysqlCommonConfigs), cluster.Spec.MysqlConf)
+	// add custom configs, would overwrite common and semi-sync configs
+	addKVConfigsToSection(sec, convertMapToKVConfig(mysqlCommonConfigs), getSemiSyncConfigs(cluster),
+		getBinlogArchiveConfigs(cluster), cluster.Spec.MysqlConf)
 
 	// include configs from /etc/mysql/conf.d/*.cnf
 	_, err := sec.NewBooleanKey(fmt.Sprintf("!includedir %s", ConfDPath))
@@ -123,6 +93,37 @@ func buildMysqlConfData(cluster *mysqlcluster.MysqlCluster) (string, error) {
 
 }
 
+// getBinlogArchiveConfigs returns the configs that disable the binlogs expiration when the
+// binlogs are archived, the sidecar purges them once they are uploaded
+func getBinlogArchiveConfigs(cluster *mysqlcluster.MysqlCluster) map[string]intstr.IntOrString {
+	if !cluster.IsBinlogArchiveEnabled() {
+		return nil
+	}
+
+	if cluster.GetMySQLSemVer().Major == 5 {
+		return map[string]intstr.IntOrString{"expire-logs-days": intstr.FromString("0")}
+	}
+	return map[string]intstr.IntOrString{"binlog_expire_logs_seconds": intstr.FromString("0")}
+}
+
+// getSemiSyncConfigs returns the configs that load and enable the semi-sync plugins. Both sides
+// are enabled on all nodes, the node controller disables the side that doesn't match the role
+// of the node.
+func getSemiSyncConfigs(cluster *mysqlcluster.MysqlCluster) map[string]intstr.IntOrString {
+	if !cluster.IsSemiSync() {
+		return nil
+	}
+
+	timeout := cluster.GetSemiSyncTimeout().Milliseconds()
+	return map[string]intstr.IntOrString{
+		"plugin-load-add":                           intstr.FromString("semisync_master.so;semisync_slave.so"),
+		"rpl-semi-sync-master-enabled":              intstr.FromString("on"),
+		"rpl-semi-sync-slave-enabled":               intstr.FromString("on"),
+		"rpl-semi-sync-master-wait-for-slave-count": intstr.FromInt(cluster.GetSemiSyncWaitForReplicaCount()),
+		"rpl-semi-sync-master-timeout":              intstr.FromString(strconv.FormatInt(timeout, 10)),
+	}
+}
+
 func convertMapToKVConfig(m map[string]string) map[string]intstr.IntOrString {
 	config := make(map[string]intstr.IntOrString)
 
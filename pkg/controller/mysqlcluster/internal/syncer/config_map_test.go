@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlcluster
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+)
+
+var _ = Describe("MySQL config", func() {
+	var (
+		cluster *mysqlcluster.MysqlCluster
+	)
+
+	BeforeEach(func() {
+		cluster = mysqlcluster.New(&api.MysqlCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "cluster",
+				Namespace: "default",
+			},
+			Spec: api.MysqlClusterSpec{
+				Replicas:   &two,
+				SecretName: "the-secret",
+			},
+		})
+	})
+
+	It("should not load the semi-sync plugins by default", func() {
+		data, err := buildMysqlConfData(cluster)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).ToNot(ContainSubstring("semi"))
+	})
+
+	It("should configure the semi-sync replication", func() {
+		cluster.Spec.Durability = &api.Durability{
+			Mode:                api.SemiSyncDurability,
+			WaitForReplicaCount: 2,
+		}
+		cluster.Spec.MysqlConf = api.MysqlConf{
+			"rpl-semi-sync-master-timeout": intstr.FromInt(3000),
+		}
+
+		data, err := buildMysqlConfData(cluster)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(ContainSubstring("plugin-load-add                           = semisync_master.so;semisync_slave.so\n"))
+		Expect(data).To(ContainSubstring("rpl-semi-sync-master-enabled              = on\n"))
+		Expect(data).To(ContainSubstring("rpl-semi-sync-slave-enabled               = on\n"))
+		Expect(data).To(ContainSubstring("rpl-semi-sync-master-wait-for-slave-count = 2\n"))
+		// the custom configs overwrite the semi-sync ones
+		Expect(data).To(ContainSubstring("rpl-semi-sync-master-timeout              = 3000\n"))
+	})
+
+	It("should not expire the binlogs that are archived", func() {
+		cluster.Spec.MysqlVersion = "5.7"
+
+		data, err := buildMysqlConfData(cluster)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(MatchRegexp(`expire-logs-days\s+= 14\n`))
+
+		cluster.Spec.BackupURL = "gs://bucket/"
+		cluster.Spec.BackupBinlogs = true
+
+		data, err = buildMysqlConfData(cluster)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(MatchRegexp(`expire-logs-days\s+= 0\n`))
+	})
+})
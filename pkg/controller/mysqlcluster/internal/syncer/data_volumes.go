@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlcluster
+
+import (
+	"fmt"
+
+	"github.com/presslabs/controller-util/syncer"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+)
+
+// volumeSnapshotAPIGroup is the API group of the CSI VolumeSnapshot resources
+const volumeSnapshotAPIGroup = "snapshot.storage.k8s.io"
+
+// NewDataVolumeSyncers returns the syncers that create, from the InitVolumeSnapshotName, the data
+// volumes of the nodes that don't have one yet. The statefulset uses the existing PVCs instead of
+// creating them from the volume claim template, which can't be changed after the statefulset is
+// created.
+func NewDataVolumeSyncers(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster) []syncer.Interface {
+	syncers := []syncer.Interface{}
+	for i := 0; i < int(*cluster.Spec.Replicas); i++ {
+		podName := fmt.Sprintf("%s-%d", cluster.GetNameForResource(mysqlcluster.StatefulSet), i)
+		syncers = append(syncers, newDataVolumeSyncer(c, cluster, podName))
+	}
+	return syncers
+}
+
+func newDataVolumeSyncer(c client.Client, cluster *mysqlcluster.MysqlCluster, podName string) syncer.Interface {
+	pvc := &core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetDataVolumeClaimName(podName),
+			Namespace: cluster.Namespace,
+		},
+	}
+
+	// the PVCs are removed together with the cluster, same as the ones from the claim template
+	var owner client.Object = cluster.Unwrap()
+	if cluster.Spec.VolumeSpec.KeepAfterDelete {
+		owner = nil
+	}
+
+	return syncer.NewObjectSyncer("DataVolume", owner, pvc, c, func() error {
+		if !pvc.CreationTimestamp.IsZero() {
+			// the volume exists, its data is not touched
+			return syncer.ErrIgnore
+		}
+
+		apiGroup := volumeSnapshotAPIGroup
+		pvc.Labels = cluster.GetSelectorLabels()
+		pvc.Spec = *cluster.Spec.VolumeSpec.PersistentVolumeClaim.DeepCopy()
+		pvc.Spec.DataSource = &core.TypedLocalObjectReference{
+			APIGroup: &apiGroup,
+			Kind:     "VolumeSnapshot",
+			Name:     cluster.Spec.InitVolumeSnapshotName,
+		}
+
+		return nil
+	})
+}
@@ -19,7 +19,6 @@ package mysqlcluster
 import (
 	"fmt"
 	"reflect"
-	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/go-test/deep"
@@ -44,6 +43,7 @@ type podSyncer struct {
 const (
 	labelMaster     = "master"
 	labelReplica    = "replica"
+	labelBackup     = "backup"
 	labelHealthy    = "yes"
 	labelNotHealthy = "no"
 )
@@ -52,7 +52,7 @@ const (
 func NewPodSyncer(c client.Client, scheme *runtime.Scheme, cluster *mysqlcluster.MysqlCluster, host string) syncer.Interface {
 	pod := &core.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      getPodNameForHost(host),
+			Name:      mysqlcluster.GetPodNameForHost(host),
 			Namespace: cluster.Namespace,
 		},
 	}
@@ -91,6 +91,9 @@ func (s *podSyncer) SyncFn(out *core.Pod) error {
 	role := labelReplica
 	if isMaster {
 		role = labelMaster
+	} else if s.cluster.IsDedicatedBackupPod(out.Name, out.Labels) {
+		// a dedicated backup replica is not selected by the replicas service, to not serve reads
+		role = labelBackup
 	}
 
 	// set healthy label
@@ -118,7 +121,3 @@ func (s *podSyncer) SyncFn(out *core.Pod) error {
 
 	return nil
 }
-
-func getPodNameForHost(host string) string {
-	return strings.SplitN(host, ".", 2)[0]
-}
@@ -123,6 +123,29 @@ var _ = Describe("Pod syncer", func() {
 		Expect(pod1.ObjectMeta.Labels).To(ContainElement(Equal("replica")))
 		Expect(pod1.ObjectMeta.Labels).To(ContainElement(Equal("yes")))
 	})
+
+	It("should label the dedicated backup replica", func() {
+		cluster.Spec.BackupCandidate = &api.BackupCandidate{
+			Policy:       api.DedicatedReplicaPolicy,
+			PreferredPod: getPodName(cluster, 1),
+		}
+
+		_, err := NewPodSyncer(c, scheme.Scheme, cluster, cluster.GetPodHostname(1)).Sync(context.TODO())
+		Expect(err).To(Succeed())
+
+		pod1 := &core.Pod{}
+		Expect(c.Get(context.TODO(), getPodKey(cluster, 1), pod1)).To(Succeed())
+		Expect(pod1.ObjectMeta.Labels).To(HaveKeyWithValue("role", "backup"))
+
+		// the master keeps its role even if it's the preferred pod
+		cluster.Spec.BackupCandidate.PreferredPod = getPodName(cluster, 0)
+		_, err = NewPodSyncer(c, scheme.Scheme, cluster, cluster.GetPodHostname(0)).Sync(context.TODO())
+		Expect(err).To(Succeed())
+
+		pod0 := &core.Pod{}
+		Expect(c.Get(context.TODO(), getPodKey(cluster, 0), pod0)).To(Succeed())
+		Expect(pod0.ObjectMeta.Labels).To(HaveKeyWithValue("role", "master"))
+	})
 })
 
 func getPodName(cluster *mysqlcluster.MysqlCluster, id int) string {
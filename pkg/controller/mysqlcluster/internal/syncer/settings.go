@@ -41,6 +41,8 @@ const (
 	SidecarServerPort = constants.SidecarServerPort
 	// SidecarServerProbePath the probe path
 	SidecarServerProbePath = constants.SidecarServerProbePath
+	// SidecarServerPreStopPath is the path of the pre-stop hook served by the sidecar
+	SidecarServerPreStopPath = constants.SidecarServerPreStopPath
 
 	// ExporterPort is the port that metrics will be exported
 	ExporterPort = constants.ExporterPort
@@ -62,8 +64,6 @@ const (
 	ConfDPath = constants.ConfDPath
 
 	confClientPath = constants.ConfClientPath
-
-	shPreStopFile = constants.ShPreStop
 )
 
 var (
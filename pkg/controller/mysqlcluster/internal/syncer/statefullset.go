@@ -18,6 +18,7 @@ package mysqlcluster
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -46,6 +47,9 @@ const (
 	confMapVolumeName = "config-map"
 	dataVolumeName    = "data"
 	tmpfsVolumeName   = "tmp"
+
+	encryptionKeysVolumeName    = "backup-encryption-keys"
+	replicationSourceVolumeName = "replication-source-tls"
 )
 
 // containers names
@@ -231,6 +235,60 @@ func (s *sfsSyncer) getEnvFor(name string) []core.EnvVar {
 		})
 	}
 
+	if len(s.cluster.Spec.InitBucketIncrementalURLs) > 0 && isCloneAndInit(name) {
+		env = append(env, core.EnvVar{
+			Name:  "INIT_BUCKET_INCREMENTAL_URIS",
+			Value: strings.Join(s.cluster.Spec.InitBucketIncrementalURLs, " "),
+		})
+	}
+
+	if len(s.cluster.Spec.InitBucketChecksums) > 0 && isCloneAndInit(name) {
+		env = append(env, core.EnvVar{
+			Name:  "INIT_BUCKET_CHECKSUMS",
+			Value: formatChecksums(s.cluster.Spec.InitBucketChecksums),
+		})
+	}
+
+	if s.cluster.IsBinlogArchiveEnabled() && isSidecar(name) {
+		env = append(env, core.EnvVar{
+			Name:  "BINLOG_ARCHIVE_URL",
+			Value: s.cluster.GetBinlogArchiveURL(),
+		}, core.EnvVar{
+			Name:  "BINLOG_RETENTION",
+			Value: s.cluster.GetBinlogRetention().String(),
+		})
+	}
+
+	if enc := s.cluster.Spec.BackupEncryption; enc != nil && s.cluster.Spec.BackupBinlogs && isSidecar(name) {
+		env = append(env, core.EnvVar{
+			Name:  "BACKUP_ENCRYPTION_KEY_ID",
+			Value: enc.KeyID,
+		})
+	}
+
+	// the backups and the binlogs from which the nodes are initialized must be encrypted too
+	if s.cluster.Spec.BackupEncryption != nil && (isCloneAndInit(name) || isSidecar(name)) {
+		env = append(env, core.EnvVar{
+			Name:  "BACKUP_ENCRYPTION_REQUIRED",
+			Value: "true",
+		})
+	}
+
+	if rp := s.cluster.Spec.InitRestorePoint; rp != nil && (isCloneAndInit(name) || isSidecar(name)) {
+		env = append(env, core.EnvVar{
+			Name:  "RESTORE_BINLOGS_URL",
+			Value: rp.BinlogsURL,
+		})
+		env = append(env, core.EnvVar{
+			Name:  "RESTORE_STOP_DATETIME",
+			Value: rp.StopDatetime,
+		})
+		env = append(env, core.EnvVar{
+			Name:  "RESTORE_STOP_GTID_SET",
+			Value: rp.StopGTIDSet,
+		})
+	}
+
 	if s.cluster.Spec.ServerIDOffset != nil {
 		env = append(env, core.EnvVar{
 			Name:  "MY_SERVER_ID_OFFSET",
@@ -257,6 +315,10 @@ func (s *sfsSyncer) getEnvFor(name string) []core.EnvVar {
 		})
 	}
 
+	if isCloneAndInit(name) || isSidecar(name) {
+		env = append(env, s.cluster.GetBackupStorageEnv()...)
+	}
+
 	hasXbstreamExtraArgs := len(s.cluster.Spec.XbstreamExtraArgs) > 0
 	if hasXbstreamExtraArgs && (isCloneAndInit(name) || isSidecar(name)) {
 		env = append(env, core.EnvVar{
@@ -289,6 +351,20 @@ func (s *sfsSyncer) getEnvFor(name string) []core.EnvVar {
 		})
 	}
 
+	if limit := s.cluster.Spec.BackupBandwidthLimit; limit != nil && isSidecar(name) {
+		env = append(env, core.EnvVar{
+			Name:  "BACKUP_BANDWIDTH_LIMIT",
+			Value: strconv.FormatInt(limit.Value(), 10),
+		})
+	}
+
+	if limit := s.cluster.Spec.CloneBandwidthLimit; limit != nil && isSidecar(name) {
+		env = append(env, core.EnvVar{
+			Name:  "CLONE_BANDWIDTH_LIMIT",
+			Value: strconv.FormatInt(limit.Value(), 10),
+		})
+	}
+
 	hasInitFileExtraSQL := len(s.cluster.Spec.InitFileExtraSQL) > 0
 	if hasInitFileExtraSQL && isCloneAndInit(name) {
 		env = append(env, core.EnvVar{
@@ -316,7 +392,7 @@ func (s *sfsSyncer) getEnvFor(name string) []core.EnvVar {
 	case containerCloneAndInitName:
 		env = append(env, s.envVarFromSecret(sctOpName, "BACKUP_USER", "BACKUP_USER", true))
 		env = append(env, s.envVarFromSecret(sctOpName, "BACKUP_PASSWORD", "BACKUP_PASSWORD", true))
-	case containerMysqlName:
+	case containerMysqlName, containerSidecarName:
 		env = append(env, core.EnvVar{
 			Name:  "ORCH_CLUSTER_ALIAS",
 			Value: s.cluster.GetClusterAlias(),
@@ -391,13 +467,10 @@ func (s *sfsSyncer) ensureContainersSpec() []core.Container {
 	if s.cluster.Spec.PodSpec.MysqlLifecycle != nil {
 		mysql.Lifecycle = s.cluster.Spec.PodSpec.MysqlLifecycle
 	} else if s.opt.FailoverBeforeShutdownEnabled {
-		mysql.Lifecycle = &core.Lifecycle{
-			PreStop: &core.Handler{
-				Exec: &core.ExecAction{
-					Command: []string{"bash", fmt.Sprintf("%s/%s", ConfVolumeMountPath, shPreStopFile)},
-				},
-			},
-		}
+		mysql.Lifecycle = ensurePreStopHook([]string{
+			"curl", "--fail", "--silent", "--show-error",
+			fmt.Sprintf("http://127.0.0.1:%d%s", SidecarServerPort, SidecarServerPreStopPath),
+		})
 	}
 
 	// nolint: gosec
@@ -424,6 +497,10 @@ func (s *sfsSyncer) ensureContainersSpec() []core.Container {
 		ContainerPort: SidecarServerPort,
 	})
 	sidecar.Resources = s.ensureResources(containerSidecarName)
+	// the sidecar serves the pre-stop hook of MySQL, so it waits for the takeover too
+	if s.cluster.Spec.PodSpec.MysqlLifecycle == nil && s.opt.FailoverBeforeShutdownEnabled {
+		sidecar.Lifecycle = ensurePreStopHook([]string{"mysql-operator-sidecar", "pre-stop"})
+	}
 	sidecar.ReadinessProbe = ensureProbe(30, 5, 5, core.Handler{
 		HTTPGet: &core.HTTPGetAction{
 			Path:   SidecarServerProbePath,
@@ -561,6 +638,24 @@ func (s *sfsSyncer) ensureVolumes() []core.Volume {
 		}))
 	}
 
+	// the keys used to encrypt the binlogs and to decrypt the backups
+	if enc := s.cluster.Spec.BackupEncryption; enc != nil {
+		volumes = append(volumes, ensureVolume(encryptionKeysVolumeName, core.VolumeSource{
+			Secret: &core.SecretVolumeSource{
+				SecretName: enc.SecretName,
+			},
+		}))
+	}
+
+	// the certificates of the replication from the source of a standby cluster
+	if src := s.cluster.Spec.ReplicationSource; src != nil && src.TLS != nil {
+		volumes = append(volumes, ensureVolume(replicationSourceVolumeName, core.VolumeSource{
+			Secret: &core.SecretVolumeSource{
+				SecretName: src.TLS.SecretName,
+			},
+		}))
+	}
+
 	// append the custom volumes defined by the user
 	if len(s.cluster.Spec.PodSpec.Volumes) > 0 {
 		volumes = append(volumes, s.cluster.Spec.PodSpec.Volumes...)
@@ -616,6 +711,26 @@ func (s *sfsSyncer) getEnvSourcesFor(name string) []core.EnvFromSource {
 			},
 		})
 	}
+	// the sidecar downloads the binlogs to replay from the init bucket
+	if isSidecar(name) && s.cluster.Spec.InitRestorePoint != nil && len(s.cluster.Spec.InitBucketSecretName) > 0 {
+		envSources = append(envSources, core.EnvFromSource{
+			SecretRef: &core.SecretEnvSource{
+				LocalObjectReference: core.LocalObjectReference{
+					Name: s.cluster.Spec.InitBucketSecretName,
+				},
+			},
+		})
+	}
+	// the sidecar uploads the master binlogs to the backup bucket
+	if isSidecar(name) && s.cluster.Spec.BackupBinlogs && len(s.cluster.Spec.BackupSecretName) > 0 {
+		envSources = append(envSources, core.EnvFromSource{
+			SecretRef: &core.SecretEnvSource{
+				LocalObjectReference: core.LocalObjectReference{
+					Name: s.cluster.Spec.BackupSecretName,
+				},
+			},
+		})
+	}
 	if isCloneAndInit(name) || isSidecar(name) {
 		envSources = append(envSources, core.EnvFromSource{
 			SecretRef: &core.SecretEnvSource{
@@ -636,6 +751,9 @@ func (s *sfsSyncer) getVolumeMountsFor(name string) []core.VolumeMount {
 			{Name: confMapVolumeName, MountPath: ConfMapVolumeMountPath},
 			{Name: dataVolumeName, MountPath: DataVolumeMountPath},
 		}
+		if s.cluster.Spec.BackupEncryption != nil {
+			mounts = append(mounts, encryptionKeysVolumeMount())
+		}
 
 		return mounts
 
@@ -647,6 +765,16 @@ func (s *sfsSyncer) getVolumeMountsFor(name string) []core.VolumeMount {
 		if s.cluster.Spec.TmpfsSize != nil {
 			mounts = append(mounts, core.VolumeMount{Name: tmpfsVolumeName, MountPath: DataVolumeMountPath})
 		}
+		if s.cluster.Spec.BackupEncryption != nil && isSidecar(name) {
+			mounts = append(mounts, encryptionKeysVolumeMount())
+		}
+		if src := s.cluster.Spec.ReplicationSource; src != nil && src.TLS != nil && name == containerMysqlName {
+			mounts = append(mounts, core.VolumeMount{
+				Name:      replicationSourceVolumeName,
+				MountPath: constants.ReplicationSourceTLSPath,
+				ReadOnly:  true,
+			})
+		}
 
 		// add custom volume mounts to the mysql containers
 		if len(s.cluster.Spec.PodSpec.VolumeMounts) > 0 {
@@ -664,6 +792,14 @@ func (s *sfsSyncer) getVolumeMountsFor(name string) []core.VolumeMount {
 	return nil
 }
 
+func encryptionKeysVolumeMount() core.VolumeMount {
+	return core.VolumeMount{
+		Name:      encryptionKeysVolumeName,
+		MountPath: constants.BackupEncryptionKeysPath,
+		ReadOnly:  true,
+	}
+}
+
 func (s *sfsSyncer) getLabels(extra map[string]string) map[string]string {
 	defaultsLabels := s.cluster.GetLabels()
 	for k, v := range extra {
@@ -758,6 +894,19 @@ func ensureProbe(delay, timeout, period int32, handler core.Handler) *core.Probe
 	}
 }
 
+// ensurePreStopHook returns the lifecycle that runs the given command, which calls the pre-stop
+// endpoint of the sidecar. The endpoint takes over the master before the node is stopped and it
+// accepts only the requests from the pod itself, so it can't be called by an HTTP hook.
+func ensurePreStopHook(command []string) *core.Lifecycle {
+	return &core.Lifecycle{
+		PreStop: &core.Handler{
+			Exec: &core.ExecAction{
+				Command: command,
+			},
+		},
+	}
+}
+
 func ensurePorts(ports ...core.ContainerPort) []core.ContainerPort {
 	return ports
 }
@@ -769,3 +918,14 @@ func isCloneAndInit(name string) bool {
 func isSidecar(name string) bool {
 	return name == containerSidecarName
 }
+
+// formatChecksums returns the checksums in the `<url>=<sha256>` format read by the sidecar,
+// sorted by URL such that the statefulset doesn't change between reconciliations
+func formatChecksums(checksums map[string]string) string {
+	pairs := []string{}
+	for url, checksum := range checksums {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", url, checksum))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
@@ -135,9 +135,13 @@ type ReconcileMysqlCluster struct {
 
 // Automatically generate RBAC rules to allow the Controller to read and write Deployments
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=core,resources=configmaps;secrets;services;events;jobs;pods;persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps;secrets;serviceaccounts;services;events;jobs;pods;persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=mysql.presslabs.org,resources=mysqlclusters;mysqlclusters/status;mysqlclusters/finalizers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=mysql.presslabs.org,resources=mysqlbackups,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile reads that state of the cluster for a MysqlCluster object and makes changes based on the state read
@@ -243,14 +247,37 @@ func (r *ReconcileMysqlCluster) Reconcile(ctx context.Context, request reconcile
 		clustersyncer.NewMasterSVCSyncer(r.Client, r.scheme, cluster),
 		clustersyncer.NewHealthySVCSyncer(r.Client, r.scheme, cluster),
 		clustersyncer.NewHealthyReplicasSVCSyncer(r.Client, r.scheme, cluster),
+	}
 
-		clustersyncer.NewStatefulSetSyncer(r.Client, r.scheme, cluster, cmRev, sctRev, r.opt),
+	// the data volumes are created from the snapshot before the statefulset creates them empty
+	if len(cluster.Spec.InitVolumeSnapshotName) != 0 && cluster.Spec.VolumeSpec.PersistentVolumeClaim != nil {
+		syncers = append(syncers, clustersyncer.NewDataVolumeSyncers(r.Client, r.scheme, cluster)...)
 	}
 
+	syncers = append(syncers, clustersyncer.NewStatefulSetSyncer(r.Client, r.scheme, cluster, cmRev, sctRev, r.opt))
+
 	if len(cluster.Spec.MinAvailable) != 0 {
 		syncers = append(syncers, clustersyncer.NewPDBSyncer(r.Client, r.scheme, cluster))
 	}
 
+	if len(cluster.GetBackupTrashes()) != 0 {
+		syncers = append(syncers, clustersyncer.NewBackupTrashPurgeSyncer(r.Client, r.scheme, cluster, r.opt))
+	}
+
+	if cluster.Spec.BackupCatalogSync && len(cluster.Spec.BackupURL) > 0 {
+		if len(cluster.Spec.PodSpec.ServiceAccountName) == 0 {
+			syncers = append(syncers, clustersyncer.NewBackupCatalogServiceAccountSyncer(r.Client, r.scheme, cluster))
+		}
+		syncers = append(syncers,
+			clustersyncer.NewBackupCatalogConfigMapSyncer(r.Client, r.scheme, cluster),
+			clustersyncer.NewBackupCatalogRoleSyncer(r.Client, r.scheme, cluster),
+			clustersyncer.NewBackupCatalogRoleBindingSyncer(r.Client, r.scheme, cluster),
+			clustersyncer.NewBackupCatalogSyncer(r.Client, r.scheme, cluster, r.opt),
+			clustersyncer.NewBackupCatalogImportSyncer(r.Client, r.scheme, cluster),
+		)
+	}
+	syncers = append(syncers, clustersyncer.NewBackupCatalogCleanupSyncer(r.Client, r.scheme, cluster))
+
 	// run the syncers
 	for _, sync := range syncers {
 		if err = syncer.Sync(context.TODO(), sync, r.recorder); err != nil {
@@ -0,0 +1,242 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlrestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	mysqlv1alpha1 "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlrestore"
+	"github.com/bitpoke/mysql-operator/pkg/options"
+	"github.com/bitpoke/mysql-operator/pkg/util/constants"
+)
+
+const (
+	restoreContainerName = "restore"
+
+	encryptionKeysVolumeName = "encryption-keys"
+)
+
+// getLogicalSource returns the location of a database dumped by a logical backup
+func (r *ReconcileMysqlRestore) getLogicalSource(restore *mysqlrestore.Restore,
+	cluster *mysqlcluster.MysqlCluster, backup *mysqlbackup.MysqlBackup) (*restoreSource, error) {
+	if !isBackupSucceeded(backup) {
+		return nil, fail("BackupNotCompleted", "backup %s is not completed successfully", backup.Name)
+	}
+	if restore.Spec.RestorePoint != nil {
+		return nil, fail("RestorePointNotSupported", "logical backups can't be restored to a point in time")
+	}
+	if len(backup.Status.EncryptionKeyID) > 0 && cluster.Spec.BackupEncryption == nil {
+		return nil, fail("EncryptionKeysMissing", "backup %s is encrypted with key %s but the cluster "+
+			"has no backupEncryption configured", backup.Name, backup.Status.EncryptionKeyID)
+	}
+
+	db := restore.Spec.Database
+	if len(db) == 0 {
+		if len(backup.Status.Databases) != 1 {
+			return nil, fail("DatabaseNotSpecified", "backup %s contains %d databases, spec.database "+
+				"should be specified", backup.Name, len(backup.Status.Databases))
+		}
+		db = backup.Status.Databases[0]
+	}
+
+	if len(backup.Status.Databases) > 0 && !containsDatabase(backup.Status.Databases, db) {
+		return nil, fail("DatabaseNotFound", "backup %s does not contain database %s", backup.Name, db)
+	}
+
+	src := &restoreSource{
+		url:        backup.Spec.BackupURL,
+		secretName: restore.Spec.BackupSecretName,
+		database:   db,
+	}
+	if len(src.secretName) == 0 {
+		src.secretName = backup.Spec.BackupSecretName
+	}
+
+	return src, nil
+}
+
+func containsDatabase(databases []string, db string) bool {
+	for _, name := range databases {
+		if name == db {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreDatabase loads a database into the running cluster with a job and waits for it to finish
+func (r *ReconcileMysqlRestore) restoreDatabase(ctx context.Context, restore *mysqlrestore.Restore,
+	cluster *mysqlcluster.MysqlCluster, src *restoreSource) (reconcile.Result, error) {
+	job := &batchv1.Job{}
+	key := types.NamespacedName{Name: restore.GetNameForJob(), Namespace: restore.Namespace}
+
+	err := r.Get(ctx, key, job)
+	if apierrors.IsNotFound(err) {
+		job = newDatabaseRestoreJob(restore, cluster, src)
+		if err = controllerutil.SetControllerReference(restore.Unwrap(), job, r.scheme); err != nil {
+			return reconcile.Result{}, err
+		}
+
+		log.Info("loading database from backup", "key", cluster.GetNamespacedName(), "source", src.String())
+		if err = r.Create(ctx, job); err != nil {
+			return reconcile.Result{}, err
+		}
+
+		r.recorder.Eventf(restore.Unwrap(), corev1.EventTypeNormal, "RestoreStarted",
+			"restoring %s into cluster %s", src, cluster.Name)
+	} else if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch cond.Type {
+		case batchv1.JobComplete:
+			restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreComplete, corev1.ConditionTrue, "RestoreSucceeded",
+				fmt.Sprintf("database %s was restored successfully", src.database))
+			r.recorder.Eventf(restore.Unwrap(), corev1.EventTypeNormal, "RestoreSucceeded",
+				"database %s was restored into cluster %s", src.database, cluster.Name)
+			return reconcile.Result{}, nil
+		case batchv1.JobFailed:
+			return reconcile.Result{}, fail("RestoreJobFailed", "loading database %s failed: %s",
+				src.database, cond.Message)
+		}
+	}
+
+	restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreComplete, corev1.ConditionFalse, "WaitingForJob",
+		fmt.Sprintf("waiting for job %s to load database %s", job.Name, src.database))
+	return reconcile.Result{RequeueAfter: pollInterval}, nil
+}
+
+// newDatabaseRestoreJob returns the job that loads the database dump into the cluster master
+func newDatabaseRestoreJob(restore *mysqlrestore.Restore, cluster *mysqlcluster.MysqlCluster,
+	src *restoreSource) *batchv1.Job {
+	opt := options.GetOptions()
+	secretName := cluster.GetNameForResource(mysqlcluster.Secret)
+
+	container := corev1.Container{
+		Name:            restoreContainerName,
+		Image:           cluster.GetSidecarImage(),
+		ImagePullPolicy: opt.ImagePullPolicy,
+		Args: []string{
+			"restore-logical-backup",
+			cluster.GetMasterHost(),
+			src.url,
+			src.database,
+		},
+		Env: []corev1.EnvVar{
+			secretKeyEnv("OPERATOR_USER", secretName),
+			secretKeyEnv("OPERATOR_PASSWORD", secretName),
+		},
+	}
+
+	if len(cluster.Spec.BackupCompressCommand) > 0 && len(cluster.Spec.BackupDecompressCommand) > 0 {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "BACKUP_DECOMPRESS_COMMAND",
+			Value: strings.Join(cluster.Spec.BackupDecompressCommand, " "),
+		})
+	}
+
+	if len(cluster.Spec.RcloneExtraArgs) > 0 {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "RCLONE_EXTRA_ARGS",
+			Value: strings.Join(cluster.Spec.RcloneExtraArgs, " "),
+		})
+	}
+	container.Env = append(container.Env, cluster.GetBackupStorageEnv()...)
+
+	if len(src.secretName) > 0 {
+		container.EnvFrom = []corev1.EnvFromSource{
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: src.secretName},
+				},
+			},
+		}
+	}
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy:      corev1.RestartPolicyNever,
+		ImagePullSecrets:   cluster.Spec.PodSpec.ImagePullSecrets,
+		ServiceAccountName: cluster.Spec.PodSpec.ServiceAccountName,
+	}
+
+	// encrypted dumps are decrypted with the keys of the cluster
+	if enc := cluster.Spec.BackupEncryption; enc != nil {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: encryptionKeysVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: enc.SecretName},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      encryptionKeysVolumeName,
+			MountPath: constants.BackupEncryptionKeysPath,
+			ReadOnly:  true,
+		})
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "BACKUP_ENCRYPTION_REQUIRED",
+			Value: "true",
+		})
+	}
+
+	podSpec.Containers = []corev1.Container{container}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restore.GetNameForJob(),
+			Namespace: restore.Namespace,
+			Labels: map[string]string{
+				"cluster": cluster.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// secretKeyEnv returns the env var with the value of the same key from the secret
+func secretKeyEnv(key, secretName string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: key,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  key,
+			},
+		},
+	}
+}
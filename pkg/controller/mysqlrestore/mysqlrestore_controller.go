@@ -0,0 +1,588 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-test/deep"
+	logf "github.com/presslabs/controller-util/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mysqlv1alpha1 "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlrestore"
+)
+
+const (
+	controllerName = "mysql-restore"
+
+	// pollInterval is the interval at which the progress of a restore is checked
+	pollInterval = 10 * time.Second
+)
+
+var log = logf.Log.WithName("controller.mysql-restore")
+
+// ReconcileMysqlRestore reconciles a MysqlRestore object
+type ReconcileMysqlRestore struct {
+	client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+// check for reconciler to implement reconciler.Reconciler interface
+var _ reconcile.Reconciler = &ReconcileMysqlRestore{}
+
+// restoreFailure is returned when the restore can not be performed and should not be retried
+type restoreFailure struct {
+	reason  string
+	message string
+}
+
+func (f *restoreFailure) Error() string {
+	return f.message
+}
+
+func fail(reason, format string, args ...interface{}) error {
+	return &restoreFailure{reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+// restoreSource holds the location of the backups from which the cluster is restored
+type restoreSource struct {
+	url             string
+	incrementalURLs []string
+	secretName      string
+
+	// checksums maps the URLs to the checksums recorded in the backups status
+	checksums map[string]string
+
+	// volumeSnapshotName is set instead of the URLs for volume snapshot backups
+	volumeSnapshotName string
+
+	// database is the database loaded from the url of a logical backup
+	database string
+}
+
+func (src *restoreSource) String() string {
+	if len(src.volumeSnapshotName) > 0 {
+		return fmt.Sprintf("volume snapshot %s", src.volumeSnapshotName)
+	}
+	if len(src.database) > 0 {
+		return fmt.Sprintf("database %s from %s", src.database, src.url)
+	}
+	return src.url
+}
+
+// Automatically generate RBAC rules to allow the Controller to read and write MysqlRestores
+// +kubebuilder:rbac:groups=mysql.presslabs.org,resources=mysqlrestores;mysqlrestores/status,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile drives a MysqlRestore through its steps: it scales the cluster down, deletes the
+// data volumes, clones the first node from the backup then scales the cluster back up such
+// that the replicas are cloned from the restored node. Each step is recorded as a condition.
+// A database from a logical backup is instead loaded by a job into the running cluster.
+func (r *ReconcileMysqlRestore) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	restore := mysqlrestore.Wrap(&mysqlv1alpha1.MysqlRestore{})
+
+	err := r.Get(ctx, request.NamespacedName, restore.Unwrap())
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// Object not found, return.  Created objects are automatically garbage collected.
+			// For additional cleanup logic use finalizers.
+			return reconcile.Result{}, nil
+		}
+
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	if restore.IsFinished() {
+		return reconcile.Result{}, nil
+	}
+
+	oldStatus := restore.DeepCopy().Status
+
+	result, err := r.restore(ctx, restore)
+	if f, ok := err.(*restoreFailure); ok {
+		log.Info("restore failed", "key", request.NamespacedName, "reason", f.reason, "message", f.message)
+		r.recorder.Event(restore.Unwrap(), corev1.EventTypeWarning, f.reason, f.message)
+		restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreFailed, corev1.ConditionTrue, f.reason, f.message)
+		result, err = reconcile.Result{}, nil
+	}
+
+	if !reflect.DeepEqual(oldStatus, restore.Status) {
+		log.V(1).Info("update MySQL restore status", "diff", deep.Equal(oldStatus, restore.Status))
+
+		if uErr := r.Status().Update(ctx, restore.Unwrap()); uErr != nil {
+			return reconcile.Result{}, uErr
+		}
+	}
+
+	return result, err
+}
+
+// nolint: gocyclo
+func (r *ReconcileMysqlRestore) restore(ctx context.Context, restore *mysqlrestore.Restore) (reconcile.Result, error) {
+	cluster := mysqlcluster.New(&mysqlv1alpha1.MysqlCluster{})
+	if err := r.Get(ctx, restore.GetClusterKey(), cluster.Unwrap()); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, fail("ClusterNotFound", "cluster %s not found", restore.Spec.ClusterName)
+		}
+		return reconcile.Result{}, err
+	}
+
+	// set defaults on cluster, only for the checks, the cluster is updated without them
+	r.scheme.Default(cluster.Unwrap())
+	cluster.UpdateSpec()
+
+	src, err := r.getRestoreSource(ctx, restore, cluster)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if len(src.database) > 0 {
+		return r.restoreDatabase(ctx, restore, cluster, src)
+	}
+
+	// remember the number of replicas and the initialization source before touching the cluster,
+	// and save them before continuing such that a failed status update does not lose them
+	if restore.Status.OriginalReplicas == nil {
+		replicas := *cluster.Spec.Replicas
+		restore.Status.OriginalReplicas = &replicas
+		restore.Status.OriginalInitSource = getInitSource(cluster)
+		r.recorder.Eventf(restore.Unwrap(), corev1.EventTypeNormal, "RestoreStarted",
+			"restoring cluster %s from %s", cluster.Name, src)
+		return reconcile.Result{Requeue: true}, nil
+	}
+
+	if !restore.IsConditionTrue(mysqlv1alpha1.MysqlRestoreScaledDown) {
+		if err := r.scaleCluster(ctx, cluster, 0); err != nil {
+			return reconcile.Result{}, err
+		}
+
+		pods := &corev1.PodList{}
+		if err := r.List(ctx, pods, listOptionsFor(cluster)); err != nil {
+			return reconcile.Result{}, err
+		}
+		if len(pods.Items) > 0 {
+			restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreScaledDown, corev1.ConditionFalse, "WaitingForPods",
+				fmt.Sprintf("waiting for %d pods to terminate", len(pods.Items)))
+			return reconcile.Result{RequeueAfter: pollInterval}, nil
+		}
+
+		restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreScaledDown, corev1.ConditionTrue, "PodsTerminated",
+			"all cluster pods were terminated")
+	}
+
+	if !restore.IsConditionTrue(mysqlv1alpha1.MysqlRestoreVolumesDeleted) {
+		done, err := r.deleteDataVolumes(ctx, restore, cluster)
+		if err != nil || !done {
+			return reconcile.Result{RequeueAfter: pollInterval}, err
+		}
+
+		restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreVolumesDeleted, corev1.ConditionTrue, "VolumesDeleted",
+			"all data volumes were deleted")
+	}
+
+	if !restore.IsConditionTrue(mysqlv1alpha1.MysqlRestoreMasterRestored) {
+		if err := r.initClusterFrom(ctx, restore, cluster, src); err != nil {
+			return reconcile.Result{}, err
+		}
+
+		ready, err := r.isMasterReady(ctx, cluster)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if !ready {
+			restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreMasterRestored, corev1.ConditionFalse, "WaitingForMaster",
+				"waiting for the first node to be cloned from the backup")
+			return reconcile.Result{RequeueAfter: pollInterval}, nil
+		}
+
+		restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreMasterRestored, corev1.ConditionTrue, "MasterReady",
+			"the first node was restored from the backup")
+	}
+
+	// the new replicas are cloned from the restored node, not from the backup
+	replicas := *restore.Status.OriginalReplicas
+	if err := r.resetClusterInit(ctx, restore, cluster, replicas); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if !cluster.IsClusterReady() || cluster.Status.ReadyNodes != int(replicas) {
+		restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreComplete, corev1.ConditionFalse, "WaitingForReplicas",
+			fmt.Sprintf("waiting for %d/%d nodes to be ready", cluster.Status.ReadyNodes, replicas))
+		return reconcile.Result{RequeueAfter: pollInterval}, nil
+	}
+
+	restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreComplete, corev1.ConditionTrue, "RestoreSucceeded",
+		"cluster was restored successfully")
+	r.recorder.Eventf(restore.Unwrap(), corev1.EventTypeNormal, "RestoreSucceeded",
+		"cluster %s was restored successfully", cluster.Name)
+
+	return reconcile.Result{}, nil
+}
+
+// getRestoreSource resolves the backup location. For an incremental backup the chain of base
+// backups is followed up to the full backup.
+func (r *ReconcileMysqlRestore) getRestoreSource(ctx context.Context, restore *mysqlrestore.Restore,
+	cluster *mysqlcluster.MysqlCluster) (*restoreSource, error) {
+	src := &restoreSource{
+		url:        restore.Spec.BackupURL,
+		secretName: restore.Spec.BackupSecretName,
+	}
+
+	if len(restore.Spec.BackupName) == 0 {
+		if len(src.url) == 0 {
+			return nil, fail("BackupNotSpecified", "either spec.backupName or spec.backupURL should be specified")
+		}
+		if len(src.secretName) == 0 {
+			src.secretName = cluster.Spec.BackupSecretName
+		}
+		// the URL is taken to be of a logical backup when a database is specified
+		src.database = restore.Spec.Database
+		return src, nil
+	}
+
+	backup := mysqlbackup.New(&mysqlv1alpha1.MysqlBackup{})
+	if err := r.Get(ctx, restore.GetBackupKey(), backup.Unwrap()); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fail("BackupNotFound", "backup %s not found", restore.Spec.BackupName)
+		}
+		return nil, err
+	}
+
+	if backup.IsVolumeSnapshot() {
+		return r.getVolumeSnapshotSource(restore, cluster, backup)
+	}
+
+	if backup.IsLogical() {
+		return r.getLogicalSource(restore, cluster, backup)
+	} else if len(restore.Spec.Database) > 0 {
+		return nil, fail("DatabaseNotSupported", "backup %s is not a logical backup", backup.Name)
+	}
+
+	chain, err := backup.GetChain(ctx, r.Client)
+	if apierrors.IsNotFound(err) {
+		return nil, fail("BackupNotFound", "a base backup of %s is not found: %s", backup.Name, err)
+	} else if errors.Is(err, mysqlbackup.ErrInvalidChain) {
+		return nil, fail("InvalidBackupChain", "%s", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	urls := []string{}
+	checksums := map[string]string{}
+	for _, b := range chain {
+		if !isBackupSucceeded(b) {
+			return nil, fail("BackupNotCompleted", "backup %s is not completed successfully", b.Name)
+		}
+		// the cluster nodes decrypt the backup with the keys from the cluster encryption secret
+		if len(b.Status.EncryptionKeyID) > 0 && cluster.Spec.BackupEncryption == nil {
+			return nil, fail("EncryptionKeysMissing", "backup %s is encrypted with key %s but the cluster "+
+				"has no backupEncryption configured", b.Name, b.Status.EncryptionKeyID)
+		}
+		urls = append(urls, b.Spec.BackupURL)
+		if len(b.Status.SHA256) > 0 {
+			checksums[b.Spec.BackupURL] = b.Status.SHA256
+		}
+	}
+
+	if len(src.secretName) == 0 {
+		src.secretName = backup.Spec.BackupSecretName
+	}
+
+	src.url = urls[0]
+	src.incrementalURLs = urls[1:]
+	if len(checksums) > 0 {
+		src.checksums = checksums
+	}
+
+	return src, nil
+}
+
+// getVolumeSnapshotSource returns the snapshot from which the data volumes are created
+func (r *ReconcileMysqlRestore) getVolumeSnapshotSource(restore *mysqlrestore.Restore,
+	cluster *mysqlcluster.MysqlCluster, backup *mysqlbackup.MysqlBackup) (*restoreSource, error) {
+	if !isBackupSucceeded(backup) {
+		return nil, fail("BackupNotCompleted", "backup %s is not completed successfully", backup.Name)
+	}
+	if cluster.Spec.VolumeSpec.PersistentVolumeClaim == nil {
+		return nil, fail("VolumeSnapshotNotSupported", "restoring volume snapshots requires persistent volumes")
+	}
+	if restore.Spec.RestorePoint != nil {
+		return nil, fail("RestorePointNotSupported", "volume snapshots can't be restored to a point in time")
+	}
+
+	return &restoreSource{volumeSnapshotName: backup.Status.VolumeSnapshotName}, nil
+}
+
+func isBackupSucceeded(backup *mysqlbackup.MysqlBackup) bool {
+	if !backup.Status.Completed {
+		return false
+	}
+
+	cond := backup.GetBackupCondition(mysqlv1alpha1.BackupComplete)
+	return cond != nil && cond.Status == corev1.ConditionTrue
+}
+
+func (r *ReconcileMysqlRestore) scaleCluster(ctx context.Context, cluster *mysqlcluster.MysqlCluster, replicas int32) error {
+	if *cluster.Spec.Replicas == replicas {
+		return nil
+	}
+
+	log.Info("scaling cluster", "key", cluster.GetNamespacedName(), "replicas", replicas)
+	return r.updateCluster(ctx, cluster, func(spec *mysqlv1alpha1.MysqlClusterSpec) {
+		spec.Replicas = &replicas
+	})
+}
+
+// updateCluster applies the changes on the latest version of the cluster and patches only the
+// changed fields, such that the defaults set on the given cluster are not saved
+func (r *ReconcileMysqlRestore) updateCluster(ctx context.Context, cluster *mysqlcluster.MysqlCluster,
+	update func(spec *mysqlv1alpha1.MysqlClusterSpec)) error {
+	latest := &mysqlv1alpha1.MysqlCluster{}
+	if err := r.Get(ctx, cluster.GetNamespacedName(), latest); err != nil {
+		return err
+	}
+
+	updated := latest.DeepCopy()
+	update(&updated.Spec)
+	if reflect.DeepEqual(updated.Spec, latest.Spec) {
+		return nil
+	}
+
+	if err := r.Patch(ctx, updated, client.MergeFrom(latest)); err != nil {
+		return err
+	}
+
+	update(&cluster.Spec)
+	return nil
+}
+
+// deleteDataVolumes removes the PVCs of the cluster, returns true when all are gone
+func (r *ReconcileMysqlRestore) deleteDataVolumes(ctx context.Context, restore *mysqlrestore.Restore,
+	cluster *mysqlcluster.MysqlCluster) (bool, error) {
+	vs := cluster.Spec.VolumeSpec
+	if vs.PersistentVolumeClaim == nil {
+		if vs.HostPath != nil {
+			return false, fail("HostPathNotSupported", "restoring clusters with hostPath volumes is not supported")
+		}
+		// emptyDir volumes are deleted along with the pods
+		return true, nil
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcs, listOptionsFor(cluster)); err != nil {
+		return false, err
+	}
+
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if pvc.DeletionTimestamp != nil {
+			continue
+		}
+
+		log.Info("deleting data volume", "key", cluster.GetNamespacedName(), "pvc", pvc.Name)
+		if err := r.Delete(ctx, pvc); err != nil && !apierrors.IsNotFound(err) {
+			return false, err
+		}
+	}
+
+	if len(pvcs.Items) > 0 {
+		restore.UpdateCondition(mysqlv1alpha1.MysqlRestoreVolumesDeleted, corev1.ConditionFalse, "WaitingForVolumes",
+			fmt.Sprintf("waiting for %d volumes to be deleted", len(pvcs.Items)))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// initClusterFrom configures the cluster to be initialized from the backup and starts the first node
+func (r *ReconcileMysqlRestore) initClusterFrom(ctx context.Context, restore *mysqlrestore.Restore,
+	cluster *mysqlcluster.MysqlCluster, src *restoreSource) error {
+	one := int32(1)
+	initFrom := func(spec *mysqlv1alpha1.MysqlClusterSpec) {
+		spec.Replicas = &one
+		spec.InitBucketURL = src.url
+		spec.InitBucketURI = ""
+		spec.InitBucketIncrementalURLs = src.incrementalURLs
+		spec.InitBucketChecksums = src.checksums
+		spec.InitBucketSecretName = src.secretName
+		spec.InitRestorePoint = restore.Spec.RestorePoint
+		spec.InitVolumeSnapshotName = src.volumeSnapshotName
+	}
+
+	spec := cluster.Spec.DeepCopy()
+	initFrom(spec)
+	if reflect.DeepEqual(*spec, cluster.Spec) {
+		return nil
+	}
+
+	log.Info("initializing cluster from backup", "key", cluster.GetNamespacedName(), "source", src.String())
+	return r.updateCluster(ctx, cluster, initFrom)
+}
+
+// resetClusterInit sets back the initialization source the cluster had before the restore and
+// scales it to the given number of replicas
+func (r *ReconcileMysqlRestore) resetClusterInit(ctx context.Context, restore *mysqlrestore.Restore,
+	cluster *mysqlcluster.MysqlCluster, replicas int32) error {
+	reset := func(spec *mysqlv1alpha1.MysqlClusterSpec) {
+		spec.Replicas = &replicas
+		// the restores started by an older operator version did not save it
+		if src := restore.Status.OriginalInitSource; src != nil {
+			spec.InitBucketURL = src.InitBucketURL
+			spec.InitBucketURI = src.InitBucketURI
+			spec.InitBucketIncrementalURLs = src.InitBucketIncrementalURLs
+			spec.InitBucketChecksums = src.InitBucketChecksums
+			spec.InitBucketSecretName = src.InitBucketSecretName
+			spec.InitRestorePoint = src.InitRestorePoint
+			spec.InitVolumeSnapshotName = src.InitVolumeSnapshotName
+		}
+	}
+
+	spec := cluster.Spec.DeepCopy()
+	reset(spec)
+	if reflect.DeepEqual(*spec, cluster.Spec) {
+		return nil
+	}
+
+	log.Info("scaling cluster", "key", cluster.GetNamespacedName(), "replicas", replicas)
+	return r.updateCluster(ctx, cluster, reset)
+}
+
+func getInitSource(cluster *mysqlcluster.MysqlCluster) *mysqlv1alpha1.MysqlRestoreInitSource {
+	src := &mysqlv1alpha1.MysqlRestoreInitSource{
+		InitBucketURL:             cluster.Spec.InitBucketURL,
+		InitBucketURI:             cluster.Spec.InitBucketURI,
+		InitBucketIncrementalURLs: cluster.Spec.InitBucketIncrementalURLs,
+		InitBucketChecksums:       cluster.Spec.InitBucketChecksums,
+		InitBucketSecretName:      cluster.Spec.InitBucketSecretName,
+		InitRestorePoint:          cluster.Spec.InitRestorePoint,
+		InitVolumeSnapshotName:    cluster.Spec.InitVolumeSnapshotName,
+	}
+	return src.DeepCopy()
+}
+
+func (r *ReconcileMysqlRestore) isMasterReady(ctx context.Context, cluster *mysqlcluster.MysqlCluster) (bool, error) {
+	pod := &corev1.Pod{}
+	key := types.NamespacedName{
+		Name:      fmt.Sprintf("%s-0", cluster.GetNameForResource(mysqlcluster.StatefulSet)),
+		Namespace: cluster.Namespace,
+	}
+	if err := r.Get(ctx, key, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue, nil
+		}
+	}
+
+	return false, nil
+}
+
+// clusterRestoreRequests returns the requests for the unfinished restores of a cluster
+func clusterRestoreRequests(c client.Client) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		restores := &mysqlv1alpha1.MysqlRestoreList{}
+		if err := c.List(context.TODO(), restores, client.InNamespace(obj.GetNamespace())); err != nil {
+			log.Error(err, "failed to list restores", "namespace", obj.GetNamespace())
+			return nil
+		}
+
+		requests := []reconcile.Request{}
+		for i := range restores.Items {
+			restore := mysqlrestore.Wrap(&restores.Items[i])
+			if restore.Spec.ClusterName != obj.GetName() || restore.IsFinished() {
+				continue
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: restore.Name, Namespace: restore.Namespace},
+			})
+		}
+		return requests
+	}
+}
+
+func listOptionsFor(cluster *mysqlcluster.MysqlCluster) *client.ListOptions {
+	return &client.ListOptions{
+		Namespace:     cluster.Namespace,
+		LabelSelector: labels.SelectorFromSet(cluster.GetSelectorLabels()),
+	}
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileMysqlRestore{
+		Client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetEventRecorderFor(controllerName),
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr ctrl.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to MysqlRestore
+	err = c.Watch(&source.Kind{Type: &mysqlv1alpha1.MysqlRestore{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes of the restored clusters, e.g. of their ready nodes, such that the restores
+	// move on without waiting for the next poll
+	err = c.Watch(&source.Kind{Type: &mysqlv1alpha1.MysqlCluster{}},
+		handler.EnqueueRequestsFromMapFunc(clusterRestoreRequests(mgr.GetClient())))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Add creates a new MysqlRestore Controller and adds it to the Manager with default RBAC. The Manager
+// will set fields on the Controller and Start it when the Manager is Started.
+func Add(mgr ctrl.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
@@ -0,0 +1,321 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlrestore
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	mysqlv1alpha1 "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/controller/internal/testutil"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlrestore"
+	gm "github.com/bitpoke/mysql-operator/pkg/testutil/gomegamatcher"
+)
+
+const timeout = time.Second * 2
+
+var _ = Describe("MysqlRestore controller", func() {
+	var (
+		// controller k8s client
+		c client.Client
+
+		ctxCancel func()
+	)
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{
+			Scheme:             scheme.Scheme,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// NOTE: create a new k8s client without cache to have more stable tests
+		c, err = client.New(cfg, client.Options{})
+		Expect(err).To(Succeed())
+
+		rec := newReconciler(mgr).(*ReconcileMysqlRestore)
+		// inject an uncached client
+		rec.Client = c
+		Expect(add(mgr, rec)).To(Succeed())
+
+		_, ctxCancel = testutil.StartTestManager(mgr)
+	})
+
+	AfterEach(func() {
+		ctxCancel()
+	})
+
+	var (
+		ns      string
+		cluster *mysqlcluster.MysqlCluster
+		restore *mysqlrestore.Restore
+	)
+
+	BeforeEach(func() {
+		ns = "default"
+		clusterName := fmt.Sprintf("cluster-%d", rand.Int31())
+
+		three := int32(3)
+		cluster = mysqlcluster.New(&mysqlv1alpha1.MysqlCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: ns},
+			Spec: mysqlv1alpha1.MysqlClusterSpec{
+				Replicas:   &three,
+				SecretName: "a-secret",
+			},
+		})
+		Expect(c.Create(context.TODO(), cluster.Unwrap())).To(Succeed())
+
+		restore = mysqlrestore.Wrap(&mysqlv1alpha1.MysqlRestore{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("restore-%d", rand.Int31()), Namespace: ns},
+			Spec: mysqlv1alpha1.MysqlRestoreSpec{
+				ClusterName: clusterName,
+			},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(c.Delete(context.TODO(), restore.Unwrap())).To(Succeed())
+		Expect(c.Delete(context.TODO(), cluster.Unwrap())).To(Succeed())
+	})
+
+	createBackup := func(name string, spec mysqlv1alpha1.MysqlBackupSpec, succeeded bool) {
+		backup := &mysqlv1alpha1.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+			Spec:       spec,
+		}
+		Expect(c.Create(context.TODO(), backup)).To(Succeed())
+
+		backup.Status.Completed = true
+		backup.Status.SHA256 = fmt.Sprintf("sha-%s", name)
+		backup.Status.Conditions = []mysqlv1alpha1.BackupCondition{
+			{
+				Type:               mysqlv1alpha1.BackupComplete,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: metav1.Now(),
+			},
+		}
+		if !succeeded {
+			backup.Status.Conditions[0].Type = mysqlv1alpha1.BackupFailed
+		}
+		Expect(c.Status().Update(context.TODO(), backup)).To(Succeed())
+	}
+
+	When("the backup does not exist", func() {
+		BeforeEach(func() {
+			restore.Spec.BackupName = "not-found"
+			Expect(c.Create(context.TODO(), restore.Unwrap())).To(Succeed())
+		})
+
+		It("should fail without touching the cluster", func() {
+			Eventually(testutil.RefreshFn(c, restore.Unwrap()), timeout).Should(
+				gm.HaveCondition(mysqlv1alpha1.MysqlRestoreFailed, corev1.ConditionTrue))
+
+			Expect(c.Get(context.TODO(), cluster.GetNamespacedName(), cluster.Unwrap())).To(Succeed())
+			Expect(*cluster.Spec.Replicas).To(Equal(int32(3)))
+		})
+	})
+
+	When("the backup has failed", func() {
+		BeforeEach(func() {
+			restore.Spec.BackupName = fmt.Sprintf("backup-%d", rand.Int31())
+			createBackup(restore.Spec.BackupName, mysqlv1alpha1.MysqlBackupSpec{
+				ClusterName: cluster.Name,
+				BackupURL:   "gs://bucket/full.xbackup.gz",
+			}, false)
+			Expect(c.Create(context.TODO(), restore.Unwrap())).To(Succeed())
+		})
+
+		It("should fail", func() {
+			Eventually(testutil.RefreshFn(c, restore.Unwrap()), timeout).Should(
+				gm.HaveCondition(mysqlv1alpha1.MysqlRestoreFailed, corev1.ConditionTrue))
+		})
+	})
+
+	When("restoring from an incremental backup", func() {
+		var (
+			fullName string
+			incName  string
+		)
+
+		BeforeEach(func() {
+			fullName = fmt.Sprintf("backup-full-%d", rand.Int31())
+			incName = fmt.Sprintf("backup-inc-%d", rand.Int31())
+
+			createBackup(fullName, mysqlv1alpha1.MysqlBackupSpec{
+				ClusterName:      cluster.Name,
+				BackupURL:        "gs://bucket/full.xbackup.gz",
+				BackupSecretName: "backup-secret",
+			}, true)
+			createBackup(incName, mysqlv1alpha1.MysqlBackupSpec{
+				ClusterName:      cluster.Name,
+				BackupURL:        "gs://bucket/inc.xbackup.gz",
+				BackupSecretName: "backup-secret",
+				Type:             mysqlv1alpha1.IncrementalBackup,
+				BaseBackupName:   fullName,
+			}, true)
+
+			cluster.Spec.InitBucketURL = "gs://bucket/original.xbackup.gz"
+			Expect(c.Update(context.TODO(), cluster.Unwrap())).To(Succeed())
+
+			restore.Spec.BackupName = incName
+			Expect(c.Create(context.TODO(), restore.Unwrap())).To(Succeed())
+		})
+
+		It("should remember the number of replicas", func() {
+			Eventually(func() *int32 {
+				Expect(c.Get(context.TODO(), types.NamespacedName{Name: restore.Name, Namespace: ns},
+					restore.Unwrap())).To(Succeed())
+				return restore.Status.OriginalReplicas
+			}, timeout).ShouldNot(BeNil())
+			Expect(*restore.Status.OriginalReplicas).To(Equal(int32(3)))
+		})
+
+		It("should scale down the cluster and delete the volumes", func() {
+			Eventually(testutil.RefreshFn(c, restore.Unwrap()), timeout).Should(
+				gm.HaveCondition(mysqlv1alpha1.MysqlRestoreScaledDown, corev1.ConditionTrue))
+			Eventually(testutil.RefreshFn(c, restore.Unwrap()), timeout).Should(
+				gm.HaveCondition(mysqlv1alpha1.MysqlRestoreVolumesDeleted, corev1.ConditionTrue))
+		})
+
+		It("should initialize the cluster from the backup chain", func() {
+			Eventually(testutil.RefreshFn(c, restore.Unwrap()), timeout).Should(
+				gm.HaveCondition(mysqlv1alpha1.MysqlRestoreMasterRestored, corev1.ConditionFalse))
+
+			Expect(c.Get(context.TODO(), cluster.GetNamespacedName(), cluster.Unwrap())).To(Succeed())
+			Expect(*cluster.Spec.Replicas).To(Equal(int32(1)))
+			Expect(cluster.Spec.InitBucketURL).To(Equal("gs://bucket/full.xbackup.gz"))
+			Expect(cluster.Spec.InitBucketIncrementalURLs).To(Equal([]string{"gs://bucket/inc.xbackup.gz"}))
+			Expect(cluster.Spec.InitBucketSecretName).To(Equal("backup-secret"))
+			Expect(cluster.Spec.InitBucketChecksums).To(Equal(map[string]string{
+				"gs://bucket/full.xbackup.gz": fmt.Sprintf("sha-%s", fullName),
+				"gs://bucket/inc.xbackup.gz":  fmt.Sprintf("sha-%s", incName),
+			}))
+
+			// the defaults are not saved in the cluster spec
+			Expect(cluster.Spec.MinAvailable).To(BeEmpty())
+			Expect(cluster.Spec.PodSpec.Resources.Requests).To(BeEmpty())
+		})
+
+		It("should set back the initialization source when scaling up the cluster", func() {
+			Eventually(testutil.RefreshFn(c, restore.Unwrap()), timeout).Should(
+				gm.HaveCondition(mysqlv1alpha1.MysqlRestoreMasterRestored, corev1.ConditionFalse))
+			Expect(restore.Status.OriginalInitSource).To(Equal(&mysqlv1alpha1.MysqlRestoreInitSource{
+				InitBucketURL: "gs://bucket/original.xbackup.gz",
+			}))
+
+			// the first node is restored
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s-0", cluster.GetNameForResource(mysqlcluster.StatefulSet)),
+					Namespace: ns,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "mysql", Image: "mysql"}},
+				},
+			}
+			Expect(c.Create(context.TODO(), pod)).To(Succeed())
+			defer c.Delete(context.TODO(), pod) // nolint: errcheck
+			pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+			Expect(c.Status().Update(context.TODO(), pod)).To(Succeed())
+
+			// a change of the cluster triggers the reconciliation of its restores
+			Expect(c.Get(context.TODO(), cluster.GetNamespacedName(), cluster.Unwrap())).To(Succeed())
+			cluster.Annotations = map[string]string{"touched": "true"}
+			Expect(c.Update(context.TODO(), cluster.Unwrap())).To(Succeed())
+
+			Eventually(testutil.RefreshFn(c, restore.Unwrap()), timeout).Should(
+				gm.HaveCondition(mysqlv1alpha1.MysqlRestoreMasterRestored, corev1.ConditionTrue))
+
+			Expect(c.Get(context.TODO(), cluster.GetNamespacedName(), cluster.Unwrap())).To(Succeed())
+			Expect(*cluster.Spec.Replicas).To(Equal(int32(3)))
+			Expect(cluster.Spec.InitBucketURL).To(Equal("gs://bucket/original.xbackup.gz"))
+			Expect(cluster.Spec.InitBucketIncrementalURLs).To(BeEmpty())
+			Expect(cluster.Spec.InitBucketSecretName).To(BeEmpty())
+			Expect(cluster.Spec.InitBucketChecksums).To(BeEmpty())
+		})
+	})
+	When("restoring a database from a logical backup", func() {
+		var (
+			backupName string
+		)
+
+		BeforeEach(func() {
+			backupName = fmt.Sprintf("backup-logical-%d", rand.Int31())
+			createBackup(backupName, mysqlv1alpha1.MysqlBackupSpec{
+				ClusterName:      cluster.Name,
+				BackupURL:        "gs://bucket/logical.logical",
+				BackupSecretName: "backup-secret",
+				Type:             mysqlv1alpha1.LogicalBackup,
+			}, true)
+
+			restore.Spec.BackupName = backupName
+			restore.Spec.Database = "shop"
+			Expect(c.Create(context.TODO(), restore.Unwrap())).To(Succeed())
+		})
+
+		It("should load the database with a job without touching the cluster", func() {
+			job := &batchv1.Job{}
+			Eventually(func() error {
+				key := types.NamespacedName{Name: restore.GetNameForJob(), Namespace: ns}
+				return c.Get(context.TODO(), key, job)
+			}, timeout).Should(Succeed())
+
+			Expect(job.Spec.Template.Spec.Containers[0].Args).To(Equal([]string{
+				"restore-logical-backup", cluster.GetMasterHost(), "gs://bucket/logical.logical", "shop",
+			}))
+			Expect(job.Spec.Template.Spec.Containers[0].EnvFrom[0].SecretRef.Name).To(Equal("backup-secret"))
+
+			Eventually(testutil.RefreshFn(c, restore.Unwrap()), timeout).Should(
+				gm.HaveCondition(mysqlv1alpha1.MysqlRestoreComplete, corev1.ConditionFalse))
+
+			Expect(c.Get(context.TODO(), cluster.GetNamespacedName(), cluster.Unwrap())).To(Succeed())
+			Expect(*cluster.Spec.Replicas).To(Equal(int32(3)))
+			Expect(restore.Status.OriginalReplicas).To(BeNil())
+		})
+	})
+
+	When("restoring a database from a physical backup", func() {
+		BeforeEach(func() {
+			restore.Spec.BackupName = fmt.Sprintf("backup-%d", rand.Int31())
+			createBackup(restore.Spec.BackupName, mysqlv1alpha1.MysqlBackupSpec{
+				ClusterName: cluster.Name,
+				BackupURL:   "gs://bucket/full.xbackup.gz",
+			}, true)
+			restore.Spec.Database = "shop"
+			Expect(c.Create(context.TODO(), restore.Unwrap())).To(Succeed())
+		})
+
+		It("should fail", func() {
+			Eventually(testutil.RefreshFn(c, restore.Unwrap()), timeout).Should(
+				gm.HaveCondition(mysqlv1alpha1.MysqlRestoreFailed, corev1.ConditionTrue))
+		})
+	})
+})
@@ -19,6 +19,8 @@ package node
 import (
 	"context"
 	"fmt"
+	"path"
+	"reflect"
 	"regexp"
 	"strconv"
 	"time"
@@ -49,6 +51,11 @@ var log = logf.Log.WithName(controllerName)
 
 const controllerName = "controller.mysqlNode"
 
+const (
+	eventNormal  = "Normal"
+	eventWarning = "Warning"
+)
+
 // mysqlReconciliationTimeout the time that should last a reconciliation (this is used as a MySQL timout too)
 const mysqlReconciliationTimeout = 5 * time.Second
 
@@ -110,6 +117,24 @@ func isRunning(obj runtime.Object) bool {
 	return pod.Status.Phase == corev1.PodRunning
 }
 
+// isRoleChanged returns true if the role label of the pod is changed by the update
+func isRoleChanged(oldObj, newObj metav1.Object) bool {
+	return len(newObj.GetLabels()["role"]) > 0 && oldObj.GetLabels()["role"] != newObj.GetLabels()["role"]
+}
+
+// masterPodRequest maps a cluster to the reconcile request of its master pod
+func masterPodRequest(obj client.Object) []reconcile.Request {
+	cluster := mysqlcluster.New(obj.(*api.MysqlCluster))
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Name:      mysqlcluster.GetPodNameForHost(cluster.GetMasterHost()),
+				Namespace: cluster.Namespace,
+			},
+		},
+	}
+}
+
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
@@ -127,8 +152,10 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		// trigger node initialization only on pod update, after pod is created for a while
 		// also the pod should not be initialized before and should be running because the init
 		// timeout is ~5s (see above) and the cluster status can become obsolete
+		// the replication of the nodes which change their role, on failover, is reconfigured
 		UpdateFunc: func(evt event.UpdateEvent) bool {
-			return isOwnedByMySQL(evt.ObjectNew) && isRunning(evt.ObjectNew) && !isReady(evt.ObjectNew)
+			return isOwnedByMySQL(evt.ObjectNew) && isRunning(evt.ObjectNew) &&
+				(!isReady(evt.ObjectNew) || isRoleChanged(evt.ObjectOld, evt.ObjectNew))
 		},
 
 		DeleteFunc: func(evt event.DeleteEvent) bool {
@@ -139,6 +166,31 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch for changes of the replication source or of the durability of the clusters and
+	// reconcile their master
+	err = c.Watch(&source.Kind{Type: &api.MysqlCluster{}}, handler.EnqueueRequestsFromMapFunc(masterPodRequest),
+		predicate.Funcs{
+			CreateFunc: func(evt event.CreateEvent) bool {
+				return false
+			},
+			UpdateFunc: func(evt event.UpdateEvent) bool {
+				oldSpec := evt.ObjectOld.(*api.MysqlCluster).Spec
+				newSpec := evt.ObjectNew.(*api.MysqlCluster).Spec
+				return (newSpec.ReplicationSource != nil &&
+					!reflect.DeepEqual(oldSpec.ReplicationSource, newSpec.ReplicationSource)) ||
+					(newSpec.Durability != nil && !reflect.DeepEqual(oldSpec.Durability, newSpec.Durability))
+			},
+			DeleteFunc: func(evt event.DeleteEvent) bool {
+				return false
+			},
+			GenericFunc: func(evt event.GenericEvent) bool {
+				return false
+			},
+		})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -253,7 +305,128 @@ func (r *ReconcileMysqlNode) Reconcile(ctx context.Context, request reconcile.Re
 	updatePodStatusCondition(pod, mysqlcluster.NodeInitializedConditionType,
 		corev1.ConditionTrue, "mysqlInitializationSucceeded", "success")
 
-	return reconcile.Result{}, r.updatePod(ctx, pod)
+	if err = r.updatePod(ctx, pod); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// the master of a standby cluster replicates from the replication source
+	if err = r.reconcileReplicationSource(ctx, sql, cluster); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, r.reconcileSemiSync(ctx, sql, cluster)
+}
+
+// reconcileSemiSync enables the master or the replica side of the semi-sync replication by the
+// role of the node, which changes when the master moves
+func (r *ReconcileMysqlNode) reconcileSemiSync(ctx context.Context, sql SQLInterface, cluster *mysqlcluster.MysqlCluster) error {
+	if !cluster.IsSemiSync() {
+		return nil
+	}
+
+	cfg := &SemiSync{
+		Master:              cluster.GetMasterHost() == sql.Host(),
+		WaitForReplicaCount: cluster.GetSemiSyncWaitForReplicaCount(),
+		Timeout:             cluster.GetSemiSyncTimeout(),
+	}
+
+	log.V(1).Info("configure semi-sync replication", "host", sql.Host(), "master", cfg.Master)
+	return sql.ConfigureSemiSync(ctx, cfg)
+}
+
+// reconcileReplicationSource makes the master of a standby cluster replicate from the
+// replication source, or detaches it from the source once the standby is promoted
+func (r *ReconcileMysqlNode) reconcileReplicationSource(ctx context.Context, sql SQLInterface, cluster *mysqlcluster.MysqlCluster) error {
+	spec := cluster.Spec.ReplicationSource
+	if spec == nil || cluster.GetMasterHost() != sql.Host() {
+		return nil
+	}
+
+	masterHost, err := sql.GetMasterHost(ctx)
+	if err != nil {
+		return err
+	}
+
+	if spec.Promoted {
+		if masterHost != spec.Host {
+			return nil
+		}
+
+		log.Info("detaching the promoted standby from the replication source", "host", sql.Host(), "source", spec.Host)
+		if err = sql.ResetSlave(ctx); err != nil {
+			return err
+		}
+		r.recorder.Eventf(cluster.Unwrap(), eventNormal, "StandbyPromoted",
+			"master %s is detached from the replication source %s", sql.Host(), spec.Host)
+		return nil
+	}
+
+	if masterHost == spec.Host {
+		return nil
+	}
+
+	src, err := r.getReplicationSource(ctx, cluster)
+	if err != nil {
+		r.recorder.Eventf(cluster.Unwrap(), eventWarning, "ReplicationSourceFailed", "%s", err)
+		return err
+	}
+
+	enableSuperReadOnly, err := sql.DisableSuperReadOnly(ctx)
+	if err != nil {
+		return err
+	}
+	defer enableSuperReadOnly()
+
+	log.Info("run CHANGE MASTER TO the replication source", "host", sql.Host(), "source", spec.Host)
+	if err = sql.ChangeMasterToSource(ctx, src); err != nil {
+		r.recorder.Eventf(cluster.Unwrap(), eventWarning, "ReplicationSourceFailed", "%s", err)
+		return err
+	}
+
+	r.recorder.Eventf(cluster.Unwrap(), eventNormal, "ReplicationSourceConfigured",
+		"master %s replicates from %s", sql.Host(), spec.Host)
+	return nil
+}
+
+// getReplicationSource returns the connection settings of the replication source, with the
+// credentials from its secret
+func (r *ReconcileMysqlNode) getReplicationSource(ctx context.Context, cluster *mysqlcluster.MysqlCluster) (*ReplicationSource, error) {
+	spec := cluster.Spec.ReplicationSource
+
+	secret := &corev1.Secret{}
+	secretKey := types.NamespacedName{Name: spec.SecretName, Namespace: cluster.Namespace}
+	if err := r.Get(ctx, secretKey, secret); err != nil {
+		return nil, fmt.Errorf("failed to get the replication source secret: %s", err)
+	}
+
+	src := &ReplicationSource{
+		Host:     spec.Host,
+		Port:     cluster.GetReplicationSourcePort(),
+		User:     string(secret.Data["REPLICATION_USER"]),
+		Password: string(secret.Data["REPLICATION_PASSWORD"]),
+	}
+	if anyIsEmpty(src.User, src.Password) {
+		return nil, fmt.Errorf("validation error: the replication source credentials are empty")
+	}
+
+	if spec.TLS != nil {
+		tlsSecret := &corev1.Secret{}
+		tlsKey := types.NamespacedName{Name: spec.TLS.SecretName, Namespace: cluster.Namespace}
+		if err := r.Get(ctx, tlsKey, tlsSecret); err != nil {
+			return nil, fmt.Errorf("failed to get the replication source TLS secret: %s", err)
+		}
+
+		src.SSL = true
+		src.SSLVerifyServerCert = spec.TLS.VerifyServerCert
+		src.SSLCA = path.Join(constants.ReplicationSourceTLSPath, corev1.ServiceAccountRootCAKey)
+		// the client certificate is optional
+		if len(tlsSecret.Data[corev1.TLSCertKey]) > 0 && len(tlsSecret.Data[corev1.TLSPrivateKeyKey]) > 0 {
+			src.SSLCert = path.Join(constants.ReplicationSourceTLSPath, corev1.TLSCertKey)
+			src.SSLKey = path.Join(constants.ReplicationSourceTLSPath, corev1.TLSPrivateKeyKey)
+		}
+	}
+
+	return src, nil
 }
 
 // nolint: gocyclo
@@ -29,7 +29,10 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
@@ -189,6 +192,123 @@ var _ = Describe("MysqlNode controller", func() {
 	})
 })
 
+var _ = Describe("Replication source of standby clusters", func() {
+	var (
+		r       *ReconcileMysqlNode
+		cluster *mysqlcluster.MysqlCluster
+		sqli    *fakeSQLRunner
+	)
+
+	BeforeEach(func() {
+		cluster = mysqlcluster.New(&api.MysqlCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "standby", Namespace: "default"},
+			Spec: api.MysqlClusterSpec{
+				Replicas:   &one,
+				SecretName: "the-secret",
+				ReplicationSource: &api.ReplicationSource{
+					Host:       "primary.example.com",
+					SecretName: "source-secret",
+					TLS:        &api.ReplicationSourceTLS{SecretName: "source-tls"},
+				},
+			},
+		})
+
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "source-secret", Namespace: cluster.Namespace},
+				Data: map[string][]byte{
+					"REPLICATION_USER":     []byte("ru"),
+					"REPLICATION_PASSWORD": []byte("rup"),
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "source-tls", Namespace: cluster.Namespace},
+				Data:       map[string][]byte{"ca.crt": []byte("ca")},
+			},
+		).Build()
+
+		r = &ReconcileMysqlNode{Client: c, recorder: record.NewFakeRecorder(10)}
+		sqli = &fakeSQLRunner{host: cluster.GetMasterHost()}
+	})
+
+	It("should make the master replicate from the source", func() {
+		Expect(r.reconcileReplicationSource(context.TODO(), sqli, cluster)).To(Succeed())
+		Expect(sqli.source).To(Equal(&ReplicationSource{
+			Host:     "primary.example.com",
+			Port:     3306,
+			User:     "ru",
+			Password: "rup",
+			SSL:      true,
+			SSLCA:    "/var/run/replication-source-tls/ca.crt",
+		}))
+	})
+
+	It("should not change the replication of the replicas", func() {
+		sqli.host = cluster.GetPodHostname(1)
+		Expect(r.reconcileReplicationSource(context.TODO(), sqli, cluster)).To(Succeed())
+		Expect(sqli.source).To(BeNil())
+	})
+
+	It("should detach the master when the standby is promoted", func() {
+		Expect(r.reconcileReplicationSource(context.TODO(), sqli, cluster)).To(Succeed())
+		Expect(sqli.masterHost).To(Equal("primary.example.com"))
+
+		cluster.Spec.ReplicationSource.Promoted = true
+		Expect(r.reconcileReplicationSource(context.TODO(), sqli, cluster)).To(Succeed())
+		Expect(sqli.masterHost).To(BeEmpty())
+		Expect(sqli.source).To(BeNil())
+	})
+
+	It("should fail when the source credentials are missing", func() {
+		cluster.Spec.ReplicationSource.SecretName = "missing"
+		Expect(r.reconcileReplicationSource(context.TODO(), sqli, cluster)).ToNot(Succeed())
+		Expect(sqli.source).To(BeNil())
+	})
+})
+
+var _ = Describe("Semi-sync replication", func() {
+	var (
+		r       *ReconcileMysqlNode
+		cluster *mysqlcluster.MysqlCluster
+		sqli    *fakeSQLRunner
+	)
+
+	BeforeEach(func() {
+		cluster = mysqlcluster.New(&api.MysqlCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "semi-sync", Namespace: "default"},
+			Spec: api.MysqlClusterSpec{
+				Replicas:   &one,
+				SecretName: "the-secret",
+				Durability: &api.Durability{Mode: api.SemiSyncDurability, WaitForReplicaCount: 2},
+			},
+		})
+
+		r = &ReconcileMysqlNode{recorder: record.NewFakeRecorder(10)}
+		sqli = &fakeSQLRunner{host: cluster.GetPodHostname(1)}
+	})
+
+	It("should not configure the asynchronous clusters", func() {
+		cluster.Spec.Durability.Mode = api.AsyncDurability
+		Expect(r.reconcileSemiSync(context.TODO(), sqli, cluster)).To(Succeed())
+		Expect(sqli.semiSync).To(BeNil())
+	})
+
+	It("should enable the replica side on replicas", func() {
+		Expect(r.reconcileSemiSync(context.TODO(), sqli, cluster)).To(Succeed())
+		Expect(sqli.semiSync).To(Equal(&SemiSync{
+			Master:              false,
+			WaitForReplicaCount: 2,
+			Timeout:             mysqlcluster.DefaultSemiSyncTimeout,
+		}))
+	})
+
+	It("should enable the master side when the node becomes master", func() {
+		cluster.UpdateNodeConditionStatus(cluster.GetPodHostname(1), api.NodeConditionMaster, corev1.ConditionTrue)
+		Expect(r.reconcileSemiSync(context.TODO(), sqli, cluster)).To(Succeed())
+		Expect(sqli.semiSync.Master).To(BeTrue())
+	})
+})
+
 func podKey(cluster *mysqlcluster.MysqlCluster, index int) types.NamespacedName {
 	return types.NamespacedName{
 		Name:      fmt.Sprintf("%s-%d", cluster.GetNameForResource(mysqlcluster.StatefulSet), index),
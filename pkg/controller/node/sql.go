@@ -43,9 +43,36 @@ type SQLInterface interface {
 	IsConfigured(ctx context.Context) (bool, error)
 	SetPurgedGTID(ctx context.Context) error
 	MarkSetGTIDPurged(ctx context.Context) error
+	ChangeMasterToSource(ctx context.Context, src *ReplicationSource) error
+	GetMasterHost(ctx context.Context) (string, error)
+	ResetSlave(ctx context.Context) error
+	ConfigureSemiSync(ctx context.Context, cfg *SemiSync) error
 	Host() string
 }
 
+// SemiSync holds the semi-synchronous replication settings of a node
+type SemiSync struct {
+	// Master enables the master side of the semi-sync replication, else the replica side
+	Master              bool
+	WaitForReplicaCount int
+	Timeout             time.Duration
+}
+
+// ReplicationSource holds the connection settings of the external server from which the master
+// of a standby cluster replicates
+type ReplicationSource struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+
+	SSL                 bool
+	SSLCA               string
+	SSLCert             string
+	SSLKey              string
+	SSLVerifyServerCert bool
+}
+
 type nodeSQLRunner struct {
 	dsn  string
 	host string
@@ -125,6 +152,84 @@ func (r *nodeSQLRunner) ChangeMasterTo(ctx context.Context, masterHost, user, pa
 	return nil
 }
 
+// ChangeMasterToSource makes the node replicate from the given external source and starts slave.
+func (r *nodeSQLRunner) ChangeMasterToSource(ctx context.Context, src *ReplicationSource) error {
+	query := `
+      STOP SLAVE;
+	  CHANGE MASTER TO MASTER_AUTO_POSITION=1,
+		MASTER_HOST=?,
+		MASTER_PORT=?,
+		MASTER_USER=?,
+		MASTER_PASSWORD=?,
+		MASTER_CONNECT_RETRY=?,
+		MASTER_SSL=?,
+		MASTER_SSL_CA=?,
+		MASTER_SSL_CERT=?,
+		MASTER_SSL_KEY=?,
+		MASTER_SSL_VERIFY_SERVER_CERT=?;
+	  START SLAVE;
+	`
+	if err := r.runQuery(ctx, query,
+		src.Host, src.Port, src.User, src.Password, connRetry,
+		src.SSL, src.SSLCA, src.SSLCert, src.SSLKey, src.SSLVerifyServerCert,
+	); err != nil {
+		return fmt.Errorf("failed to replicate from %s, err: %s", src.Host, err)
+	}
+
+	return nil
+}
+
+// GetMasterHost returns the host from which the node is configured to replicate, or an empty
+// string if it's not a slave
+func (r *nodeSQLRunner) GetMasterHost(ctx context.Context) (string, error) {
+	query := "SELECT HOST FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME = ''"
+
+	var host string
+	if err := r.readFromMysql(ctx, query, &host); err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	return host, nil
+}
+
+// ResetSlave stops the replication and removes the replication configuration of the node
+func (r *nodeSQLRunner) ResetSlave(ctx context.Context) error {
+	if err := r.runQuery(ctx, "STOP SLAVE; RESET SLAVE ALL;"); err != nil {
+		return fmt.Errorf("failed to reset slave node, err: %s", err)
+	}
+
+	return nil
+}
+
+// ConfigureSemiSync enables the side of the semi-sync replication that matches the role of the
+// node. The replica acknowledges the transactions only after the IO thread is restarted.
+func (r *nodeSQLRunner) ConfigureSemiSync(ctx context.Context, cfg *SemiSync) error {
+	var slaveEnabled bool
+	if err := r.readFromMysql(ctx, "SELECT @@GLOBAL.rpl_semi_sync_slave_enabled", &slaveEnabled); err != nil {
+		return fmt.Errorf("failed to read the semi-sync status, err: %s", err)
+	}
+
+	query := `
+	  SET GLOBAL rpl_semi_sync_master_wait_for_slave_count = ?;
+	  SET GLOBAL rpl_semi_sync_master_timeout = ?;
+	  SET GLOBAL rpl_semi_sync_master_enabled = ?;
+	  SET GLOBAL rpl_semi_sync_slave_enabled = ?;
+	`
+	if err := r.runQuery(ctx, query,
+		cfg.WaitForReplicaCount, cfg.Timeout.Milliseconds(), cfg.Master, !cfg.Master,
+	); err != nil {
+		return fmt.Errorf("failed to configure semi-sync, err: %s", err)
+	}
+
+	if !cfg.Master && !slaveEnabled {
+		if err := r.runQuery(ctx, "STOP SLAVE IO_THREAD; START SLAVE IO_THREAD;"); err != nil {
+			return fmt.Errorf("failed to restart the slave IO thread, err: %s", err)
+		}
+	}
+
+	return nil
+}
+
 // MarkConfigurationDone write in a MEMORY table value. The readiness probe checks for that value to exist to succeed.
 func (r *nodeSQLRunner) MarkConfigurationDone(ctx context.Context) error {
 	return r.writeStatusValue(ctx, "configured", "1")
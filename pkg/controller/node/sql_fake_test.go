@@ -24,7 +24,16 @@ import (
 	. "github.com/onsi/gomega"
 )
 
-type fakeSQLRunner struct{}
+type fakeSQLRunner struct {
+	host string
+
+	// masterHost is the host from which the node replicates
+	masterHost string
+	// source is the replication source set by ChangeMasterToSource
+	source *ReplicationSource
+	// semiSync is the semi-sync configuration set by ConfigureSemiSync
+	semiSync *SemiSync
+}
 
 // test if fakeer implements interface
 var _ SQLInterface = &fakeSQLRunner{}
@@ -46,7 +55,7 @@ func (f *fakeSQLRunner) MarkConfigurationDone(ctx context.Context) error {
 }
 
 func (f *fakeSQLRunner) Host() string {
-	return ""
+	return f.host
 }
 
 func (f *fakeSQLRunner) SetPurgedGTID(ctx context.Context) error {
@@ -61,6 +70,27 @@ func (f *fakeSQLRunner) MarkSetGTIDPurged(ctx context.Context) error {
 	return nil
 }
 
+func (f *fakeSQLRunner) ChangeMasterToSource(ctx context.Context, src *ReplicationSource) error {
+	f.source = src
+	f.masterHost = src.Host
+	return nil
+}
+
+func (f *fakeSQLRunner) GetMasterHost(ctx context.Context) (string, error) {
+	return f.masterHost, nil
+}
+
+func (f *fakeSQLRunner) ConfigureSemiSync(ctx context.Context, cfg *SemiSync) error {
+	f.semiSync = cfg
+	return nil
+}
+
+func (f *fakeSQLRunner) ResetSlave(ctx context.Context) error {
+	f.source = nil
+	f.masterHost = ""
+	return nil
+}
+
 var _ = Describe("SQL functions", func() {
 	It("should find not found error", func() {
 		err := fmt.Errorf("Error 1146: Table 'a.a' doesn't exist")
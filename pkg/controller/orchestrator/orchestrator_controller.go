@@ -46,8 +46,8 @@ import (
 )
 
 const (
-	eventNormal = "Normal"
-	//eventWarning   = "Warning"
+	eventNormal    = "Normal"
+	eventWarning   = "Warning"
 	controllerName = "controller.orchestrator"
 
 	// OrchestratorFinalizer is set when the cluster is registered in
@@ -212,7 +212,7 @@ func (r *ReconcileMysqlCluster) Reconcile(ctx context.Context, request reconcile
 
 	// TODO no sync should be triggered if no replica is available
 
-	orcSyncer := NewOrcUpdater(cluster, r.recorder, r.orcClient)
+	orcSyncer := NewOrcUpdater(r.Client, cluster, r.recorder, r.orcClient)
 	if err := syncer.Sync(context.TODO(), orcSyncer, r.recorder); err != nil {
 		return reconcile.Result{}, err
 	}
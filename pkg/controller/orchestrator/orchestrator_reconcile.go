@@ -22,6 +22,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -30,6 +31,7 @@ import (
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
 	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
@@ -48,7 +50,23 @@ const (
 	uptimeGraceTime              = 15
 )
 
+// candidateRefreshInterval is how often the promotion rules are registered again in
+// orchestrator, which expires them after an hour by default
+var candidateRefreshInterval = 10 * time.Minute
+
+// registeredCandidates holds the last promotion rule registered in orchestrator for each host
+var registeredCandidates = struct {
+	sync.Mutex
+	hosts map[string]candidateRegistration
+}{hosts: map[string]candidateRegistration{}}
+
+type candidateRegistration struct {
+	rule orc.CandidatePromotionRule
+	time time.Time
+}
+
 type orcUpdater struct {
+	client.Client
 	cluster   *mysqlcluster.MysqlCluster
 	recorder  record.EventRecorder
 	orcClient orc.Interface
@@ -57,8 +75,9 @@ type orcUpdater struct {
 }
 
 // NewOrcUpdater returns a syncer that updates cluster status from orchestrator.
-func NewOrcUpdater(cluster *mysqlcluster.MysqlCluster, r record.EventRecorder, orcClient orc.Interface) syncer.Interface {
+func NewOrcUpdater(c client.Client, cluster *mysqlcluster.MysqlCluster, r record.EventRecorder, orcClient orc.Interface) syncer.Interface {
 	return &orcUpdater{
+		Client:    c,
 		cluster:   cluster,
 		recorder:  r,
 		orcClient: orcClient,
@@ -84,12 +103,19 @@ func (ou *orcUpdater) Sync(ctx context.Context) (syncer.SyncResult, error) {
 		return syncer.SyncResult{}, err
 	}
 
+	// report if the master replicates from the replication source, the cluster is read only
+	// while it does
+	ou.updateClusterStandbyStatus(master)
+
 	// register nodes in orchestrator if needed, or remove nodes from status
 	instances, undiscoveredInstances, toRemoveInstances := ou.updateNodesInOrc(allInstances)
 
 	// register new nodes into orchestrator
 	ou.discoverNodesInOrc(undiscoveredInstances)
 
+	// register the promotion rules of the nodes into orchestrator
+	ou.registerCandidatesInOrc(ctx, instances)
+
 	// remove nodes which are not registered in orchestrator from status
 	ou.removeNodeConditionNotInOrc(instances)
 
@@ -119,6 +145,9 @@ func (ou *orcUpdater) Sync(ctx context.Context) (syncer.SyncResult, error) {
 		ou.log.Error(err, "failed to acknowledge recoveries", "ack_recoveries", toAck)
 	}
 
+	// drive the switchover requested in the spec, depends on cluster ready status
+	ou.reconcileSwitchover(master)
+
 	return syncer.SyncResult{}, nil
 }
 
@@ -143,8 +172,21 @@ func (ou *orcUpdater) getFromOrchestrator() (instances []orc.Instance, master *o
 		ou.log.V(0).Info("can't get master from Orchestrator", "error", "not found")
 	}
 
-	// check if it's the same master with one that is determined from all instances
+	// the master of a standby replicates from the replication source, which is not a node of
+	// the cluster, so it's the top of the nodes. The source is ignored even if orchestrator
+	// discovered it, in which case orchestrator sees it as the master.
 	insts := InstancesSet(instances)
+	if ou.cluster.Spec.ReplicationSource != nil {
+		insts = ou.withoutReplicationSource(insts)
+		if master != nil && !ou.cluster.IsNodeHostname(master.Key.Hostname) {
+			ou.log.V(0).Info("the replication source is discovered by orchestrator", "source", master.Key.Hostname)
+			if m := insts.DetermineMaster(); m != nil {
+				master = InstancesSet(instances).GetInstance(m.Key.Hostname)
+			}
+		}
+	}
+
+	// check if it's the same master with one that is determined from all instances
 	m := insts.DetermineMaster()
 	if master == nil || m == nil || master.Key.Hostname != m.Key.Hostname {
 		// throw a warning
@@ -181,7 +223,7 @@ func (ou *orcUpdater) updateClusterReadyStatus() {
 		}
 	}
 
-	if !hasMaster && !ou.cluster.Spec.ReadOnly && int(*ou.cluster.Spec.Replicas) > 0 {
+	if !hasMaster && !ou.cluster.IsReadOnly() && int(*ou.cluster.Spec.Replicas) > 0 {
 		ou.cluster.UpdateStatusCondition(api.ClusterConditionReady, core.ConditionFalse, "NoMaster",
 			"Cluster has no designated master")
 		return
@@ -219,6 +261,7 @@ func (ou *orcUpdater) updateNodesStatus(insts InstancesSet, master *orc.Instance
 				ou.updateNodeCondition(host, api.NodeConditionLagged, core.ConditionUnknown)
 				ou.updateNodeCondition(host, api.NodeConditionReplicating, core.ConditionUnknown)
 				ou.updateNodeCondition(host, api.NodeConditionMaster, core.ConditionUnknown)
+				ou.cluster.UpdateNodeReplicationLag(host, nil)
 			}
 			continue
 		}
@@ -228,7 +271,16 @@ func (ou *orcUpdater) updateNodesStatus(insts InstancesSet, master *orc.Instance
 			// sometimes the pt-hearbeat is slowed down, but it doesn't mean the master
 			// is lagging (it's not replicating). So always set False for master.
 			ou.updateNodeCondition(host, api.NodeConditionLagged, core.ConditionFalse)
+			ou.cluster.UpdateNodeReplicationLag(host, nil)
 		} else {
+			// the lag is recorded to select the least lagged replica for backups
+			if node.SlaveLagSeconds.Valid {
+				lag := node.SlaveLagSeconds.Int64
+				ou.cluster.UpdateNodeReplicationLag(host, &lag)
+			} else {
+				ou.cluster.UpdateNodeReplicationLag(host, nil)
+			}
+
 			if !node.SlaveLagSeconds.Valid {
 				ou.updateNodeCondition(host, api.NodeConditionLagged, core.ConditionUnknown)
 			} else if node.SlaveLagSeconds.Int64 <= maxSlaveLatency {
@@ -258,6 +310,15 @@ func (ou *orcUpdater) updateNodesStatus(insts InstancesSet, master *orc.Instance
 		} else {
 			ou.updateNodeCondition(host, api.NodeConditionReadOnly, core.ConditionFalse)
 		}
+
+		// set node semi-sync, the master falls back to async when the replicas don't acknowledge
+		// the transactions in time
+		isMaster := master != nil && host == master.Key.Hostname
+		if (isMaster && node.SemiSyncMasterStatus) || (!isMaster && node.SemiSyncReplicaStatus) {
+			ou.updateNodeCondition(host, api.NodeConditionSemiSync, core.ConditionTrue)
+		} else if ou.cluster.IsSemiSync() || ou.cluster.GetNodeCondition(host, api.NodeConditionSemiSync) != nil {
+			ou.updateNodeCondition(host, api.NodeConditionSemiSync, core.ConditionFalse)
+		}
 	}
 }
 
@@ -289,6 +350,57 @@ func (ou *orcUpdater) updateClusterReadOnlyStatus(insts InstancesSet) {
 	}
 }
 
+// updateClusterStandbyStatus sets the Standby condition of the clusters with a replication
+// source, from the replication of the master. The condition is False only after the standby is
+// promoted and its master is detached from the source.
+func (ou *orcUpdater) updateClusterStandbyStatus(master *orc.Instance) {
+	source := ou.cluster.Spec.ReplicationSource
+	if source == nil || master == nil {
+		return
+	}
+
+	host := master.Key.Hostname
+	replicating := ou.replicatesFromSource(master)
+
+	switch {
+	case replicating && master.Slave_SQL_Running && master.Slave_IO_Running:
+		ou.cluster.UpdateStatusCondition(api.ClusterConditionStandby, core.ConditionTrue, "ReplicatingFromSource",
+			fmt.Sprintf("Master %s replicates from %s", host, master.MasterKey.Hostname))
+	case replicating:
+		ou.cluster.UpdateStatusCondition(api.ClusterConditionStandby, core.ConditionTrue, "SourceReplicationStopped",
+			fmt.Sprintf("Master %s doesn't replicate from %s, the replication is stopped", host,
+				master.MasterKey.Hostname))
+	case source.Promoted:
+		ou.cluster.UpdateStatusCondition(api.ClusterConditionStandby, core.ConditionFalse, "Promoted",
+			fmt.Sprintf("Master %s is detached from the replication source", host))
+	default:
+		ou.cluster.UpdateStatusCondition(api.ClusterConditionStandby, core.ConditionTrue, "NotReplicatingFromSource",
+			fmt.Sprintf("Master %s doesn't replicate from %s yet", host, source.Host))
+	}
+}
+
+// replicatesFromSource returns true if the instance replicates from a host that is not a node of
+// the cluster, which for a standby is the replication source
+func (ou *orcUpdater) replicatesFromSource(inst *orc.Instance) bool {
+	return len(inst.MasterKey.Hostname) > 0 && !ou.cluster.IsNodeHostname(inst.MasterKey.Hostname)
+}
+
+// withoutReplicationSource returns the nodes of the cluster from the given instances, the ones
+// that replicate from the source being the top of the topology
+func (ou *orcUpdater) withoutReplicationSource(insts InstancesSet) InstancesSet {
+	nodes := InstancesSet{}
+	for _, inst := range insts {
+		if !ou.cluster.IsNodeHostname(inst.Key.Hostname) {
+			continue
+		}
+		if ou.replicatesFromSource(&inst) {
+			inst.MasterKey = orc.InstanceKey{}
+		}
+		nodes = append(nodes, inst)
+	}
+	return nodes
+}
+
 func (ou *orcUpdater) updateClusterFailoverInProgressStatus(master *orc.Instance) {
 	// check if the master is up to date and is not downtime to remove in progress failover condition
 	if master != nil && master.SecondsSinceLastSeen.Valid && master.SecondsSinceLastSeen.Int64 < 5 {
@@ -362,6 +474,7 @@ func (ou *orcUpdater) forgetNodesFromOrc(keys []orc.InstanceKey) {
 			if err := ou.orcClient.Forget(key.Hostname, key.Port); err != nil {
 				ou.log.Error(err, "failed to forget host with orchestrator", "instance", key.Hostname)
 			}
+			forgetCandidate(key.Hostname)
 		}
 	}
 }
@@ -377,6 +490,83 @@ func (ou *orcUpdater) discoverNodesInOrc(keys []orc.InstanceKey) {
 	}
 }
 
+// registerCandidatesInOrc registers the promotion rules of the nodes in orchestrator when they
+// change or before they expire
+func (ou *orcUpdater) registerCandidatesInOrc(ctx context.Context, instances InstancesSet) {
+	if len(ou.cluster.Spec.PromotionRules) == 0 || ou.cluster.DeletionTimestamp != nil {
+		return
+	}
+
+	podLabels, err := ou.getPodLabels(ctx)
+	if err != nil {
+		ou.log.Error(err, "failed to get the pods, can't register the promotion rules")
+		return
+	}
+
+	for _, inst := range instances {
+		ordinal, err := indexInSts(inst.Key.Hostname)
+		if err != nil {
+			continue
+		}
+
+		podName := mysqlcluster.GetPodNameForHost(inst.Key.Hostname)
+		rule := orc.CandidatePromotionRule(ou.cluster.GetPromotionRule(ordinal, podLabels[podName]))
+		if !shouldRegisterCandidate(inst, rule) {
+			continue
+		}
+
+		if err := ou.orcClient.RegisterCandidate(inst.Key, rule); err != nil {
+			ou.log.Error(err, "failed to register the promotion rule in orchestrator",
+				"instance", inst.Key.Hostname, "rule", rule)
+			continue
+		}
+
+		ou.log.V(1).Info("registered the promotion rule in orchestrator", "instance", inst.Key.Hostname, "rule", rule)
+		registeredCandidates.Lock()
+		registeredCandidates.hosts[inst.Key.Hostname] = candidateRegistration{rule: rule, time: time.Now()}
+		registeredCandidates.Unlock()
+	}
+}
+
+// getPodLabels returns the labels of the cluster pods, by pod name
+func (ou *orcUpdater) getPodLabels(ctx context.Context) (map[string]map[string]string, error) {
+	podLabels := map[string]map[string]string{}
+
+	pods := &core.PodList{}
+	if err := ou.List(ctx, pods, client.InNamespace(ou.cluster.Namespace),
+		client.MatchingLabels(ou.cluster.GetSelectorLabels())); err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		podLabels[pod.Name] = pod.Labels
+	}
+
+	return podLabels, nil
+}
+
+// shouldRegisterCandidate returns true if orchestrator reports another promotion rule for the
+// instance than the desired one, or if the registration should be refreshed
+func shouldRegisterCandidate(inst orc.Instance, rule orc.CandidatePromotionRule) bool {
+	if inst.PromotionRule != rule {
+		return true
+	}
+
+	registeredCandidates.Lock()
+	defer registeredCandidates.Unlock()
+
+	last, ok := registeredCandidates.hosts[inst.Key.Hostname]
+	return !ok || last.rule != rule || time.Since(last.time) > candidateRefreshInterval
+}
+
+// forgetCandidate removes the promotion rule registration of a host forgotten by orchestrator
+func forgetCandidate(host string) {
+	registeredCandidates.Lock()
+	defer registeredCandidates.Unlock()
+
+	delete(registeredCandidates.hosts, host)
+}
+
 func (ou *orcUpdater) getRecoveriesToAck(recoveries []orc.TopologyRecovery) []orc.TopologyRecovery {
 	toAck := []orc.TopologyRecovery{}
 
@@ -462,6 +652,7 @@ func (ou *orcUpdater) removeNodeConditionNotInOrc(insts InstancesSet) {
 			ou.updateNodeCondition(ns.Name, api.NodeConditionReplicating, core.ConditionUnknown)
 			ou.updateNodeCondition(ns.Name, api.NodeConditionMaster, core.ConditionUnknown)
 			ou.updateNodeCondition(ns.Name, api.NodeConditionReadOnly, core.ConditionUnknown)
+			ou.cluster.UpdateNodeReplicationLag(ns.Name, nil)
 		}
 	}
 
@@ -549,7 +740,7 @@ func (ou *orcUpdater) markReadOnlyNodesInOrc(insts InstancesSet, master *orc.Ins
 			continue
 		}
 
-		if ou.cluster.Spec.ReadOnly {
+		if ou.cluster.IsReadOnly() {
 			if err = ou.setReadOnlyNode(inst); err != nil {
 				ou.log.Error(err, "failed to set read only", "instance", instToLog(&inst))
 			}
@@ -32,7 +32,10 @@ import (
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
 	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
@@ -46,6 +49,7 @@ var _ = Describe("Orchestrator reconciler", func() {
 		orcClient *fakeOrc.OrcFakeClient
 		rec       *record.FakeRecorder
 		orcSyncer syncer.Interface
+		c         client.Client
 	)
 
 	BeforeEach(func() {
@@ -56,6 +60,7 @@ var _ = Describe("Orchestrator reconciler", func() {
 
 		rec = record.NewFakeRecorder(100)
 		orcClient = fakeOrc.New()
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
 		cluster = mysqlcluster.New(&api.MysqlCluster{
 			ObjectMeta: metav1.ObjectMeta{Name: clusterKey.Name, Namespace: clusterKey.Namespace},
 			Status: api.MysqlClusterStatus{
@@ -67,7 +72,7 @@ var _ = Describe("Orchestrator reconciler", func() {
 			},
 		})
 
-		orcSyncer = NewOrcUpdater(cluster, rec, orcClient)
+		orcSyncer = NewOrcUpdater(c, cluster, rec, orcClient)
 	})
 
 	When("cluster does not exists in orchestrator", func() {
@@ -372,7 +377,7 @@ var _ = Describe("Orchestrator reconciler", func() {
 		)
 
 		BeforeEach(func() {
-			updater = NewOrcUpdater(cluster, rec, orcClient).(*orcUpdater)
+			updater = NewOrcUpdater(c, cluster, rec, orcClient).(*orcUpdater)
 			// set cluster on readonly, master should be in read only state
 			orcClient.AddInstance(orc.Instance{
 				ClusterName: cluster.GetClusterAlias(),
@@ -392,6 +397,7 @@ var _ = Describe("Orchestrator reconciler", func() {
 				// set replication running on replica
 				Slave_SQL_Running: true,
 				Slave_IO_Running:  true,
+				SlaveLagSeconds:   sql.NullInt64{Valid: true, Int64: 3},
 				// mark instance as uptodate
 				IsUpToDate:        true,
 				IsRecentlyChecked: true,
@@ -410,6 +416,28 @@ var _ = Describe("Orchestrator reconciler", func() {
 			Expect(cluster.GetNodeStatusFor(cluster.GetPodHostname(1))).To(haveNodeCondWithStatus(api.NodeConditionReplicating, core.ConditionTrue))
 		})
 
+		It("should record the replication lag of the replicas", func() {
+			Expect(cluster.GetNodeStatusFor(cluster.GetPodHostname(0)).ReplicationLagSeconds).To(BeNil())
+			Expect(cluster.GetNodeStatusFor(cluster.GetPodHostname(1)).ReplicationLagSeconds).To(PointTo(Equal(int64(3))))
+		})
+
+		It("should report the semi-sync status of the nodes", func() {
+			Expect(cluster.GetNodeCondition(cluster.GetPodHostname(0), api.NodeConditionSemiSync)).To(BeNil())
+
+			cluster.Spec.Durability = &api.Durability{Mode: api.SemiSyncDurability}
+			orcClient.Clusters[cluster.GetClusterAlias()][0].SemiSyncMasterStatus = true
+
+			insts, _ := orcClient.Cluster(cluster.GetClusterAlias())
+			master, _ := orcClient.Master(cluster.GetClusterAlias())
+			updater.updateNodesStatus(insts, master)
+
+			Expect(cluster.GetNodeStatusFor(cluster.GetPodHostname(0))).To(
+				haveNodeCondWithStatus(api.NodeConditionSemiSync, core.ConditionTrue))
+			// the replica doesn't acknowledge the transactions
+			Expect(cluster.GetNodeStatusFor(cluster.GetPodHostname(1))).To(
+				haveNodeCondWithStatus(api.NodeConditionSemiSync, core.ConditionFalse))
+		})
+
 		It("should set the master readOnly when cluster is read only", func() {
 			cluster.Spec.ReadOnly = true
 
@@ -555,6 +583,280 @@ var _ = Describe("Orchestrator reconciler", func() {
 			})
 		})
 
+		When("a switchover is requested", func() {
+			BeforeEach(func() {
+				cluster.Spec.Replicas = &two
+				cluster.Status.ReadyNodes = 2
+				updater.updateClusterReadyStatus()
+				Expect(cluster.IsClusterReady()).To(BeTrue())
+				Expect(c.Create(context.TODO(), cluster.Unwrap())).To(Succeed())
+			})
+
+			It("should promote the target pod", func() {
+				cluster.Spec.Switchover = &api.Switchover{ID: "maintenance", TargetPod: cluster.Name + "-mysql-1"}
+				master, _ := orcClient.Master(cluster.GetClusterAlias())
+				updater.reconcileSwitchover(master)
+
+				Expect(orcClient.Takeovers).To(ConsistOf(orc.InstanceKey{Hostname: cluster.GetPodHostname(1), Port: mysqlPort}))
+				Expect(cluster.Status.Switchover).To(PointTo(MatchFields(IgnoreExtras, Fields{
+					"ID":         Equal("maintenance"),
+					"Phase":      Equal(api.SwitchoverSucceeded),
+					"FromMaster": Equal(cluster.GetPodHostname(0)),
+					"ToMaster":   Equal(cluster.GetPodHostname(1)),
+				})))
+				Expect(cluster.Status).To(haveCondWithStatus(api.ClusterConditionSwitchoverInProgress,
+					core.ConditionFalse, "SwitchoverSucceeded"))
+				Expect(rec.Events).To(Receive(ContainSubstring("SwitchoverStarted")))
+				Expect(rec.Events).To(Receive(ContainSubstring("SwitchoverSucceeded")))
+
+				// the switchover is done only once for an ID
+				master, _ = orcClient.Master(cluster.GetClusterAlias())
+				updater.reconcileSwitchover(master)
+				Expect(orcClient.Takeovers).To(HaveLen(1))
+			})
+
+			It("should save the running switchover before the takeover", func() {
+				cluster.Spec.Switchover = &api.Switchover{ID: "maintenance", TargetPod: cluster.Name + "-mysql-1"}
+				master, _ := orcClient.Master(cluster.GetClusterAlias())
+				updater.reconcileSwitchover(master)
+				Expect(cluster.Status.Switchover.Phase).To(Equal(api.SwitchoverSucceeded))
+
+				saved := &api.MysqlCluster{}
+				Expect(c.Get(context.TODO(), cluster.GetNamespacedName(), saved)).To(Succeed())
+				Expect(saved.Status.Switchover).To(PointTo(MatchFields(IgnoreExtras, Fields{
+					"ID":         Equal("maintenance"),
+					"Phase":      Equal(api.SwitchoverRunning),
+					"FromMaster": Equal(cluster.GetPodHostname(0)),
+				})))
+				Expect(saved.ResourceVersion).To(Equal(cluster.ResourceVersion))
+			})
+
+			It("should not take over the master when the switchover can't be saved", func() {
+				Expect(c.Delete(context.TODO(), cluster.Unwrap())).To(Succeed())
+				cluster.Spec.Switchover = &api.Switchover{ID: "maintenance"}
+				master, _ := orcClient.Master(cluster.GetClusterAlias())
+				updater.reconcileSwitchover(master)
+
+				Expect(orcClient.Takeovers).To(BeEmpty())
+				Expect(cluster.Status.Switchover.Phase).To(Equal(api.SwitchoverPending))
+				Expect(cluster.GetClusterCondition(api.ClusterConditionSwitchoverInProgress)).To(BeNil())
+			})
+
+			It("should complete a running switchover once the master was taken over", func() {
+				cluster.Spec.Switchover = &api.Switchover{ID: "maintenance"}
+				start := metav1.Now()
+				cluster.Status.Switchover = &api.SwitchoverStatus{
+					ID:         "maintenance",
+					Phase:      api.SwitchoverRunning,
+					FromMaster: cluster.GetPodHostname(1),
+					StartTime:  &start,
+				}
+				master, _ := orcClient.Master(cluster.GetClusterAlias())
+				updater.reconcileSwitchover(master)
+
+				Expect(orcClient.Takeovers).To(BeEmpty())
+				Expect(cluster.Status.Switchover.Phase).To(Equal(api.SwitchoverSucceeded))
+				Expect(cluster.Status.Switchover.ToMaster).To(Equal(cluster.GetPodHostname(0)))
+			})
+
+			It("should let orchestrator select the new master", func() {
+				cluster.Spec.Switchover = &api.Switchover{ID: "maintenance"}
+				master, _ := orcClient.Master(cluster.GetClusterAlias())
+				updater.reconcileSwitchover(master)
+
+				Expect(cluster.Status.Switchover.Phase).To(Equal(api.SwitchoverSucceeded))
+				Expect(cluster.Status.Switchover.ToMaster).To(Equal(cluster.GetPodHostname(1)))
+			})
+
+			It("should wait for the failover to finish", func() {
+				cluster.UpdateStatusCondition(api.ClusterConditionFailoverInProgress, core.ConditionTrue,
+					"TestFailover", "Failover is in progress")
+				cluster.Spec.Switchover = &api.Switchover{ID: "maintenance"}
+				master, _ := orcClient.Master(cluster.GetClusterAlias())
+				updater.reconcileSwitchover(master)
+
+				Expect(orcClient.Takeovers).To(BeEmpty())
+				Expect(cluster.Status.Switchover.Phase).To(Equal(api.SwitchoverPending))
+			})
+
+			It("should fail for a pod that is not part of the cluster", func() {
+				cluster.Spec.Switchover = &api.Switchover{ID: "maintenance", TargetPod: "other-mysql-1"}
+				master, _ := orcClient.Master(cluster.GetClusterAlias())
+				updater.reconcileSwitchover(master)
+
+				Expect(orcClient.Takeovers).To(BeEmpty())
+				Expect(cluster.Status.Switchover.Phase).To(Equal(api.SwitchoverFailed))
+				Expect(rec.Events).To(Receive(ContainSubstring("SwitchoverFailed")))
+			})
+
+			It("should fail when the new master is not writable in time", func() {
+				cluster.Spec.Switchover = &api.Switchover{ID: "maintenance", TargetPod: cluster.Name + "-mysql-1"}
+				start := metav1.NewTime(time.Now().Add(-2 * switchoverTimeout))
+				cluster.Status.Switchover = &api.SwitchoverStatus{
+					ID:         "maintenance",
+					Phase:      api.SwitchoverRunning,
+					FromMaster: cluster.GetPodHostname(0),
+					ToMaster:   cluster.GetPodHostname(1),
+					StartTime:  &start,
+				}
+				master, _ := orcClient.Master(cluster.GetClusterAlias())
+				updater.reconcileSwitchover(master)
+
+				Expect(cluster.Status.Switchover.Phase).To(Equal(api.SwitchoverFailed))
+			})
+		})
+
+		When("promotion rules are set", func() {
+			var (
+				insts []orc.Instance
+			)
+
+			BeforeEach(func() {
+				podLabels := cluster.GetSelectorLabels()
+				podLabels["node-pool"] = "spot"
+				Expect(c.Create(context.TODO(), &core.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      cluster.Name + "-mysql-1",
+						Namespace: cluster.Namespace,
+						Labels:    podLabels,
+					},
+				})).To(Succeed())
+
+				cluster.Spec.PromotionRules = []api.PromotionRule{
+					{Rule: api.PreferPromotion, Ordinals: []int32{0}},
+					{Rule: api.MustNotPromotion, PodSelector: map[string]string{"node-pool": "spot"}},
+				}
+				insts, _ = orcClient.Cluster(cluster.GetClusterAlias())
+			})
+
+			It("should register the promotion rules in orchestrator", func() {
+				updater.registerCandidatesInOrc(context.TODO(), insts)
+
+				insts, _ = orcClient.Cluster(cluster.GetClusterAlias())
+				Expect(InstancesSet(insts).GetInstance(cluster.GetPodHostname(0)).PromotionRule).To(
+					Equal(orc.PreferPromoteRule))
+				Expect(InstancesSet(insts).GetInstance(cluster.GetPodHostname(1)).PromotionRule).To(
+					Equal(orc.MustNotPromoteRule))
+			})
+
+			It("should refresh the promotion rules before they expire", func() {
+				updater.registerCandidatesInOrc(context.TODO(), insts)
+				Expect(orcClient.Candidates).To(HaveLen(2))
+
+				insts, _ = orcClient.Cluster(cluster.GetClusterAlias())
+				updater.registerCandidatesInOrc(context.TODO(), insts)
+				Expect(orcClient.Candidates).To(HaveLen(2))
+
+				defer func(interval time.Duration) { candidateRefreshInterval = interval }(candidateRefreshInterval)
+				candidateRefreshInterval = 0
+				updater.registerCandidatesInOrc(context.TODO(), insts)
+				Expect(orcClient.Candidates).To(HaveLen(4))
+			})
+
+			It("should register the rule again when it changes", func() {
+				updater.registerCandidatesInOrc(context.TODO(), insts)
+
+				cluster.Spec.PromotionRules = cluster.Spec.PromotionRules[1:]
+				insts, _ = orcClient.Cluster(cluster.GetClusterAlias())
+				updater.registerCandidatesInOrc(context.TODO(), insts)
+
+				Expect(orcClient.Candidates).To(HaveLen(3))
+				insts, _ = orcClient.Cluster(cluster.GetClusterAlias())
+				Expect(InstancesSet(insts).GetInstance(cluster.GetPodHostname(0)).PromotionRule).To(
+					Equal(orc.NeutralPromoteRule))
+			})
+		})
+
+		When("the cluster is a standby", func() {
+			var source string
+
+			BeforeEach(func() {
+				source = "primary.example.com"
+				cluster.Spec.ReplicationSource = &api.ReplicationSource{Host: source, SecretName: "repl"}
+
+				// the master replicates from the source
+				node0 := orcClient.Clusters[cluster.GetClusterAlias()][0]
+				node0.MasterKey = orc.InstanceKey{Hostname: source, Port: mysqlPort}
+				node0.Slave_SQL_Running = true
+				node0.Slave_IO_Running = true
+			})
+
+			It("should keep the master replicating from the source read only", func() {
+				insts, master, err := updater.getFromOrchestrator()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(master).ToNot(BeNil())
+				Expect(master.Key.Hostname).To(Equal(cluster.GetPodHostname(0)))
+
+				updater.updateClusterStandbyStatus(master)
+				Expect(cluster.Status).To(haveCondWithStatus(api.ClusterConditionStandby, core.ConditionTrue,
+					"ReplicatingFromSource"))
+
+				updater.markReadOnlyNodesInOrc(insts, master)
+				insts, _ = orcClient.Cluster(cluster.GetClusterAlias())
+				Expect(InstancesSet(insts).GetInstance(cluster.GetPodHostname(0)).ReadOnly).To(BeTrue())
+			})
+
+			It("should make the master writable once it's detached from the source", func() {
+				cluster.Spec.ReplicationSource.Promoted = true
+
+				insts, master, err := updater.getFromOrchestrator()
+				Expect(err).ToNot(HaveOccurred())
+				updater.updateClusterStandbyStatus(master)
+				updater.markReadOnlyNodesInOrc(insts, master)
+
+				// still read only until the replication from the source is stopped
+				insts, _ = orcClient.Cluster(cluster.GetClusterAlias())
+				Expect(InstancesSet(insts).GetInstance(cluster.GetPodHostname(0)).ReadOnly).To(BeTrue())
+
+				// the node controller detaches the master
+				node0 := orcClient.Clusters[cluster.GetClusterAlias()][0]
+				node0.MasterKey = orc.InstanceKey{}
+				node0.Slave_SQL_Running = false
+				node0.Slave_IO_Running = false
+
+				insts, _ = orcClient.Cluster(cluster.GetClusterAlias())
+				master = InstancesSet(insts).GetInstance(cluster.GetPodHostname(0))
+				updater.updateClusterStandbyStatus(master)
+				Expect(cluster.Status).To(haveCondWithStatus(api.ClusterConditionStandby, core.ConditionFalse, "Promoted"))
+
+				updater.markReadOnlyNodesInOrc(insts, master)
+				insts, _ = orcClient.Cluster(cluster.GetClusterAlias())
+				Expect(InstancesSet(insts).GetInstance(cluster.GetPodHostname(0)).ReadOnly).To(BeFalse())
+			})
+
+			It("should ignore the unreachable source discovered by orchestrator", func() {
+				alias := cluster.GetClusterAlias()
+
+				// orchestrator sees the source as the master of the topology
+				node0 := orcClient.Clusters[alias][0]
+				node0.ReadOnly = true
+				node0.Slave_IO_Running = false
+				orcClient.Clusters[alias] = append([]*orc.Instance{{
+					ClusterName:      alias,
+					Key:              orc.InstanceKey{Hostname: source, Port: mysqlPort},
+					ReadOnly:         false,
+					IsLastCheckValid: false,
+				}}, orcClient.Clusters[alias]...)
+
+				insts, master, err := updater.getFromOrchestrator()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(master).ToNot(BeNil())
+				Expect(master.Key.Hostname).To(Equal(cluster.GetPodHostname(0)))
+
+				updater.updateClusterStandbyStatus(master)
+				Expect(cluster.Status).To(haveCondWithStatus(api.ClusterConditionStandby, core.ConditionTrue,
+					"SourceReplicationStopped"))
+
+				// the source is not a node of the cluster, so it's removed from orchestrator
+				nodes, _, toForget := updater.updateNodesInOrc(insts)
+				Expect(toForget).To(ContainElement(orc.InstanceKey{Hostname: source, Port: mysqlPort}))
+
+				updater.markReadOnlyNodesInOrc(nodes, master)
+				insts, _ = orcClient.Cluster(alias)
+				Expect(InstancesSet(insts).GetInstance(cluster.GetPodHostname(0)).ReadOnly).To(BeTrue())
+			})
+		})
+
 	})
 
 	// NOTE: this test sute should be deleted in next major version
@@ -564,7 +866,7 @@ var _ = Describe("Orchestrator reconciler", func() {
 		)
 
 		BeforeEach(func() {
-			updater = NewOrcUpdater(cluster, rec, orcClient).(*orcUpdater)
+			updater = NewOrcUpdater(c, cluster, rec, orcClient).(*orcUpdater)
 			// set cluster on readonly, master should be in read only state
 			orcClient.AddInstance(orc.Instance{
 				ClusterName: cluster.GetClusterAlias(),
@@ -0,0 +1,212 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	orc "github.com/bitpoke/mysql-operator/pkg/orchestrator"
+)
+
+// switchoverTimeout is the time in which the new master should become writable after the
+// master takeover
+var switchoverTimeout = 5 * time.Minute
+
+// reconcileSwitchover drives the switchover requested in the cluster spec: it waits for the
+// cluster to be ready, asks orchestrator for a graceful master takeover and then waits for the
+// new master to be writable
+func (ou *orcUpdater) reconcileSwitchover(master *orc.Instance) {
+	spec := ou.cluster.Spec.Switchover
+	if spec == nil || len(spec.ID) == 0 {
+		return
+	}
+
+	status := ou.cluster.Status.Switchover
+	if status == nil || status.ID != spec.ID {
+		status = &api.SwitchoverStatus{ID: spec.ID, Phase: api.SwitchoverPending}
+		ou.cluster.Status.Switchover = status
+	}
+
+	switch status.Phase {
+	case api.SwitchoverSucceeded, api.SwitchoverFailed:
+		return
+	case api.SwitchoverRunning:
+		ou.verifySwitchover(status, master)
+		return
+	}
+
+	if reason := ou.getSwitchoverBlocker(master); len(reason) > 0 {
+		status.Phase = api.SwitchoverPending
+		status.Message = reason
+		return
+	}
+
+	target, err := ou.getSwitchoverTarget(spec)
+	if err != nil {
+		ou.failSwitchover(status, err.Error())
+		return
+	}
+
+	now := metav1.Now()
+	status.FromMaster = master.Key.Hostname
+	status.ToMaster = target
+	status.StartTime = &now
+
+	if target == master.Key.Hostname {
+		ou.completeSwitchover(status, fmt.Sprintf("%s is already the master", target))
+		return
+	}
+
+	ou.log.Info("switching over the master", "switchover", spec.ID, "from", status.FromMaster, "to", target)
+	ou.recorder.Eventf(ou.cluster, eventNormal, "SwitchoverStarted",
+		"switchover %s: taking over the master %s", spec.ID, status.FromMaster)
+
+	// the running switchover is saved before the takeover, so it's verified instead of being
+	// started again if the status update at the end of the reconciliation is lost
+	base := ou.cluster.Unwrap().DeepCopy()
+	saved := *status
+	status.Phase = api.SwitchoverRunning
+	status.Message = "waiting for the new master to be writable"
+	ou.cluster.UpdateStatusCondition(api.ClusterConditionSwitchoverInProgress, core.ConditionTrue,
+		"SwitchoverRunning", fmt.Sprintf("Switchover %s is in progress", spec.ID))
+	// the whole switchover status is saved, it may not be saved at all yet
+	base.Status.Switchover = nil
+	if err = ou.patchStatus(base); err != nil {
+		ou.log.Error(err, "failed to save the running switchover", "switchover", spec.ID)
+		ou.cluster.Status.Conditions = base.Status.Conditions
+		*status = saved
+		status.Message = fmt.Sprintf("failed to save the running switchover: %s", err)
+		return
+	}
+
+	designated := orc.InstanceKey{}
+	if len(target) > 0 {
+		designated = orc.InstanceKey{Hostname: target, Port: mysqlPort}
+	}
+	takeoverErr := ou.orcClient.GracefulMasterTakeover(ou.cluster.GetClusterAlias(), designated)
+
+	newMaster, err := ou.orcClient.Master(ou.cluster.GetClusterAlias())
+	if err != nil {
+		ou.log.Info("can't get the new master from orchestrator", "error", err.Error())
+		newMaster = nil
+	}
+
+	// the takeover may fail to respond even if the master was taken over
+	if takeoverErr != nil && (newMaster == nil || newMaster.Key.Hostname == status.FromMaster) {
+		ou.failSwitchover(status, fmt.Sprintf("master takeover failed: %s", takeoverErr))
+		return
+	}
+
+	ou.verifySwitchover(status, newMaster)
+}
+
+// patchStatus saves the changes of the cluster status made since base
+func (ou *orcUpdater) patchStatus(base *api.MysqlCluster) error {
+	// the cluster is patched on a copy, so the changes not yet saved are kept
+	cluster := ou.cluster.Unwrap().DeepCopy()
+	if err := ou.Status().Patch(context.TODO(), cluster, client.MergeFrom(base)); err != nil {
+		return err
+	}
+
+	ou.cluster.ResourceVersion = cluster.ResourceVersion
+	return nil
+}
+
+// getSwitchoverBlocker returns the reason for which the switchover can't start yet, or an
+// empty string if it can
+func (ou *orcUpdater) getSwitchoverBlocker(master *orc.Instance) string {
+	if master == nil {
+		return "the cluster has no master"
+	}
+
+	if cond := ou.cluster.GetClusterCondition(api.ClusterConditionFailoverInProgress); cond != nil &&
+		cond.Status == core.ConditionTrue {
+		return "a failover is in progress"
+	}
+
+	if !ou.cluster.IsClusterReady() {
+		return "the cluster is not ready"
+	}
+
+	return ""
+}
+
+// getSwitchoverTarget returns the hostname of the pod that should be promoted, or an empty
+// string to let orchestrator select the best candidate
+func (ou *orcUpdater) getSwitchoverTarget(spec *api.Switchover) (string, error) {
+	if len(spec.TargetPod) == 0 {
+		return "", nil
+	}
+
+	for i := 0; i < int(*ou.cluster.Spec.Replicas); i++ {
+		host := ou.cluster.GetPodHostname(i)
+		if mysqlcluster.GetPodNameForHost(host) == spec.TargetPod {
+			return host, nil
+		}
+	}
+
+	return "", fmt.Errorf("pod %s is not a node of the cluster", spec.TargetPod)
+}
+
+// verifySwitchover completes the running switchover when the master was taken over and the
+// new master is writable, or fails it when that doesn't happen in time
+func (ou *orcUpdater) verifySwitchover(status *api.SwitchoverStatus, master *orc.Instance) {
+	if master != nil && master.Key.Hostname != status.FromMaster &&
+		(!master.ReadOnly || ou.cluster.IsReadOnly()) {
+		msg := fmt.Sprintf("%s is the master", master.Key.Hostname)
+		if len(status.ToMaster) > 0 && master.Key.Hostname != status.ToMaster {
+			msg = fmt.Sprintf("%s is the master instead of %s", master.Key.Hostname, status.ToMaster)
+		}
+		status.ToMaster = master.Key.Hostname
+		ou.completeSwitchover(status, msg)
+		return
+	}
+
+	if status.StartTime != nil && time.Since(status.StartTime.Time) > switchoverTimeout {
+		ou.failSwitchover(status, fmt.Sprintf("the new master is not writable after %s", switchoverTimeout))
+	}
+}
+
+func (ou *orcUpdater) completeSwitchover(status *api.SwitchoverStatus, msg string) {
+	now := metav1.Now()
+	status.Phase = api.SwitchoverSucceeded
+	status.Message = msg
+	status.CompletionTime = &now
+
+	ou.cluster.UpdateStatusCondition(api.ClusterConditionSwitchoverInProgress, core.ConditionFalse,
+		"SwitchoverSucceeded", fmt.Sprintf("Switchover %s succeeded", status.ID))
+	ou.recorder.Eventf(ou.cluster, eventNormal, "SwitchoverSucceeded", "switchover %s: %s", status.ID, msg)
+}
+
+func (ou *orcUpdater) failSwitchover(status *api.SwitchoverStatus, msg string) {
+	now := metav1.Now()
+	status.Phase = api.SwitchoverFailed
+	status.Message = msg
+	status.CompletionTime = &now
+
+	ou.cluster.UpdateStatusCondition(api.ClusterConditionSwitchoverInProgress, core.ConditionFalse,
+		"SwitchoverFailed", fmt.Sprintf("Switchover %s failed", status.ID))
+	ou.recorder.Eventf(ou.cluster, eventWarning, "SwitchoverFailed", "switchover %s: %s", status.ID, msg)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlbackup
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ManifestSuffix is the extension of the manifest uploaded next to a backup
+	ManifestSuffix = "manifest.json"
+
+	// CatalogConfigMapKey is the key of the catalog config map under which the catalog is written
+	CatalogConfigMapKey = "catalog.json"
+
+	// ManifestConfigMapKey is the key of the config map in which the manifest job writes the
+	// manifest of a backup
+	ManifestConfigMapKey = "manifest.json"
+)
+
+// Catalog is the list of backups found in a bucket. It's written by the catalog job in the
+// catalog config map, which is limited in size, so only a part of a large bucket may be
+// listed, in which case Truncated is set.
+type Catalog struct {
+	Entries   []CatalogEntry `json:"entries,omitempty"`
+	Truncated bool           `json:"truncated,omitempty"`
+}
+
+// CatalogEntry is a backup found in the bucket
+type CatalogEntry struct {
+	// Name is the name of the backup file, or directory for logical backups, from the bucket
+	Name string `json:"name"`
+	// Size is the size of the backup file
+	Size int64 `json:"size,omitempty"`
+	// ModTime is the time when the backup was uploaded
+	ModTime time.Time `json:"modTime"`
+	// Manifest is the manifest uploaded next to the backup, if any
+	Manifest *Manifest `json:"manifest,omitempty"`
+}
+
+// ParseCatalog decodes a catalog
+func ParseCatalog(data string) (*Catalog, error) {
+	c := &Catalog{}
+	if err := json.Unmarshal([]byte(data), c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Encode returns the catalog serialized as JSON
+func (c *Catalog) Encode() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// GetManifestURL returns the location of the manifest of the backup from backupURL
+func GetManifestURL(backupURL string) string {
+	return fmt.Sprintf("%s.%s", strings.TrimSuffix(backupURL, "/"), ManifestSuffix)
+}
+
+// ParseBackupFileName returns the name of the backup and whether it's a logical backup, which
+// is a directory, from the name of a file from the bucket. The name is empty if the file is
+// not a backup.
+func ParseBackupFileName(fileName string) (name string, logical bool) {
+	if strings.HasSuffix(fileName, "."+LogicalBackupSuffix) {
+		return strings.TrimSuffix(fileName, "."+LogicalBackupSuffix), true
+	}
+	if strings.HasSuffix(fileName, "."+BackupSuffix) {
+		return strings.TrimSuffix(fileName, "."+BackupSuffix), false
+	}
+	return "", false
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+)
+
+// ErrInvalidChain is returned when the base backups of an incremental backup do not lead to
+// a full backup
+var ErrInvalidChain = errors.New("invalid chain of backups")
+
+// GetChain returns the backups needed to restore this backup, in the order in which they have to
+// be applied: the full backup first, followed by the incremental backups, ending with this one.
+func (b *MysqlBackup) GetChain(ctx context.Context, c client.Client) ([]*MysqlBackup, error) {
+	chain := []*MysqlBackup{b}
+	visited := map[string]bool{b.Name: true}
+
+	for current := b; current.IsIncremental(); {
+		name := current.Spec.BaseBackupName
+		if len(name) == 0 {
+			return nil, fmt.Errorf("%w: backup %s has no base backup", ErrInvalidChain, current.Name)
+		}
+		if visited[name] {
+			return nil, fmt.Errorf("%w: backup %s is its own base backup", ErrInvalidChain, name)
+		}
+		visited[name] = true
+
+		base := New(&api.MysqlBackup{})
+		key := types.NamespacedName{Name: name, Namespace: b.Namespace}
+		if err := c.Get(ctx, key, base.Unwrap()); err != nil {
+			return nil, err
+		}
+
+		// the incremental backups apply only on top of a backup of the same server
+		if uuid := base.Status.ServerUUID; len(uuid) > 0 && len(current.Status.ServerUUID) > 0 &&
+			uuid != current.Status.ServerUUID {
+			return nil, fmt.Errorf("%w: backup %s is taken from server %s, but its base backup %s from %s",
+				ErrInvalidChain, current.Name, current.Status.ServerUUID, name, uuid)
+		}
+
+		chain = append([]*MysqlBackup{base}, chain...)
+		current = base
+	}
+
+	return chain, nil
+}
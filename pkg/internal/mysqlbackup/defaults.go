@@ -27,4 +27,22 @@ func (w *MysqlBackup) SetDefaults(cluster *mysqlcluster.MysqlCluster) {
 	if len(w.Spec.BackupSecretName) == 0 {
 		w.Spec.BackupSecretName = cluster.Spec.BackupSecretName
 	}
+
+	if w.Spec.Encryption == nil && cluster.Spec.BackupEncryption != nil {
+		w.Spec.Encryption = cluster.Spec.BackupEncryption.DeepCopy()
+	}
+
+	if w.Spec.Hooks == nil && cluster.Spec.BackupHooks != nil {
+		w.Spec.Hooks = cluster.Spec.BackupHooks.DeepCopy()
+	}
+
+	if w.Spec.ActiveDeadlineSeconds == nil && cluster.Spec.BackupActiveDeadlineSeconds != nil {
+		deadline := *cluster.Spec.BackupActiveDeadlineSeconds
+		w.Spec.ActiveDeadlineSeconds = &deadline
+	}
+
+	if w.Spec.BackoffLimit == nil && cluster.Spec.BackupBackoffLimit != nil {
+		limit := *cluster.Spec.BackupBackoffLimit
+		w.Spec.BackoffLimit = &limit
+	}
 }
@@ -0,0 +1,105 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlbackup
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Manifest contains the details of a taken backup. It's written by the backup job as
+// the container termination message and it's read by the operator to fill the backup status.
+type Manifest struct {
+	// FromLSN and ToLSN are the log sequence numbers between which the backup was taken
+	FromLSN int64 `json:"fromLSN,omitempty"`
+	ToLSN   int64 `json:"toLSN,omitempty"`
+
+	// Size is the number of bytes uploaded to the bucket
+	Size int64 `json:"size,omitempty"`
+	// SHA256 is the hex encoded checksum of the bytes uploaded to the bucket
+	SHA256 string `json:"sha256,omitempty"`
+	// GTIDSet and MysqlVersion are read from the xtrabackup info files
+	GTIDSet      string `json:"gtidSet,omitempty"`
+	MysqlVersion string `json:"mysqlVersion,omitempty"`
+	// ServerUUID is the UUID of the MySQL server from which the backup was taken
+	ServerUUID string `json:"serverUUID,omitempty"`
+	// CompressCommand is the command through which the backup was piped before the upload
+	CompressCommand string `json:"compressCommand,omitempty"`
+	// EncryptionKeyID is the ID of the key used to encrypt the backup
+	EncryptionKeyID string `json:"encryptionKeyID,omitempty"`
+	// Databases is the list of databases dumped by a logical backup
+	Databases []string `json:"databases,omitempty"`
+	// DatabaseChecksums maps the databases dumped by a logical backup to the hex encoded
+	// checksums of their dumps, as uploaded to the bucket
+	DatabaseChecksums map[string]string `json:"databaseChecksums,omitempty"`
+
+	// Truncated is set when the fields of unbounded size were left out for the manifest to fit
+	// in the termination message, the manifest uploaded next to the backup has them and it's
+	// read by the operator into the backup status
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ParseManifest decodes a manifest
+func ParseManifest(data string) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal([]byte(data), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Encode returns the manifest serialized as JSON
+func (m *Manifest) Encode() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// EncodeWithin returns the manifest serialized as JSON in at most size bytes. When it doesn't
+// fit, the databases with their checksums and then the GTID set are left out and Truncated is set.
+func (m *Manifest) EncodeWithin(size int) ([]byte, error) {
+	trimmed := *m
+	for _, trim := range []func(){
+		func() {},
+		func() { trimmed.Databases, trimmed.DatabaseChecksums, trimmed.Truncated = nil, nil, true },
+		func() { trimmed.GTIDSet = "" },
+	} {
+		trim()
+		data, err := trimmed.Encode()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= size {
+			return data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("manifest does not fit in %d bytes", size)
+}
+
+// UpdateStatusFromManifest sets the backup status fields reported by the manifest
+func (b *MysqlBackup) UpdateStatusFromManifest(m *Manifest) {
+	b.Status.FromLSN = m.FromLSN
+	b.Status.ToLSN = m.ToLSN
+	b.Status.Size = m.Size
+	b.Status.SHA256 = m.SHA256
+	b.Status.GTIDSet = m.GTIDSet
+	b.Status.MysqlVersion = m.MysqlVersion
+	b.Status.ServerUUID = m.ServerUUID
+	b.Status.CompressCommand = m.CompressCommand
+	b.Status.EncryptionKeyID = m.EncryptionKeyID
+	b.Status.Databases = m.Databases
+	b.Status.DatabaseChecksums = m.DatabaseChecksums
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"strings"
+	"time"
 
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
@@ -31,6 +32,21 @@ const (
 	// BackupSuffix is the file extension that will be uploaded into storage
 	// provider
 	BackupSuffix = "xbackup.gz"
+
+	// LogicalBackupSuffix is the extension of the directory in which the dumps of a logical
+	// backup are uploaded
+	LogicalBackupSuffix = "logical"
+
+	// LogicalDumpSuffix is the file extension of the dump of a database
+	LogicalDumpSuffix = "sql.gz"
+
+	// DefaultVerifyQuery is the sanity query run on a restored backup, it reads the
+	// metadata of all tables
+	DefaultVerifyQuery = "SELECT COUNT(*) FROM information_schema.TABLES"
+
+	// TrashTimestampFormat is the format of the trash directories, which are named after the
+	// time when the backups were soft deleted
+	TrashTimestampFormat = "20060102T150405Z"
 )
 
 var log = logf.Log.WithName("mysqlbackup")
@@ -54,7 +70,7 @@ func (b *MysqlBackup) Unwrap() *api.MysqlBackup {
 
 // GetBackupURL returns a backup URL
 func (b *MysqlBackup) GetBackupURL(cluster *mysqlcluster.MysqlCluster) string {
-	if strings.HasSuffix(b.Spec.BackupURL, BackupSuffix) {
+	if strings.HasSuffix(b.Spec.BackupURL, b.backupSuffix()) {
 		return b.Spec.BackupURL
 	}
 
@@ -73,10 +89,44 @@ func (b *MysqlBackup) composeBackupURL(base string) string {
 		base = base[:len(base)-1]
 	}
 
-	fileName := fmt.Sprintf("/%s.%s", b.GetName(), BackupSuffix)
+	fileName := fmt.Sprintf("/%s.%s", b.GetName(), b.backupSuffix())
 	return base + fileName
 }
 
+func (b *MysqlBackup) backupSuffix() string {
+	if b.IsLogical() {
+		return LogicalBackupSuffix
+	}
+	return BackupSuffix
+}
+
+// GetDumpURL returns the location of the dump of a database from a logical backup
+func GetDumpURL(backupURL, database string) string {
+	return fmt.Sprintf("%s/%s.%s", strings.TrimSuffix(backupURL, "/"), database, LogicalDumpSuffix)
+}
+
+// GetTrashLocation returns the trash of the backup's location, where it's moved when it's
+// soft deleted
+func (b *MysqlBackup) GetTrashLocation(trashPrefix string) string {
+	base, _ := b.splitBackupURL()
+	return fmt.Sprintf("%s/%s", base, trashPrefix)
+}
+
+// GetTrashURL returns the location where the backup is moved when it's soft deleted, under a
+// directory named after the deletion time, from the trash of the backup's location
+func (b *MysqlBackup) GetTrashURL(trashPrefix string, deletedAt time.Time) string {
+	_, name := b.splitBackupURL()
+	return fmt.Sprintf("%s/%s/%s", b.GetTrashLocation(trashPrefix), deletedAt.UTC().Format(TrashTimestampFormat), name)
+}
+
+// splitBackupURL splits the backup URL into the location of the backup and its name
+func (b *MysqlBackup) splitBackupURL() (string, string) {
+	if i := strings.LastIndex(b.Spec.BackupURL, "/"); i >= 0 {
+		return b.Spec.BackupURL[:i], b.Spec.BackupURL[i+1:]
+	}
+	return b.Spec.BackupURL, b.Spec.BackupURL
+}
+
 // GetNameForJob returns the name of the job
 func (b *MysqlBackup) GetNameForJob() string {
 	prefix := b.Name
@@ -95,6 +145,77 @@ func (b *MysqlBackup) GetNameForDeletionJob() string {
 	return fmt.Sprintf("%s-cleanup", prefix)
 }
 
+// GetNameForVerificationJob returns the name of the job that restores the backup to verify it
+func (b *MysqlBackup) GetNameForVerificationJob() string {
+	prefix := b.Name
+	if len(prefix) >= 56 {
+		prefix = fmt.Sprintf("%s-%d", prefix[:44], hash(prefix))
+	}
+	return fmt.Sprintf("%s-verify", prefix)
+}
+
+// GetNameForPostHookJob returns the name of the job that runs the post backup hooks
+func (b *MysqlBackup) GetNameForPostHookJob() string {
+	prefix := b.Name
+	if len(prefix) >= 53 {
+		prefix = fmt.Sprintf("%s-%d", prefix[:42], hash(prefix))
+	}
+	return fmt.Sprintf("%s-post-hook", prefix)
+}
+
+// GetNameForManifestJob returns the name of the job that reads the manifest uploaded next to the
+// backup, which is also the name of the resources the job uses
+func (b *MysqlBackup) GetNameForManifestJob() string {
+	prefix := b.Name
+	if len(prefix) >= 54 {
+		prefix = fmt.Sprintf("%s-%d", prefix[:42], hash(prefix))
+	}
+	return fmt.Sprintf("%s-manifest", prefix)
+}
+
+// GetNameForVolumeSnapshot returns the name of the VolumeSnapshot of a volume snapshot backup
+func (b *MysqlBackup) GetNameForVolumeSnapshot() string {
+	return b.Name
+}
+
+// ShouldVerify returns true if the backup should be restored to check it's usable
+func (b *MysqlBackup) ShouldVerify(cluster *mysqlcluster.MysqlCluster) bool {
+	// only the physical backups from the bucket are restored by the verification job
+	if b.IsVolumeSnapshot() || b.IsLogical() {
+		return false
+	}
+	if b.Spec.Verify != nil {
+		return *b.Spec.Verify
+	}
+	return cluster.Spec.BackupVerify
+}
+
+// GetVerifyQuery returns the sanity query run on the restored backup
+func (b *MysqlBackup) GetVerifyQuery(cluster *mysqlcluster.MysqlCluster) string {
+	if len(b.Spec.VerifyQuery) > 0 {
+		return b.Spec.VerifyQuery
+	}
+	if len(cluster.Spec.BackupVerifyQuery) > 0 {
+		return cluster.Spec.BackupVerifyQuery
+	}
+	return DefaultVerifyQuery
+}
+
+// IsIncremental returns true if the backup contains only the changes since a base backup
+func (b *MysqlBackup) IsIncremental() bool {
+	return b.Spec.Type == api.IncrementalBackup
+}
+
+// IsLogical returns true if the backup is a SQL dump of a list of databases
+func (b *MysqlBackup) IsLogical() bool {
+	return b.Spec.Type == api.LogicalBackup
+}
+
+// IsVolumeSnapshot returns true if the backup is a CSI VolumeSnapshot of a data volume
+func (b *MysqlBackup) IsVolumeSnapshot() bool {
+	return b.Spec.Method == api.VolumeSnapshotMethod
+}
+
 // String returns the backup name and namespace
 func (b *MysqlBackup) String() string {
 	return fmt.Sprintf("%s/%s", b.Namespace, b.Name)
@@ -16,7 +16,10 @@ limitations under the License.
 package mysqlbackup
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -27,6 +30,7 @@ import (
 	logf "github.com/presslabs/controller-util/log"
 
 	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
 )
 
 func TestMySQLBackupWrapper(t *testing.T) {
@@ -73,4 +77,171 @@ var _ = Describe("MySQL backup unit tests", func() {
 		Expect(backup.GetNameForJob()).To(Equal("not-too-long-backup-name-for-testing-backup-job-test-backup"))
 		Expect(len(backup.GetNameForJob())).To(BeNumerically("<=", 63))
 	})
+
+	It("should fill the status from the backup manifest", func() {
+		backup := New(&api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "backup-name",
+			},
+		})
+
+		manifest, err := ParseManifest(`{"fromLSN":0,"toLSN":1626007,"size":2048,` +
+			`"gtidSet":"684ca0cf-495e-11e9-9fe8-0a580af407e9:1-5","mysqlVersion":"5.7.26-29-log",` +
+			`"compressCommand":"gzip -c","sha256":"e3b0c442","databases":["shop"],` +
+			`"databaseChecksums":{"shop":"5feceb66"},` +
+			`"serverUUID":"684ca0cf-495e-11e9-9fe8-0a580af407e9"}`)
+		Expect(err).ToNot(HaveOccurred())
+
+		backup.UpdateStatusFromManifest(manifest)
+		Expect(backup.Status.ToLSN).To(Equal(int64(1626007)))
+		Expect(backup.Status.Size).To(Equal(int64(2048)))
+		Expect(backup.Status.GTIDSet).To(Equal("684ca0cf-495e-11e9-9fe8-0a580af407e9:1-5"))
+		Expect(backup.Status.MysqlVersion).To(Equal("5.7.26-29-log"))
+		Expect(backup.Status.CompressCommand).To(Equal("gzip -c"))
+		Expect(backup.Status.SHA256).To(Equal("e3b0c442"))
+		Expect(backup.Status.Databases).To(ConsistOf("shop"))
+		Expect(backup.Status.DatabaseChecksums).To(Equal(map[string]string{"shop": "5feceb66"}))
+		Expect(backup.Status.ServerUUID).To(Equal("684ca0cf-495e-11e9-9fe8-0a580af407e9"))
+	})
+
+	It("should leave out the large fields of a manifest that does not fit", func() {
+		uuids := []string{}
+		for i := 0; i < 100; i++ {
+			uuids = append(uuids, fmt.Sprintf("684ca0cf-495e-11e9-9fe8-0a580af4%04d:1-5", i))
+		}
+		manifest := &Manifest{
+			ToLSN:     1626007,
+			GTIDSet:   strings.Join(uuids, ","),
+			Databases: []string{"shop"},
+		}
+
+		data, err := manifest.EncodeWithin(8192)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"databases":["shop"]`))
+		Expect(string(data)).ToNot(ContainSubstring("truncated"))
+
+		data, err = manifest.EncodeWithin(4096)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(`{"toLSN":1626007,"truncated":true}`))
+		Expect(manifest.GTIDSet).ToNot(BeEmpty())
+
+		_, err = manifest.EncodeWithin(16)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should take the verification settings from the backup or the cluster", func() {
+		cluster := mysqlcluster.New(&api.MysqlCluster{})
+		backup := New(&api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "backup-name",
+			},
+		})
+
+		Expect(backup.GetNameForVerificationJob()).To(Equal("backup-name-verify"))
+
+		Expect(backup.ShouldVerify(cluster)).To(BeFalse())
+		Expect(backup.GetVerifyQuery(cluster)).To(Equal(DefaultVerifyQuery))
+
+		cluster.Spec.BackupVerify = true
+		cluster.Spec.BackupVerifyQuery = "SELECT 1"
+		Expect(backup.ShouldVerify(cluster)).To(BeTrue())
+		Expect(backup.GetVerifyQuery(cluster)).To(Equal("SELECT 1"))
+
+		no := false
+		backup.Spec.Verify = &no
+		backup.Spec.VerifyQuery = "SELECT 2"
+		Expect(backup.ShouldVerify(cluster)).To(BeFalse())
+		Expect(backup.GetVerifyQuery(cluster)).To(Equal("SELECT 2"))
+	})
+
+	It("should not verify volume snapshot backups", func() {
+		cluster := mysqlcluster.New(&api.MysqlCluster{})
+		cluster.Spec.BackupVerify = true
+
+		backup := New(&api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "backup-name",
+			},
+			Spec: api.MysqlBackupSpec{
+				Method: api.VolumeSnapshotMethod,
+			},
+		})
+
+		Expect(backup.IsVolumeSnapshot()).To(BeTrue())
+		Expect(backup.GetNameForVolumeSnapshot()).To(Equal("backup-name"))
+		Expect(backup.ShouldVerify(cluster)).To(BeFalse())
+	})
+
+	It("should compose the location of logical backups", func() {
+		cluster := mysqlcluster.New(&api.MysqlCluster{})
+		cluster.Spec.BackupURL = "gs://bucket/backups/"
+		cluster.Spec.BackupVerify = true
+
+		backup := New(&api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "backup-name",
+			},
+			Spec: api.MysqlBackupSpec{
+				Type: api.LogicalBackup,
+			},
+		})
+
+		Expect(backup.IsLogical()).To(BeTrue())
+		Expect(backup.ShouldVerify(cluster)).To(BeFalse())
+
+		backup.SetDefaults(cluster)
+		Expect(backup.Spec.BackupURL).To(Equal("gs://bucket/backups/backup-name.logical"))
+		// the URL is not composed again once set
+		Expect(backup.GetBackupURL(cluster)).To(Equal("gs://bucket/backups/backup-name.logical"))
+
+		Expect(GetDumpURL(backup.Spec.BackupURL, "shop")).To(
+			Equal("gs://bucket/backups/backup-name.logical/shop.sql.gz"))
+	})
+
+	It("should compose the trash URL from the backup location", func() {
+		backup := New(&api.MysqlBackup{
+			Spec: api.MysqlBackupSpec{
+				BackupURL: "s3://bucket/backups/backup-name.xbackup.gz",
+			},
+		})
+		deletedAt := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+
+		Expect(backup.GetTrashURL("trash", deletedAt)).To(
+			Equal("s3://bucket/backups/trash/20210102T150405Z/backup-name.xbackup.gz"))
+		Expect(backup.GetTrashLocation("trash")).To(Equal("s3://bucket/backups/trash"))
+	})
+	It("should take the deadline and the retries from the backup or the cluster", func() {
+		clusterDeadline := int64(7200)
+		clusterRetries := int32(3)
+		cluster := mysqlcluster.New(&api.MysqlCluster{})
+		cluster.Spec.BackupURL = "gs://bucket/backups/"
+		cluster.Spec.BackupActiveDeadlineSeconds = &clusterDeadline
+		cluster.Spec.BackupBackoffLimit = &clusterRetries
+
+		deadline := int64(600)
+		backup := New(&api.MysqlBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-name"},
+			Spec:       api.MysqlBackupSpec{ActiveDeadlineSeconds: &deadline},
+		})
+
+		backup.SetDefaults(cluster)
+		Expect(*backup.Spec.ActiveDeadlineSeconds).To(Equal(int64(600)))
+		Expect(*backup.Spec.BackoffLimit).To(Equal(int32(3)))
+	})
+	It("should estimate the completion of a backup from its progress", func() {
+		start := time.Date(2021, 1, 2, 10, 0, 0, 0, time.UTC)
+		progress := &Progress{StartTime: start, Bytes: 100 * 1024, DataSize: 400 * 1024}
+		now := start.Add(100 * time.Second)
+
+		Expect(progress.Throughput(now)).To(Equal(int64(1024)))
+		Expect(*progress.EstimatedCompletionTime(now)).To(Equal(now.Add(300 * time.Second)))
+
+		status := progress.ToStatus(now)
+		Expect(status.BytesStreamed).To(Equal(int64(100 * 1024)))
+		Expect(status.EstimatedCompletionTime.Time).To(Equal(now.Add(300 * time.Second)))
+
+		// the data size is unknown
+		progress.DataSize = 0
+		Expect(progress.EstimatedCompletionTime(now)).To(BeNil())
+	})
 })
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlbackup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/util/constants"
+)
+
+// Progress is the progress of the backup streamed by the sidecar of the source node
+type Progress struct {
+	// StartTime is the time when the backup stream started
+	StartTime time.Time `json:"startTime"`
+	// Bytes is the number of bytes streamed so far, before compression
+	Bytes int64 `json:"bytes"`
+	// DataSize is the size of the data directory of the node, which estimates the stream size
+	DataSize int64 `json:"dataSize,omitempty"`
+}
+
+// Throughput returns the average number of bytes streamed per second
+func (p *Progress) Throughput(now time.Time) int64 {
+	elapsed := now.Sub(p.StartTime).Seconds()
+	if elapsed < 1 {
+		return 0
+	}
+	return int64(float64(p.Bytes) / elapsed)
+}
+
+// EstimatedCompletionTime returns when the stream is expected to end at the current throughput,
+// or nil when it can't be estimated
+func (p *Progress) EstimatedCompletionTime(now time.Time) *time.Time {
+	throughput := p.Throughput(now)
+	if throughput == 0 || p.DataSize == 0 {
+		return nil
+	}
+
+	remaining := p.DataSize - p.Bytes
+	if remaining < 0 {
+		// the stream grew past the data dir size, e.g. because of the redo log
+		remaining = 0
+	}
+
+	eta := now.Add(time.Duration(remaining/throughput) * time.Second)
+	return &eta
+}
+
+// ToStatus returns the progress as reported in the backup status
+func (p *Progress) ToStatus(now time.Time) *api.BackupProgress {
+	status := &api.BackupProgress{
+		BytesStreamed:  p.Bytes,
+		Throughput:     p.Throughput(now),
+		DataSize:       p.DataSize,
+		LastUpdateTime: metav1.NewTime(now),
+	}
+	if eta := p.EstimatedCompletionTime(now); eta != nil {
+		t := metav1.NewTime(*eta)
+		status.EstimatedCompletionTime = &t
+	}
+	return status
+}
+
+// GetProgress returns the progress of the backup streamed by the sidecar of host, which is
+// requested with the backup credentials of the cluster
+func GetProgress(ctx context.Context, host, user, password string) (*Progress, error) {
+	url := fmt.Sprintf("http://%s:%d%s?%s=%s", host, constants.SidecarServerPort, constants.SidecarServerBackupProgressPath,
+		constants.SidecarServerStreamPurposeParam, constants.SidecarServerBackupPurpose)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(user, password)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get backup progress: %s", resp.Status)
+	}
+
+	progress := &Progress{}
+	if err = json.NewDecoder(resp.Body).Decode(progress); err != nil {
+		return nil, fmt.Errorf("failed to decode backup progress: %s", err)
+	}
+	return progress, nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlbackup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bitpoke/mysql-operator/pkg/util/constants"
+)
+
+// ErrSnapshotLockNotFound is returned when the sidecar doesn't know the lock of a backup, e.g.
+// because it restarted meanwhile, so the node may have been unlocked at any time
+var ErrSnapshotLockNotFound = errors.New("snapshot lock not found")
+
+// SnapshotLock is the lock for backup held by the sidecar of a node, with FLUSH TABLES WITH READ
+// LOCK, while the snapshot of its data volume is cut
+type SnapshotLock struct {
+	// GTIDSet is the set of executed transactions when the lock was taken
+	GTIDSet string `json:"gtidSet"`
+	// Version is the MySQL server version
+	Version string `json:"version"`
+	// LockTime is when the lock was taken
+	LockTime time.Time `json:"lockTime"`
+	// ReleaseTime is when the lock was released, or when it was last known to be held if the
+	// connection holding it was lost. It's nil while the node is locked.
+	ReleaseTime *time.Time `json:"releaseTime,omitempty"`
+}
+
+// IsLocked returns true while the node is locked
+func (l *SnapshotLock) IsLocked() bool {
+	return l.ReleaseTime == nil
+}
+
+// HeldAt returns true if the node was locked at the given time
+func (l *SnapshotLock) HeldAt(t time.Time) bool {
+	return !t.Before(l.LockTime) && (l.ReleaseTime == nil || !t.After(*l.ReleaseTime))
+}
+
+// RequestSnapshotLock calls the sidecar of host, with the backup credentials of the cluster, to
+// lock the node for the given backup (POST), to get the state of the lock (GET) or to release it
+// (DELETE). The lock is held by the sidecar, so it doesn't depend on the caller.
+func RequestSnapshotLock(ctx context.Context, method, host, user, password, backup string) (*SnapshotLock, error) {
+	u := fmt.Sprintf("http://%s:%d%s?%s=%s", host, constants.SidecarServerPort, constants.SidecarServerSnapshotLockPath,
+		constants.SidecarServerSnapshotLockBackupParam, url.QueryEscape(backup))
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(user, password)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrSnapshotLockNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("snapshot lock request failed: %s", resp.Status)
+	}
+
+	lock := &SnapshotLock{}
+	if err = json.NewDecoder(resp.Body).Decode(lock); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot lock: %s", err)
+	}
+	return lock, nil
+}
@@ -18,7 +18,9 @@ package mysqlcluster
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/blang/semver"
 	core "k8s.io/api/core/v1"
@@ -33,6 +35,16 @@ import (
 const (
 	// HeadlessSVCName is the name of the headless service that is commonly used for all clusters
 	HeadlessSVCName = "mysql"
+
+	// DefaultBackupTrashPrefix is the default path of the trash, relative to the backups location
+	DefaultBackupTrashPrefix = "trash"
+	// DefaultBackupTrashRetention is the default grace period of the soft deleted backups
+	DefaultBackupTrashRetention = 7 * 24 * time.Hour
+	// DefaultBinlogRetention is the default time the binary logs are kept on the nodes
+	DefaultBinlogRetention = 14 * 24 * time.Hour
+
+	// DefaultSemiSyncTimeout is the default time the master waits for the semi-sync replicas
+	DefaultSemiSyncTimeout = 10 * time.Second
 )
 
 // MysqlCluster is the wrapper for api.MysqlCluster type
@@ -120,6 +132,18 @@ const (
 	PodDisruptionBudget ResourceName = "pdb"
 	// Secret is the name of the "private" secret that contains operator related credentials
 	Secret ResourceName = "operated-secret"
+	// BackupTrashPurgeCronJob is the name of the cron job that purges the soft deleted backups
+	BackupTrashPurgeCronJob ResourceName = "backup-trash-purge"
+	// BackupCatalogCronJob is the name of the cron job that lists the backups from the bucket
+	BackupCatalogCronJob ResourceName = "backup-catalog"
+	// BackupCatalogConfigMap is the name of the config map in which the catalog job writes the backups
+	BackupCatalogConfigMap ResourceName = "backup-catalog-config-map"
+	// BackupCatalogRole is the name of the role, and of its binding, that allows the catalog job
+	// to write the catalog config map
+	BackupCatalogRole ResourceName = "backup-catalog-role"
+	// BackupCatalogServiceAccount is the name of the service account of the catalog job, used
+	// when the cluster has none
+	BackupCatalogServiceAccount ResourceName = "backup-catalog-service-account"
 )
 
 // GetNameForResource returns the name of a resource from above
@@ -142,6 +166,10 @@ func GetNameForResource(name ResourceName, clusterName string) string {
 		return fmt.Sprintf("%s-mysql-nodes", clusterName)
 	case Secret:
 		return fmt.Sprintf("%s-mysql-operated", clusterName)
+	case BackupTrashPurgeCronJob:
+		return fmt.Sprintf("%s-mysql-trash-purge", clusterName)
+	case BackupCatalogCronJob, BackupCatalogConfigMap, BackupCatalogRole, BackupCatalogServiceAccount:
+		return fmt.Sprintf("%s-mysql-backup-catalog", clusterName)
 	default:
 		return fmt.Sprintf("%s-mysql", clusterName)
 	}
@@ -154,6 +182,29 @@ func (c *MysqlCluster) GetPodHostname(p int) string {
 		c.Namespace)
 }
 
+// GetPodNameForHost returns the name of the pod from its hostname
+func GetPodNameForHost(host string) string {
+	return strings.SplitN(host, ".", 2)[0]
+}
+
+// IsNodeHostname returns true if the given host is the hostname of a node of the cluster
+func (c *MysqlCluster) IsNodeHostname(host string) bool {
+	prefix := fmt.Sprintf("%s-", c.GetNameForResource(StatefulSet))
+	suffix := fmt.Sprintf(".%s.%s", c.GetNameForResource(HeadlessSVC), c.Namespace)
+	if !strings.HasPrefix(host, prefix) || !strings.HasSuffix(host, suffix) {
+		return false
+	}
+
+	_, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(host, prefix), suffix))
+	return err == nil
+}
+
+// GetDataVolumeClaimName returns the name of the PVC that holds the data of the given pod, as
+// it's created by the statefulset from the volume claim template
+func (c *MysqlCluster) GetDataVolumeClaimName(podName string) string {
+	return fmt.Sprintf("data-%s", podName)
+}
+
 // GetClusterAlias returns the cluster alias that as it is in orchestrator
 func (c *MysqlCluster) GetClusterAlias() string {
 	return fmt.Sprintf("%s.%s", c.Name, c.Namespace)
@@ -278,6 +329,246 @@ func (c *MysqlCluster) GetSidecarImage() string {
 	return options.GetOptions().SidecarMysql57Image
 }
 
+// IsBinlogArchiveEnabled returns true if the master's binlogs are archived to the backups location
+func (c *MysqlCluster) IsBinlogArchiveEnabled() bool {
+	return c.Spec.BackupBinlogs && len(c.Spec.BackupURL) > 0
+}
+
+// GetBinlogArchiveURL returns the location where the cluster's binlogs are archived
+func (c *MysqlCluster) GetBinlogArchiveURL() string {
+	return fmt.Sprintf("%s/binlogs/%s", strings.TrimSuffix(c.Spec.BackupURL, "/"), c.Name)
+}
+
+// GetBackupTrashPrefix returns the path, relative to the backups location, where the soft
+// deleted backups are moved
+func (c *MysqlCluster) GetBackupTrashPrefix() string {
+	if len(c.Spec.BackupTrashPrefix) > 0 {
+		return strings.Trim(c.Spec.BackupTrashPrefix, "/")
+	}
+	return DefaultBackupTrashPrefix
+}
+
+// GetBackupTrashURL returns the location of the trash for the cluster's backups
+func (c *MysqlCluster) GetBackupTrashURL() string {
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(c.Spec.BackupURL, "/"), c.GetBackupTrashPrefix())
+}
+
+// GetBackupStorageEnv returns the environment variables that configure the storage backend
+// used by the sidecar to access the backups bucket
+func (c *MysqlCluster) GetBackupStorageEnv() []core.EnvVar {
+	storage := c.Spec.BackupStorage
+	if storage == nil {
+		return nil
+	}
+
+	env := []core.EnvVar{}
+	if len(storage.Backend) > 0 {
+		env = append(env, core.EnvVar{Name: "STORAGE_BACKEND", Value: string(storage.Backend)})
+	}
+	if storage.PartSize != nil {
+		env = append(env, core.EnvVar{Name: "STORAGE_PART_SIZE", Value: strconv.FormatInt(storage.PartSize.Value(), 10)})
+	}
+	if storage.Concurrency > 0 {
+		env = append(env, core.EnvVar{Name: "STORAGE_CONCURRENCY", Value: strconv.Itoa(int(storage.Concurrency))})
+	}
+	return env
+}
+
+// GetBackupCandidatePolicy returns the policy for selecting the node from which the backups
+// are taken
+func (c *MysqlCluster) GetBackupCandidatePolicy() api.BackupCandidatePolicy {
+	if c.Spec.BackupCandidate == nil || len(c.Spec.BackupCandidate.Policy) == 0 {
+		return api.FirstHealthyReplicaPolicy
+	}
+	return c.Spec.BackupCandidate.Policy
+}
+
+// IsPreferredBackupPod returns true if the pod with the given name and labels is preferred
+// for taking the backups
+func (c *MysqlCluster) IsPreferredBackupPod(name string, podLabels map[string]string) bool {
+	candidate := c.Spec.BackupCandidate
+	if candidate == nil {
+		return false
+	}
+
+	if len(candidate.PreferredPod) > 0 && candidate.PreferredPod == name {
+		return true
+	}
+
+	return len(candidate.PreferredPodSelector) > 0 &&
+		labels.SelectorFromSet(candidate.PreferredPodSelector).Matches(labels.Set(podLabels))
+}
+
+// IsDedicatedBackupPod returns true if the pod is reserved for taking the backups
+func (c *MysqlCluster) IsDedicatedBackupPod(name string, podLabels map[string]string) bool {
+	return c.GetBackupCandidatePolicy() == api.DedicatedReplicaPolicy && c.IsPreferredBackupPod(name, podLabels)
+}
+
+// GetPromotionRule returns the promotion preference of the node with the given ordinal and pod
+// labels, from the first promotion rule that selects it
+func (c *MysqlCluster) GetPromotionRule(ordinal int32, podLabels map[string]string) api.PromotionRuleType {
+	for _, rule := range c.Spec.PromotionRules {
+		for _, o := range rule.Ordinals {
+			if o == ordinal {
+				return rule.Rule
+			}
+		}
+
+		if len(rule.PodSelector) > 0 &&
+			labels.SelectorFromSet(rule.PodSelector).Matches(labels.Set(podLabels)) {
+			return rule.Rule
+		}
+	}
+
+	return api.NeutralPromotion
+}
+
+// IsStandby returns true if the cluster replicates from the replication source, which is until
+// it's promoted and its master stops replicating from the source
+func (c *MysqlCluster) IsStandby() bool {
+	if c.Spec.ReplicationSource == nil {
+		return false
+	}
+	if !c.Spec.ReplicationSource.Promoted {
+		return true
+	}
+
+	cond := c.GetClusterCondition(api.ClusterConditionStandby)
+	return cond == nil || cond.Status != core.ConditionFalse
+}
+
+// IsReadOnly returns true if the master of the cluster should not be writable
+func (c *MysqlCluster) IsReadOnly() bool {
+	return c.Spec.ReadOnly || c.IsStandby()
+}
+
+// IsSemiSync returns true if the cluster uses the semi-synchronous replication
+func (c *MysqlCluster) IsSemiSync() bool {
+	return c.Spec.Durability != nil && c.Spec.Durability.Mode == api.SemiSyncDurability
+}
+
+// GetSemiSyncWaitForReplicaCount returns the number of replicas that acknowledge a transaction
+// in semiSync mode
+func (c *MysqlCluster) GetSemiSyncWaitForReplicaCount() int {
+	if c.Spec.Durability == nil || c.Spec.Durability.WaitForReplicaCount < 1 {
+		return 1
+	}
+	return int(c.Spec.Durability.WaitForReplicaCount)
+}
+
+// GetSemiSyncTimeout returns the time after which the master falls back to the asynchronous
+// replication in semiSync mode
+func (c *MysqlCluster) GetSemiSyncTimeout() time.Duration {
+	if c.Spec.Durability == nil || c.Spec.Durability.Timeout == nil {
+		return DefaultSemiSyncTimeout
+	}
+	return c.Spec.Durability.Timeout.Duration
+}
+
+// GetReplicationSourcePort returns the MySQL port of the replication source
+func (c *MysqlCluster) GetReplicationSourcePort() int {
+	if c.Spec.ReplicationSource == nil || c.Spec.ReplicationSource.Port == 0 {
+		return constants.MysqlPort
+	}
+	return int(c.Spec.ReplicationSource.Port)
+}
+
+// BackupTrash is a location where soft deleted backups are moved
+type BackupTrash struct {
+	// Schedule is the name of the backup schedule that uses the trash, it's empty for the
+	// cluster's BackupURL
+	Schedule   string
+	URL        string
+	SecretName string
+}
+
+// isSoftDelete returns true if the backups are soft deleted by the policy, which is the default
+func isSoftDelete(policy api.DeletePolicy) bool {
+	return policy == api.SoftDelete || len(policy) == 0
+}
+
+// GetBackupTrashes returns the trash locations of the backup destinations that use the
+// softDelete policy, the cluster's BackupURL and the ones of the BackupSchedules, followed by
+// the other trashes where backups of the cluster were soft deleted, from the status
+func (c *MysqlCluster) GetBackupTrashes() []BackupTrash {
+	trashes := []BackupTrash{}
+	seen := map[string]bool{}
+
+	if isSoftDelete(c.Spec.BackupRemoteDeletePolicy) && len(c.Spec.BackupURL) > 0 {
+		trashes = append(trashes, BackupTrash{
+			URL:        c.GetBackupTrashURL(),
+			SecretName: c.Spec.BackupSecretName,
+		})
+		seen[c.GetBackupTrashURL()] = true
+	}
+
+	for _, bs := range c.Spec.BackupSchedules {
+		if !isSoftDelete(bs.RemoteDeletePolicy) {
+			continue
+		}
+
+		backupURL, secretName := bs.BackupURL, bs.BackupSecretName
+		if len(backupURL) == 0 {
+			backupURL = c.Spec.BackupURL
+		}
+		if len(secretName) == 0 {
+			secretName = c.Spec.BackupSecretName
+		}
+
+		trashURL := fmt.Sprintf("%s/%s", strings.TrimSuffix(backupURL, "/"), c.GetBackupTrashPrefix())
+		if len(backupURL) == 0 || seen[trashURL] {
+			continue
+		}
+		seen[trashURL] = true
+
+		trashes = append(trashes, BackupTrash{
+			Schedule:   bs.Name,
+			URL:        trashURL,
+			SecretName: secretName,
+		})
+	}
+
+	for _, trash := range c.Status.BackupTrashes {
+		if seen[trash.URL] {
+			continue
+		}
+		seen[trash.URL] = true
+
+		trashes = append(trashes, BackupTrash{
+			URL:        trash.URL,
+			SecretName: trash.SecretName,
+		})
+	}
+
+	return trashes
+}
+
+// HasBackupTrash returns true if the given trash is purged by the cluster
+func (c *MysqlCluster) HasBackupTrash(url string) bool {
+	for _, trash := range c.GetBackupTrashes() {
+		if trash.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBackupTrashRetention returns the time after which the soft deleted backups are purged
+func (c *MysqlCluster) GetBackupTrashRetention() time.Duration {
+	if c.Spec.BackupTrashRetention != nil {
+		return c.Spec.BackupTrashRetention.Duration
+	}
+	return DefaultBackupTrashRetention
+}
+
+// GetBinlogRetention returns the time the binary logs are kept on the nodes when they are archived
+func (c *MysqlCluster) GetBinlogRetention() time.Duration {
+	if c.Spec.BinlogRetention != nil {
+		return c.Spec.BinlogRetention.Duration
+	}
+	return DefaultBinlogRetention
+}
+
 // IsClusterReady checks if the cluster is ready or not.
 func (c *MysqlCluster) IsClusterReady() bool {
 	isReady := false
@@ -17,7 +17,9 @@ limitations under the License.
 package mysqlcluster
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
@@ -101,6 +103,146 @@ var _ = Describe("Test MySQL cluster wrapper", func() {
 		Expect(cluster.ShouldHaveInitContainerForMysql()).To(Equal(false))
 	})
 
+	It("should return the binlog archive URL", func() {
+		cluster.Spec.BackupURL = "gs://bucket/backups/"
+		Expect(cluster.GetBinlogArchiveURL()).To(Equal("gs://bucket/backups/binlogs/cl-name"))
+	})
+
+	It("should return the binlog retention", func() {
+		Expect(cluster.GetBinlogRetention()).To(Equal(DefaultBinlogRetention))
+
+		cluster.Spec.BinlogRetention = &metav1.Duration{Duration: 48 * time.Hour}
+		Expect(cluster.GetBinlogRetention()).To(Equal(48 * time.Hour))
+	})
+
+	It("should return the trashes of the soft deleting backup destinations", func() {
+		Expect(cluster.GetBackupTrashes()).To(BeEmpty())
+
+		cluster.Spec.BackupURL = "gs://bucket/backups/"
+		cluster.Spec.BackupSecretName = "backup-secret"
+		cluster.Spec.BackupSchedules = []api.BackupSchedule{
+			{Name: "hourly"},
+			{Name: "daily", BackupURL: "s3://offsite", BackupSecretName: "offsite", RemoteDeletePolicy: api.SoftDelete},
+			{Name: "weekly", BackupURL: "s3://other", RemoteDeletePolicy: api.Delete},
+		}
+
+		Expect(cluster.GetBackupTrashes()).To(Equal([]BackupTrash{
+			{URL: "gs://bucket/backups/trash", SecretName: "backup-secret"},
+			{Schedule: "daily", URL: "s3://offsite/trash", SecretName: "offsite"},
+		}))
+
+		cluster.Status.BackupTrashes = []api.BackupTrashLocation{
+			{URL: "s3://offsite/trash", SecretName: "offsite"},
+			{URL: "s3://manual/trash", SecretName: "manual"},
+		}
+		Expect(cluster.GetBackupTrashes()).To(Equal([]BackupTrash{
+			{URL: "gs://bucket/backups/trash", SecretName: "backup-secret"},
+			{Schedule: "daily", URL: "s3://offsite/trash", SecretName: "offsite"},
+			{URL: "s3://manual/trash", SecretName: "manual"},
+		}))
+		Expect(cluster.HasBackupTrash("s3://manual/trash")).To(BeTrue())
+		Expect(cluster.HasBackupTrash("s3://other/trash")).To(BeFalse())
+
+		// the hourly schedule soft deletes the backups by default, in the trash of the cluster
+		cluster.Spec.BackupRemoteDeletePolicy = api.Retain
+		Expect(cluster.GetBackupTrashes()[0]).To(Equal(BackupTrash{
+			Schedule: "hourly", URL: "gs://bucket/backups/trash", SecretName: "backup-secret",
+		}))
+	})
+
+	It("should tell the hostnames of the cluster's nodes", func() {
+		Expect(cluster.IsNodeHostname(cluster.GetPodHostname(0))).To(BeTrue())
+		Expect(cluster.IsNodeHostname(cluster.GetPodHostname(12))).To(BeTrue())
+		Expect(cluster.IsNodeHostname("primary.example.com")).To(BeFalse())
+		Expect(cluster.IsNodeHostname(strings.Replace(cluster.GetPodHostname(0), "-0.", "-x.", 1))).To(BeFalse())
+	})
+
+	It("should return the storage backend environment", func() {
+		Expect(cluster.GetBackupStorageEnv()).To(BeEmpty())
+
+		partSize := resource.MustParse("64Mi")
+		cluster.Spec.BackupStorage = &api.BackupStorage{
+			Backend:     api.NativeStorageBackend,
+			PartSize:    &partSize,
+			Concurrency: 8,
+		}
+
+		Expect(cluster.GetBackupStorageEnv()).To(Equal([]corev1.EnvVar{
+			{Name: "STORAGE_BACKEND", Value: "native"},
+			{Name: "STORAGE_PART_SIZE", Value: "67108864"},
+			{Name: "STORAGE_CONCURRENCY", Value: "8"},
+		}))
+	})
+
+	It("should select the pods preferred for backups", func() {
+		Expect(cluster.GetBackupCandidatePolicy()).To(Equal(api.FirstHealthyReplicaPolicy))
+		Expect(cluster.IsPreferredBackupPod("cl-name-mysql-1", nil)).To(BeFalse())
+
+		cluster.Spec.BackupCandidate = &api.BackupCandidate{
+			PreferredPod:         "cl-name-mysql-1",
+			PreferredPodSelector: map[string]string{"backups": "yes"},
+		}
+		Expect(cluster.IsPreferredBackupPod("cl-name-mysql-1", nil)).To(BeTrue())
+		Expect(cluster.IsPreferredBackupPod("cl-name-mysql-2", map[string]string{"backups": "yes"})).To(BeTrue())
+		Expect(cluster.IsPreferredBackupPod("cl-name-mysql-2", map[string]string{"backups": "no"})).To(BeFalse())
+		Expect(cluster.IsDedicatedBackupPod("cl-name-mysql-1", nil)).To(BeFalse())
+
+		cluster.Spec.BackupCandidate.Policy = api.DedicatedReplicaPolicy
+		Expect(cluster.IsDedicatedBackupPod("cl-name-mysql-1", nil)).To(BeTrue())
+		Expect(cluster.IsDedicatedBackupPod("cl-name-mysql-0", nil)).To(BeFalse())
+	})
+
+	It("should select the promotion rule of the nodes", func() {
+		Expect(cluster.GetPromotionRule(0, nil)).To(Equal(api.NeutralPromotion))
+
+		cluster.Spec.PromotionRules = []api.PromotionRule{
+			{Rule: api.PreferPromotion, Ordinals: []int32{1}},
+			{Rule: api.MustNotPromotion, PodSelector: map[string]string{"node-pool": "spot"}},
+			{Rule: api.PreferPromotion, PodSelector: map[string]string{"zone": "preferred"}},
+		}
+		Expect(cluster.GetPromotionRule(0, nil)).To(Equal(api.NeutralPromotion))
+		Expect(cluster.GetPromotionRule(1, map[string]string{"node-pool": "spot"})).To(Equal(api.PreferPromotion))
+		Expect(cluster.GetPromotionRule(2, map[string]string{"node-pool": "spot", "zone": "preferred"})).To(
+			Equal(api.MustNotPromotion))
+		Expect(cluster.GetPromotionRule(2, map[string]string{"zone": "preferred"})).To(Equal(api.PreferPromotion))
+	})
+
+	It("should be read only while it's a standby", func() {
+		Expect(cluster.IsStandby()).To(BeFalse())
+		Expect(cluster.IsReadOnly()).To(BeFalse())
+
+		cluster.Spec.ReplicationSource = &api.ReplicationSource{Host: "primary.example.com", SecretName: "repl"}
+		Expect(cluster.IsStandby()).To(BeTrue())
+		Expect(cluster.IsReadOnly()).To(BeTrue())
+		Expect(cluster.GetReplicationSourcePort()).To(Equal(3306))
+
+		// stays read only until the master is detached from the source
+		cluster.Spec.ReplicationSource.Promoted = true
+		Expect(cluster.IsReadOnly()).To(BeTrue())
+
+		cluster.UpdateStatusCondition(api.ClusterConditionStandby, corev1.ConditionFalse, "Promoted", "")
+		Expect(cluster.IsStandby()).To(BeFalse())
+		Expect(cluster.IsReadOnly()).To(BeFalse())
+
+		cluster.Spec.ReadOnly = true
+		Expect(cluster.IsReadOnly()).To(BeTrue())
+	})
+
+	It("should return the semi-sync settings", func() {
+		Expect(cluster.IsSemiSync()).To(BeFalse())
+		Expect(cluster.GetSemiSyncWaitForReplicaCount()).To(Equal(1))
+		Expect(cluster.GetSemiSyncTimeout()).To(Equal(DefaultSemiSyncTimeout))
+
+		cluster.Spec.Durability = &api.Durability{
+			Mode:                api.SemiSyncDurability,
+			WaitForReplicaCount: 2,
+			Timeout:             &metav1.Duration{Duration: time.Second},
+		}
+		Expect(cluster.IsSemiSync()).To(BeTrue())
+		Expect(cluster.GetSemiSyncWaitForReplicaCount()).To(Equal(2))
+		Expect(cluster.GetSemiSyncTimeout()).To(Equal(time.Second))
+	})
+
 	DescribeTable("defaults for innodb-buffer-pool-size and innodb-buffer-pool-instances",
 		func(mem, cpu, expectedBufferSize, expectedBufferInstances string) {
 			cluster = New(&api.MysqlCluster{
@@ -96,6 +96,12 @@ func (c *MysqlCluster) UpdateNodeConditionStatus(nodeName string, condType api.N
 	return updateNodeCondition(&c.Status.Nodes[i], condType, status)
 }
 
+// UpdateNodeReplicationLag sets the replication lag of a node, nil when it's not known
+func (c *MysqlCluster) UpdateNodeReplicationLag(nodeName string, lag *int64) {
+	i := c.GetNodeStatusIndex(nodeName)
+	c.Status.Nodes[i].ReplicationLagSeconds = lag
+}
+
 // UpdateNodeCondition updates the condition for a given type
 func updateNodeCondition(ns *api.NodeStatus, cType api.NodeConditionType,
 	cStatus core.ConditionStatus) bool {
@@ -37,6 +37,14 @@ func (c *MysqlCluster) Validate() error {
 		return fmt.Errorf("no .spec.volumeSpec is specified")
 	}
 
+	if c.Spec.InitRestorePoint != nil && len(c.Spec.InitBucketURL) == 0 {
+		return fmt.Errorf("spec.initRestorePoint requires spec.initBucketURL")
+	}
+
+	if c.Spec.BackupBinlogs && len(c.Spec.BackupURL) == 0 {
+		return fmt.Errorf("spec.backupBinlogs requires spec.backupURL")
+	}
+
 	return nil
 }
 
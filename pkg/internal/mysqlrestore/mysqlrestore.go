@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlrestore
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mysqlv1alpha1 "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+)
+
+// Restore is a wrapper over MysqlRestore k8s resource
+type Restore struct {
+	*mysqlv1alpha1.MysqlRestore
+}
+
+// Wrap wraps a MysqlRestore
+func Wrap(r *mysqlv1alpha1.MysqlRestore) *Restore {
+	return &Restore{
+		MysqlRestore: r,
+	}
+}
+
+// Unwrap returns the MysqlRestore object
+func (r *Restore) Unwrap() *mysqlv1alpha1.MysqlRestore {
+	return r.MysqlRestore
+}
+
+// ConditionExists returns a condition and whether it exists
+func (r *Restore) ConditionExists(
+	ct mysqlv1alpha1.MysqlRestoreConditionType,
+) (
+	*mysqlv1alpha1.MysqlRestoreCondition, bool,
+) {
+	for i := range r.Status.Conditions {
+		cond := &r.Status.Conditions[i]
+		if cond.Type == ct {
+			return cond, true
+		}
+	}
+
+	return nil, false
+}
+
+// IsConditionTrue returns true if the condition of the given type exists and is true
+func (r *Restore) IsConditionTrue(ct mysqlv1alpha1.MysqlRestoreConditionType) bool {
+	cond, exists := r.ConditionExists(ct)
+	return exists && cond.Status == corev1.ConditionTrue
+}
+
+// IsFinished returns true if the restore either completed or failed
+func (r *Restore) IsFinished() bool {
+	return r.IsConditionTrue(mysqlv1alpha1.MysqlRestoreComplete) ||
+		r.IsConditionTrue(mysqlv1alpha1.MysqlRestoreFailed)
+}
+
+// UpdateCondition updates the restore's condition matching the given type
+func (r *Restore) UpdateCondition(
+	condType mysqlv1alpha1.MysqlRestoreConditionType, status corev1.ConditionStatus, reason, message string,
+) (
+	cond *mysqlv1alpha1.MysqlRestoreCondition, changed bool,
+) {
+	t := metav1.NewTime(time.Now())
+
+	existingCondition, exists := r.ConditionExists(condType)
+	if !exists {
+		newCondition := mysqlv1alpha1.MysqlRestoreCondition{
+			Type:               condType,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: t,
+			LastUpdateTime:     t,
+		}
+		r.Status.Conditions = append(r.Status.Conditions, newCondition)
+
+		return &newCondition, true
+	}
+
+	if status != existingCondition.Status {
+		existingCondition.LastTransitionTime = t
+		changed = true
+	}
+
+	if message != existingCondition.Message || reason != existingCondition.Reason {
+		existingCondition.LastUpdateTime = t
+		changed = true
+	}
+
+	existingCondition.Status = status
+	existingCondition.Message = message
+	existingCondition.Reason = reason
+
+	return existingCondition, changed
+}
+
+// GetClusterKey returns the key of the restored cluster
+func (r *Restore) GetClusterKey() client.ObjectKey {
+	return client.ObjectKey{
+		Name:      r.Spec.ClusterName,
+		Namespace: r.Namespace,
+	}
+}
+
+// GetBackupKey returns the key of the backup from which the cluster is restored
+func (r *Restore) GetBackupKey() client.ObjectKey {
+	return client.ObjectKey{
+		Name:      r.Spec.BackupName,
+		Namespace: r.Namespace,
+	}
+}
+
+// GetNameForJob returns the name of the job that loads a database from a logical backup
+func (r *Restore) GetNameForJob() string {
+	prefix := r.Name
+	if len(prefix) >= 55 {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(prefix))
+		prefix = fmt.Sprintf("%s-%d", prefix[:44], h.Sum32())
+	}
+	return fmt.Sprintf("%s-restore", prefix)
+}
@@ -18,6 +18,7 @@ package orchelper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -34,6 +35,10 @@ import (
 	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
 )
 
+// ErrRecoveryBlocked is returned when the failed host is the replication source of a standby
+// cluster, which is never recovered by promoting the standby
+var ErrRecoveryBlocked = errors.New("the failed host is the replication source of a standby cluster")
+
 // parse the orchestrator cluster name as NamespacedName
 func orcNameToKey(name string) (types.NamespacedName, error) {
 	components := strings.Split(name, ".")
@@ -120,3 +125,31 @@ func UpdateEventForCluster(c client.Client, s *runtime.Scheme, clusterName, evRe
 
 	return nil
 }
+
+// CheckRecovery returns ErrRecoveryBlocked if the failed host, from the given orchestrator
+// cluster, is the replication source of a standby cluster that is not promoted. The failure of a
+// node of the cluster is recovered as usual.
+func CheckRecovery(c client.Client, clusterName, failedHost string) error {
+	if key, err := orcNameToKey(clusterName); err == nil {
+		cluster := mysqlcluster.New(&api.MysqlCluster{})
+		if err = c.Get(context.TODO(), key, cluster.Unwrap()); err == nil && cluster.IsNodeHostname(failedHost) {
+			return nil
+		}
+	}
+
+	// orchestrator may have discovered the source, which is the top of the topology in that case,
+	// so the cluster name is not the one of the standby
+	clusters := &api.MysqlClusterList{}
+	if err := c.List(context.TODO(), clusters); err != nil {
+		return err
+	}
+
+	for _, cluster := range clusters.Items {
+		source := cluster.Spec.ReplicationSource
+		if source != nil && !source.Promoted && source.Host == failedHost {
+			return fmt.Errorf("%w: %s/%s", ErrRecoveryBlocked, cluster.Namespace, cluster.Name)
+		}
+	}
+
+	return nil
+}
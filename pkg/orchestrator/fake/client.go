@@ -35,6 +35,8 @@ type OrcFakeClient struct {
 	AckRec     []int64
 
 	Discovered []InstanceKey
+	Takeovers  []InstanceKey
+	Candidates []InstanceKey
 
 	lock      *sync.Mutex
 	reachable bool
@@ -335,6 +337,77 @@ func (o *OrcFakeClient) SetHostReadOnly(key InstanceKey) error {
 	return fmt.Errorf("the desired host and port was not found")
 }
 
+// GracefulMasterTakeover promotes the designated instance, or the first replica when the key is
+// empty, and makes the other instances replicate from it
+func (o *OrcFakeClient) GracefulMasterTakeover(clusterHint string, designated InstanceKey) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if !o.reachable {
+		return NewErrorMsg("can't connect to orc", "/")
+	}
+
+	instances, ok := o.Clusters[clusterHint]
+	if !ok {
+		return NewErrorMsg("Unable to determine cluster name", "/graceful-master-takeover-auto")
+	}
+
+	var promoted *Instance
+	for _, inst := range instances {
+		if len(designated.Hostname) > 0 && inst.Key.Hostname == designated.Hostname ||
+			len(designated.Hostname) == 0 && promoted == nil && inst.ReadOnly {
+			promoted = inst
+		}
+	}
+	if promoted == nil {
+		return fmt.Errorf("orc failed with: no candidate to promote")
+	}
+
+	for _, inst := range instances {
+		if inst == promoted {
+			inst.MasterKey = InstanceKey{}
+			inst.ReadOnly = false
+			inst.Slave_SQL_Running = false
+			inst.Slave_IO_Running = false
+			continue
+		}
+		inst.MasterKey = promoted.Key
+		inst.ReadOnly = true
+		inst.Slave_SQL_Running = true
+		inst.Slave_IO_Running = true
+	}
+
+	o.Takeovers = append(o.Takeovers, promoted.Key)
+	return nil
+}
+
+// RegisterCandidate sets the promotion rule of an instance
+func (o *OrcFakeClient) RegisterCandidate(key InstanceKey, rule CandidatePromotionRule) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if !o.reachable {
+		return NewErrorMsg("can't connect to orc", "/")
+	}
+
+	check := false
+	for _, instances := range o.Clusters {
+		for _, inst := range instances {
+			if inst.Key.Hostname == key.Hostname && inst.Key.Port == key.Port {
+				inst.PromotionRule = rule
+				inst.IsCandidate = rule != NeutralPromoteRule
+				check = true
+			}
+		}
+	}
+	if !check {
+		return fmt.Errorf("the desired host and port was not found")
+	}
+
+	o.Candidates = append(o.Candidates, key)
+	return nil
+}
+
 // BeginMaintenance set a host in maintenance
 func (o *OrcFakeClient) BeginMaintenance(key InstanceKey, owner, reason string) error {
 	return nil
@@ -104,6 +104,9 @@ type Instance struct {
 	SemiSyncEnforced                bool
 	SemiSyncMasterEnabled           bool
 	SemiSyncReplicaEnabled          bool
+	SemiSyncMasterStatus            bool
+	SemiSyncMasterClients           uint
+	SemiSyncReplicaStatus           bool
 
 	LastSeenTimestamp    string
 	IsLastCheckValid     bool
@@ -36,11 +36,17 @@ type Interface interface {
 	SetHostWritable(key InstanceKey) error
 	SetHostReadOnly(key InstanceKey) error
 
+	GracefulMasterTakeover(clusterHint string, designated InstanceKey) error
+	RegisterCandidate(key InstanceKey, rule CandidatePromotionRule) error
+
 	BeginMaintenance(key InstanceKey, owner, reason string) error
 	EndMaintenance(key InstanceKey) error
 	Maintenance() ([]Maintenance, error)
 }
 
+// gracefulTakeoverTimeout is the minimum timeout of the graceful master takeover requests
+const gracefulTakeoverTimeout = 2 * time.Minute
+
 type orchestrator struct {
 	connectURI string
 	timeout    time.Duration
@@ -129,6 +135,29 @@ func (o *orchestrator) SetHostReadOnly(key InstanceKey) error {
 	return nil
 }
 
+// GracefulMasterTakeover promotes the designated replica, or the best candidate when the key
+// is empty, and makes the old master replicate from it
+func (o *orchestrator) GracefulMasterTakeover(clusterHint string, designated InstanceKey) error {
+	path := fmt.Sprintf("graceful-master-takeover-auto/%s", clusterHint)
+	if len(designated.Hostname) > 0 {
+		path = fmt.Sprintf("%s/%s/%d", path, designated.Hostname, designated.Port)
+	}
+
+	// the takeover waits for the replicas to catch up, so it takes longer than other requests
+	takeover := *o
+	if takeover.timeout < gracefulTakeoverTimeout {
+		takeover.timeout = gracefulTakeoverTimeout
+	}
+
+	return takeover.makeGetAPIRequest(path, nil)
+}
+
+// RegisterCandidate sets the promotion rule of an instance, which expires in orchestrator if
+// it's not registered again
+func (o *orchestrator) RegisterCandidate(key InstanceKey, rule CandidatePromotionRule) error {
+	return o.makeGetAPIRequest(fmt.Sprintf("register-candidate/%s/%d/%s", key.Hostname, key.Port, rule), nil)
+}
+
 func (o *orchestrator) BeginMaintenance(key InstanceKey, owner, reason string) error {
 
 	if err := o.makeGetAPIRequest(fmt.Sprintf("begin-maintenance/%s/%d/%s/%s", key.Hostname, key.Port, owner, reason), nil); err != nil {
@@ -0,0 +1,513 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitpoke/mysql-operator/pkg/sidecar/storage"
+)
+
+var binlogFileRe = regexp.MustCompile(`^mysql-bin\.\d+$`)
+
+// binlogMagic is the magic number at the start of the binlog files
+var binlogMagic = []byte("\xfebin")
+
+// archiveBinlogs uploads periodically the binlogs closed by the master to the
+// binlog archive URL, until stop is closed.
+func archiveBinlogs(cfg *Config, stop <-chan struct{}) {
+	log.Info("start archiving binlogs", "url", cfg.BinlogArchiveURL)
+
+	// the binlogs uploaded by this sidecar, the binlogs uploaded before a restart are found
+	// in the bucket
+	archived := map[string]bool{}
+
+	ticker := time.NewTicker(binlogArchiveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := archiveClosedBinlogs(cfg, archived); err != nil {
+				log.Error(err, "failed to archive binlogs")
+			}
+		}
+	}
+}
+
+func archiveClosedBinlogs(cfg *Config, archived map[string]bool) error {
+	db, err := sql.Open("mysql", cfg.MysqlDSN())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	master, err := isMaster(cfg, db)
+	if err != nil {
+		return fmt.Errorf("failed to check replication status: %s", err)
+	}
+	if !master {
+		// only the master binlogs are archived, the binlogs of the replicas are purged by age
+		before := time.Now().Add(-cfg.BinlogRetention).Format("2006-01-02 15:04:05")
+		if _, err := db.Exec(fmt.Sprintf("PURGE BINARY LOGS BEFORE '%s'", before)); err != nil {
+			return fmt.Errorf("failed to purge binlogs: %s", err)
+		}
+		return nil
+	}
+
+	binlogs, current, err := binaryLogs(db)
+	if err != nil {
+		return fmt.Errorf("failed to list binlogs: %s", err)
+	}
+
+	archiveDir := fmt.Sprintf("%s/%s", normalizeBucketURI(cfg.BinlogArchiveURL), cfg.Hostname)
+	if err := findArchivedBinlogs(cfg, archiveDir, binlogs, archived); err != nil {
+		return fmt.Errorf("failed to list archived binlogs: %s", err)
+	}
+
+	for _, name := range binlogs {
+		if archived[name] {
+			continue
+		}
+
+		dest := fmt.Sprintf("%s/%s", archiveDir, name)
+		log.V(1).Info("archive binlog", "binlog", name, "dest", dest)
+
+		if err := uploadBinlog(cfg, path.Join(dataDir, name), dest); err != nil {
+			return fmt.Errorf("failed to upload binlog %s: %s", name, err)
+		}
+
+		archived[name] = true
+	}
+
+	// MySQL doesn't expire the binlogs when archiving is enabled, so they are not removed
+	// before being uploaded
+	before := time.Now().Add(-cfg.BinlogRetention)
+	target := binlogsPurgeTarget(binlogs, current, func(name string) bool {
+		info, err := os.Stat(path.Join(dataDir, name))
+		return archived[name] && err == nil && info.ModTime().Before(before)
+	})
+	if len(target) == 0 {
+		return nil
+	}
+	if !binlogFileRe.MatchString(target) {
+		return fmt.Errorf("unexpected binlog name: %q", target)
+	}
+
+	log.V(1).Info("purge archived binlogs", "to", target)
+	// nolint: gosec
+	if _, err := db.Exec(fmt.Sprintf("PURGE BINARY LOGS TO '%s'", target)); err != nil {
+		return fmt.Errorf("failed to purge binlogs: %s", err)
+	}
+	return nil
+}
+
+// findArchivedBinlogs marks as archived the binlogs that are already in the archive dir, such
+// that the binlogs are not uploaded again after a restart of the sidecar. The bucket is listed
+// only when some of the binlogs are not known to be archived.
+func findArchivedBinlogs(cfg *Config, archiveDir string, binlogs []string, archived map[string]bool) error {
+	pending := false
+	for _, name := range binlogs {
+		if !archived[name] {
+			pending = true
+			break
+		}
+	}
+	if !pending {
+		return nil
+	}
+
+	objects, err := cfg.StorageFor(archiveDir).List(context.Background(), archiveDir)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		archived[obj.Key] = true
+	}
+	return nil
+}
+
+// binlogsPurgeTarget returns the binlog up to which the closed binlogs can be purged, which is
+// the first one that is not purgeable, or empty if no binlog can be purged
+func binlogsPurgeTarget(closed []string, current string, purgeable func(string) bool) string {
+	for i, name := range closed {
+		if !purgeable(name) {
+			if i == 0 {
+				return ""
+			}
+			return name
+		}
+	}
+	if len(closed) == 0 {
+		return ""
+	}
+	return current
+}
+
+// uploadBinlog copies the binlog file to dest, encrypting it if encryption is enabled
+func uploadBinlog(cfg *Config, file, dest string) error {
+	if len(cfg.BackupEncryptionKeyID) > 0 {
+		return uploadEncrypted(cfg, file, dest)
+	}
+
+	f, err := os.Open(path.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	return cfg.StorageFor(dest).Upload(context.Background(), dest, f)
+}
+
+// isMaster returns true if the node does not replicate from another node of the cluster. The
+// master of a standby cluster replicates from the replication source, outside of the cluster.
+func isMaster(cfg *Config, db *sql.DB) (bool, error) {
+	rows, err := db.Query("SHOW SLAVE STATUS")
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	values, err := scanRow(rows)
+	if err != nil {
+		return false, err
+	}
+	if values == nil {
+		return true, nil
+	}
+
+	return !cfg.IsClusterNode(values["Master_Host"]), nil
+}
+
+// binaryLogs returns the closed binlogs and the one in which the server currently writes
+func binaryLogs(db *sql.DB) ([]string, string, error) {
+	rows, err := db.Query("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = rows.Close() }()
+
+	binlogs := []string{}
+	for {
+		// the number of columns differs between MySQL versions, only the first one is needed
+		values, err := scanRow(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		if values == nil {
+			break
+		}
+		binlogs = append(binlogs, values["Log_name"])
+	}
+
+	if len(binlogs) == 0 {
+		return binlogs, "", nil
+	}
+	return binlogs[:len(binlogs)-1], binlogs[len(binlogs)-1], nil
+}
+
+// scanRow returns the values of the next row by column name, or nil if there are no more rows
+func scanRow(rows *sql.Rows) (map[string]string, error) {
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]sql.RawBytes, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]string, len(cols))
+	for i, col := range cols {
+		row[col] = string(values[i])
+	}
+	return row, nil
+}
+
+// markPendingRestorePoint marks the data dir such that the sidecar replays the
+// archived binlogs once MySQL is started
+func markPendingRestorePoint() error {
+	return ioutil.WriteFile(path.Join(dataDir, restorePointMarker), []byte{}, 0644)
+}
+
+// restoreToPoint replays the archived binlogs if the data dir is marked as
+// pending a restore point
+func restoreToPoint(cfg *Config) error {
+	marker := path.Join(dataDir, restorePointMarker)
+	if _, err := os.Stat(marker); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	log.Info("restoring to point in time", "binlogs", cfg.RestoreBinlogsURL,
+		"stop-datetime", cfg.RestoreStopDatetime, "stop-gtid-set", cfg.RestoreStopGTIDSet)
+
+	if err := waitForMysql(cfg); err != nil {
+		return err
+	}
+
+	binlogsDir, err := ioutil.TempDir("", "binlogs")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(binlogsDir); err != nil {
+			log.Error(err, "failed to remove downloaded binlogs")
+		}
+	}()
+
+	if err := downloadBinlogs(cfg, normalizeBucketURI(cfg.RestoreBinlogsURL), binlogsDir); err != nil {
+		return fmt.Errorf("failed to download binlogs: %s", err)
+	}
+
+	binlogs, err := listBinlogFiles(binlogsDir)
+	if err != nil {
+		return err
+	}
+
+	if len(binlogs) > 0 {
+		if err := replayBinlogs(cfg, binlogs); err != nil {
+			return err
+		}
+	} else {
+		log.Info("no binlogs found to replay", "binlogs", cfg.RestoreBinlogsURL)
+	}
+
+	log.Info("restore to point in time done successfully")
+	return os.Remove(marker)
+}
+
+// downloadBinlogs downloads and decrypts the binlogs archived under url into dir, keeping their
+// paths
+func downloadBinlogs(cfg *Config, url, dir string) error {
+	backend := cfg.StorageFor(url)
+	objects, err := backend.List(context.Background(), url)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		if !binlogFileRe.MatchString(path.Base(obj.Key)) {
+			continue
+		}
+
+		file := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+obj.Key)))
+		if err := downloadFile(backend, fmt.Sprintf("%s/%s", strings.TrimSuffix(url, "/"), obj.Key), file); err != nil {
+			return err
+		}
+		if err := decryptFile(file, cfg.BackupEncryptionRequired); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadFile downloads the object at url to file
+func downloadFile(backend storage.Backend, url, file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	download, err := backend.Download(context.Background(), url)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = download.Close() }()
+
+	f, err := os.Create(path.Clean(file))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, download); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replayBinlogs applies the given binlogs by piping mysqlbinlog into the mysql client. The
+// transactions already present in the backup are skipped by MySQL because of GTIDs.
+func replayBinlogs(cfg *Config, binlogs []string) error {
+	if err := checkMysqlbinlog(); err != nil {
+		return err
+	}
+
+	// nolint: gosec
+	mysqlbinlog := exec.Command(mysqlbinlogCommand, append(cfg.MysqlbinlogArgs(), binlogs...)...)
+
+	// nolint: gosec
+	mysql := exec.Command("mysql", fmt.Sprintf("--defaults-file=%s", confClientPath))
+
+	var err error
+	if mysql.Stdin, err = mysqlbinlog.StdoutPipe(); err != nil {
+		return err
+	}
+
+	mysqlbinlog.Stderr = os.Stderr
+	mysql.Stderr = os.Stderr
+
+	if err := mysqlbinlog.Start(); err != nil {
+		return fmt.Errorf("mysqlbinlog start error: %s", err)
+	}
+
+	if err := mysql.Start(); err != nil {
+		return fmt.Errorf("mysql start error: %s", err)
+	}
+
+	if err := mysqlbinlog.Wait(); err != nil {
+		return fmt.Errorf("mysqlbinlog wait error: %s", err)
+	}
+
+	if err := mysql.Wait(); err != nil {
+		return fmt.Errorf("mysql wait error: %s", err)
+	}
+
+	return nil
+}
+
+// checkMysqlbinlog returns an error if mysqlbinlog is the MariaDB one, which doesn't read the
+// MySQL GTIDs, e.g. it doesn't support --include-gtids
+func checkMysqlbinlog() error {
+	// nolint: gosec
+	out, err := exec.Command(mysqlbinlogCommand, "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mysqlbinlog version error: %s", err)
+	}
+	if isMariaDBVersion(string(out)) {
+		return fmt.Errorf("the MariaDB mysqlbinlog can't replay MySQL binlogs: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// isMariaDBVersion returns true if the version printed by a MySQL client is of a MariaDB client
+func isMariaDBVersion(version string) bool {
+	return strings.Contains(strings.ToLower(version), "mariadb")
+}
+
+// listBinlogFiles returns the binlog files found recursively under dir, in the order in
+// which they were written. The binlogs of different masters are ordered by the time when they
+// were created, read from the binlogs, and then by their sequence number.
+func listBinlogFiles(dir string) ([]string, error) {
+	type binlogFile struct {
+		path    string
+		name    string
+		created time.Time
+	}
+
+	files := []binlogFile{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !binlogFileRe.MatchString(info.Name()) {
+			return nil
+		}
+
+		created, err := binlogCreationTime(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, binlogFile{path: p, name: info.Name(), created: created})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].created.Equal(files[j].created) {
+			return files[i].created.Before(files[j].created)
+		}
+		if files[i].name != files[j].name {
+			return files[i].name < files[j].name
+		}
+		return files[i].path < files[j].path
+	})
+
+	binlogs := make([]string, len(files))
+	for i, f := range files {
+		binlogs[i] = f.path
+	}
+	return binlogs, nil
+}
+
+// binlogCreationTime returns the time when the binlog was created, which is the timestamp of
+// its first event, the format description event
+func binlogCreationTime(file string) (time.Time, error) {
+	f, err := os.Open(path.Clean(file))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	// the magic number followed by the timestamp of the first event header
+	header := make([]byte, len(binlogMagic)+4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read binlog %s: %s", file, err)
+	}
+	if !bytes.Equal(header[:len(binlogMagic)], binlogMagic) {
+		return time.Time{}, fmt.Errorf("%s is not a binlog", file)
+	}
+
+	return time.Unix(int64(binary.LittleEndian.Uint32(header[len(binlogMagic):])), 0), nil
+}
+
+func waitForMysql(cfg *Config) error {
+	db, err := sql.Open("mysql", cfg.MysqlDSN())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	deadline := time.Now().Add(mysqlStartTimeout)
+	for {
+		if err = db.Ping(); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("mysql is not available: %s", err)
+		}
+		log.V(1).Info("waiting for mysql to start", "error", err)
+		time.Sleep(time.Second)
+	}
+}
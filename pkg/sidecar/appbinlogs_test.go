@@ -0,0 +1,237 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test binlogs archiving and replay", func() {
+	var (
+		binlogsDir string
+	)
+
+	// writeBinlog writes a binlog created at the given time. The modification times are in the
+	// reverse order, as the binlogs uploaded again to the archive could have.
+	writeBinlog := func(host, name string, created time.Time) string {
+		dir := path.Join(binlogsDir, host)
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+
+		p := path.Join(dir, name)
+		Expect(ioutil.WriteFile(p, newBinlogBuilderAt(created).close("next"), 0644)).To(Succeed())
+		modTime := time.Now().Add(-created.Sub(time.Now()))
+		Expect(os.Chtimes(p, modTime, modTime)).To(Succeed())
+		return p
+	}
+
+	BeforeEach(func() {
+		var err error
+		binlogsDir, err = ioutil.TempDir("", "mysql-operator-binlogs")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(binlogsDir)).To(Succeed())
+	})
+
+	It("should list binlogs in the order in which they were written", func() {
+		now := time.Now()
+		b1 := writeBinlog("cluster-mysql-0", "mysql-bin.000001", now.Add(-3*time.Hour))
+		b2 := writeBinlog("cluster-mysql-0", "mysql-bin.000002", now.Add(-2*time.Hour))
+		// failover happened, node 1 is the new master
+		b3 := writeBinlog("cluster-mysql-1", "mysql-bin.000001", now.Add(-time.Hour))
+		// failback to node 0, in the same second
+		b4 := writeBinlog("cluster-mysql-0", "mysql-bin.000004", now.Add(-time.Hour))
+		b5 := writeBinlog("cluster-mysql-0", "mysql-bin.000005", now)
+		Expect(ioutil.WriteFile(path.Join(binlogsDir, "cluster-mysql-1", "mysql-bin.index"), []byte{}, 0644)).To(Succeed())
+
+		Expect(listBinlogFiles(binlogsDir)).To(Equal([]string{b1, b2, b3, b4, b5}))
+	})
+
+	It("should read the time when a binlog was created", func() {
+		created := time.Date(2021, 1, 2, 10, 0, 0, 0, time.UTC)
+		p := writeBinlog("cluster-mysql-0", "mysql-bin.000001", created)
+		Expect(binlogCreationTime(p)).To(BeTemporally("==", created))
+
+		Expect(ioutil.WriteFile(p, []byte("MOENC\x00\x00\x01"), 0644)).To(Succeed())
+		_, err := binlogCreationTime(p)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should skip the replay when no restore point is pending", func() {
+		cfg := &Config{}
+		Expect(restoreToPoint(cfg)).To(Succeed())
+	})
+
+	It("should purge only the binlogs up to the first one that is not purgeable", func() {
+		closed := []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003"}
+		purgeable := func(names ...string) func(string) bool {
+			return func(name string) bool {
+				for _, n := range names {
+					if n == name {
+						return true
+					}
+				}
+				return false
+			}
+		}
+
+		Expect(binlogsPurgeTarget(closed, "mysql-bin.000004", purgeable())).To(BeEmpty())
+		Expect(binlogsPurgeTarget(closed, "mysql-bin.000004", purgeable("mysql-bin.000002"))).To(BeEmpty())
+		Expect(binlogsPurgeTarget(closed, "mysql-bin.000004",
+			purgeable("mysql-bin.000001", "mysql-bin.000003"))).To(Equal("mysql-bin.000002"))
+		Expect(binlogsPurgeTarget(closed, "mysql-bin.000004",
+			purgeable(closed...))).To(Equal("mysql-bin.000004"))
+		Expect(binlogsPurgeTarget([]string{}, "mysql-bin.000001", purgeable())).To(BeEmpty())
+	})
+
+	It("should detect the MariaDB mysqlbinlog", func() {
+		Expect(isMariaDBVersion("mysqlbinlog Ver 3.4 for debian-linux-gnu at x86_64")).To(BeFalse())
+		Expect(isMariaDBVersion("mysqlbinlog  Ver 8.0.26-16 for Linux on x86_64 (Percona Server (GPL), Release 16)")).To(BeFalse())
+		Expect(isMariaDBVersion("mysqlbinlog Ver 3.4 for debian-linux-gnu at x86_64, MariaDB 10.3.31")).To(BeTrue())
+	})
+
+	It("should replay from a binlog only the transactions up to the restore point", func() {
+		if _, err := exec.LookPath(mysqlbinlogCommand); err != nil {
+			Skip("mysqlbinlog is not installed")
+		}
+		if err := checkMysqlbinlog(); err != nil {
+			Skip(err.Error())
+		}
+
+		sid := "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+		b := newBinlogBuilder()
+		for gno := int64(1); gno <= 3; gno++ {
+			b.transaction(sid, gno, "test", fmt.Sprintf("INSERT INTO t VALUES (%d)", gno))
+		}
+		binlog := path.Join(binlogsDir, "mysql-bin.000001")
+		Expect(ioutil.WriteFile(binlog, b.close("mysql-bin.000002"), 0644)).To(Succeed())
+
+		cfg := &Config{RestoreStopGTIDSet: sid + ":1-2"}
+		// nolint: gosec
+		out, err := exec.Command(mysqlbinlogCommand, append(cfg.MysqlbinlogArgs(), binlog)...).CombinedOutput()
+		Expect(err).ToNot(HaveOccurred(), string(out))
+
+		Expect(string(out)).To(ContainSubstring(fmt.Sprintf("GTID_NEXT= '%s:1'", sid)))
+		Expect(string(out)).To(ContainSubstring("INSERT INTO t VALUES (1)"))
+		Expect(string(out)).To(ContainSubstring("INSERT INTO t VALUES (2)"))
+		Expect(string(out)).ToNot(ContainSubstring("INSERT INTO t VALUES (3)"))
+	})
+})
+
+// binlogBuilder writes binlogs in the format of MySQL 5.7 (binlog version 4, with CRC32 event
+// checksums), as written by a server with binlog-format=STATEMENT
+type binlogBuilder struct {
+	buf     bytes.Buffer
+	created time.Time
+}
+
+const (
+	binlogQueryEvent          = 2
+	binlogRotateEvent         = 4
+	binlogFormatDescEvent     = 15
+	binlogXIDEvent            = 16
+	binlogGTIDEvent           = 33
+	binlogPreviousGTIDsEvent  = 35
+	binlogEventHeaderLength   = 19
+	binlogEventChecksumLength = 4
+)
+
+// binlogPostHeaderLengths are the lengths of the post headers of the event types, as written
+// by MySQL 5.7 in the format description event
+var binlogPostHeaderLengths = []byte{
+	56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 95, 0, 4, 26, 8, 0, 0, 0, 8, 8, 8, 2, 0, 0, 0,
+	10, 10, 10, 42, 42, 0, 18, 52, 0,
+}
+
+func newBinlogBuilder() *binlogBuilder {
+	return newBinlogBuilderAt(time.Now())
+}
+
+// newBinlogBuilderAt returns a builder of a binlog whose events are written at the given time
+func newBinlogBuilderAt(created time.Time) *binlogBuilder {
+	b := &binlogBuilder{created: created}
+	b.buf.Write([]byte("\xfebin"))
+
+	version := make([]byte, 50)
+	copy(version, "5.7.35-38-log")
+	// binlog version, server version, creation time, header length, post header lengths and
+	// the checksum algorithm, CRC32
+	b.event(binlogFormatDescEvent, littleEndian(uint16(4), version, uint32(0),
+		uint8(binlogEventHeaderLength), binlogPostHeaderLengths, uint8(1)))
+
+	// no previous GTIDs
+	b.event(binlogPreviousGTIDsEvent, littleEndian(uint64(0)))
+	return b
+}
+
+func (b *binlogBuilder) event(typ byte, body []byte) {
+	size := binlogEventHeaderLength + len(body) + binlogEventChecksumLength
+
+	// timestamp, type, server ID, size, the position of the next event and flags
+	event := littleEndian(uint32(b.created.Unix()), typ, uint32(1), uint32(size),
+		uint32(b.buf.Len()+size), uint16(0), body)
+
+	b.buf.Write(event)
+	b.buf.Write(littleEndian(crc32.ChecksumIEEE(event)))
+}
+
+func (b *binlogBuilder) query(db, query string) {
+	// thread ID, execution time, database length, error code, status variables length,
+	// database and query
+	b.event(binlogQueryEvent, littleEndian(uint32(1), uint32(0), uint8(len(db)), uint16(0), uint16(0),
+		[]byte(db), uint8(0), []byte(query)))
+}
+
+func (b *binlogBuilder) transaction(sid string, gno int64, db, query string) {
+	uuid, err := hex.DecodeString(strings.Replace(sid, "-", "", -1))
+	Expect(err).ToNot(HaveOccurred())
+
+	// flags, SID, GNO and the logical clock: type, last committed and sequence number
+	b.event(binlogGTIDEvent, littleEndian(uint8(1), uuid, gno, uint8(2), gno-1, gno))
+
+	b.query(db, "BEGIN")
+	b.query(db, query)
+	b.event(binlogXIDEvent, littleEndian(uint64(gno)))
+}
+
+// close ends the binlog with the rotation to the next binlog and returns its content
+func (b *binlogBuilder) close(next string) []byte {
+	b.event(binlogRotateEvent, littleEndian(uint64(4), []byte(next)))
+	return b.buf.Bytes()
+}
+
+func littleEndian(values ...interface{}) []byte {
+	buf := bytes.Buffer{}
+	for _, v := range values {
+		Expect(binary.Write(&buf, binary.LittleEndian, v)).To(Succeed())
+	}
+	return buf.Bytes()
+}
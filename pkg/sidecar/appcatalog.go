@@ -0,0 +1,248 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/sidecar/storage"
+)
+
+// bucketEntry is an object or a directory at the root of a bucket listing
+type bucketEntry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// listBucket returns the objects and the directories at the root of url. The size and the
+// modification time of a directory are the total size and the latest modification time of
+// its objects.
+func listBucket(cfg *Config, url string) ([]bucketEntry, error) {
+	objects, err := cfg.StorageFor(url).List(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	return bucketEntries(objects), nil
+}
+
+func bucketEntries(objects []storage.Object) []bucketEntry {
+	entries := []bucketEntry{}
+	dirs := map[string]int{}
+	for _, obj := range objects {
+		parts := strings.SplitN(obj.Key, "/", 2)
+		if len(parts) == 1 {
+			entries = append(entries, bucketEntry{Name: obj.Key, Size: obj.Size, ModTime: obj.ModTime})
+			continue
+		}
+
+		i, ok := dirs[parts[0]]
+		if !ok {
+			i = len(entries)
+			dirs[parts[0]] = i
+			entries = append(entries, bucketEntry{Name: parts[0], IsDir: true})
+		}
+		entries[i].Size += obj.Size
+		if obj.ModTime.After(entries[i].ModTime) {
+			entries[i].ModTime = obj.ModTime
+		}
+	}
+	return entries
+}
+
+// RunListBackupsCommand lists the backups from bucket and writes them as the catalog in the
+// given config map, the known backups are skipped by the operator when importing the catalog
+func RunListBackupsCommand(cfg *Config, bucket, configMapName string) error {
+	log.Info("list backups", "bucket", bucket, "configMap", configMapName)
+	bucket = normalizeBucketURI(bucket)
+
+	entries, err := listBucket(cfg, bucket)
+	if err != nil {
+		return fmt.Errorf("failed to list bucket: %s", err)
+	}
+
+	catalog := buildCatalog(entries, func(name string) *mysqlbackup.Manifest {
+		manifest, err := readManifest(cfg, fmt.Sprintf("%s/%s", strings.TrimSuffix(bucket, "/"), name))
+		if err != nil {
+			log.Info("failed to read backup manifest", "manifest", name, "error", err)
+		}
+		return manifest
+	})
+
+	data, err := catalog.Encode()
+	if err != nil {
+		return err
+	}
+
+	log.Info("backups found", "count", len(catalog.Entries), "truncated", catalog.Truncated)
+	if err = writeConfigMap(cfg, configMapName, mysqlbackup.CatalogConfigMapKey, data); err != nil {
+		return fmt.Errorf("failed to write backup catalog: %s", err)
+	}
+	return nil
+}
+
+// RunReadManifestCommand reads the manifest uploaded next to the backup from backupURL into the
+// given config map, from where the operator fills the backup status
+func RunReadManifestCommand(cfg *Config, backupURL, configMapName string) error {
+	log.Info("read backup manifest", "backup", backupURL, "configMap", configMapName)
+
+	manifest, err := readManifest(cfg, mysqlbackup.GetManifestURL(normalizeBucketURI(backupURL)))
+	if err != nil {
+		return fmt.Errorf("failed to read the manifest of backup %s: %s", backupURL, err)
+	}
+
+	data, err := manifest.Encode()
+	if err != nil {
+		return err
+	}
+
+	if err = writeConfigMap(cfg, configMapName, mysqlbackup.ManifestConfigMapKey, data); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %s", err)
+	}
+	return nil
+}
+
+// writeConfigMap writes the data under key in the config map, which is created by the operator
+func writeConfigMap(cfg *Config, configMapName, key string, data []byte) error {
+	restConfig, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	c, err := client.New(restConfig, client.Options{})
+	if err != nil {
+		return err
+	}
+
+	cm := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName,
+			Namespace: cfg.Namespace,
+		},
+	}
+	patch := client.MergeFrom(cm.DeepCopy())
+	cm.Data = map[string]string{
+		key: string(data),
+	}
+
+	return c.Patch(context.Background(), cm, patch)
+}
+
+// buildCatalog returns the catalog of the backups from the bucket entries, oldest first, that
+// fits in the catalog config map. The manifests are read by readManifest.
+func buildCatalog(entries []bucketEntry, readManifest func(name string) *mysqlbackup.Manifest) *mysqlbackup.Catalog {
+	files := map[string]bool{}
+	for _, entry := range entries {
+		files[entry.Name] = true
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime.Before(entries[j].ModTime)
+	})
+
+	catalog := &mysqlbackup.Catalog{}
+	size := 0
+	for _, entry := range entries {
+		name, logical := mysqlbackup.ParseBackupFileName(entry.Name)
+		if len(name) == 0 || logical != entry.IsDir {
+			continue
+		}
+
+		ce := mysqlbackup.CatalogEntry{
+			Name:    entry.Name,
+			ModTime: entry.ModTime,
+		}
+		if !entry.IsDir {
+			ce.Size = entry.Size
+		}
+		if manifest := mysqlbackup.GetManifestURL(entry.Name); files[manifest] {
+			ce.Manifest = readManifest(manifest)
+		}
+
+		data, err := json.Marshal(ce)
+		if err != nil {
+			continue
+		}
+
+		// keep room for the JSON object that wraps the entries
+		if size+len(data)+1 > backupCatalogMaxSize-64 {
+			catalog.Truncated = true
+			break
+		}
+
+		size += len(data) + 1
+		catalog.Entries = append(catalog.Entries, ce)
+	}
+
+	return catalog
+}
+
+// errNoManifest is returned by readManifest for the backups without a manifest, taken before
+// the manifests were uploaded
+var errNoManifest = errors.New("backup has no manifest")
+
+// readManifest downloads and decodes the manifest from url
+func readManifest(cfg *Config, url string) (*mysqlbackup.Manifest, error) {
+	out, err := downloadManifest(cfg, url)
+	// rclone prints nothing for a missing file, unless its directory is missing as well
+	if storage.IsNotFound(err) || (err == nil && len(out) == 0) {
+		return nil, fmt.Errorf("%w: %s", errNoManifest, url)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return mysqlbackup.ParseManifest(string(out))
+}
+
+func downloadManifest(cfg *Config, url string) ([]byte, error) {
+	download, err := cfg.StorageFor(url).Download(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = download.Close() }()
+
+	return ioutil.ReadAll(download)
+}
+
+// uploadManifest uploads the manifest next to the backup, to be found by the catalog sync
+func uploadManifest(cfg *Config, manifest *mysqlbackup.Manifest, backupURL string) error {
+	data, err := manifest.Encode()
+	if err != nil {
+		return err
+	}
+
+	manifestURL := mysqlbackup.GetManifestURL(backupURL)
+	if err = cfg.StorageFor(manifestURL).Upload(context.Background(), manifestURL, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to upload manifest: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/sidecar/storage"
+)
+
+var _ = Describe("Test backup catalog", func() {
+	var (
+		t0 = time.Date(2021, 1, 2, 10, 0, 0, 0, time.UTC)
+	)
+
+	noManifest := func(name string) *mysqlbackup.Manifest {
+		return nil
+	}
+
+	It("should list the backups, with their manifests", func() {
+		entries := []bucketEntry{
+			{Name: "new.xbackup.gz", Size: 2048, ModTime: t0.Add(time.Hour)},
+			{Name: "new.xbackup.gz.manifest.json", Size: 100, ModTime: t0.Add(time.Hour)},
+			{Name: "old.xbackup.gz", Size: 1024, ModTime: t0},
+			{Name: "known.xbackup.gz", Size: 1024, ModTime: t0},
+			{Name: "partial.xbackup.gz.tmp", Size: 512, ModTime: t0},
+			{Name: "shop.logical", Size: -1, IsDir: true, ModTime: t0.Add(2 * time.Hour)},
+			{Name: "binlogs", Size: -1, IsDir: true, ModTime: t0},
+		}
+
+		read := []string{}
+		catalog := buildCatalog(entries, func(name string) *mysqlbackup.Manifest {
+			read = append(read, name)
+			return &mysqlbackup.Manifest{ToLSN: 42}
+		})
+
+		Expect(catalog.Truncated).To(BeFalse())
+		Expect(catalog.Entries).To(HaveLen(4))
+		Expect(catalog.Entries[0].Name).To(Equal("old.xbackup.gz"))
+		Expect(catalog.Entries[0].Manifest).To(BeNil())
+		Expect(catalog.Entries[1].Name).To(Equal("known.xbackup.gz"))
+		Expect(catalog.Entries[2].Name).To(Equal("new.xbackup.gz"))
+		Expect(catalog.Entries[2].Size).To(Equal(int64(2048)))
+		Expect(catalog.Entries[2].Manifest.ToLSN).To(Equal(int64(42)))
+		Expect(catalog.Entries[3].Name).To(Equal("shop.logical"))
+		Expect(catalog.Entries[3].Size).To(BeZero())
+		Expect(read).To(ConsistOf("new.xbackup.gz.manifest.json"))
+	})
+
+	It("should truncate the catalog to fit in the config map", func() {
+		entries := []bucketEntry{}
+		for i := 0; i < 20000; i++ {
+			entries = append(entries, bucketEntry{
+				Name:    fmt.Sprintf("cluster-auto-backup-%05d.xbackup.gz", i),
+				ModTime: t0.Add(time.Duration(i) * time.Hour),
+			})
+		}
+
+		catalog := buildCatalog(entries, noManifest)
+		Expect(catalog.Truncated).To(BeTrue())
+		Expect(catalog.Entries[0].Name).To(Equal("cluster-auto-backup-00000.xbackup.gz"))
+
+		data, err := catalog.Encode()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(data)).To(BeNumerically("<=", backupCatalogMaxSize))
+	})
+
+	It("should list the directories at the root of the bucket", func() {
+		entries := bucketEntries([]storage.Object{
+			{Key: "old.xbackup.gz", Size: 1024, ModTime: t0},
+			{Key: "shop.logical/shop.sql.gz", Size: 100, ModTime: t0},
+			{Key: "shop.logical/blog.sql.gz", Size: 200, ModTime: t0.Add(time.Hour)},
+		})
+
+		Expect(entries).To(ConsistOf(
+			bucketEntry{Name: "old.xbackup.gz", Size: 1024, ModTime: t0},
+			bucketEntry{Name: "shop.logical", Size: 300, ModTime: t0.Add(time.Hour), IsDir: true},
+		))
+	})
+})
@@ -17,14 +17,20 @@ limitations under the License.
 package sidecar
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
 	"path"
-	"strings"
 
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
 	"github.com/bitpoke/mysql-operator/pkg/util/constants"
 )
 
@@ -63,7 +69,7 @@ func RunCloneCommand(cfg *Config) error {
 
 	if cfg.ExistsMySQLData {
 		log.Info("data already exists! Remove manually PVC to cleanup or to reinitialize.")
-		return nil
+		return claimDataDir(dataDir, cfg.Hostname)
 	}
 
 	if err := deleteLostFound(); err != nil {
@@ -85,6 +91,12 @@ func RunCloneCommand(cfg *Config) error {
 		if err := cloneFromBucket(cfg); err != nil {
 			return fmt.Errorf("failed to clone from bucket, err: %s", err)
 		}
+		if cfg.ShouldRestoreToPoint() {
+			// binlogs are replayed by the sidecar once MySQL is started
+			if err := markPendingRestorePoint(); err != nil {
+				return fmt.Errorf("failed to mark restore point: %s", err)
+			}
+		}
 	} else if cfg.IsFirstPodInSet() {
 		log.Info("nothing to clone from: empty cluster initializing")
 		return nil
@@ -93,6 +105,33 @@ func RunCloneCommand(cfg *Config) error {
 	}
 
 	// prepare backup
+	if err := xtrabackupPrepare(cfg); err != nil {
+		return err
+	}
+
+	return claimDataDir(dataDir, cfg.Hostname)
+}
+
+// RunRestoreBackupCommand restores the backup from the init bucket URL, together with its
+// incremental backups, into an empty data dir and prepares it. It's used to check that a
+// backup can be restored, without being part of a cluster.
+func RunRestoreBackupCommand(cfg *Config) error {
+	if cfg.ExistsMySQLData {
+		return fmt.Errorf("data dir is not empty")
+	}
+
+	if len(cfg.InitBucketURL) == 0 {
+		return fmt.Errorf("no backup to restore, INIT_BUCKET_URI is not set")
+	}
+
+	if err := deleteLostFound(); err != nil {
+		return fmt.Errorf("removing lost+found: %s", err)
+	}
+
+	if err := cloneFromBucket(cfg); err != nil {
+		return fmt.Errorf("failed to restore from bucket, err: %s", err)
+	}
+
 	return xtrabackupPrepare(cfg)
 }
 
@@ -130,74 +169,287 @@ func attemptClone(cfg *Config, sourceService string) error {
 }
 
 func cloneFromBucket(cfg *Config) error {
-	initBucket := strings.Replace(cfg.InitBucketURL, "://", ":", 1)
-
-	log.Info("cloning from bucket", "bucket", initBucket)
+	log.Info("cloning from bucket", "bucket", cfg.InitBucketURL, "incrementals", cfg.InitBucketIncrementalURLs)
 
 	if _, err := os.Stat(constants.RcloneConfigFile); os.IsNotExist(err) {
 		log.Error(err, "rclone config file does not exists")
 		return err
 	}
 
-	// writes the contents of the bucket url to stdout
+	cloneSucceeded := false
+	defer func() {
+		if !cloneSucceeded {
+			log.Info("clone operation failed, cleaning up dataDir so retries may proceed")
+			cleanDataDir()
+		}
+	}()
+
+	if err := extractFromBucket(cfg, cfg.InitBucketURL, dataDir); err != nil {
+		return err
+	}
+
+	if len(cfg.InitBucketIncrementalURLs) > 0 {
+		if err := applyIncrementalBackups(cfg); err != nil {
+			return err
+		}
+	}
+
+	log.Info("cloning done successfully")
+	cloneSucceeded = true
+	return nil
+}
+
+// applyIncrementalBackups merges, in order, the incremental backups into the full backup
+// from the data dir. The final prepare is done afterwards by xtrabackupPrepare.
+func applyIncrementalBackups(cfg *Config) error {
+	// uncommitted transactions should not be rolled back until the last incremental is applied
+	if err := runXtrabackup(cfg.XtrabackupApplyLogOnlyArgs("")); err != nil {
+		return fmt.Errorf("failed to prepare the full backup: %s", err)
+	}
+
+	if err := checkBackupChain(cfg); err != nil {
+		return err
+	}
+
+	incrementalDir := path.Join(dataDir, incrementalDirName)
+	for _, bucketURL := range cfg.InitBucketIncrementalURLs {
+		log.Info("applying incremental backup", "bucket", bucketURL)
+
+		if err := os.MkdirAll(incrementalDir, 0755); err != nil {
+			return err
+		}
+
+		if err := extractFromBucket(cfg, bucketURL, incrementalDir); err != nil {
+			return err
+		}
+
+		if err := runXtrabackup(cfg.XtrabackupApplyLogOnlyArgs(incrementalDir)); err != nil {
+			return fmt.Errorf("failed to apply incremental backup %s: %s", bucketURL, err)
+		}
+
+		if err := os.RemoveAll(incrementalDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkBackupChain verifies, by their manifests, that the incremental backups were taken from
+// the server of the full backup and that each one starts where the previous one ends. The
+// backups without a manifest are not verified.
+func checkBackupChain(cfg *Config) error {
+	urls := append([]string{cfg.InitBucketURL}, cfg.InitBucketIncrementalURLs...)
+	manifests := make([]*mysqlbackup.Manifest, len(urls))
+	for i, bucketURL := range urls {
+		manifest, err := readManifest(cfg, mysqlbackup.GetManifestURL(normalizeBucketURI(bucketURL)))
+		if err != nil {
+			log.Info("no manifest found for backup, it will not be verified", "bucket", bucketURL, "error", err)
+			continue
+		}
+		manifests[i] = manifest
+	}
+
+	return verifyBackupChain(urls, manifests)
+}
+
+func verifyBackupChain(urls []string, manifests []*mysqlbackup.Manifest) error {
+	serverUUID, serverURL := "", ""
+	for i, manifest := range manifests {
+		if manifest == nil {
+			continue
+		}
+
+		if len(manifest.ServerUUID) > 0 {
+			if len(serverUUID) == 0 {
+				serverUUID, serverURL = manifest.ServerUUID, urls[i]
+			} else if manifest.ServerUUID != serverUUID {
+				return fmt.Errorf("backup %s is taken from server %s, but backup %s from server %s",
+					urls[i], manifest.ServerUUID, serverURL, serverUUID)
+			}
+		}
+
+		if prev := i - 1; prev >= 0 && manifests[prev] != nil && manifests[prev].ToLSN > 0 &&
+			manifest.FromLSN != manifests[prev].ToLSN {
+			return fmt.Errorf("backup %s starts at LSN %d, but backup %s ends at LSN %d",
+				urls[i], manifest.FromLSN, urls[prev], manifests[prev].ToLSN)
+		}
+	}
+
+	return nil
+}
+
+// extractFromBucket downloads, decompresses and extracts a backup from bucketURL into dir
+func extractFromBucket(cfg *Config, bucketURL, dir string) error {
+	// extracts files from stdin and writes them to dir
 	// nolint: gosec
-	rclone := exec.Command("rclone", append(cfg.RcloneArgs(), "cat", initBucket)...)
+	xbstream := exec.Command(xbstreamCommand, cfg.XbstreamArgsFor(dir)...)
+
+	manifest, err := backupManifest(cfg, bucketURL)
+	if err != nil {
+		return err
+	}
 
+	return streamFromBucket(cfg, bucketURL, manifest, xbstream)
+}
+
+// backupManifest returns what is known about the backup from bucketURL before downloading it:
+// the SHA-256 checksum, either passed by the operator or read from the backup manifest, and the
+// key with which it's encrypted. Backups taken before the manifests were uploaded have none, in
+// which case an empty manifest is returned. A manifest that can't be read is an error, such that
+// the backup is not restored without being verified.
+func backupManifest(cfg *Config, bucketURL string) (*mysqlbackup.Manifest, error) {
+	manifestURL := mysqlbackup.GetManifestURL(normalizeBucketURI(bucketURL))
+	manifest, err := readManifest(cfg, manifestURL)
+	if errors.Is(err, errNoManifest) {
+		log.Info("no manifest found for backup", "bucket", bucketURL)
+		manifest = &mysqlbackup.Manifest{}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest of backup %s: %s", bucketURL, err)
+	}
+
+	if checksum, ok := cfg.InitBucketChecksums[bucketURL]; ok {
+		manifest.SHA256 = checksum
+	}
+	if len(manifest.SHA256) == 0 {
+		log.Info("no checksum found for backup, it will not be verified", "bucket", bucketURL)
+	}
+
+	return manifest, nil
+}
+
+// streamFromBucket downloads and decompresses the file from bucketURL into the stdin of out. When
+// the manifest has a checksum, the downloaded file is verified against it once out finished, so a
+// mismatch must be treated as a failure of everything out did. The file must be encrypted when
+// the manifest has an encryption key or when the encryption is required.
+func streamFromBucket(cfg *Config, bucketURL string, manifest *mysqlbackup.Manifest, out *exec.Cmd) error {
+	bucket := normalizeBucketURI(bucketURL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	download, err := cfg.StorageFor(bucket).Download(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = download.Close() }()
+
+	// the file is hashed as stored in the bucket, before decryption
+	hash := sha256.New()
+	downloaded := io.TeeReader(download, hash)
+
+	if err := streamInto(cfg, downloaded, manifest, out); err != nil {
+		return err
+	}
+
+	if len(manifest.SHA256) == 0 {
+		return nil
+	}
+
+	// trailing bytes not consumed by decompress are part of the checksum too
+	if _, err := io.Copy(ioutil.Discard, downloaded); err != nil {
+		return fmt.Errorf("download error: %s", err)
+	}
+
+	return verifyChecksum(bucketURL, manifest.SHA256, hash)
+}
+
+// downloadVerified downloads the file from bucketURL into a temporary file and, when the manifest
+// has a checksum, verifies it before anything reads it. The caller must close and remove the file.
+func downloadVerified(cfg *Config, bucketURL string, manifest *mysqlbackup.Manifest) (*os.File, error) {
+	bucket := normalizeBucketURI(bucketURL)
+
+	download, err := cfg.StorageFor(bucket).Download(context.Background(), bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = download.Close() }()
+
+	file, err := ioutil.TempFile("", "mysql-operator-download")
+	if err != nil {
+		return nil, err
+	}
+
+	// the file is hashed as stored in the bucket, before decryption
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(file, hash), download); err != nil {
+		err = fmt.Errorf("download error: %s", err)
+	} else if len(manifest.SHA256) > 0 {
+		err = verifyChecksum(bucketURL, manifest.SHA256, hash)
+	}
+
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// verifyChecksum compares the hash of the file from bucketURL with the expected checksum
+func verifyChecksum(bucketURL, checksum string, h hash.Hash) error {
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != checksum {
+		err := &checksumError{url: bucketURL, expected: checksum, actual: actual}
+		log.Error(err, "backup is corrupted", "bucket", bucketURL)
+		return err
+	}
+
+	log.Info("backup checksum verified", "bucket", bucketURL, "sha256", checksum)
+	return nil
+}
+
+// streamInto decrypts and decompresses in into the stdin of out. The input must be encrypted when
+// the manifest has an encryption key or when the encryption is required.
+func streamInto(cfg *Config, in io.Reader, manifest *mysqlbackup.Manifest, out *exec.Cmd) error {
 	// decompress reads from stdin and decompresses to stdout
 	decompressCmd := cfg.BackupDecompressCmd()
 	// nolint: gosec
 	decompress := exec.Command(decompressCmd[0], decompressCmd[1:]...)
 
-	// extracts files from stdin and writes them to mysql data dir
-	// nolint: gosec
-	xbstream := exec.Command(xbstreamCommand, cfg.XbstreamArgs()...)
+	// in | decrypt | decompress | out
+	// backups that are not encrypted pass through unchanged, if allowed
+	encrypted := cfg.BackupEncryptionRequired || len(manifest.EncryptionKeyID) > 0
+	decompress.Stdin = newDecryptingReader(in, encrypted)
 
 	var err error
-	// rclone | decompress | xbstream
-	if decompress.Stdin, err = rclone.StdoutPipe(); err != nil {
+	if out.Stdin, err = decompress.StdoutPipe(); err != nil {
 		return err
 	}
 
-	if xbstream.Stdin, err = decompress.StdoutPipe(); err != nil {
-		return err
-	}
-
-	rclone.Stderr = os.Stderr
 	decompress.Stderr = os.Stderr
-	xbstream.Stderr = os.Stderr
-
-	if err := rclone.Start(); err != nil {
-		return fmt.Errorf("rclone start error: %s", err)
-	}
+	out.Stderr = os.Stderr
 
 	if err := decompress.Start(); err != nil {
 		return fmt.Errorf("decompress start error: %s", err)
 	}
 
-	if err := xbstream.Start(); err != nil {
-		return fmt.Errorf("xbstream start error: %s", err)
-	}
-
-	if err := rclone.Wait(); err != nil {
-		return fmt.Errorf("rclone wait error: %s", err)
+	if err := out.Start(); err != nil {
+		return fmt.Errorf("%s start error: %s", out.Args[0], err)
 	}
 
+	// the decompress stdin is copied, read and decrypted, by this process so a failed download
+	// is returned by decompress
 	if err := decompress.Wait(); err != nil {
 		return fmt.Errorf("decompress wait error: %s", err)
 	}
 
-	if err := xbstream.Wait(); err != nil {
-		return fmt.Errorf("xbstream wait error: %s", err)
+	if err := out.Wait(); err != nil {
+		return fmt.Errorf("%s wait error: %s", out.Args[0], err)
 	}
 
-	log.Info("cloning done successfully")
 	return nil
 }
 
 func cloneFromSource(cfg *Config, host string) error {
 	log.Info("cloning from node", "host", host)
 
-	response, err := requestABackup(cfg, host, serverBackupEndpoint)
+	endpoint := fmt.Sprintf("%s?%s=%s", serverBackupEndpoint, streamPurposeParam, clonePurpose)
+	response, err := requestABackup(cfg, host, endpoint)
 	if err != nil {
 		return fmt.Errorf("fail to get backup: %s", err)
 	}
@@ -234,11 +486,36 @@ func cloneFromSource(cfg *Config, host string) error {
 }
 
 func xtrabackupPrepare(cfg *Config) error {
+	return runXtrabackup(cfg.XtrabackupPrepareArgs())
+}
+
+func runXtrabackup(args []string) error {
 	// nolint: gosec
-	xtrabackupPrepare := exec.Command(xtrabackupCommand, cfg.XtrabackupPrepareArgs()...)
-	xtrabackupPrepare.Stderr = os.Stderr
+	xtrabackup := exec.Command(xtrabackupCommand, args...)
+	xtrabackup.Stderr = os.Stderr
+
+	return xtrabackup.Run()
+}
+
+// claimDataDir marks the data dir as owned by the given host. When the data was copied from
+// another node the server UUID is removed, for MySQL to generate a new one, otherwise the two
+// nodes would conflict when replicating.
+func claimDataDir(dir, hostname string) error {
+	ownerFile := path.Join(dir, dataOwnerFile)
+
+	owner, err := ioutil.ReadFile(path.Clean(ownerFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err == nil && string(owner) != hostname {
+		log.Info("data was copied from another node, a new server UUID will be generated", "from", string(owner))
+		if err := os.Remove(path.Join(dir, "auto.cnf")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 
-	return xtrabackupPrepare.Run()
+	return ioutil.WriteFile(ownerFile, []byte(hostname), 0644)
 }
 
 func deleteLostFound() error {
@@ -117,7 +117,7 @@ func (fSrv *fakeServer) callsForEndpoint(endpoint string) int {
 }
 
 func (fSrv *fakeServer) healthHandler(w http.ResponseWriter, req *http.Request) {
-	fSrv.calls = append(fSrv.calls, loggedRequest{req.RequestURI, time.Now()})
+	fSrv.calls = append(fSrv.calls, loggedRequest{req.URL.Path, time.Now()})
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write([]byte("OK")); err != nil {
 		log.Error(err, "failed writing request")
@@ -125,7 +125,7 @@ func (fSrv *fakeServer) healthHandler(w http.ResponseWriter, req *http.Request)
 }
 
 func (fSrv *fakeServer) backupHandler(w http.ResponseWriter, req *http.Request) {
-	fSrv.calls = append(fSrv.calls, loggedRequest{req.RequestURI, time.Now()})
+	fSrv.calls = append(fSrv.calls, loggedRequest{req.URL.Path, time.Now()})
 
 	// Error: return http status code of 500
 	if fSrv.simulateError {
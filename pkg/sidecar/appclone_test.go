@@ -26,6 +26,8 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"sigs.k8s.io/testing_frameworks/integration/addr"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
 )
 
 var _ = Describe("Test RunCloneCommand cloning logic", func() {
@@ -155,6 +157,26 @@ var _ = Describe("Test RunCloneCommand cloning logic", func() {
 		Expect(fakeBackupFile).ShouldNot(BeAnExistingFile())
 	})
 
+	It("should reset the server UUID of data copied from another node", func() {
+		dir, err := ioutil.TempDir("", "mysql-operator-claim")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		autoCnf := path.Join(dir, "auto.cnf")
+		Expect(ioutil.WriteFile(autoCnf, []byte("[auto]"), 0644)).To(Succeed())
+
+		// the data is claimed without touching the server UUID
+		Expect(claimDataDir(dir, "cluster-mysql-1")).To(Succeed())
+		Expect(autoCnf).Should(BeAnExistingFile())
+		Expect(claimDataDir(dir, "cluster-mysql-1")).To(Succeed())
+		Expect(autoCnf).Should(BeAnExistingFile())
+
+		// the data is started by another node
+		Expect(claimDataDir(dir, "cluster-mysql-2")).To(Succeed())
+		Expect(autoCnf).ShouldNot(BeAnExistingFile())
+		Expect(ioutil.ReadFile(path.Join(dir, dataOwnerFile))).To(Equal([]byte("cluster-mysql-2")))
+	})
+
 	It("should request a backup and succeed ", func() {
 		Expect(fakeBackupFile).ShouldNot(BeAnExistingFile())
 
@@ -291,4 +313,33 @@ var _ = Describe("Test RunCloneCommand cloning logic", func() {
 
 	})
 
+	Describe("backup chain verification", func() {
+		urls := []string{"gs://bucket/full.xbackup.gz", "gs://bucket/inc-1.xbackup.gz", "gs://bucket/inc-2.xbackup.gz"}
+
+		It("should accept incrementals taken from the server of the full backup", func() {
+			Expect(verifyBackupChain(urls, []*mysqlbackup.Manifest{
+				{ToLSN: 100, ServerUUID: "uuid-1"},
+				// backups without a manifest are not verified
+				nil,
+				{FromLSN: 200, ToLSN: 300, ServerUUID: "uuid-1"},
+			})).To(Succeed())
+		})
+
+		It("should reject incrementals taken from another server", func() {
+			err := verifyBackupChain(urls, []*mysqlbackup.Manifest{
+				{ToLSN: 100, ServerUUID: "uuid-1"},
+				{FromLSN: 100, ToLSN: 200, ServerUUID: "uuid-2"},
+				{FromLSN: 200, ToLSN: 300, ServerUUID: "uuid-2"},
+			})
+			Expect(err).To(MatchError(ContainSubstring("is taken from server uuid-2")))
+		})
+
+		It("should reject incrementals that don't start where their base ends", func() {
+			err := verifyBackupChain(urls[:2], []*mysqlbackup.Manifest{
+				{ToLSN: 100},
+				{FromLSN: 150, ToLSN: 200},
+			})
+			Expect(err).To(MatchError(ContainSubstring("starts at LSN 150")))
+		})
+	})
 })
@@ -77,3 +77,60 @@ var _ = Describe("Test sidecar GTID extraction", func() {
 	})
 
 })
+
+var _ = Describe("Test sidecar LSN extraction", func() {
+	It("should find the LSNs of an incremental backup", func() {
+		source := `backup_type = incremental
+from_lsn = 1626007
+to_lsn = 4124244
+last_lsn = 4124244
+compact = 0
+recover_binlog_info = 0
+`
+		fromLSN, toLSN, err := getLSNsFrom(strings.NewReader(source))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fromLSN).To(Equal(int64(1626007)))
+		Expect(toLSN).To(Equal(int64(4124244)))
+	})
+
+	It("should fail when LSNs are missing", func() {
+		_, _, err := getLSNsFrom(strings.NewReader("backup_type = full-backuped\n"))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Test sidecar backup info extraction", func() {
+	It("should find the server version and a multi-line GTID set", func() {
+		source := `uuid = 6fd2d9c4-a54e-11ea-9a3e-0242ac110002
+tool_name = xtrabackup
+server_version = 5.7.26-29-log
+binlog_pos = filename 'mysql-bin.000002', position '191', GTID of the last change '684ca0cf-495e-11e9-9fe8-0a580af407e9:1-5,
+00003306-1111-1111-1111-111111111111:1-7'
+innodb_from_lsn = 0
+`
+		gtidSet, version, err := getBackupInfoFrom(strings.NewReader(source))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version).To(Equal("5.7.26-29-log"))
+		Expect(gtidSet).To(Equal("684ca0cf-495e-11e9-9fe8-0a580af407e9:1-5," +
+			"00003306-1111-1111-1111-111111111111:1-7"))
+	})
+
+	It("should find a single line GTID set", func() {
+		source := `server_version = 8.0.20
+binlog_pos = filename 'mysql-bin.000002', position '191', GTID of the last change '684ca0cf-495e-11e9-9fe8-0a580af407e9:1-5'
+`
+		gtidSet, version, err := getBackupInfoFrom(strings.NewReader(source))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version).To(Equal("8.0.20"))
+		Expect(gtidSet).To(Equal("684ca0cf-495e-11e9-9fe8-0a580af407e9:1-5"))
+	})
+
+	It("should find the server UUID", func() {
+		uuid, err := getServerUUIDFrom(strings.NewReader("[auto]\nserver-uuid=684ca0cf-495e-11e9-9fe8-0a580af407e9\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uuid).To(Equal("684ca0cf-495e-11e9-9fe8-0a580af407e9"))
+
+		_, err = getServerUUIDFrom(strings.NewReader("[auto]\n"))
+		Expect(err).To(HaveOccurred())
+	})
+})
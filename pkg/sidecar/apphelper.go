@@ -16,6 +16,10 @@ limitations under the License.
 
 package sidecar
 
+import (
+	"fmt"
+)
+
 // const (
 // 	// timeOut represents the number of tries to check mysql to be ready.
 // 	timeOut = 60
@@ -26,6 +30,14 @@ package sidecar
 // RunSidecarCommand is the main command, and represents the runtime helper that
 // configures the mysql server
 func RunSidecarCommand(cfg *Config, stop <-chan struct{}) error {
+	if err := restoreToPoint(cfg); err != nil {
+		return fmt.Errorf("failed to restore to point in time: %s", err)
+	}
+
+	if len(cfg.BinlogArchiveURL) != 0 {
+		go archiveBinlogs(cfg, stop)
+	}
+
 	log.Info("start http server for backups")
 	srv := newServer(cfg, stop)
 	return srv.ListenAndServe()
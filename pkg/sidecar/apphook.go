@@ -0,0 +1,57 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// RunSQLHookCommand executes the statements of a backup hook on host, in order and in a single
+// session, stopping at the first failed statement
+func RunSQLHookCommand(cfg *Config, host string, statements []string) error {
+	log.Info("run backup hook", "host", host, "statements", len(statements))
+
+	// nolint: gosec
+	mysql := exec.Command("mysql", append(cfg.MysqlClientArgs(host), "--batch")...)
+	mysql.Env = append(os.Environ(), fmt.Sprintf("MYSQL_PWD=%s", cfg.OperatorPassword))
+	mysql.Stdin = strings.NewReader(hookScript(statements))
+	mysql.Stdout = os.Stdout
+	mysql.Stderr = os.Stderr
+
+	if err := mysql.Run(); err != nil {
+		return fmt.Errorf("failed to execute hook statements: %s", err)
+	}
+
+	log.Info("backup hook executed successfully")
+	return nil
+}
+
+// hookScript returns the statements as a script for the mysql client
+func hookScript(statements []string) string {
+	script := ""
+	for _, stmt := range statements {
+		stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+		if len(stmt) == 0 {
+			continue
+		}
+		script += stmt + ";\n"
+	}
+	return script
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test backup hooks", func() {
+	It("should build the script of the hook statements", func() {
+		Expect(hookScript([]string{
+			"FLUSH TABLES",
+			" SET @a = 1; ",
+			"",
+			"SELECT @a",
+		})).To(Equal("FLUSH TABLES;\nSET @a = 1;\nSELECT @a;\n"))
+	})
+})
@@ -0,0 +1,175 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/sidecar/storage"
+)
+
+// RunTakeLogicalBackupCommand dumps each of the databases from srcHost and uploads the dumps
+// under the destBucket directory
+func RunTakeLogicalBackupCommand(cfg *Config, srcHost, destBucket string, databases []string) error {
+	log.Info("take a logical backup", "host", srcHost, "bucket", destBucket, "databases", databases)
+	destBucket = normalizeBucketURI(destBucket)
+
+	manifest := &mysqlbackup.Manifest{
+		CompressCommand:   strings.Join(cfg.BackupCompressCmd(), " "),
+		EncryptionKeyID:   cfg.BackupEncryptionKeyID,
+		DatabaseChecksums: map[string]string{},
+	}
+
+	for _, db := range databases {
+		size, checksum, err := dumpDatabaseTo(cfg, srcHost, db, mysqlbackup.GetDumpURL(destBucket, db))
+		if err != nil {
+			return fmt.Errorf("dump database %s: %w", db, err)
+		}
+
+		manifest.Size += size
+		manifest.Databases = append(manifest.Databases, db)
+		manifest.DatabaseChecksums[db] = checksum
+	}
+
+	if err := uploadManifest(cfg, manifest, destBucket); err != nil {
+		log.Error(err, "backup manifest was not uploaded")
+	}
+
+	return writeBackupManifest(manifest)
+}
+
+// dumpDatabaseTo uploads the dump of a database to dest, through a temporary file which is
+// moved to dest only when the dump succeeds. It returns the size and the checksum of the upload.
+func dumpDatabaseTo(cfg *Config, srcHost, db, dest string) (int64, string, error) {
+	tmpDest := fmt.Sprintf("%s.tmp", dest)
+
+	// nolint: gosec
+	mysqldump := exec.Command("mysqldump", cfg.MysqldumpArgs(srcHost, db)...)
+	mysqldump.Env = append(os.Environ(), fmt.Sprintf("MYSQL_PWD=%s", cfg.OperatorPassword))
+	mysqldump.Stderr = os.Stderr
+
+	dump, err := mysqldump.StdoutPipe()
+	if err != nil {
+		return 0, "", err
+	}
+
+	if err = mysqldump.Start(); err != nil {
+		return 0, "", fmt.Errorf("mysqldump start error: %s", err)
+	}
+
+	size, checksum, err := uploadToBucket(cfg, dump, tmpDest)
+	if err != nil {
+		// don't leave mysqldump blocked on writing the dump
+		_ = mysqldump.Process.Kill()
+		_ = mysqldump.Wait()
+		removeFromBucket(cfg, tmpDest)
+		return 0, "", err
+	}
+
+	// a dump that stops midway is still uploaded, so the upload is kept in the temporary file
+	if err = mysqldump.Wait(); err != nil {
+		removeFromBucket(cfg, tmpDest)
+		return 0, "", fmt.Errorf("mysqldump wait error: %s", err)
+	}
+
+	log.Info("database dumped successfully", "database", db, "size", size)
+	return size, checksum, moveInBucket(cfg, tmpDest, dest)
+}
+
+// removeFromBucket deletes the partial dump from the bucket, a failure is only logged since the
+// temporary files are not restored
+func removeFromBucket(cfg *Config, url string) {
+	if err := cfg.StorageFor(url).Delete(context.Background(), url); err != nil && !storage.IsNotFound(err) {
+		log.Error(err, "failed to remove the partial dump", "url", url)
+	}
+}
+
+// RunRestoreLogicalBackupCommand loads the dump of a database from a logical backup into the
+// database with the same name from host. The database is created if it doesn't exist.
+func RunRestoreLogicalBackupCommand(cfg *Config, host, srcBucket, db string) error {
+	log.Info("restore a database from a logical backup", "host", host, "bucket", srcBucket, "database", db)
+
+	dump, err := dumpManifest(cfg, srcBucket, db)
+	if err != nil {
+		return err
+	}
+
+	// the dump is downloaded and verified before anything is loaded, so a corrupted dump leaves
+	// the database untouched
+	file, err := downloadVerified(cfg, mysqlbackup.GetDumpURL(srcBucket, db), dump)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	// nolint: gosec
+	create := exec.Command("mysql", append(cfg.MysqlClientArgs(host),
+		fmt.Sprintf("--execute=CREATE DATABASE IF NOT EXISTS %s", quoteIdentifier(db)))...)
+	create.Env = append(os.Environ(), fmt.Sprintf("MYSQL_PWD=%s", cfg.OperatorPassword))
+	create.Stderr = os.Stderr
+
+	if err := create.Run(); err != nil {
+		return fmt.Errorf("failed to create database %s: %s", db, err)
+	}
+
+	// nolint: gosec
+	mysql := exec.Command("mysql", append(cfg.MysqlClientArgs(host), fmt.Sprintf("--database=%s", db))...)
+	mysql.Env = append(os.Environ(), fmt.Sprintf("MYSQL_PWD=%s", cfg.OperatorPassword))
+
+	if err := streamInto(cfg, file, dump, mysql); err != nil {
+		return err
+	}
+
+	log.Info("database restored successfully", "database", db)
+	return nil
+}
+
+// dumpManifest returns, from the manifest of the logical backup from srcBucket, what is needed
+// to verify the dump of db: its checksum and the key with which it's encrypted. The backups
+// without a manifest are not verified.
+func dumpManifest(cfg *Config, srcBucket, db string) (*mysqlbackup.Manifest, error) {
+	manifest, err := readManifest(cfg, mysqlbackup.GetManifestURL(normalizeBucketURI(srcBucket)))
+	if errors.Is(err, errNoManifest) {
+		log.Info("no manifest found for backup, the dump will not be verified", "bucket", srcBucket)
+		return &mysqlbackup.Manifest{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest of backup %s: %s", srcBucket, err)
+	}
+
+	dump := &mysqlbackup.Manifest{
+		SHA256:          manifest.DatabaseChecksums[db],
+		EncryptionKeyID: manifest.EncryptionKeyID,
+	}
+	if len(dump.SHA256) == 0 {
+		log.Info("no checksum found for the dump, it will not be verified", "bucket", srcBucket, "database", db)
+	}
+	return dump, nil
+}
+
+// quoteIdentifier returns the name quoted as a MySQL identifier
+func quoteIdentifier(name string) string {
+	return fmt.Sprintf("`%s`", strings.ReplaceAll(name, "`", "``"))
+}
@@ -17,10 +17,20 @@ limitations under the License.
 package sidecar
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
 )
 
 // RunTakeBackupCommand starts a backup command
@@ -33,66 +43,209 @@ func RunTakeBackupCommand(cfg *Config, srcHost, destBucket string) error {
 func pushBackupFromTo(cfg *Config, srcHost, destBucket string) error {
 	tmpDestBucket := fmt.Sprintf("%s.tmp", destBucket)
 
-	response, err := requestABackup(cfg, srcHost, serverBackupEndpoint)
+	endpoint := serverBackupEndpoint
+	if len(cfg.BackupIncrementalLSN) != 0 {
+		log.Info("take an incremental backup", "lsn", cfg.BackupIncrementalLSN)
+		endpoint = fmt.Sprintf("%s?%s=%s", endpoint, incrementalLSNParam, cfg.BackupIncrementalLSN)
+	}
+
+	response, err := requestABackup(cfg, srcHost, endpoint)
 	if err != nil {
 		return fmt.Errorf("getting backup: %s", err)
 	}
 
+	// count the received bytes to log the progress of the backup
+	received := &countingWriter{w: ioutil.Discard}
+	stream := struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(response.Body, received), response.Body}
+
+	stopProgress := logProgress(received, response)
+	size, checksum, err := uploadToBucket(cfg, stream, tmpDestBucket)
+	stopProgress()
+	if err != nil {
+		return err
+	}
+
+	if err = checkBackupTrailers(response); err != nil {
+		// backup failed so delete it from remote
+		log.Info("backup was partially taken", "trailers", response.Trailer)
+		return err
+	}
+
+	log.Info("backup was taken successfully, now move it to permanent URL")
+
+	// the backup was a success
+	// remove .tmp extension
+	if err = moveInBucket(cfg, tmpDestBucket, destBucket); err != nil {
+		return err
+	}
+
+	manifest := manifestFromTrailers(response)
+	manifest.Size = size
+	manifest.SHA256 = checksum
+	manifest.CompressCommand = strings.Join(cfg.BackupCompressCmd(), " ")
+	manifest.EncryptionKeyID = cfg.BackupEncryptionKeyID
+
+	// the backup is usable without the manifest, so it's only logged when the upload fails
+	if err = uploadManifest(cfg, manifest, destBucket); err != nil {
+		log.Error(err, "backup manifest was not uploaded")
+	}
+
+	return writeBackupManifest(manifest)
+}
+
+// logProgress periodically logs the number of bytes received from the sidecar server, the
+// throughput and the estimated completion time, until the returned function is called
+func logProgress(received *countingWriter, resp *http.Response) (stop func()) {
+	progress := &mysqlbackup.Progress{StartTime: time.Now()}
+	if size, err := strconv.ParseInt(resp.Header.Get(backupDataSizeHeader), 10, 64); err == nil {
+		progress.DataSize = size
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(backupProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				progress.Bytes = received.Count()
+				keysAndValues := []interface{}{"bytes", progress.Bytes, "dataSize", progress.DataSize,
+					"throughput", progress.Throughput(now)}
+				if eta := progress.EstimatedCompletionTime(now); eta != nil {
+					keysAndValues = append(keysAndValues, "estimatedCompletionTime", eta.Format(time.RFC3339))
+				}
+				log.Info("backup progress", keysAndValues...)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// uploadToBucket compresses, and encrypts if enabled, the stream read from in and uploads it to
+// dest. It returns the number of uploaded bytes and the hex encoded SHA-256 checksum of them.
+func uploadToBucket(cfg *Config, in io.Reader, dest string) (int64, string, error) {
 	compressCmd := cfg.BackupCompressCmd()
 	// nolint: gosec
 	compress := exec.Command(compressCmd[0], compressCmd[1:]...)
 
-	// nolint: gosec
-	rclone := exec.Command("rclone", append(cfg.RcloneArgs(), "rcat", tmpDestBucket)...)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	compress.Stdin = response.Body
+	// the compressed stream is piped through this process to count and hash the uploaded bytes
+	pipeReader, pipeWriter := io.Pipe()
+	hash := sha256.New()
+	uploaded := &countingWriter{w: io.MultiWriter(pipeWriter, hash)}
+
+	compress.Stdin = in
+	compress.Stdout = uploaded
 	compress.Stderr = os.Stderr
-	rclone.Stderr = os.Stderr
 
-	if rclone.Stdin, err = compress.StdoutPipe(); err != nil {
-		return err
+	// the compressed stream is encrypted before leaving the job
+	var encrypter io.WriteCloser
+	var err error
+	if len(cfg.BackupEncryptionKeyID) > 0 {
+		if encrypter, err = newEncryptingWriterFor(cfg, uploaded); err != nil {
+			return 0, "", fmt.Errorf("backup encryption: %s", err)
+		}
+		compress.Stdout = encrypter
 	}
 
-	errChan := make(chan error, 2)
+	if err = compress.Start(); err != nil {
+		return 0, "", fmt.Errorf("compress start error: %s", err)
+	}
 
+	// a hung input stream or upload stops the uploaded bytes count
+	stopWatch := watchProgress(uploaded, backupIdleTimeout, func() {
+		log.Info("upload made no progress, stopping it", "timeout", backupIdleTimeout)
+		if closer, ok := in.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		_ = compress.Process.Kill()
+		cancel()
+	})
+
+	compressErrChan := make(chan error, 1)
 	go func() {
 		log.V(2).Info("wait for compress to finish")
-		errChan <- compress.Run()
+		err := compress.Wait()
+		if err == nil && encrypter != nil {
+			err = encrypter.Close()
+		}
+		// signal the end of the stream to the upload
+		_ = pipeWriter.CloseWithError(err)
+		compressErrChan <- err
 	}()
 
-	go func() {
-		log.V(2).Info("wait for rclone to finish")
-		errChan <- rclone.Run()
-	}()
+	log.V(2).Info("wait for the upload to finish")
+	err = cfg.StorageFor(dest).Upload(ctx, dest, pipeReader)
+	// unblocks the compression when the upload stops early
+	_ = pipeReader.CloseWithError(fmt.Errorf("upload stopped: %v", err))
 
-	// wait for both commands to finish successful
-	for i := 1; i <= 2; i++ {
-		if err = <-errChan; err != nil {
-			return err
-		}
+	// a failed compression fails the upload too, whose error is reported
+	if compressErr := <-compressErrChan; err == nil {
+		err = compressErr
 	}
 
-	if err = checkBackupTrailers(response); err != nil {
-		// backup failed so delete it from remote
-		log.Info("backup was partially taken", "trailers", response.Trailer)
-		return err
+	if stopWatch() {
+		return 0, "", &timeoutError{op: "upload", timeout: backupIdleTimeout}
+	}
+	if err != nil {
+		return 0, "", err
 	}
 
-	log.Info("backup was taken successfully, now move it to permanent URL")
+	return uploaded.Count(), hex.EncodeToString(hash.Sum(nil)), nil
+}
 
-	// the backup was a success
-	// remove .tmp extension
-	// nolint: gosec
-	rclone = exec.Command("rclone", append(cfg.RcloneArgs(), "moveto", tmpDestBucket, destBucket)...)
+// moveInBucket moves an uploaded file, e.g. to its permanent location once complete
+func moveInBucket(cfg *Config, src, dest string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backupIdleTimeout)
+	defer cancel()
 
-	if err = rclone.Start(); err != nil {
+	if err := cfg.StorageFor(src).Move(ctx, src, dest); ctx.Err() == context.DeadlineExceeded {
+		return &timeoutError{op: "final move", timeout: backupIdleTimeout}
+	} else if err != nil {
 		return fmt.Errorf("final move failed: %s", err)
 	}
 
-	if err = rclone.Wait(); err != nil {
-		return fmt.Errorf("final move failed: %s", err)
+	return nil
+}
+
+// manifestFromTrailers returns the backup details sent by the sidecar server as trailers
+func manifestFromTrailers(resp *http.Response) *mysqlbackup.Manifest {
+	manifest := &mysqlbackup.Manifest{}
+
+	var err error
+	if manifest.FromLSN, err = strconv.ParseInt(resp.Trailer.Get(backupFromLSNTrailer), 10, 64); err != nil {
+		log.Info("backup from LSN not reported", "error", err)
+	}
+	if manifest.ToLSN, err = strconv.ParseInt(resp.Trailer.Get(backupToLSNTrailer), 10, 64); err != nil {
+		log.Info("backup to LSN not reported", "error", err)
+	}
+	manifest.GTIDSet = resp.Trailer.Get(backupGTIDSetTrailer)
+	manifest.MysqlVersion = resp.Trailer.Get(backupVersionTrailer)
+	manifest.ServerUUID = resp.Trailer.Get(backupServerUUIDTrailer)
+
+	return manifest
+}
+
+// writeBackupManifest writes the manifest as the container termination message
+// from where it's read by the operator
+func writeBackupManifest(manifest *mysqlbackup.Manifest) error {
+	data, err := manifest.EncodeWithin(terminationMessageMaxSize)
+	if err != nil {
+		return err
 	}
 
+	if err = ioutil.WriteFile(terminationLogPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %s", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,237 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"bytes"
+	"crypto/md5" // nolint: gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+)
+
+// bucketServer is a minimal S3 stand-in that stores the objects in memory
+type bucketServer struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *bucketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		source := r.Header.Get("X-Amz-Copy-Source")
+		if len(source) > 0 {
+			data = b.objects[source]
+		}
+		b.objects[name] = data
+		// nolint: gosec
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+		if len(source) > 0 {
+			fmt.Fprint(w, "<CopyObjectResult/>")
+		}
+	case http.MethodGet, http.MethodHead:
+		data, ok := b.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		delete(b.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+var _ = Describe("Test backup upload with the native storage backend", func() {
+	var (
+		bucket *bucketServer
+		server *httptest.Server
+		cfg    *Config
+	)
+
+	BeforeEach(func() {
+		bucket = &bucketServer{objects: map[string][]byte{}}
+		server = httptest.NewServer(bucket)
+
+		os.Setenv("AWS_ACCESS_KEY_ID", "access")
+		os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		os.Setenv("S3_ENDPOINT", server.URL)
+
+		cfg = &Config{StorageBackend: string(api.NativeStorageBackend)}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.Unsetenv("AWS_ACCESS_KEY_ID")
+		os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+		os.Unsetenv("S3_ENDPOINT")
+	})
+
+	It("should upload, move and download a backup", func() {
+		data := []byte(strings.Repeat("backup data ", 1024))
+
+		size, checksum, err := uploadToBucket(cfg, bytes.NewReader(data), "s3:bucket/backup.xbackup.gz.tmp")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(BeNumerically(">", 0))
+		Expect(bucket.objects["bucket/backup.xbackup.gz.tmp"]).To(HaveLen(int(size)))
+
+		sum := sha256.Sum256(bucket.objects["bucket/backup.xbackup.gz.tmp"])
+		Expect(checksum).To(Equal(hex.EncodeToString(sum[:])))
+
+		Expect(moveInBucket(cfg, "s3:bucket/backup.xbackup.gz.tmp", "s3:bucket/backup.xbackup.gz")).To(Succeed())
+		Expect(bucket.objects).ToNot(HaveKey("bucket/backup.xbackup.gz.tmp"))
+
+		out := &bytes.Buffer{}
+		cat := exec.Command("cat")
+		cat.Stdout = out
+		Expect(streamFromBucket(cfg, "s3://bucket/backup.xbackup.gz",
+			&mysqlbackup.Manifest{SHA256: checksum}, cat)).To(Succeed())
+		Expect(out.Bytes()).To(Equal(data))
+	})
+
+	It("should fail to stream a missing backup", func() {
+		err := streamFromBucket(cfg, "s3://bucket/missing.xbackup.gz", &mysqlbackup.Manifest{}, exec.Command("cat"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail to stream a corrupted backup", func() {
+		data := []byte(strings.Repeat("backup data ", 1024))
+		_, checksum, err := uploadToBucket(cfg, bytes.NewReader(data), "s3:bucket/backup.xbackup.gz")
+		Expect(err).ToNot(HaveOccurred())
+
+		// append a valid gzip member, so only the checksum tells the difference
+		extra, _, err := uploadToBucket(cfg, strings.NewReader("more data"), "s3:bucket/extra.xbackup.gz")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(extra).To(BeNumerically(">", 0))
+		bucket.objects["bucket/backup.xbackup.gz"] = append(bucket.objects["bucket/backup.xbackup.gz"],
+			bucket.objects["bucket/extra.xbackup.gz"]...)
+
+		err = streamFromBucket(cfg, "s3://bucket/backup.xbackup.gz", &mysqlbackup.Manifest{SHA256: checksum},
+			exec.Command("cat"))
+		Expect(IsChecksumMismatch(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(checksum))
+	})
+
+	It("should verify a downloaded backup before it is read", func() {
+		data := []byte(strings.Repeat("backup data ", 1024))
+		_, checksum, err := uploadToBucket(cfg, bytes.NewReader(data), "s3:bucket/backup.xbackup.gz")
+		Expect(err).ToNot(HaveOccurred())
+
+		file, err := downloadVerified(cfg, "s3://bucket/backup.xbackup.gz", &mysqlbackup.Manifest{SHA256: checksum})
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		out := &bytes.Buffer{}
+		cat := exec.Command("cat")
+		cat.Stdout = out
+		Expect(streamInto(cfg, file, &mysqlbackup.Manifest{}, cat)).To(Succeed())
+		Expect(out.Bytes()).To(Equal(data))
+
+		bucket.objects["bucket/backup.xbackup.gz"] = append(bucket.objects["bucket/backup.xbackup.gz"], 0)
+		_, err = downloadVerified(cfg, "s3://bucket/backup.xbackup.gz", &mysqlbackup.Manifest{SHA256: checksum})
+		Expect(IsChecksumMismatch(err)).To(BeTrue())
+	})
+
+	It("should not load a corrupted dump of a logical backup", func() {
+		_, checksum, err := uploadToBucket(cfg, strings.NewReader("CREATE TABLE t (id int);"),
+			"s3:"+mysqlbackup.GetDumpURL("bucket/backup.logical", "shop"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uploadManifest(cfg, &mysqlbackup.Manifest{
+			Databases:         []string{"shop"},
+			DatabaseChecksums: map[string]string{"shop": checksum + "0"},
+		}, "s3:bucket/backup.logical")).To(Succeed())
+
+		// the host is not reachable, the restore fails at the checksum before connecting to it
+		err = RunRestoreLogicalBackupCommand(cfg, "unreachable", "s3://bucket/backup.logical", "shop")
+		Expect(IsChecksumMismatch(err)).To(BeTrue())
+	})
+
+	It("should find the checksum of the backup to restore", func() {
+		manifest, err := backupManifest(cfg, "s3://bucket/backup.xbackup.gz")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(manifest.SHA256).To(BeEmpty())
+
+		Expect(uploadManifest(cfg, &mysqlbackup.Manifest{SHA256: "from-manifest", EncryptionKeyID: "key-1"},
+			"s3:bucket/backup.xbackup.gz")).To(Succeed())
+		manifest, err = backupManifest(cfg, "s3://bucket/backup.xbackup.gz")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(manifest.SHA256).To(Equal("from-manifest"))
+
+		cfg.InitBucketChecksums = map[string]string{"s3://bucket/backup.xbackup.gz": "from-status"}
+		Expect(backupManifest(cfg, "s3://bucket/backup.xbackup.gz")).To(Equal(&mysqlbackup.Manifest{
+			SHA256:          "from-status",
+			EncryptionKeyID: "key-1",
+		}))
+	})
+
+	It("should fail when the manifest of the backup can't be read", func() {
+		bucket.objects[mysqlbackup.GetManifestURL("bucket/backup.xbackup.gz")] = []byte("{not json")
+
+		_, err := backupManifest(cfg, "s3://bucket/backup.xbackup.gz")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should find the checksum of a database dump from the logical backup manifest", func() {
+		dump, err := dumpManifest(cfg, "s3://bucket/backup.logical", "shop")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dump.SHA256).To(BeEmpty())
+
+		Expect(uploadManifest(cfg, &mysqlbackup.Manifest{
+			Databases:         []string{"shop", "blog"},
+			DatabaseChecksums: map[string]string{"shop": "shop-sum", "blog": "blog-sum"},
+			EncryptionKeyID:   "key-1",
+		}, "s3:bucket/backup.logical")).To(Succeed())
+		Expect(dumpManifest(cfg, "s3://bucket/backup.logical", "shop")).To(Equal(&mysqlbackup.Manifest{
+			SHA256:          "shop-sum",
+			EncryptionKeyID: "key-1",
+		}))
+	})
+
+	It("should fail to stream a backup that should be encrypted but is not", func() {
+		data := []byte(strings.Repeat("backup data ", 1024))
+		_, _, err := uploadToBucket(cfg, bytes.NewReader(data), "s3:bucket/backup.xbackup.gz")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = streamFromBucket(cfg, "s3://bucket/backup.xbackup.gz", &mysqlbackup.Manifest{EncryptionKeyID: "key-1"},
+			exec.Command("cat"))
+		Expect(err).To(HaveOccurred())
+
+		cfg.BackupEncryptionRequired = true
+		err = streamFromBucket(cfg, "s3://bucket/backup.xbackup.gz", &mysqlbackup.Manifest{}, exec.Command("cat"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,128 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/sidecar/storage"
+)
+
+// RunPurgeTrashCommand removes from the trash the backups that were soft deleted earlier
+// than the retention period
+func RunPurgeTrashCommand(cfg *Config, trashURL string, retention time.Duration) error {
+	trash := normalizeBucketURI(strings.TrimSuffix(trashURL, "/"))
+	log.Info("purge backups trash", "trash", trash, "retention", retention)
+
+	entries, err := listBucket(cfg, trash)
+	if err != nil {
+		return fmt.Errorf("failed to list the trash: %s", err)
+	}
+
+	for _, dir := range expiredTrashDirs(entries, time.Now().Add(-retention)) {
+		log.Info("purge soft deleted backups", "dir", dir)
+
+		if err := purgeDir(cfg, fmt.Sprintf("%s/%s", trash, dir)); err != nil {
+			return fmt.Errorf("failed to purge %s: %s", dir, err)
+		}
+	}
+
+	return nil
+}
+
+// RunDeleteBackupCommand removes the backup from the bucket, or moves it to the trash when the
+// trash URL is given. The logical backups are directories, all their dumps are removed.
+func RunDeleteBackupCommand(cfg *Config, backupURL, trashURL string) error {
+	backupURL = normalizeBucketURI(strings.TrimSuffix(backupURL, "/"))
+	log.Info("delete backup", "backup", backupURL, "trash", trashURL)
+
+	backend := cfg.StorageFor(backupURL)
+	objects, err := backend.List(context.Background(), backupURL)
+	if err != nil {
+		return fmt.Errorf("failed to list the backup: %s", err)
+	}
+
+	urls := map[string]string{}
+	if len(objects) == 0 {
+		urls[backupURL] = trashURL
+	}
+	for _, obj := range objects {
+		dest := ""
+		if len(trashURL) > 0 {
+			dest = fmt.Sprintf("%s/%s", trashURL, obj.Key)
+		}
+		urls[fmt.Sprintf("%s/%s", backupURL, obj.Key)] = dest
+	}
+
+	for src, dest := range urls {
+		if len(dest) > 0 {
+			err = backend.Move(context.Background(), src, normalizeBucketURI(dest))
+		} else {
+			err = backend.Delete(context.Background(), src)
+		}
+
+		// the backup was removed by a previous attempt
+		if storage.IsNotFound(err) {
+			log.Info("backup not found", "url", src)
+		} else if err != nil {
+			return fmt.Errorf("failed to delete %s: %s", src, err)
+		}
+	}
+
+	return nil
+}
+
+// purgeDir removes all the objects under the directory url
+func purgeDir(cfg *Config, url string) error {
+	backend := cfg.StorageFor(url)
+
+	objects, err := backend.List(context.Background(), url)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := backend.Delete(context.Background(), fmt.Sprintf("%s/%s", url, obj.Key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expiredTrashDirs returns the trash directories, from the trash listing, in which the backups
+// were moved before the given time. Directories not created by the operator are ignored.
+func expiredTrashDirs(entries []bucketEntry, before time.Time) []string {
+	dirs := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir {
+			continue
+		}
+
+		deletedAt, err := time.Parse(mysqlbackup.TrashTimestampFormat, entry.Name)
+		if err != nil {
+			continue
+		}
+
+		if deletedAt.Before(before) {
+			dirs = append(dirs, entry.Name)
+		}
+	}
+	return dirs
+}
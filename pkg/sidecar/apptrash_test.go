@@ -0,0 +1,40 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test backups trash purge", func() {
+	It("should select only the directories older than the retention", func() {
+		entries := []bucketEntry{
+			{Name: "20210101T100000Z", IsDir: true},
+			{Name: "20210105T100000Z", IsDir: true},
+			{Name: "20210103T100000Z"},
+			{Name: "something-else", IsDir: true},
+			{Name: "20210110T100000Z", IsDir: true},
+		}
+		before := time.Date(2021, 1, 6, 0, 0, 0, 0, time.UTC)
+
+		Expect(expiredTrashDirs(entries, before)).To(ConsistOf("20210101T100000Z", "20210105T100000Z"))
+		Expect(expiredTrashDirs(nil, before)).To(BeEmpty())
+	})
+})
@@ -30,7 +30,9 @@ import (
 	"github.com/blang/semver"
 	"github.com/presslabs/controller-util/rand"
 
+	api "github.com/bitpoke/mysql-operator/pkg/apis/mysql/v1alpha1"
 	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlcluster"
+	"github.com/bitpoke/mysql-operator/pkg/sidecar/storage"
 	"github.com/bitpoke/mysql-operator/pkg/util/constants"
 )
 
@@ -48,6 +50,35 @@ type Config struct {
 	// InitBucketURL represents the init bucket to initialize mysql
 	InitBucketURL string
 
+	// InitBucketIncrementalURLs is the list of incremental backups applied on top of InitBucketURL
+	InitBucketIncrementalURLs []string
+
+	// InitBucketChecksums maps the backups to restore to their SHA-256 checksums, as recorded in
+	// the backup status
+	InitBucketChecksums map[string]string
+
+	// BackupIncrementalLSN is the LSN from which to take an incremental backup
+	BackupIncrementalLSN string
+
+	// BackupEncryptionKeyID is the ID of the key with which backups and binlogs are encrypted
+	// before the upload, empty if encryption is not enabled
+	BackupEncryptionKeyID string
+
+	// BackupEncryptionRequired is set when the backups and binlogs read from the bucket must be
+	// encrypted, so that data that is not encrypted is rejected
+	BackupEncryptionRequired bool
+
+	// BinlogArchiveURL is the location where the master uploads its closed binlogs
+	BinlogArchiveURL string
+	// BinlogRetention is how long the binlogs are kept after they are archived
+	BinlogRetention time.Duration
+
+	// RestoreBinlogsURL is the location of the binlogs to replay after cloning from InitBucketURL
+	RestoreBinlogsURL string
+	// RestoreStopDatetime and RestoreStopGTIDSet define where the binlogs replay stops
+	RestoreStopDatetime string
+	RestoreStopGTIDSet  string
+
 	// OperatorUser represents the credentials that the operator will use to connect to the mysql
 	OperatorUser     string
 	OperatorPassword string
@@ -68,6 +99,11 @@ type Config struct {
 	OrchestratorUser     string
 	OrchestratorPassword string
 
+	// OrchestratorURI is the orchestrator HTTP API and OrchestratorClusterAlias is the alias
+	// of the cluster in orchestrator, used to take over the master before shutdown
+	OrchestratorURI          string
+	OrchestratorClusterAlias string
+
 	// heartbeat credentials
 	HeartBeatUser     string
 	HeartBeatPassword string
@@ -100,6 +136,18 @@ type Config struct {
 	// XtrabackupTargetDir is a backup destination directory for xtrabackup.
 	XtrabackupTargetDir string
 
+	// BackupBandwidthLimit and CloneBandwidthLimit are the maximum rates, in bytes per second,
+	// at which the data is streamed for backups and for cloning. Zero means unlimited.
+	BackupBandwidthLimit int64
+	CloneBandwidthLimit  int64
+
+	// StorageBackend is the client used to access the bucket, rclone or native
+	StorageBackend string
+	// StoragePartSize and StorageConcurrency configure the multipart uploads of the native
+	// storage backend
+	StoragePartSize    int64
+	StorageConcurrency int64
+
 	masterService              string
 	healthyReplicaCloneService string
 
@@ -116,6 +164,13 @@ func (cfg *Config) FQDNForServer(id int) string {
 	return fmt.Sprintf("%s-%d.%s.%s", base, id-cfg.MyServerIDOffset, cfg.ServiceName, cfg.Namespace)
 }
 
+// IsClusterNode returns true if the given host is the FQDN of a node of this cluster
+func (cfg *Config) IsClusterNode(host string) bool {
+	base := mysqlcluster.GetNameForResource(mysqlcluster.StatefulSet, cfg.ClusterName)
+	return strings.HasPrefix(host, base+"-") &&
+		strings.HasSuffix(strings.TrimSuffix(host, "."), fmt.Sprintf(".%s.%s", cfg.ServiceName, cfg.Namespace))
+}
+
 // ClusterFQDN returns the cluster FQ Name of the cluster from which the node belongs
 func (cfg *Config) ClusterFQDN() string {
 	return fmt.Sprintf("%s.%s", cfg.ClusterName, cfg.Namespace)
@@ -160,6 +215,11 @@ func (cfg *Config) ShouldCloneFromBucket() bool {
 	return !cfg.ExistsMySQLData && cfg.ServerID() == cfg.MyServerIDOffset && len(cfg.InitBucketURL) != 0
 }
 
+// ShouldRestoreToPoint returns true if archived binlogs should be replayed after cloning from bucket
+func (cfg *Config) ShouldRestoreToPoint() bool {
+	return cfg.ShouldCloneFromBucket() && len(cfg.RestoreBinlogsURL) != 0
+}
+
 // BackupCompressCmd returns a command to use for compressing the backup.
 func (cfg *Config) BackupCompressCmd() []string {
 	if len(cfg.BackupCompressCommand) > 0 {
@@ -183,10 +243,25 @@ func (cfg *Config) RcloneArgs() []string {
 	return append(rcloneArgs, cfg.RcloneExtraArgs...)
 }
 
+// StorageFor returns the storage backend for the objects at url
+func (cfg *Config) StorageFor(url string) storage.Backend {
+	return storage.New(url, storage.Options{
+		Native:      cfg.StorageBackend == string(api.NativeStorageBackend),
+		PartSize:    cfg.StoragePartSize,
+		Concurrency: int(cfg.StorageConcurrency),
+		RcloneArgs:  cfg.RcloneArgs(),
+	})
+}
+
 // XbstreamArgs returns a complete set of xbstream arguments.
 func (cfg *Config) XbstreamArgs() []string {
-	// xbstream --extract --directory=<mysql-data-dir> <extra-args>
-	xbstreamArgs := []string{"--extract", fmt.Sprintf("--directory=%s", dataDir)}
+	return cfg.XbstreamArgsFor(dataDir)
+}
+
+// XbstreamArgsFor returns a complete set of xbstream arguments for extracting into dir.
+func (cfg *Config) XbstreamArgsFor(dir string) []string {
+	// xbstream --extract --directory=<dir> <extra-args>
+	xbstreamArgs := []string{"--extract", fmt.Sprintf("--directory=%s", dir)}
 	return append(xbstreamArgs, cfg.XbstreamExtraArgs...)
 }
 
@@ -214,6 +289,56 @@ func (cfg *Config) XtrabackupPrepareArgs() []string {
 	return append(xtrabackupPrepareArgs, cfg.XtrabackupPrepareExtraArgs...)
 }
 
+// MysqlbinlogArgs returns the mysqlbinlog arguments used to replay binlogs up to the restore point.
+func (cfg *Config) MysqlbinlogArgs() []string {
+	mysqlbinlogArgs := []string{}
+	if len(cfg.RestoreStopDatetime) != 0 {
+		mysqlbinlogArgs = append(mysqlbinlogArgs, fmt.Sprintf("--stop-datetime=%s", cfg.RestoreStopDatetime))
+	}
+	if len(cfg.RestoreStopGTIDSet) != 0 {
+		mysqlbinlogArgs = append(mysqlbinlogArgs, fmt.Sprintf("--include-gtids=%s", cfg.RestoreStopGTIDSet))
+	}
+	return mysqlbinlogArgs
+}
+
+// MysqlClientArgs returns the arguments of the mysql clients to connect to host as the
+// operator user. The password is passed through the MYSQL_PWD environment variable.
+func (cfg *Config) MysqlClientArgs(host string) []string {
+	return []string{
+		fmt.Sprintf("--host=%s", host),
+		fmt.Sprintf("--port=%s", mysqlPort),
+		fmt.Sprintf("--user=%s", cfg.OperatorUser),
+	}
+}
+
+// MysqldumpArgs returns the mysqldump arguments used to dump a database for a logical backup.
+// The dump is taken in a consistent snapshot, without locking the tables, and has no CREATE
+// DATABASE statement such that it can be loaded into any database.
+func (cfg *Config) MysqldumpArgs(host, database string) []string {
+	return append(cfg.MysqlClientArgs(host),
+		"--single-transaction",
+		"--quick",
+		"--routines",
+		"--triggers",
+		"--events",
+		// the dumps are loaded into other clusters, which have their own GTIDs
+		"--set-gtid-purged=OFF",
+		database,
+	)
+}
+
+// XtrabackupApplyLogOnlyArgs returns a complete set of xtrabackup arguments for preparing a
+// backup on which incremental backups are applied afterwards. The incremental backup from
+// incrementalDir is merged into the data dir, if set.
+func (cfg *Config) XtrabackupApplyLogOnlyArgs(incrementalDir string) []string {
+	// xtrabackup --prepare --apply-log-only --target-dir=<mysql-data-dir> [--incremental-dir=<dir>] <extra-args>
+	xtrabackupPrepareArgs := []string{"--prepare", "--apply-log-only", fmt.Sprintf("--target-dir=%s", dataDir)}
+	if len(incrementalDir) != 0 {
+		xtrabackupPrepareArgs = append(xtrabackupPrepareArgs, fmt.Sprintf("--incremental-dir=%s", incrementalDir))
+	}
+	return append(xtrabackupPrepareArgs, cfg.XtrabackupPrepareExtraArgs...)
+}
+
 // NewConfig returns a pointer to Config configured from environment variables
 func NewConfig() *Config {
 	var (
@@ -252,7 +377,21 @@ func NewConfig() *Config {
 		Namespace:   getEnvValue("MY_NAMESPACE"),
 		ServiceName: getEnvValue("MY_SERVICE_NAME"),
 
-		InitBucketURL: getEnvValue("INIT_BUCKET_URI"),
+		InitBucketURL:             getEnvValue("INIT_BUCKET_URI"),
+		InitBucketIncrementalURLs: strings.Fields(getEnvValue("INIT_BUCKET_INCREMENTAL_URIS")),
+		InitBucketChecksums:       parseChecksums(getEnvValue("INIT_BUCKET_CHECKSUMS")),
+
+		BackupIncrementalLSN: getEnvValue("BACKUP_INCREMENTAL_LSN"),
+
+		BackupEncryptionKeyID:    getEnvValue("BACKUP_ENCRYPTION_KEY_ID"),
+		BackupEncryptionRequired: getEnvValue("BACKUP_ENCRYPTION_REQUIRED") == "true",
+
+		BinlogArchiveURL: getEnvValue("BINLOG_ARCHIVE_URL"),
+		BinlogRetention:  getEnvDuration("BINLOG_RETENTION", defaultBinlogRetention),
+
+		RestoreBinlogsURL:   getEnvValue("RESTORE_BINLOGS_URL"),
+		RestoreStopDatetime: getEnvValue("RESTORE_STOP_DATETIME"),
+		RestoreStopGTIDSet:  getEnvValue("RESTORE_STOP_GTID_SET"),
 
 		OperatorUser:     getEnvValue("OPERATOR_USER"),
 		OperatorPassword: getEnvValue("OPERATOR_PASSWORD"),
@@ -269,6 +408,9 @@ func NewConfig() *Config {
 		OrchestratorUser:     getEnvValue("ORC_TOPOLOGY_USER"),
 		OrchestratorPassword: getEnvValue("ORC_TOPOLOGY_PASSWORD"),
 
+		OrchestratorURI:          getEnvValue("ORCH_HTTP_API"),
+		OrchestratorClusterAlias: getEnvValue("ORCH_CLUSTER_ALIAS"),
+
 		HeartBeatUser:     heartBeatUserName,
 		HeartBeatPassword: hbPass,
 
@@ -284,6 +426,13 @@ func NewConfig() *Config {
 		XtrabackupPrepareExtraArgs: strings.Fields(getEnvValue("XTRABACKUP_PREPARE_EXTRA_ARGS")),
 		XtrabackupTargetDir:        getEnvValue("XTRABACKUP_TARGET_DIR"),
 
+		BackupBandwidthLimit: getEnvInt64("BACKUP_BANDWIDTH_LIMIT"),
+		CloneBandwidthLimit:  getEnvInt64("CLONE_BANDWIDTH_LIMIT"),
+
+		StorageBackend:     getEnvValue("STORAGE_BACKEND"),
+		StoragePartSize:    getEnvInt64("STORAGE_PART_SIZE"),
+		StorageConcurrency: getEnvInt64("STORAGE_CONCURRENCY"),
+
 		InitFileExtraSQL: strings.Split(getEnvValue("INITFILE_EXTRA_SQL"), ";"),
 
 		MySQLVersion: mysqlVersion,
@@ -301,6 +450,51 @@ func getEnvValue(key string) string {
 	return value
 }
 
+// getEnvInt64 returns the value of the environment variable as an integer, zero when not set
+func getEnvInt64(key string) int64 {
+	value := getEnvValue(key)
+	if len(value) == 0 {
+		return 0
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Info("environment is not an integer", "key", key, "value", value)
+		return 0
+	}
+	return n
+}
+
+// getEnvDuration returns the value of the environment variable as a duration, def when not set
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value := getEnvValue(key)
+	if len(value) == 0 {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Info("environment is not a duration", "key", key, "value", value)
+		return def
+	}
+	return d
+}
+
+// parseChecksums parses a space separated list of url=sha256 pairs
+func parseChecksums(value string) map[string]string {
+	checksums := map[string]string{}
+	for _, pair := range strings.Fields(value) {
+		// the url may contain '=' as well, unlike the checksum
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			log.Info("malformed backup checksum", "value", pair)
+			continue
+		}
+		checksums[pair[:i]] = pair[i+1:]
+	}
+	return checksums
+}
+
 func getOrdinalFromHostname(hn string) int {
 	begin := strings.LastIndex(hn, "-")
 	if begin < 0 {
@@ -17,6 +17,9 @@ limitations under the License.
 package sidecar
 
 import (
+	"os"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -52,6 +55,69 @@ var _ = Describe("Test sidecar configs", func() {
 		Expect(cfg.MasterFQDN()).To(Equal("cluster-mysql-master"))
 	})
 
+	It("should recognize the nodes of the cluster", func() {
+		Expect(cfg.IsClusterNode("cluster-mysql-1.mysql.default")).To(BeTrue())
+		Expect(cfg.IsClusterNode("cluster-mysql-1.mysql.default.")).To(BeTrue())
+		// the replication source of a standby cluster
+		Expect(cfg.IsClusterNode("primary.example.com")).To(BeFalse())
+		Expect(cfg.IsClusterNode("other-mysql-0.mysql.default")).To(BeFalse())
+	})
+
+	It("should stop the binlogs replay at the restore point", func() {
+		Expect(cfg.MysqlbinlogArgs()).To(BeEmpty())
+
+		cfg.RestoreStopDatetime = "2021-01-02 10:00:00"
+		cfg.RestoreStopGTIDSet = "uuid:1-10"
+		Expect(cfg.MysqlbinlogArgs()).To(ConsistOf(
+			"--stop-datetime=2021-01-02 10:00:00",
+			"--include-gtids=uuid:1-10",
+		))
+	})
+
+	It("should merge incremental backups into the data dir", func() {
+		Expect(cfg.XtrabackupApplyLogOnlyArgs("")).To(Equal([]string{
+			"--prepare", "--apply-log-only", "--target-dir=" + dataDir,
+		}))
+		Expect(cfg.XtrabackupApplyLogOnlyArgs("/tmp/inc")).To(ContainElement("--incremental-dir=/tmp/inc"))
+	})
+
+	It("should dump a single database without locking", func() {
+		cfg.OperatorUser = "operator"
+		args := cfg.MysqldumpArgs("cluster-mysql-1.mysql.default", "shop")
+		Expect(args).To(ContainElements(
+			"--host=cluster-mysql-1.mysql.default",
+			"--user=operator",
+			"--single-transaction",
+			"--set-gtid-purged=OFF",
+		))
+		Expect(args).ToNot(ContainElement("--databases"))
+		Expect(args[len(args)-1]).To(Equal("shop"))
+	})
+
+	It("should quote the database names", func() {
+		Expect(quoteIdentifier("shop")).To(Equal("`shop`"))
+		Expect(quoteIdentifier("sh`op")).To(Equal("`sh``op`"))
+	})
+
+	It("should parse the checksums of the backups to restore", func() {
+		Expect(parseChecksums("")).To(BeEmpty())
+		Expect(parseChecksums("gs://bucket/full.xbackup.gz=abc s3://bucket/inc.xbackup.gz?v=1=def bogus")).To(Equal(map[string]string{
+			"gs://bucket/full.xbackup.gz":    "abc",
+			"s3://bucket/inc.xbackup.gz?v=1": "def",
+		}))
+	})
+
+	It("should parse the binlog retention", func() {
+		Expect(getEnvDuration("TEST_BINLOG_RETENTION", defaultBinlogRetention)).To(Equal(defaultBinlogRetention))
+
+		os.Setenv("TEST_BINLOG_RETENTION", "48h0m0s")
+		defer os.Unsetenv("TEST_BINLOG_RETENTION")
+		Expect(getEnvDuration("TEST_BINLOG_RETENTION", defaultBinlogRetention)).To(Equal(48 * time.Hour))
+
+		os.Setenv("TEST_BINLOG_RETENTION", "two days")
+		Expect(getEnvDuration("TEST_BINLOG_RETENTION", defaultBinlogRetention)).To(Equal(defaultBinlogRetention))
+	})
+
 	It("should determine the host ip", func() {
 		Expect(retryLookupHost("localhost")).To(ContainElement("127.0.0.1"))
 	})
@@ -66,14 +66,70 @@ var (
 	serverProbeEndpoint = constants.SidecarServerProbePath
 	// ServerBackupEndpoint is the http server endpoint for backups
 	serverBackupEndpoint = "/xbackup"
+	// serverBackupProgressEndpoint is the http server endpoint for the progress of the running backup
+	serverBackupProgressEndpoint = constants.SidecarServerBackupProgressPath
+	// serverPreStopEndpoint is the http server endpoint for the pre-stop hook
+	serverPreStopEndpoint = constants.SidecarServerPreStopPath
+	// serverSnapshotLockEndpoint is the http server endpoint for the locks of volume snapshot backups
+	serverSnapshotLockEndpoint = constants.SidecarServerSnapshotLockPath
+	// snapshotLockTimeout is the maximum time for which the node is locked for a volume snapshot
+	// backup, until the snapshot of its data volume is cut
+	snapshotLockTimeout = 2 * time.Minute
+	// snapshotLockWaitTimeout is how long, in seconds, the lock for backup is waited for, e.g.
+	// behind long running queries, before the backup is retried
+	snapshotLockWaitTimeout = 10
+	// snapshotLockRecordTTL is how long a released lock is remembered, such that the operator
+	// can tell whether the snapshot was cut before the release
+	snapshotLockRecordTTL = time.Hour
+	// backupProgressInterval is how often the backup job logs the progress of the backup
+	backupProgressInterval = time.Minute
 	// ServerDialTimeout is the connect timeout (not http timeout) for requesting a backup from the sidecar server
 	serverConnectTimeout = 5 * time.Second
 
+	// backupIdleTimeout is how long a backup upload may make no progress, either because the
+	// stream from the sidecar server or the upload to the bucket hangs, before it's stopped
+	backupIdleTimeout = 30 * time.Minute
+
 	// xtrabackup Executable Name
 	xtrabackupCommand = "xtrabackup"
 
 	// xbstream Executable Name
 	xbstreamCommand = "xbstream"
 
-	shPreStop = constants.ShPreStop
+	// mysqlbinlog Executable Name
+	mysqlbinlogCommand = "mysqlbinlog"
+
+	// binlogArchiveInterval is the interval at which the master checks for closed binlogs to upload
+	binlogArchiveInterval = time.Minute
+
+	// defaultBinlogRetention is how long the binlogs are kept by MySQL when not configured, the
+	// master purges them only after they are archived
+	defaultBinlogRetention = 14 * 24 * time.Hour
+
+	// restorePointMarker is the file that marks that binlogs should be replayed once MySQL starts
+	restorePointMarker = "pending-restore-point"
+
+	// dataOwnerFile holds the hostname of the node that owns the data, to detect data copied
+	// from another node, e.g. a data volume created from a volume snapshot
+	dataOwnerFile = ".mysql-operator-owner"
+
+	// mysqlStartTimeout is the time to wait for MySQL to accept connections
+	mysqlStartTimeout = 10 * time.Minute
+
+	// terminationLogPath is the file in which the backup job writes the backup manifest
+	terminationLogPath = "/dev/termination-log"
+
+	// terminationMessageMaxSize is the maximum size of a container termination message
+	terminationMessageMaxSize = 4096
+
+	// backupCatalogMaxSize is the maximum size of the backup catalog, which is written in a config
+	// map, limited to 1MiB, along with its metadata
+	backupCatalogMaxSize = 1000 * 1024
+
+	// incrementalDirName is the directory, inside dataDir, where incremental backups are
+	// extracted before being merged into the data dir
+	incrementalDirName = "xtrabackup-incremental"
+
+	// encryptionKeysDir is the directory with the backup encryption keys, a file per key ID
+	encryptionKeysDir = constants.BackupEncryptionKeysPath
 )
@@ -0,0 +1,421 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strings"
+)
+
+// Backups are encrypted with AES-256-GCM in chunks, such that streams of unknown size are
+// processed without being held in memory. An encrypted stream has the format:
+//
+//   magic (8 bytes) | key ID length (1 byte) | key ID | nonce prefix (7 bytes) | chunks
+//
+// Each chunk holds at most encryptionChunkSize bytes of data followed by the GCM tag. The nonce
+// of a chunk is made of the nonce prefix, the chunk index (4 bytes, big endian) and a byte that
+// is set only for the last chunk, so a truncated stream fails to decrypt. The header is
+// authenticated with every chunk.
+
+var encryptionMagic = []byte("MOENC\x00\x00\x01")
+
+// errNotEncrypted is returned when reading a stream that is not encrypted, but should be
+var errNotEncrypted = errors.New("the data is not encrypted, but encryption is required")
+
+const (
+	encryptionChunkSize       = 64 * 1024
+	encryptionKeySize         = 32
+	encryptionNoncePrefixSize = 7
+)
+
+type encryptingWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+
+	headerWritten bool
+	closed        bool
+	counter       uint32
+	buf           []byte
+	out           []byte
+}
+
+// newEncryptingWriter returns a writer that encrypts with the given key the data written to w.
+// It must be closed to write the last chunk.
+func newEncryptingWriter(w io.Writer, keyID string, key []byte) (io.WriteCloser, error) {
+	if len(keyID) == 0 || len(keyID) > math.MaxUint8 {
+		return nil, fmt.Errorf("invalid encryption key ID: %q", keyID)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, encryptionNoncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{}, encryptionMagic...)
+	header = append(header, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = append(header, prefix...)
+
+	return &encryptingWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		buf:    make([]byte, 0, encryptionChunkSize),
+	}, nil
+}
+
+// newEncryptingWriterFor returns a writer that encrypts the data with the configured key
+func newEncryptingWriterFor(cfg *Config, w io.Writer) (io.WriteCloser, error) {
+	key, err := loadEncryptionKey(cfg.BackupEncryptionKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptingWriter(w, cfg.BackupEncryptionKeyID, key)
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, fmt.Errorf("write to closed encryption stream")
+	}
+
+	n := 0
+	for len(p) > 0 {
+		if len(e.buf) == encryptionChunkSize {
+			// more data follows so the buffered chunk is not the last one
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+
+		c := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+
+	return n, nil
+}
+
+// Close writes the last chunk, it does not close the underlying writer
+func (e *encryptingWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(true)
+}
+
+func (e *encryptingWriter) seal(last bool) error {
+	if e.counter == math.MaxUint32 {
+		return fmt.Errorf("encryption stream is too large")
+	}
+
+	if !e.headerWritten {
+		if _, err := e.w.Write(e.header); err != nil {
+			return err
+		}
+		e.headerWritten = true
+	}
+
+	e.out = e.aead.Seal(e.out[:0], chunkNonce(e.prefix, e.counter, last), e.buf, e.header)
+	e.counter++
+	e.buf = e.buf[:0]
+
+	_, err := e.w.Write(e.out)
+	return err
+}
+
+type decryptingReader struct {
+	r *bufio.Reader
+
+	required    bool
+	initialized bool
+	plain       bool
+	done        bool
+
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+
+	chunk []byte
+	buf   []byte
+	out   []byte
+}
+
+// newDecryptingReader returns a reader that decrypts the data read from r. The key is found by
+// the ID written in the stream header. Streams that are not encrypted are read as they are,
+// unless the encryption is required, in which case reading them fails.
+func newDecryptingReader(r io.Reader, required bool) *decryptingReader {
+	return &decryptingReader{
+		r:        bufio.NewReader(r),
+		required: required,
+	}
+}
+
+// encrypted reads the stream header and returns true if the stream is encrypted
+func (d *decryptingReader) encrypted() (bool, error) {
+	if err := d.init(); err != nil {
+		return false, err
+	}
+	return !d.plain, nil
+}
+
+func (d *decryptingReader) init() error {
+	if d.initialized {
+		return nil
+	}
+	d.initialized = true
+
+	magic, err := d.r.Peek(len(encryptionMagic))
+	if err != nil || !bytes.Equal(magic, encryptionMagic) {
+		if d.required {
+			return errNotEncrypted
+		}
+		d.plain = true
+		return nil
+	}
+
+	header := make([]byte, len(encryptionMagic)+1)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return err
+	}
+
+	keyID := make([]byte, int(header[len(header)-1]))
+	if _, err := io.ReadFull(d.r, keyID); err != nil {
+		return fmt.Errorf("failed to read the encryption header: %s", err)
+	}
+
+	prefix := make([]byte, encryptionNoncePrefixSize)
+	if _, err := io.ReadFull(d.r, prefix); err != nil {
+		return fmt.Errorf("failed to read the encryption header: %s", err)
+	}
+
+	key, err := loadEncryptionKey(string(keyID))
+	if err != nil {
+		return err
+	}
+
+	if d.aead, err = newAEAD(key); err != nil {
+		return err
+	}
+
+	d.header = append(append(header, keyID...), prefix...)
+	d.prefix = prefix
+	d.chunk = make([]byte, encryptionChunkSize+d.aead.Overhead())
+
+	return nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	if err := d.init(); err != nil {
+		return 0, err
+	}
+
+	if d.plain {
+		return d.r.Read(p)
+	}
+
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *decryptingReader) open() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+
+	last := false
+	switch err {
+	case nil:
+		// a full chunk is the last one only when nothing follows
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		return fmt.Errorf("encrypted stream is truncated")
+	default:
+		return err
+	}
+
+	d.buf, err = d.aead.Open(d.buf[:0], chunkNonce(d.prefix, d.counter, last), d.chunk[:n], d.header)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt, the key is wrong or the data is corrupted: %s", err)
+	}
+
+	d.counter++
+	d.out = d.buf
+	d.done = last
+	return nil
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, encryptionNoncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptionNoncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// loadEncryptionKey reads the key with the given ID from the mounted secret
+func loadEncryptionKey(keyID string) ([]byte, error) {
+	if len(keyID) == 0 || strings.Contains(keyID, "/") || keyID == "." || keyID == ".." {
+		return nil, fmt.Errorf("invalid encryption key ID: %q", keyID)
+	}
+
+	data, err := ioutil.ReadFile(path.Join(encryptionKeysDir, keyID))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("encryption key %q is not found", keyID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	key, err := parseEncryptionKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key %q: %s", keyID, err)
+	}
+	return key, nil
+}
+
+// parseEncryptionKey accepts 256-bit keys either raw, hex or base64 encoded
+func parseEncryptionKey(data []byte) ([]byte, error) {
+	if len(data) == encryptionKeySize {
+		return data, nil
+	}
+
+	str := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(str); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(str); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("the key must have 256 bits, raw, hex or base64 encoded")
+}
+
+// uploadEncrypted encrypts the file and uploads it to dest
+func uploadEncrypted(cfg *Config, file, dest string) error {
+	f, err := os.Open(path.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	pipeReader, pipeWriter := io.Pipe()
+	// unblocks the encryption when the upload fails early
+	defer func() { _ = pipeReader.Close() }()
+
+	encrypter, err := newEncryptingWriterFor(cfg, pipeWriter)
+	if err != nil {
+		return err
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(encrypter, f)
+		if err == nil {
+			err = encrypter.Close()
+		}
+		_ = pipeWriter.CloseWithError(err)
+		errChan <- err
+	}()
+
+	if err := cfg.StorageFor(dest).Upload(context.Background(), dest, pipeReader); err != nil {
+		return err
+	}
+
+	return <-errChan
+}
+
+// decryptFile decrypts in place the given file, if it's encrypted. When the encryption is
+// required a file that is not encrypted is an error.
+func decryptFile(file string, required bool) error {
+	f, err := os.Open(path.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	decrypter := newDecryptingReader(f, required)
+	if encrypted, err := decrypter.encrypted(); err != nil || !encrypted {
+		return err
+	}
+
+	tmpFile := file + ".decrypted"
+	out, err := os.Create(path.Clean(tmpFile))
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, decrypter); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("failed to decrypt %s: %s", file, err)
+	}
+
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, file)
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test backup encryption", func() {
+	var (
+		keysDir     string
+		origKeysDir string
+		key         []byte
+	)
+
+	encrypt := func(keyID string, data []byte) []byte {
+		out := &bytes.Buffer{}
+		w, err := newEncryptingWriter(out, keyID, key)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w.Write(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+		return out.Bytes()
+	}
+
+	BeforeEach(func() {
+		var err error
+		keysDir, err = ioutil.TempDir("", "mysql-operator-keys")
+		Expect(err).ToNot(HaveOccurred())
+
+		origKeysDir = encryptionKeysDir
+		encryptionKeysDir = keysDir
+
+		key = make([]byte, encryptionKeySize)
+		_, err = rand.Read(key)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(ioutil.WriteFile(path.Join(keysDir, "key-1"), key, 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(path.Join(keysDir, "key-2"), []byte(hex.EncodeToString(key)+"\n"), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		encryptionKeysDir = origKeysDir
+		Expect(os.RemoveAll(keysDir)).To(Succeed())
+	})
+
+	DescribeTable("should decrypt what was encrypted",
+		func(size int) {
+			data := make([]byte, size)
+			_, err := rand.Read(data)
+			Expect(err).ToNot(HaveOccurred())
+
+			encrypted := encrypt("key-1", data)
+			if size > 0 {
+				Expect(encrypted).ToNot(ContainSubstring(string(data)))
+			}
+
+			decrypted, err := ioutil.ReadAll(newDecryptingReader(bytes.NewReader(encrypted), true))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decrypted).To(Equal(data))
+		},
+		Entry("empty stream", 0),
+		Entry("small stream", 100),
+		Entry("exactly one chunk", encryptionChunkSize),
+		Entry("more than one chunk", encryptionChunkSize+1),
+		Entry("many chunks", 3*encryptionChunkSize+42),
+	)
+
+	It("should find the key by the ID from the stream", func() {
+		encrypted := encrypt("key-2", []byte("some data"))
+
+		decrypted, err := ioutil.ReadAll(newDecryptingReader(bytes.NewReader(encrypted), true))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decrypted).To(Equal([]byte("some data")))
+	})
+
+	It("should fail when the key is not found", func() {
+		encrypted := encrypt("rotated", []byte("some data"))
+
+		_, err := ioutil.ReadAll(newDecryptingReader(bytes.NewReader(encrypted), true))
+		Expect(err).To(MatchError(ContainSubstring(`"rotated" is not found`)))
+	})
+
+	It("should fail when the stream is truncated", func() {
+		data := make([]byte, 2*encryptionChunkSize+10)
+		encrypted := encrypt("key-1", data)
+
+		// drop the last chunk
+		truncated := encrypted[:len(encrypted)-26]
+		_, err := ioutil.ReadAll(newDecryptingReader(bytes.NewReader(truncated), true))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail when the stream is tampered", func() {
+		encrypted := encrypt("key-1", []byte("some data"))
+		encrypted[len(encrypted)-1] ^= 0xff
+
+		_, err := ioutil.ReadAll(newDecryptingReader(bytes.NewReader(encrypted), true))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should read streams that are not encrypted", func() {
+		decrypter := newDecryptingReader(bytes.NewReader([]byte("plain")), false)
+		Expect(decrypter.encrypted()).To(BeFalse())
+
+		data, err := ioutil.ReadAll(decrypter)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("plain")))
+	})
+
+	It("should fail to read streams that are not encrypted when encryption is required", func() {
+		_, err := ioutil.ReadAll(newDecryptingReader(bytes.NewReader([]byte("plain")), true))
+		Expect(err).To(Equal(errNotEncrypted))
+
+		file := path.Join(keysDir, "mysql-bin.000002")
+		Expect(ioutil.WriteFile(file, []byte("binlog"), 0644)).To(Succeed())
+		Expect(decryptFile(file, true)).To(Equal(errNotEncrypted))
+	})
+
+	It("should decrypt files in place", func() {
+		file := path.Join(keysDir, "mysql-bin.000001")
+		Expect(ioutil.WriteFile(file, encrypt("key-1", []byte("binlog")), 0644)).To(Succeed())
+
+		Expect(decryptFile(file, true)).To(Succeed())
+		Expect(ioutil.ReadFile(file)).To(Equal([]byte("binlog")))
+
+		// a second time is a no-op
+		Expect(decryptFile(file, false)).To(Succeed())
+		Expect(ioutil.ReadFile(file)).To(Equal([]byte("binlog")))
+	})
+
+	It("should parse keys in any encoding", func() {
+		Expect(parseEncryptionKey(key)).To(Equal(key))
+		Expect(parseEncryptionKey([]byte(hex.EncodeToString(key)))).To(Equal(key))
+		Expect(parseEncryptionKey([]byte(base64.StdEncoding.EncodeToString(key) + "\n"))).To(Equal(key))
+
+		_, err := parseEncryptionKey([]byte("too short"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -18,27 +18,74 @@ package sidecar
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/time/rate"
 	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/util/constants"
 )
 
 const (
-	backupStatusTrailer = "X-Backup-Status"
-	backupSuccessful    = "Success"
-	backupFailed        = "Failed"
+	backupStatusTrailer  = "X-Backup-Status"
+	backupSuccessful     = "Success"
+	backupFailed         = "Failed"
+	backupFromLSNTrailer = "X-Backup-From-LSN"
+	backupToLSNTrailer   = "X-Backup-To-LSN"
+	backupGTIDSetTrailer = "X-Backup-GTID-Set"
+	backupVersionTrailer = "X-Backup-MySQL-Version"
+	// backupServerUUIDTrailer is the UUID of the server from which the backup is taken
+	backupServerUUIDTrailer = "X-Backup-Server-UUID"
+
+	// backupDataSizeHeader is the size of the data dir of the node, sent to estimate the
+	// size of the backup stream
+	backupDataSizeHeader = "X-Backup-Data-Size"
+
+	// incrementalLSNParam is the query parameter for requesting an incremental backup
+	incrementalLSNParam = "incremental-lsn"
+
+	// streamPurposeParam is the query parameter that tells what the stream is used for, to
+	// throttle it with the matching bandwidth limit and to report its progress
+	streamPurposeParam = constants.SidecarServerStreamPurposeParam
+	// clonePurpose marks the streams requested by nodes that clone their data
+	clonePurpose = "clone"
+	// backupPurpose marks the streams requested by the backup jobs, the default purpose
+	backupPurpose = constants.SidecarServerBackupPurpose
 )
 
+// streamProgress is the progress of a stream, whose bytes are counted by streamed
+type streamProgress struct {
+	progress mysqlbackup.Progress
+	streamed *countingWriter
+}
+
 type server struct {
 	cfg *Config
 	http.Server
+
+	// progress is the progress of the streams being sent, by purpose
+	progressLock sync.Mutex
+	progress     map[string]*streamProgress
+
+	// the master takeover is done once, the pre-stop hooks of all containers wait for it. A
+	// failed takeover is retried by the next hook.
+	takeoverLock sync.Mutex
+	takeoverDone bool
+
+	// snapshotLocks are the locks held for volume snapshot backups, until their snapshots are cut
+	snapshotLocks *snapshotLocks
 }
 
 func newServer(cfg *Config, stop <-chan struct{}) *server {
@@ -49,11 +96,16 @@ func newServer(cfg *Config, stop <-chan struct{}) *server {
 			Addr:    fmt.Sprintf(":%d", serverPort),
 			Handler: mux,
 		},
+		snapshotLocks: newSnapshotLocks(),
 	}
 
 	// Add handle functions
 	mux.HandleFunc(serverProbeEndpoint, srv.healthHandler)
+	// the streams are sent one at a time, each at most at the bandwidth limit of its purpose
 	mux.Handle(serverBackupEndpoint, maxClients(http.HandlerFunc(srv.backupHandler), 1))
+	mux.HandleFunc(serverBackupProgressEndpoint, srv.backupProgressHandler)
+	mux.HandleFunc(serverPreStopEndpoint, srv.preStopHandler)
+	mux.HandleFunc(serverSnapshotLockEndpoint, srv.snapshotLockHandler)
 
 	// Shutdown gracefully the http server
 	go func() {
@@ -88,12 +140,44 @@ func (s *server) backupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	xtrabackupArgs := s.cfg.XtrabackupArgs()
+	if lsn := r.URL.Query().Get(incrementalLSNParam); len(lsn) != 0 {
+		if _, err := strconv.ParseUint(lsn, 10, 64); err != nil {
+			http.Error(w, "invalid incremental LSN", http.StatusBadRequest)
+			return
+		}
+		xtrabackupArgs = append(xtrabackupArgs, fmt.Sprintf("--incremental-lsn=%s", lsn))
+	}
+
+	// save a copy of xtrabackup_checkpoints and xtrabackup_info to report the backup details
+	lsnDir, err := ioutil.TempDir("", "xtrabackup-lsn")
+	if err != nil {
+		log.Error(err, "failed to create LSN dir")
+		http.Error(w, "xtrabackup failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(lsnDir); err != nil {
+			log.Error(err, "failed to remove LSN dir")
+		}
+	}()
+	xtrabackupArgs = append(xtrabackupArgs, fmt.Sprintf("--extra-lsndir=%s", lsnDir))
+
+	dataSize, err := dirSize(dataDir)
+	if err != nil {
+		log.Info("failed to compute the data dir size", "error", err)
+	}
+
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Trailer", backupStatusTrailer)
+	w.Header().Set(backupDataSizeHeader, strconv.FormatInt(dataSize, 10))
+	w.Header().Set("Trailer", strings.Join([]string{
+		backupStatusTrailer, backupFromLSNTrailer, backupToLSNTrailer,
+		backupGTIDSetTrailer, backupVersionTrailer, backupServerUUIDTrailer,
+	}, ","))
 
 	// nolint: gosec
-	xtrabackup := exec.Command(xtrabackupCommand, s.cfg.XtrabackupArgs()...)
+	xtrabackup := exec.Command(xtrabackupCommand, xtrabackupArgs...)
 	xtrabackup.Stderr = os.Stderr
 
 	stdout, err := xtrabackup.StdoutPipe()
@@ -114,7 +198,17 @@ func (s *server) backupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := io.Copy(w, stdout); err != nil {
+	purpose := streamPurpose(r)
+	streamed := &countingWriter{w: w}
+	s.startProgress(purpose, streamed, dataSize)
+	defer s.stopProgress(purpose, streamed)
+
+	var out io.Writer = streamed
+	if limiter := s.limiter(r); limiter != nil {
+		out = newThrottledWriter(r.Context(), streamed, limiter)
+	}
+
+	if _, err := io.Copy(out, stdout); err != nil {
 		log.Error(err, "failed to copy buffer")
 		http.Error(w, "buffer copy failed", http.StatusInternalServerError)
 		return
@@ -128,15 +222,147 @@ func (s *server) backupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// success
+	if fromLSN, toLSN, err := readCheckpoints(lsnDir); err != nil {
+		log.Info("failed to read backup LSNs", "error", err)
+	} else {
+		w.Header().Set(backupFromLSNTrailer, strconv.FormatInt(fromLSN, 10))
+		w.Header().Set(backupToLSNTrailer, strconv.FormatInt(toLSN, 10))
+	}
+	if gtidSet, version, err := readBackupInfo(lsnDir); err != nil {
+		log.Info("failed to read backup info", "error", err)
+	} else {
+		w.Header().Set(backupGTIDSetTrailer, gtidSet)
+		w.Header().Set(backupVersionTrailer, version)
+	}
+	if uuid, err := readServerUUID(dataDir); err != nil {
+		log.Info("failed to read the server UUID", "error", err)
+	} else {
+		w.Header().Set(backupServerUUIDTrailer, uuid)
+	}
 	w.Header().Set(backupStatusTrailer, backupSuccessful)
 	flusher.Flush()
 }
 
+// streamPurpose returns what the requested stream is used for, a clone or a backup
+func streamPurpose(r *http.Request) string {
+	if r.URL.Query().Get(streamPurposeParam) == clonePurpose {
+		return clonePurpose
+	}
+	return backupPurpose
+}
+
+// bandwidthLimit returns the rate at which the requested stream is sent, clones and backups
+// being throttled independently
+func (s *server) bandwidthLimit(r *http.Request) int64 {
+	if streamPurpose(r) == clonePurpose {
+		return s.cfg.CloneBandwidthLimit
+	}
+	return s.cfg.BackupBandwidthLimit
+}
+
+// limiter returns the limiter of the requested stream, or nil if it's not throttled
+func (s *server) limiter(r *http.Request) *rate.Limiter {
+	limit := s.bandwidthLimit(r)
+	if limit <= 0 {
+		return nil
+	}
+	return newLimiter(limit)
+}
+
+// backupProgressHandler reports the progress of the stream with the requested purpose
+func (s *server) backupProgressHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthenticated(r) {
+		http.Error(w, "Not authenticated!", http.StatusForbidden)
+		return
+	}
+
+	s.progressLock.Lock()
+	defer s.progressLock.Unlock()
+
+	purpose := streamPurpose(r)
+	sp, ok := s.progress[purpose]
+	if !ok {
+		http.Error(w, fmt.Sprintf("no %s is running", purpose), http.StatusNotFound)
+		return
+	}
+
+	progress := sp.progress
+	progress.Bytes = sp.streamed.Count()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(progress); err != nil {
+		log.Error(err, "failed writing request")
+	}
+}
+
+// preStopHandler takes over the master, if this node is the master, before the pod is stopped.
+// It's called only by the exec pre-stop hooks of the pod containers, through the loopback interface.
+func (s *server) preStopHandler(w http.ResponseWriter, r *http.Request) {
+	if !isLoopback(r) {
+		http.Error(w, "Not allowed!", http.StatusForbidden)
+		return
+	}
+
+	s.takeoverLock.Lock()
+	defer s.takeoverLock.Unlock()
+
+	if !s.takeoverDone {
+		if err := takeOverMaster(r.Context(), s.cfg, newOrcClient(s.cfg)); err != nil {
+			log.Error(err, "pre-stop master takeover failed")
+			http.Error(w, fmt.Sprintf("master takeover failed: %s", err), http.StatusInternalServerError)
+			return
+		}
+		s.takeoverDone = true
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("OK")); err != nil {
+		log.Error(err, "failed writing request")
+	}
+}
+
+func (s *server) startProgress(purpose string, streamed *countingWriter, dataSize int64) {
+	s.progressLock.Lock()
+	defer s.progressLock.Unlock()
+
+	if s.progress == nil {
+		s.progress = map[string]*streamProgress{}
+	}
+	s.progress[purpose] = &streamProgress{
+		progress: mysqlbackup.Progress{
+			StartTime: time.Now(),
+			DataSize:  dataSize,
+		},
+		streamed: streamed,
+	}
+}
+
+// stopProgress stops reporting the progress of the stream, unless a newer stream with the same
+// purpose replaced it
+func (s *server) stopProgress(purpose string, streamed *countingWriter) {
+	s.progressLock.Lock()
+	defer s.progressLock.Unlock()
+
+	if sp, ok := s.progress[purpose]; ok && sp.streamed == streamed {
+		delete(s.progress, purpose)
+	}
+}
+
 func (s *server) isAuthenticated(r *http.Request) bool {
 	user, pass, ok := r.BasicAuth()
 	return ok && user == s.cfg.BackupUser && pass == s.cfg.BackupPassword
 }
 
+// isLoopback returns true if the request comes from the pod itself
+func isLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // maxClients limit an http endpoint to allow just n max concurrent connections
 func maxClients(h http.Handler, n int) http.Handler {
 	sema := make(chan struct{}, n)
@@ -194,8 +420,12 @@ func requestABackup(cfg *Config, host, endpoint string) (*http.Response, error)
 	// set authentication user and password
 	req.SetBasicAuth(cfg.BackupUser, cfg.BackupPassword)
 
+	// the server responds once xtrabackup starts streaming
+	transport := transportWithTimeout(serverConnectTimeout).(*http.Transport)
+	transport.ResponseHeaderTimeout = backupIdleTimeout
+
 	client := &http.Client{}
-	client.Transport = transportWithTimeout(serverConnectTimeout)
+	client.Transport = transport
 
 	resp, err := client.Do(req)
 	if err != nil || resp.StatusCode != 200 {
@@ -0,0 +1,101 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+)
+
+var _ = Describe("Test sidecar server", func() {
+	var (
+		srv *server
+	)
+
+	progressRequest := func(purpose string) *http.Request {
+		req := httptest.NewRequest("GET", serverBackupProgressEndpoint+"?"+streamPurposeParam+"="+purpose, nil)
+		req.SetBasicAuth("backup", "pass")
+		return req
+	}
+
+	BeforeEach(func() {
+		srv = &server{cfg: &Config{BackupUser: "backup", BackupPassword: "pass"}}
+	})
+
+	It("should require the backup credentials for the progress", func() {
+		rec := httptest.NewRecorder()
+		srv.backupProgressHandler(rec, httptest.NewRequest("GET", serverBackupProgressEndpoint, nil))
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("should report that no backup is running", func() {
+		rec := httptest.NewRecorder()
+		srv.backupProgressHandler(rec, progressRequest(backupPurpose))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should report the progress of the running backup", func() {
+		streamed := &countingWriter{w: ioutil.Discard}
+		srv.startProgress(backupPurpose, streamed, 4096)
+		_, _ = streamed.Write(make([]byte, 1024))
+
+		rec := httptest.NewRecorder()
+		srv.backupProgressHandler(rec, progressRequest(backupPurpose))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		progress := &mysqlbackup.Progress{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), progress)).To(Succeed())
+		Expect(progress.Bytes).To(Equal(int64(1024)))
+		Expect(progress.DataSize).To(Equal(int64(4096)))
+
+		srv.stopProgress(backupPurpose, streamed)
+		rec = httptest.NewRecorder()
+		srv.backupProgressHandler(rec, progressRequest(backupPurpose))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should report the progress of clones and backups apart", func() {
+		backup := &countingWriter{w: ioutil.Discard}
+		srv.startProgress(backupPurpose, backup, 4096)
+		_, _ = backup.Write(make([]byte, 1024))
+
+		clone := &countingWriter{w: ioutil.Discard}
+		srv.startProgress(clonePurpose, clone, 4096)
+		_, _ = clone.Write(make([]byte, 2048))
+
+		rec := httptest.NewRecorder()
+		srv.backupProgressHandler(rec, progressRequest(backupPurpose))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		progress := &mysqlbackup.Progress{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), progress)).To(Succeed())
+		Expect(progress.Bytes).To(Equal(int64(1024)))
+
+		// the end of the clone doesn't stop reporting the backup
+		srv.stopProgress(clonePurpose, clone)
+		rec = httptest.NewRecorder()
+		srv.backupProgressHandler(rec, progressRequest(backupPurpose))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,263 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+	"github.com/bitpoke/mysql-operator/pkg/util/constants"
+)
+
+// lockConn is the connection on which a lock is held, a *sql.Conn
+type lockConn interface {
+	PingContext(ctx context.Context) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Close() error
+}
+
+// snapshotLock is a lock for a volume snapshot backup, held on a connection to the local MySQL
+type snapshotLock struct {
+	db    *sql.DB
+	conn  lockConn
+	timer *time.Timer
+
+	// lastCheck is the last time the connection holding the lock was known to be alive
+	lastCheck time.Time
+
+	lock mysqlbackup.SnapshotLock
+}
+
+// snapshotLocks are the locks held by this node for volume snapshot backups, by backup. The
+// released locks are kept for a while, to tell when they were released.
+type snapshotLocks struct {
+	mu    sync.Mutex
+	locks map[string]*snapshotLock
+
+	// lockNode locks the node for backup, it's replaced in tests
+	lockNode func(ctx context.Context, dsn string) (*snapshotLock, error)
+}
+
+func newSnapshotLocks() *snapshotLocks {
+	return &snapshotLocks{
+		locks:    map[string]*snapshotLock{},
+		lockNode: lockNodeForBackup,
+	}
+}
+
+// snapshotLockHandler locks the node for the backup on POST, reports the lock on GET and
+// releases it on DELETE
+func (s *server) snapshotLockHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthenticated(r) {
+		http.Error(w, "Not authenticated!", http.StatusForbidden)
+		return
+	}
+
+	backup := r.URL.Query().Get(constants.SidecarServerSnapshotLockBackupParam)
+	if len(backup) == 0 {
+		http.Error(w, "backup is required", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		lock *mysqlbackup.SnapshotLock
+		err  error
+	)
+	switch r.Method {
+	case http.MethodPost:
+		lock, err = s.snapshotLocks.acquire(r.Context(), s.cfg.MysqlDSN(), backup)
+	case http.MethodGet:
+		lock = s.snapshotLocks.get(r.Context(), backup)
+	case http.MethodDelete:
+		lock = s.snapshotLocks.release(backup)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		log.Error(err, "failed to lock node for backup", "backup", backup)
+		http.Error(w, fmt.Sprintf("failed to lock node for backup: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if lock == nil {
+		http.Error(w, fmt.Sprintf("no lock for backup %s", backup), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lock); err != nil {
+		log.Error(err, "failed writing request")
+	}
+}
+
+// acquire locks the node for the backup, a lock already held for it is kept. The lock is
+// released after snapshotLockTimeout, unless it's released sooner.
+func (l *snapshotLocks) acquire(ctx context.Context, dsn, backup string) (*mysqlbackup.SnapshotLock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.forgetReleased()
+	if held, ok := l.locks[backup]; ok && held.lock.IsLocked() {
+		lock := held.lock
+		return &lock, nil
+	}
+
+	held, err := l.lockNode(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	held.lock.LockTime = time.Now()
+	held.lastCheck = held.lock.LockTime
+	held.timer = time.AfterFunc(snapshotLockTimeout, func() {
+		log.Info("snapshot lock expired", "backup", backup)
+		l.release(backup)
+	})
+	l.locks[backup] = held
+
+	log.Info("node locked for volume snapshot backup", "backup", backup, "gtid_set", held.lock.GTIDSet)
+	lock := held.lock
+	return &lock, nil
+}
+
+// get returns the lock for the backup, or nil if it's not known. A lock whose connection was
+// lost is released as of the last time it was known to be held.
+func (l *snapshotLocks) get(ctx context.Context, backup string) *mysqlbackup.SnapshotLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	held, ok := l.locks[backup]
+	if !ok {
+		return nil
+	}
+
+	if held.lock.IsLocked() {
+		if err := held.conn.PingContext(ctx); err != nil {
+			log.Error(err, "the connection holding the snapshot lock is lost", "backup", backup)
+			held.unlock(held.lastCheck)
+		} else {
+			held.lastCheck = time.Now()
+		}
+	}
+
+	lock := held.lock
+	return &lock
+}
+
+// release unlocks the node locked for the backup, and returns the released lock or nil if
+// it's not known
+func (l *snapshotLocks) release(backup string) *mysqlbackup.SnapshotLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	held, ok := l.locks[backup]
+	if !ok {
+		return nil
+	}
+
+	if held.lock.IsLocked() {
+		held.unlock(time.Now())
+		log.Info("node unlocked after volume snapshot backup", "backup", backup)
+	}
+
+	lock := held.lock
+	return &lock
+}
+
+// forgetReleased removes the locks released for longer than snapshotLockRecordTTL
+func (l *snapshotLocks) forgetReleased() {
+	for backup, held := range l.locks {
+		if !held.lock.IsLocked() && time.Since(*held.lock.ReleaseTime) > snapshotLockRecordTTL {
+			delete(l.locks, backup)
+		}
+	}
+}
+
+// lockNodeForBackup locks the node with FLUSH TABLES WITH READ LOCK, which blocks all writes,
+// such that a consistent snapshot of its data can be taken, matching the recorded GTID set
+func lockNodeForBackup(ctx context.Context, dsn string) (*snapshotLock, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// the lock is held by the session, so a single connection is used
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	held := &snapshotLock{db: db, conn: conn}
+
+	// don't block the writes for long, waiting behind long running queries
+	if _, err = conn.ExecContext(ctx, fmt.Sprintf("SET SESSION lock_wait_timeout = %d",
+		snapshotLockWaitTimeout)); err != nil {
+		held.close()
+		return nil, err
+	}
+
+	if _, err = conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+		held.close()
+		return nil, err
+	}
+
+	if err = conn.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_executed, @@GLOBAL.version").
+		Scan(&held.lock.GTIDSet, &held.lock.Version); err != nil {
+		held.unlock(time.Now())
+		return nil, err
+	}
+
+	return held, nil
+}
+
+// unlock releases the lock, as of releaseTime, and closes the connection
+func (l *snapshotLock) unlock(releaseTime time.Time) {
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.lock.ReleaseTime = &releaseTime
+
+	// the lock is released even if the request that released it is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// closing the connection releases the lock as well
+	if _, err := l.conn.ExecContext(ctx, "UNLOCK TABLES"); err != nil {
+		log.Error(err, "failed to unlock node")
+	}
+	l.close()
+}
+
+func (l *snapshotLock) close() {
+	if err := l.conn.Close(); err != nil {
+		log.Error(err, "failed closing the connection")
+	}
+	if l.db == nil {
+		return
+	}
+	if err := l.db.Close(); err != nil {
+		log.Error(err, "failed closing the database connection")
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bitpoke/mysql-operator/pkg/internal/mysqlbackup"
+)
+
+// fakeLockConn records the statements executed on the connection holding a lock
+type fakeLockConn struct {
+	executed []string
+	closed   bool
+	lost     bool
+}
+
+func (c *fakeLockConn) PingContext(_ context.Context) error {
+	if c.lost {
+		return errors.New("connection lost")
+	}
+	return nil
+}
+
+func (c *fakeLockConn) ExecContext(_ context.Context, query string, _ ...interface{}) (sql.Result, error) {
+	c.executed = append(c.executed, query)
+	return nil, nil
+}
+
+func (c *fakeLockConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+var _ = Describe("Test sidecar snapshot locks", func() {
+	var (
+		srv  *server
+		conn *fakeLockConn
+	)
+
+	lockRequest := func(method, backup string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, serverSnapshotLockEndpoint+"?backup="+backup, nil)
+		req.SetBasicAuth("backup", "pass")
+		rec := httptest.NewRecorder()
+		srv.snapshotLockHandler(rec, req)
+		return rec
+	}
+
+	decodeLock := func(rec *httptest.ResponseRecorder) *mysqlbackup.SnapshotLock {
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		lock := &mysqlbackup.SnapshotLock{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), lock)).To(Succeed())
+		return lock
+	}
+
+	BeforeEach(func() {
+		conn = &fakeLockConn{}
+		srv = &server{
+			cfg:           &Config{BackupUser: "backup", BackupPassword: "pass"},
+			snapshotLocks: newSnapshotLocks(),
+		}
+		srv.snapshotLocks.lockNode = func(_ context.Context, _ string) (*snapshotLock, error) {
+			return &snapshotLock{
+				conn: conn,
+				lock: mysqlbackup.SnapshotLock{GTIDSet: "uuid:1-10", Version: "5.7.31"},
+			}, nil
+		}
+	})
+
+	AfterEach(func() {
+		lockRequest(http.MethodDelete, "backup-1")
+	})
+
+	It("should require the backup credentials", func() {
+		rec := httptest.NewRecorder()
+		srv.snapshotLockHandler(rec, httptest.NewRequest(http.MethodPost, serverSnapshotLockEndpoint+"?backup=backup-1", nil))
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("should hold the lock until it's released", func() {
+		lock := decodeLock(lockRequest(http.MethodPost, "backup-1"))
+		Expect(lock.GTIDSet).To(Equal("uuid:1-10"))
+		Expect(lock.IsLocked()).To(BeTrue())
+
+		Expect(decodeLock(lockRequest(http.MethodGet, "backup-1")).IsLocked()).To(BeTrue())
+		Expect(conn.closed).To(BeFalse())
+
+		released := decodeLock(lockRequest(http.MethodDelete, "backup-1"))
+		Expect(released.IsLocked()).To(BeFalse())
+		Expect(released.HeldAt(lock.LockTime)).To(BeTrue())
+		Expect(conn.executed).To(ConsistOf("UNLOCK TABLES"))
+		Expect(conn.closed).To(BeTrue())
+
+		// the release is remembered
+		Expect(decodeLock(lockRequest(http.MethodGet, "backup-1")).ReleaseTime).To(Equal(released.ReleaseTime))
+	})
+
+	It("should report the unknown locks", func() {
+		Expect(lockRequest(http.MethodGet, "backup-1").Code).To(Equal(http.StatusNotFound))
+		Expect(lockRequest(http.MethodDelete, "backup-1").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should release the lock whose connection is lost", func() {
+		lock := decodeLock(lockRequest(http.MethodPost, "backup-1"))
+
+		conn.lost = true
+		released := decodeLock(lockRequest(http.MethodGet, "backup-1"))
+		Expect(released.IsLocked()).To(BeFalse())
+		Expect(released.ReleaseTime.Equal(lock.LockTime)).To(BeTrue())
+		Expect(conn.closed).To(BeTrue())
+	})
+})
@@ -0,0 +1,323 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // nolint: gosec
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+var (
+	// azureCopyPollInterval is how often the status of a pending copy is checked
+	azureCopyPollInterval = time.Second
+	// azureDownloadRetries is the number of times a failed download is resumed
+	azureDownloadRetries = 3
+)
+
+// azure is the native backend of Azure Blob Storage, which uploads block blobs
+type azure struct {
+	service azblob.ServiceClient
+
+	partSize    int64
+	concurrency int
+}
+
+func newAzureFromEnv(opts Options) (Backend, error) {
+	account := os.Getenv("AZUREBLOB_ACCOUNT")
+	key := os.Getenv("AZUREBLOB_KEY")
+	if len(account) == 0 || len(key) == 0 {
+		return nil, fmt.Errorf("AZUREBLOB_ACCOUNT and AZUREBLOB_KEY are not set")
+	}
+
+	return newAzure(fmt.Sprintf("https://%s.blob.core.windows.net", account), account, key, opts)
+}
+
+func newAzure(endpoint, account, key string, opts Options) (*azure, error) {
+	cred, err := azblob.NewSharedKeyCredential(account, key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AZUREBLOB_KEY: %s", err)
+	}
+
+	service, err := azblob.NewServiceClientWithSharedKey(endpoint, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azure{
+		service:     service,
+		partSize:    opts.partSize(),
+		concurrency: opts.concurrency(),
+	}, nil
+}
+
+// azureError returns the error of an operation, with the details of the error returned by Azure
+func azureError(op, objURL string, err error) error {
+	var storageErr *azblob.StorageError
+	if errors.As(err, &storageErr) {
+		e := &Error{Op: op, URL: objURL, StatusCode: storageErr.StatusCode(), Code: string(storageErr.ErrorCode)}
+		if storageErr.ErrorCode == azblob.StorageErrorCodeMD5Mismatch {
+			e.Err = ErrChecksumMismatch
+		}
+		return e
+	}
+	return &Error{Op: op, URL: objURL, Err: err}
+}
+
+func (a *azure) blob(objURL string) (azblob.BlockBlobClient, error) {
+	_, container, blob, err := parseURL(objURL)
+	if err != nil {
+		return azblob.BlockBlobClient{}, err
+	}
+	return a.service.NewContainerClient(container).NewBlockBlobClient(blob), nil
+}
+
+func (a *azure) Upload(ctx context.Context, objURL string, r io.Reader) error {
+	blob, err := a.blob(objURL)
+	if err != nil {
+		return &Error{Op: "upload", URL: objURL, Err: err}
+	}
+
+	// the blocks that are not committed are removed by the storage
+	ids, err := a.stageBlocks(ctx, blob, r)
+	if err != nil {
+		return azureError("upload", objURL, err)
+	}
+
+	if _, err := blob.CommitBlockList(ctx, ids, &azblob.CommitBlockListOptions{
+		BlobHTTPHeaders: &azblob.BlobHTTPHeaders{BlobContentType: stringPtr("application/octet-stream")},
+	}); err != nil {
+		return azureError("upload", objURL, err)
+	}
+	return nil
+}
+
+// stageBlocks uploads the data read from r in blocks, up to concurrency blocks in parallel, and
+// returns the IDs of the blocks in order. The storage rejects the blocks whose data doesn't match
+// the MD5 checksum sent along.
+func (a *azure) stageBlocks(ctx context.Context, blob azblob.BlockBlobClient, r io.Reader) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		blockErr error
+	)
+	sema := make(chan struct{}, a.concurrency)
+	ids := []string{}
+
+	for last := false; !last && ctx.Err() == nil; {
+		block := make([]byte, a.partSize)
+		n, err := io.ReadFull(r, block)
+		if err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			last = true
+		} else if err != nil {
+			errOnce.Do(func() { blockErr = err })
+			break
+		}
+
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		// the IDs of the blocks of a blob must have the same length
+		id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%05d", len(ids))))
+		ids = append(ids, id)
+
+		wg.Add(1)
+		go func(id string, block []byte) {
+			defer wg.Done()
+			defer func() { <-sema }()
+
+			sum := md5.Sum(block) // nolint: gosec
+			_, err := blob.StageBlock(ctx, id, nopSeekCloser{bytes.NewReader(block)}, &azblob.StageBlockOptions{
+				BlockBlobStageBlockOptions: &azblob.BlockBlobStageBlockOptions{TransactionalContentMD5: sum[:]},
+			})
+			if err != nil {
+				errOnce.Do(func() {
+					blockErr = err
+					cancel()
+				})
+			}
+		}(id, block[:n])
+	}
+
+	wg.Wait()
+
+	if blockErr == nil && ctx.Err() != nil {
+		blockErr = ctx.Err()
+	}
+	return ids, blockErr
+}
+
+// nopSeekCloser is a ReadSeeker with a no-op Close
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+func (a *azure) Download(ctx context.Context, objURL string) (io.ReadCloser, error) {
+	blob, err := a.blob(objURL)
+	if err != nil {
+		return nil, &Error{Op: "download", URL: objURL, Err: err}
+	}
+
+	resp, err := blob.Download(ctx, nil)
+	if err != nil {
+		return nil, azureError("download", objURL, err)
+	}
+
+	body := resp.Body(&azblob.RetryReaderOptions{MaxRetryRequests: azureDownloadRetries})
+	// the checksum is stored only for the blobs uploaded at once
+	if len(resp.ContentMD5) == md5.Size {
+		return newVerifyingReader(body, resp.ContentMD5), nil
+	}
+	return body, nil
+}
+
+func (a *azure) Move(ctx context.Context, src, dest string) error {
+	srcBlob, err := a.blob(src)
+	if err != nil {
+		return &Error{Op: "move", URL: src, Err: err}
+	}
+	destBlob, err := a.blob(dest)
+	if err != nil {
+		return &Error{Op: "move", URL: dest, Err: err}
+	}
+
+	resp, err := destBlob.StartCopyFromURL(ctx, srcBlob.URL(), nil)
+	if err != nil {
+		return azureError("move", src, err)
+	}
+
+	if err := a.waitForCopy(ctx, src, destBlob, resp.CopyStatus); err != nil {
+		return err
+	}
+
+	if _, err := srcBlob.Delete(ctx, nil); err != nil {
+		return azureError("move", src, err)
+	}
+	return nil
+}
+
+// waitForCopy waits for the copy of a blob to complete, the large blobs being copied
+// asynchronously
+func (a *azure) waitForCopy(ctx context.Context, src string, blob azblob.BlockBlobClient,
+	status *azblob.CopyStatusType) error {
+	description := ""
+	for logged := false; ; logged = true {
+		switch {
+		case status == nil:
+			return &Error{Op: "move", URL: src, Message: "unknown copy status"}
+		case *status == azblob.CopyStatusTypeSuccess:
+			return nil
+		case *status == azblob.CopyStatusTypePending:
+			if !logged {
+				log.V(1).Info("waiting for the copy to complete", "url", src)
+			}
+		default:
+			return &Error{Op: "move", URL: src, Code: string(*status), Message: description}
+		}
+
+		select {
+		case <-ctx.Done():
+			return &Error{Op: "move", URL: src, Err: ctx.Err()}
+		case <-time.After(azureCopyPollInterval):
+		}
+
+		props, err := blob.GetProperties(ctx, nil)
+		if err != nil {
+			return azureError("move", src, err)
+		}
+		status = props.CopyStatus
+		if props.CopyStatusDescription != nil {
+			description = *props.CopyStatusDescription
+		}
+	}
+}
+
+func (a *azure) List(ctx context.Context, prefixURL string) ([]Object, error) {
+	_, container, prefix, err := parsePrefix(prefixURL)
+	if err != nil {
+		return nil, &Error{Op: "list", URL: prefixURL, Err: err}
+	}
+
+	objects := []Object{}
+	pager := a.service.NewContainerClient(container).ListBlobsFlat(&azblob.ContainerListBlobFlatSegmentOptions{
+		Prefix: &prefix,
+	})
+	for pager.NextPage(ctx) {
+		segment := pager.PageResponse().Segment
+		if segment == nil {
+			continue
+		}
+
+		for _, item := range segment.BlobItems {
+			if item.Name == nil || item.Properties == nil {
+				continue
+			}
+
+			obj := Object{Key: strings.TrimPrefix(*item.Name, prefix)}
+			if item.Properties.ContentLength != nil {
+				obj.Size = *item.Properties.ContentLength
+			}
+			if item.Properties.LastModified != nil {
+				obj.ModTime = *item.Properties.LastModified
+			}
+			objects = append(objects, obj)
+		}
+	}
+	if err := pager.Err(); err != nil {
+		return nil, azureError("list", prefixURL, err)
+	}
+
+	return objects, nil
+}
+
+func (a *azure) Delete(ctx context.Context, objURL string) error {
+	blob, err := a.blob(objURL)
+	if err != nil {
+		return &Error{Op: "delete", URL: objURL, Err: err}
+	}
+
+	if _, err := blob.Delete(ctx, nil); err != nil {
+		return azureError("delete", objURL, err)
+	}
+	return nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeAzure is an in memory stand-in of Azure Blob Storage, for the requests sent by the azure
+// backend
+type fakeAzure struct {
+	lock sync.Mutex
+
+	// corrupt alters the data received before its checksum is checked
+	corrupt bool
+
+	blobs  map[string][]byte
+	blocks map[string][]byte
+}
+
+type blockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Latest  []string `xml:"Latest"`
+}
+
+func (f *fakeAzure) fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("X-Ms-Error-Code", code)
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", code)
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey account:") || len(r.Header.Get("X-Ms-Date")) == 0 {
+		f.fail(w, http.StatusForbidden, "AuthenticationFailed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	if f.corrupt && len(body) > 0 {
+		body[0]++
+	}
+	md5Sum := md5.Sum(body)
+	sum := base64.StdEncoding.EncodeToString(md5Sum[:])
+	if md5 := r.Header.Get("Content-MD5"); len(md5) > 0 && md5 != sum {
+		f.fail(w, http.StatusBadRequest, "Md5Mismatch")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		f.blocks[name+"/"+query.Get("blockid")] = body
+		w.Header().Set("Content-MD5", sum)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var list blockList
+		if err := xml.Unmarshal(body, &list); err != nil {
+			f.fail(w, http.StatusBadRequest, "InvalidXmlDocument")
+			return
+		}
+		data := []byte{}
+		for _, id := range list.Latest {
+			data = append(data, f.blocks[name+"/"+id]...)
+		}
+		f.blobs[name] = data
+		w.Header().Set("Content-MD5", sum)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodPut && len(r.Header.Get("X-Ms-Copy-Source")) > 0:
+		source, err := url.Parse(r.Header.Get("X-Ms-Copy-Source"))
+		if err != nil {
+			f.fail(w, http.StatusBadRequest, "InvalidHeaderValue")
+			return
+		}
+		data, ok := f.blobs[strings.TrimPrefix(source.Path, "/")]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "CannotVerifyCopySource")
+			return
+		}
+		f.blobs[name] = data
+		w.Header().Set("X-Ms-Copy-Status", "success")
+		w.WriteHeader(http.StatusAccepted)
+
+	case r.Method == http.MethodPut:
+		f.blobs[name] = body
+		w.Header().Set("Content-MD5", sum)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodGet && query.Get("comp") == "list":
+		fmt.Fprint(w, "<EnumerationResults><Blobs>")
+		for blob, data := range f.blobs {
+			if !strings.HasPrefix(blob, name+"/"+query.Get("prefix")) {
+				continue
+			}
+			fmt.Fprintf(w, "<Blob><Name>%s</Name><Properties><Content-Length>%d</Content-Length>"+
+				"<Last-Modified>%s</Last-Modified></Properties></Blob>",
+				strings.TrimPrefix(blob, name+"/"), len(data), time.Now().UTC().Format(http.TimeFormat))
+		}
+		fmt.Fprint(w, "</Blobs><NextMarker/></EnumerationResults>")
+
+	case r.Method == http.MethodGet:
+		data, ok := f.blobs[name]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+		_, _ = w.Write(data)
+
+	case r.Method == http.MethodDelete:
+		delete(f.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "UnsupportedHttpVerb")
+	}
+}
+
+var _ = Describe("Native Azure backend", func() {
+	var (
+		fake    *fakeAzure
+		server  *httptest.Server
+		backend *azure
+	)
+
+	BeforeEach(func() {
+		fake = &fakeAzure{blobs: map[string][]byte{}, blocks: map[string][]byte{}}
+		server = httptest.NewServer(fake)
+
+		var err error
+		key := base64.StdEncoding.EncodeToString([]byte("key"))
+		backend, err = newAzure(server.URL, "account", key, Options{PartSize: MinPartSize, Concurrency: 2})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should upload small blobs", func() {
+		data := []byte("the manifest")
+		Expect(backend.Upload(context.Background(), "azure:container/manifest.json", bytes.NewReader(data))).To(Succeed())
+
+		Expect(fake.blobs).To(HaveKeyWithValue("container/manifest.json", data))
+		Expect(download(backend, "azure:container/manifest.json")).To(Equal(data))
+	})
+
+	It("should upload large blobs in blocks", func() {
+		data := randomData(2*MinPartSize + 1024)
+		Expect(backend.Upload(context.Background(), "azure:container/backup.xbackup.gz", bytes.NewReader(data))).To(Succeed())
+
+		Expect(fake.blocks).To(HaveLen(3))
+		Expect(download(backend, "azure:container/backup.xbackup.gz")).To(Equal(data))
+	})
+
+	It("should fail when an uploaded block is corrupted", func() {
+		fake.corrupt = true
+
+		data := randomData(2*MinPartSize + 1024)
+		err := backend.Upload(context.Background(), "azure:container/backup.xbackup.gz", bytes.NewReader(data))
+		Expect(errors.Is(err, ErrChecksumMismatch)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("Md5Mismatch"))
+
+		Expect(fake.blobs).ToNot(HaveKey("container/backup.xbackup.gz"))
+	})
+
+	It("should move blobs", func() {
+		data := randomData(1024)
+		Expect(backend.Upload(context.Background(), "azure:container/backup.tmp", bytes.NewReader(data))).To(Succeed())
+
+		Expect(backend.Move(context.Background(), "azure:container/backup.tmp", "azure:container/backup")).To(Succeed())
+		Expect(fake.blobs).ToNot(HaveKey("container/backup.tmp"))
+		Expect(fake.blobs).To(HaveKeyWithValue("container/backup", data))
+	})
+
+	It("should list and delete blobs", func() {
+		Expect(backend.Upload(context.Background(), "azure:container/trash/backup", strings.NewReader("data"))).To(Succeed())
+		Expect(backend.Upload(context.Background(), "azure:container/backup", strings.NewReader("data"))).To(Succeed())
+
+		objects, err := backend.List(context.Background(), "azure:container/trash/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(objects).To(HaveLen(1))
+		Expect(objects[0].Key).To(Equal("backup"))
+		Expect(objects[0].Size).To(Equal(int64(4)))
+
+		Expect(backend.Delete(context.Background(), "azure:container/trash/backup")).To(Succeed())
+		Expect(fake.blobs).To(HaveLen(1))
+	})
+
+	It("should report missing blobs", func() {
+		_, err := backend.Download(context.Background(), "azure:container/missing")
+		Expect(IsNotFound(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("BlobNotFound"))
+	})
+})
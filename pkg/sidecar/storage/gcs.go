@@ -0,0 +1,212 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	gcstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// gcs is the native backend of Google Cloud Storage
+type gcs struct {
+	client *gcstorage.Client
+
+	// acl is the predefined ACL of the objects, e.g. projectPrivate
+	acl          string
+	storageClass string
+
+	partSize int64
+}
+
+func newGCSFromEnv(opts Options) (Backend, error) {
+	key := os.Getenv("GCS_SERVICE_ACCOUNT_JSON_KEY")
+	if len(key) == 0 {
+		return nil, fmt.Errorf("GCS_SERVICE_ACCOUNT_JSON_KEY is not set")
+	}
+
+	b, err := newGCS(opts, option.WithCredentialsJSON([]byte(key)), option.WithScopes(gcstorage.ScopeReadWrite))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GCS_SERVICE_ACCOUNT_JSON_KEY: %s", err)
+	}
+	// the ACLs are given as for rclone, which uses the names of the JSON API
+	b.acl = os.Getenv("GCS_OBJECT_ACL")
+	b.storageClass = os.Getenv("GCS_STORAGE_CLASS")
+
+	return b, nil
+}
+
+func newGCS(opts Options, clientOpts ...option.ClientOption) (*gcs, error) {
+	client, err := gcstorage.NewClient(context.Background(), clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcs{
+		client:   client,
+		partSize: opts.partSize(),
+	}, nil
+}
+
+// gcsError returns the error of an operation, with the details of the error returned by GCS
+func gcsError(op, objURL string, err error) error {
+	if errors.Is(err, gcstorage.ErrObjectNotExist) || errors.Is(err, gcstorage.ErrBucketNotExist) {
+		return &Error{Op: op, URL: objURL, StatusCode: http.StatusNotFound, Message: err.Error()}
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		e := &Error{Op: op, URL: objURL, StatusCode: apiErr.Code, Message: apiErr.Message}
+		if len(apiErr.Errors) > 0 {
+			e.Code = apiErr.Errors[0].Reason
+		}
+		return e
+	}
+
+	return &Error{Op: op, URL: objURL, Err: err}
+}
+
+func (g *gcs) object(objURL string) (*gcstorage.ObjectHandle, error) {
+	_, bucket, key, err := parseURL(objURL)
+	if err != nil {
+		return nil, err
+	}
+	return g.client.Bucket(bucket).Object(key), nil
+}
+
+func (g *gcs) Upload(ctx context.Context, objURL string, r io.Reader) error {
+	obj, err := g.object(objURL)
+	if err != nil {
+		return &Error{Op: "upload", URL: objURL, Err: err}
+	}
+
+	// the upload is cancelled, and the object is not created, when the context is cancelled
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := obj.NewWriter(ctx)
+	w.ChunkSize = int(g.partSize)
+	w.ContentType = "application/octet-stream"
+	w.PredefinedACL = g.acl
+	w.StorageClass = g.storageClass
+
+	// the CRC32C checksum of a stream is not known when the upload starts, to be sent along with
+	// the data, so it's compared with the checksum computed by the storage once uploaded
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := io.Copy(w, io.TeeReader(r, crc)); err != nil {
+		cancel()
+		_ = w.Close()
+		return gcsError("upload", objURL, err)
+	}
+	if err := w.Close(); err != nil {
+		return gcsError("upload", objURL, err)
+	}
+
+	if w.Attrs().CRC32C != crc.Sum32() {
+		if err := obj.Delete(ctx); err != nil {
+			log.Info("failed to delete corrupted object", "url", objURL, "error", err)
+		}
+		return &Error{Op: "upload", URL: objURL, Err: ErrChecksumMismatch}
+	}
+	return nil
+}
+
+func (g *gcs) Download(ctx context.Context, objURL string) (io.ReadCloser, error) {
+	obj, err := g.object(objURL)
+	if err != nil {
+		return nil, &Error{Op: "download", URL: objURL, Err: err}
+	}
+
+	// the reader verifies the CRC32C checksum of the object at EOF
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return nil, gcsError("download", objURL, err)
+	}
+	return r, nil
+}
+
+func (g *gcs) Move(ctx context.Context, src, dest string) error {
+	srcObj, err := g.object(src)
+	if err != nil {
+		return &Error{Op: "move", URL: src, Err: err}
+	}
+	destObj, err := g.object(dest)
+	if err != nil {
+		return &Error{Op: "move", URL: dest, Err: err}
+	}
+
+	copier := destObj.CopierFrom(srcObj)
+	copier.ContentType = "application/octet-stream"
+	copier.PredefinedACL = g.acl
+	copier.StorageClass = g.storageClass
+	if _, err := copier.Run(ctx); err != nil {
+		return gcsError("move", src, err)
+	}
+
+	if err := srcObj.Delete(ctx); err != nil {
+		return gcsError("move", src, err)
+	}
+	return nil
+}
+
+func (g *gcs) List(ctx context.Context, prefixURL string) ([]Object, error) {
+	_, bucket, prefix, err := parsePrefix(prefixURL)
+	if err != nil {
+		return nil, &Error{Op: "list", URL: prefixURL, Err: err}
+	}
+
+	objects := []Object{}
+	it := g.client.Bucket(bucket).Objects(ctx, &gcstorage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, gcsError("list", prefixURL, err)
+		}
+
+		objects = append(objects, Object{
+			Key:     strings.TrimPrefix(attrs.Name, prefix),
+			Size:    attrs.Size,
+			ModTime: attrs.Updated,
+		})
+	}
+
+	return objects, nil
+}
+
+func (g *gcs) Delete(ctx context.Context, objURL string) error {
+	obj, err := g.object(objURL)
+	if err != nil {
+		return &Error{Op: "delete", URL: objURL, Err: err}
+	}
+
+	if err := obj.Delete(ctx); err != nil {
+		return gcsError("delete", objURL, err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/api/option"
+)
+
+// fakeGCS is an in memory stand-in of Google Cloud Storage, for the objects uploaded at once by
+// the gcs backend
+type fakeGCS struct {
+	lock sync.Mutex
+
+	// corrupt alters the data received before its checksum is computed
+	corrupt bool
+
+	objects map[string][]byte
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/"):
+		bucket := strings.Split(strings.TrimPrefix(r.URL.Path, "/upload/storage/v1/b/"), "/")[0]
+
+		// the metadata and the data of the object are the parts of a multipart request
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		parts := multipart.NewReader(r.Body, params["boundary"])
+
+		attrs := map[string]interface{}{}
+		part, err := parts.NextPart()
+		if err != nil || json.NewDecoder(part).Decode(&attrs) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		part, err = parts.NextPart()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(part)
+		if f.corrupt {
+			data[0]++
+		}
+
+		name := attrs["name"].(string)
+		f.objects[bucket+"/"+name] = data
+
+		crc := make([]byte, 4)
+		binary.BigEndian.PutUint32(crc, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"bucket": bucket,
+			"name":   name,
+			"crc32c": base64.StdEncoding.EncodeToString(crc),
+		})
+
+	case r.Method == http.MethodDelete:
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/storage/v1/b/"), "/o/")
+		delete(f.objects, strings.Join(parts, "/"))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+var _ = Describe("Native GCS backend", func() {
+	var (
+		fake    *fakeGCS
+		server  *httptest.Server
+		backend *gcs
+	)
+
+	BeforeEach(func() {
+		fake = &fakeGCS{objects: map[string][]byte{}}
+		server = httptest.NewServer(fake)
+
+		var err error
+		backend, err = newGCS(Options{PartSize: MinPartSize},
+			option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should upload objects", func() {
+		data := []byte("the manifest")
+		Expect(backend.Upload(context.Background(), "gs:bucket/manifest.json", bytes.NewReader(data))).To(Succeed())
+
+		Expect(fake.objects).To(HaveKeyWithValue("bucket/manifest.json", data))
+	})
+
+	It("should remove the uploaded object when it's corrupted", func() {
+		fake.corrupt = true
+
+		err := backend.Upload(context.Background(), "gs:bucket/manifest.json", strings.NewReader("the manifest"))
+		Expect(errors.Is(err, ErrChecksumMismatch)).To(BeTrue())
+
+		Expect(fake.objects).ToNot(HaveKey("bucket/manifest.json"))
+	})
+})
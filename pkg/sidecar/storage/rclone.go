@@ -0,0 +1,157 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// the rclone exit codes for a missing directory and a missing file
+const (
+	rcloneDirNotFoundExitCode  = 3
+	rcloneFileNotFoundExitCode = 4
+)
+
+// rclone is the backend that runs rclone, it supports all the providers configured for rclone
+type rclone struct {
+	args []string
+}
+
+// NewRclone returns a backend that runs rclone with the given arguments
+func NewRclone(args []string) Backend {
+	return &rclone{args: args}
+}
+
+func (rc *rclone) command(ctx context.Context, args ...string) *exec.Cmd {
+	// nolint: gosec
+	cmd := exec.CommandContext(ctx, "rclone", append(append([]string{}, rc.args...), args...)...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+func (rc *rclone) Upload(ctx context.Context, url string, r io.Reader) error {
+	cmd := rc.command(ctx, "rcat", url)
+	cmd.Stdin = r
+
+	if err := cmd.Run(); err != nil {
+		return &Error{Op: "upload", URL: url, Err: err}
+	}
+	return nil
+}
+
+func (rc *rclone) Download(ctx context.Context, url string) (io.ReadCloser, error) {
+	cmd := rc.command(ctx, "cat", url)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, &Error{Op: "download", URL: url, Err: err}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, &Error{Op: "download", URL: url, Err: err}
+	}
+
+	return &rcloneReader{cmd: cmd, stdout: stdout, url: url}, nil
+}
+
+func (rc *rclone) Move(ctx context.Context, src, dest string) error {
+	if err := rc.command(ctx, "moveto", src, dest).Run(); err != nil {
+		return &Error{Op: "move", URL: src, Err: err}
+	}
+	return nil
+}
+
+func (rc *rclone) List(ctx context.Context, url string) ([]Object, error) {
+	out, err := rc.command(ctx, "lsjson", "--recursive", "--files-only", url).Output()
+	if err != nil {
+		return nil, &Error{Op: "list", URL: url, Err: err}
+	}
+
+	entries := []struct {
+		Path    string    `json:"Path"`
+		Size    int64     `json:"Size"`
+		ModTime time.Time `json:"ModTime"`
+	}{}
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil, &Error{Op: "list", URL: url, Err: err}
+	}
+
+	objects := make([]Object, 0, len(entries))
+	for _, entry := range entries {
+		objects = append(objects, Object{Key: entry.Path, Size: entry.Size, ModTime: entry.ModTime})
+	}
+	return objects, nil
+}
+
+func (rc *rclone) Delete(ctx context.Context, url string) error {
+	if err := rc.command(ctx, "deletefile", url).Run(); err != nil {
+		return &Error{Op: "delete", URL: url, Err: err}
+	}
+	return nil
+}
+
+// rcloneReader reads the output of rclone cat and reports its exit status at EOF, such that a
+// failed download is not mistaken for a complete one
+type rcloneReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	url    string
+
+	waitOnce sync.Once
+	waitErr  error
+}
+
+func (r *rcloneReader) wait() error {
+	r.waitOnce.Do(func() {
+		if err := r.cmd.Wait(); err != nil {
+			e := &Error{Op: "download", URL: r.url, Err: err}
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && (exitErr.ExitCode() == rcloneDirNotFoundExitCode ||
+				exitErr.ExitCode() == rcloneFileNotFoundExitCode) {
+				e.StatusCode = http.StatusNotFound
+			}
+			r.waitErr = e
+		}
+	})
+	return r.waitErr
+}
+
+func (r *rcloneReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		if waitErr := r.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *rcloneReader) Close() error {
+	if r.cmd.ProcessState == nil {
+		// stop the download when the reader is closed early
+		_ = r.cmd.Process.Kill()
+	}
+	_ = r.wait()
+	return nil
+}
@@ -0,0 +1,415 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // nolint: gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	// maxCopySize is the size of the largest object copied by a single request
+	maxCopySize int64 = 5 << 30
+	// copyPartSize is the size of the parts of the objects copied in parts
+	copyPartSize int64 = 1 << 30
+	// abortTimeout is the time given to abort a failed multipart copy
+	abortTimeout = time.Minute
+)
+
+// s3 is the native backend of the S3 compatible storages
+type s3 struct {
+	client   *awss3.Client
+	uploader *manager.Uploader
+
+	acl          types.ObjectCannedACL
+	storageClass types.StorageClass
+
+	concurrency int
+}
+
+func newS3FromEnv(opts Options) (Backend, error) {
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if len(secretAccessKey) == 0 {
+		secretAccessKey = os.Getenv("AWS_SECRET_KEY")
+	}
+	if len(accessKeyID) == 0 || len(secretAccessKey) == 0 {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if len(region) == 0 {
+		region = "us-east-1"
+	}
+
+	b := newS3(awss3.Options{
+		Region: region,
+		Credentials: credentials.NewStaticCredentialsProvider(
+			accessKeyID, secretAccessKey, os.Getenv("AWS_SESSION_TOKEN")),
+	}, os.Getenv("S3_ENDPOINT"), opts)
+	b.acl = types.ObjectCannedACL(os.Getenv("AWS_ACL"))
+	b.storageClass = types.StorageClass(os.Getenv("AWS_STORAGE_CLASS"))
+
+	return b, nil
+}
+
+// newS3 returns the backend that uses a client with the given options. The objects of the
+// S3 compatible storages, with a custom endpoint, are addressed by path.
+func newS3(clientOpts awss3.Options, endpoint string, opts Options) *s3 {
+	if len(endpoint) > 0 {
+		clientOpts.EndpointResolver = awss3.EndpointResolverFromURL(endpoint)
+		clientOpts.UsePathStyle = true
+	}
+	client := awss3.New(clientOpts)
+
+	return &s3{
+		client: client,
+		uploader: manager.NewUploader(client, func(u *manager.Uploader) {
+			u.PartSize = opts.partSize()
+			u.Concurrency = opts.concurrency()
+		}),
+		concurrency: opts.concurrency(),
+	}
+}
+
+// s3Error returns the error of an operation, with the details of the error returned by S3
+func s3Error(op, objURL string, err error) error {
+	e := &Error{Op: op, URL: objURL}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		e.StatusCode = respErr.HTTPStatusCode()
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		e.Code = apiErr.ErrorCode()
+		e.Message = apiErr.ErrorMessage()
+	}
+	switch {
+	case e.Code == "BadDigest":
+		e.Err = ErrChecksumMismatch
+	case len(e.Code) == 0:
+		e.Err = err
+	}
+
+	return e
+}
+
+func (s *s3) Upload(ctx context.Context, objURL string, r io.Reader) error {
+	_, bucket, key, err := parseURL(objURL)
+	if err != nil {
+		return &Error{Op: "upload", URL: objURL, Err: err}
+	}
+
+	// the parts of the failed multipart uploads are removed by the uploader, and the storage
+	// rejects the parts whose data doesn't match the SHA256 checksum sent along
+	_, err = s.uploader.Upload(ctx, &awss3.PutObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		Body:              r,
+		ContentType:       aws.String("application/octet-stream"),
+		ACL:               s.acl,
+		StorageClass:      s.storageClass,
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+	})
+	if err != nil {
+		return s3Error("upload", objURL, err)
+	}
+	return nil
+}
+
+func (s *s3) Download(ctx context.Context, objURL string) (io.ReadCloser, error) {
+	_, bucket, key, err := parseURL(objURL)
+	if err != nil {
+		return nil, &Error{Op: "download", URL: objURL, Err: err}
+	}
+
+	out, err := s.client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error("download", objURL, err)
+	}
+
+	// the ETag is the checksum of the object only when it was uploaded at once and it's not
+	// encrypted with a KMS key
+	etag := strings.Trim(aws.ToString(out.ETag), `"`)
+	if sum, err := hex.DecodeString(etag); err == nil && len(sum) == md5.Size &&
+		out.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+		return newVerifyingReader(out.Body, sum), nil
+	}
+	return out.Body, nil
+}
+
+func (s *s3) Move(ctx context.Context, src, dest string) error {
+	_, srcBucket, srcKey, err := parseURL(src)
+	if err != nil {
+		return &Error{Op: "move", URL: src, Err: err}
+	}
+	_, destBucket, destKey, err := parseURL(dest)
+	if err != nil {
+		return &Error{Op: "move", URL: dest, Err: err}
+	}
+
+	if err := s.copy(ctx, src, srcBucket, srcKey, destBucket, destKey); err != nil {
+		return err
+	}
+
+	if _, err := s.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	}); err != nil {
+		return s3Error("move", src, err)
+	}
+	return nil
+}
+
+// copy copies the object in the storage, in parts if it's too large to be copied at once
+func (s *s3) copy(ctx context.Context, src, srcBucket, srcKey, destBucket, destKey string) error {
+	head, err := s.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return s3Error("move", src, err)
+	}
+
+	source := url.PathEscape(srcBucket) + "/" + escapeKey(srcKey)
+	if head.ContentLength > maxCopySize {
+		return s.multipartCopy(ctx, src, source, destBucket, destKey, head.ContentLength)
+	}
+
+	if _, err := s.client.CopyObject(ctx, &awss3.CopyObjectInput{
+		Bucket:       aws.String(destBucket),
+		Key:          aws.String(destKey),
+		CopySource:   aws.String(source),
+		ACL:          s.acl,
+		StorageClass: s.storageClass,
+	}); err != nil {
+		return s3Error("move", src, err)
+	}
+	return nil
+}
+
+// multipartCopy copies the object from source, of the given size, in parts
+func (s *s3) multipartCopy(ctx context.Context, src, source, bucket, key string, size int64) error {
+	upload, err := s.client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ContentType:  aws.String("application/octet-stream"),
+		ACL:          s.acl,
+		StorageClass: s.storageClass,
+	})
+	if err != nil {
+		return s3Error("move", src, err)
+	}
+
+	partSize := copyPartSize
+	if size > partSize*maxParts {
+		partSize = (size + maxParts - 1) / maxParts
+	}
+	parts := make([]types.CompletedPart, (size+partSize-1)/partSize)
+
+	var lock sync.Mutex
+	err = runParts(ctx, len(parts), s.concurrency, func(ctx context.Context, part int) error {
+		start := int64(part-1) * partSize
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		out, err := s.client.UploadPartCopy(ctx, &awss3.UploadPartCopyInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			UploadId:        upload.UploadId,
+			PartNumber:      int32(part),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		})
+		if err != nil {
+			return err
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		parts[part-1] = types.CompletedPart{PartNumber: int32(part), ETag: out.CopyPartResult.ETag}
+		return nil
+	})
+
+	if err == nil {
+		_, err = s.client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+
+	if err != nil {
+		// the copy is aborted also when it fails because the context is cancelled
+		abortCtx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+		defer cancel()
+
+		// the parts copied so far are removed by the storage
+		if _, abortErr := s.client.AbortMultipartUpload(abortCtx, &awss3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: upload.UploadId,
+		}); abortErr != nil {
+			log.Info("failed to abort multipart copy", "url", src, "error", abortErr)
+		}
+		return s3Error("move", src, err)
+	}
+
+	return nil
+}
+
+func (s *s3) List(ctx context.Context, prefixURL string) ([]Object, error) {
+	_, bucket, prefix, err := parsePrefix(prefixURL)
+	if err != nil {
+		return nil, &Error{Op: "list", URL: prefixURL, Err: err}
+	}
+
+	objects := []Object{}
+	pages := awss3.NewListObjectsV2Paginator(s.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error("list", prefixURL, err)
+		}
+
+		for _, obj := range page.Contents {
+			objects = append(objects, Object{
+				Key:     strings.TrimPrefix(aws.ToString(obj.Key), prefix),
+				Size:    obj.Size,
+				ModTime: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func (s *s3) Delete(ctx context.Context, objURL string) error {
+	_, bucket, key, err := parseURL(objURL)
+	if err != nil {
+		return &Error{Op: "delete", URL: objURL, Err: err}
+	}
+
+	if _, err := s.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return s3Error("delete", objURL, err)
+	}
+	return nil
+}
+
+// escapeKey escapes the segments of an object key, for the copy source
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// runParts calls fn for the parts from 1 to parts, up to concurrency parts in parallel, and
+// returns the first error
+func runParts(ctx context.Context, parts, concurrency int, fn func(ctx context.Context, part int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		partErr error
+	)
+	sema := make(chan struct{}, concurrency)
+
+	for part := 1; part <= parts && ctx.Err() == nil; part++ {
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		wg.Add(1)
+		go func(part int) {
+			defer wg.Done()
+			defer func() { <-sema }()
+			if err := fn(ctx, part); err != nil {
+				errOnce.Do(func() {
+					partErr = err
+					cancel()
+				})
+			}
+		}(part)
+	}
+
+	wg.Wait()
+
+	if partErr == nil && ctx.Err() != nil {
+		partErr = ctx.Err()
+	}
+	return partErr
+}
+
+// verifyingReader checks, at EOF, that the MD5 checksum of the data read matches the expected
+// one
+type verifyingReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected []byte
+}
+
+func newVerifyingReader(r io.ReadCloser, expected []byte) io.ReadCloser {
+	// nolint: gosec
+	return &verifyingReader{ReadCloser: r, hash: md5.New(), expected: expected}
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	_, _ = r.hash.Write(p[:n])
+	if err == io.EOF && !bytes.Equal(r.hash.Sum(nil), r.expected) {
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
@@ -0,0 +1,420 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeS3 is an in memory stand-in of S3, for the requests sent by the s3 backend
+type fakeS3 struct {
+	lock sync.Mutex
+
+	// failPart is the number of the part that fails to be uploaded
+	failPart int
+	// corruptPart is the number of the part whose data is altered before its checksum is
+	// checked, 1 for the objects uploaded at once
+	corruptPart int
+
+	objects  map[string][]byte
+	etags    map[string]string
+	uploads  map[string]map[int][]byte
+	requests []string
+	lastID   int
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: map[string][]byte{},
+		etags:   map[string]string{},
+		uploads: map[string]map[int][]byte{},
+	}
+}
+
+func md5Sum(data []byte) []byte {
+	sum := md5.Sum(data)
+	return sum[:]
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, http.StatusText(status))
+}
+
+func (f *fakeS3) etag(data []byte) string {
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(md5Sum(data)))
+}
+
+// source returns the object from the copy source header and the requested range
+func (f *fakeS3) source(r *http.Request) ([]byte, bool) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return nil, false
+	}
+	data, ok := f.objects[strings.TrimPrefix(source, "/")]
+	if !ok {
+		return nil, false
+	}
+
+	if rng := r.Header.Get("X-Amz-Copy-Source-Range"); len(rng) > 0 {
+		var start, end int
+		if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil {
+			return nil, false
+		}
+		data = data[start : end+1]
+	}
+	return data, true
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.requests = append(f.requests, fmt.Sprintf("%s %s", r.Method, r.URL.RawQuery))
+
+	if len(r.Header.Get("Authorization")) == 0 {
+		f.fail(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	isCopy := len(r.Header.Get("X-Amz-Copy-Source")) > 0
+
+	if r.Method == http.MethodPut && !isCopy {
+		part, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil {
+			part = 1
+		}
+		if part == f.corruptPart {
+			body[0]++
+		}
+		sum := sha256.Sum256(body)
+		if r.Header.Get("X-Amz-Checksum-Sha256") != base64.StdEncoding.EncodeToString(sum[:]) {
+			f.fail(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query["uploads"] != nil:
+		f.lastID++
+		id := strconv.Itoa(f.lastID)
+		f.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+
+	case r.Method == http.MethodPut && len(query.Get("uploadId")) > 0:
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		part, _ := strconv.Atoi(query.Get("partNumber"))
+		if part == f.failPart {
+			f.fail(w, http.StatusInternalServerError, "InternalError")
+			return
+		}
+
+		if isCopy {
+			data, ok := f.source(r)
+			if !ok {
+				f.fail(w, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			parts[part] = data
+			fmt.Fprintf(w, "<CopyPartResult><ETag>%s</ETag></CopyPartResult>", f.etag(data))
+			return
+		}
+
+		parts[part] = body
+		w.Header().Set("ETag", f.etag(body))
+
+	case r.Method == http.MethodPost && len(query.Get("uploadId")) > 0:
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+
+		var complete completeMultipartUpload
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			f.fail(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+
+		data := []byte{}
+		for _, part := range complete.Parts {
+			if f.etag(parts[part.PartNumber]) != part.ETag {
+				f.fail(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			data = append(data, parts[part.PartNumber]...)
+		}
+
+		delete(f.uploads, query.Get("uploadId"))
+		f.objects[name] = data
+		f.etags[name] = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(md5Sum(data)), len(complete.Parts))
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><ETag>%s</ETag></CompleteMultipartUploadResult>", f.etags[name])
+
+	case r.Method == http.MethodDelete && len(query.Get("uploadId")) > 0:
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut && isCopy:
+		data, ok := f.source(r)
+		if !ok {
+			// the errors of copies are sent after the status
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		f.objects[name] = data
+		f.etags[name] = f.etag(data)
+		fmt.Fprintf(w, "<CopyObjectResult><ETag>%s</ETag></CopyObjectResult>", f.etags[name])
+
+	case r.Method == http.MethodPut:
+		f.objects[name] = body
+		f.etags[name] = f.etag(body)
+		w.Header().Set("ETag", f.etags[name])
+
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		fmt.Fprint(w, "<ListBucketResult>")
+		for key, data := range f.objects {
+			if !strings.HasPrefix(key, name+"/"+query.Get("prefix")) {
+				continue
+			}
+			fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents>",
+				strings.TrimPrefix(key, name+"/"), len(data), time.Now().UTC().Format(time.RFC3339))
+		}
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[name]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", f.etags[name])
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) countRequests(substr string) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	count := 0
+	for _, req := range f.requests {
+		if strings.Contains(req, substr) {
+			count++
+		}
+	}
+	return count
+}
+
+func randomData(size int) []byte {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	return data
+}
+
+func download(b Backend, url string) ([]byte, error) {
+	r, err := b.Download(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	return ioutil.ReadAll(r)
+}
+
+var _ = Describe("Native S3 backend", func() {
+	var (
+		fake    *fakeS3
+		server  *httptest.Server
+		backend *s3
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3()
+		server = httptest.NewServer(fake)
+
+		backend = newS3(awss3.Options{
+			Region:      "us-east-1",
+			Credentials: credentials.NewStaticCredentialsProvider("access", "secret", ""),
+			Retryer:     aws.NopRetryer{},
+		}, server.URL, Options{PartSize: MinPartSize, Concurrency: 2})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should upload small objects at once", func() {
+		data := []byte("the manifest")
+		Expect(backend.Upload(context.Background(), "s3:bucket/dir/manifest.json", bytes.NewReader(data))).To(Succeed())
+
+		Expect(fake.objects).To(HaveKeyWithValue("bucket/dir/manifest.json", data))
+		Expect(fake.countRequests("uploads")).To(Equal(0))
+
+		Expect(download(backend, "s3://bucket/dir/manifest.json")).To(Equal(data))
+	})
+
+	It("should upload large objects in parts", func() {
+		data := randomData(2*MinPartSize + 1024)
+		Expect(backend.Upload(context.Background(), "s3:bucket/backup.xbackup.gz", bytes.NewReader(data))).To(Succeed())
+
+		Expect(fake.objects["bucket/backup.xbackup.gz"]).To(Equal(data))
+		Expect(fake.countRequests("partNumber")).To(Equal(3))
+		Expect(fake.uploads).To(BeEmpty())
+
+		Expect(download(backend, "s3:bucket/backup.xbackup.gz")).To(Equal(data))
+	})
+
+	It("should abort the upload when a part fails", func() {
+		fake.failPart = 2
+
+		data := randomData(3 * MinPartSize)
+		err := backend.Upload(context.Background(), "s3:bucket/backup.xbackup.gz", bytes.NewReader(data))
+
+		var storageErr *Error
+		Expect(errors.As(err, &storageErr)).To(BeTrue())
+		Expect(storageErr.StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(storageErr.Code).To(Equal("InternalError"))
+
+		Expect(fake.objects).ToNot(HaveKey("bucket/backup.xbackup.gz"))
+		Expect(fake.uploads).To(BeEmpty())
+	})
+
+	It("should fail when an uploaded part is corrupted", func() {
+		fake.corruptPart = 2
+
+		data := randomData(2*MinPartSize + 1024)
+		err := backend.Upload(context.Background(), "s3:bucket/backup.xbackup.gz", bytes.NewReader(data))
+		Expect(errors.Is(err, ErrChecksumMismatch)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("BadDigest"))
+
+		Expect(fake.objects).ToNot(HaveKey("bucket/backup.xbackup.gz"))
+		Expect(fake.uploads).To(BeEmpty())
+	})
+
+	It("should fail when an object uploaded at once is corrupted", func() {
+		fake.corruptPart = 1
+
+		err := backend.Upload(context.Background(), "s3:bucket/manifest.json", strings.NewReader("data"))
+		Expect(errors.Is(err, ErrChecksumMismatch)).To(BeTrue())
+		Expect(fake.objects).ToNot(HaveKey("bucket/manifest.json"))
+	})
+
+	It("should fail when the downloaded object is corrupted", func() {
+		Expect(backend.Upload(context.Background(), "s3:bucket/manifest.json", strings.NewReader("data"))).To(Succeed())
+		fake.objects["bucket/manifest.json"] = []byte("atad")
+
+		_, err := download(backend, "s3:bucket/manifest.json")
+		Expect(errors.Is(err, ErrChecksumMismatch)).To(BeTrue())
+	})
+
+	It("should report missing objects", func() {
+		_, err := backend.Download(context.Background(), "s3:bucket/missing")
+		Expect(IsNotFound(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("NoSuchKey"))
+	})
+
+	It("should move objects", func() {
+		data := randomData(1024)
+		Expect(backend.Upload(context.Background(), "s3:bucket/backup.tmp", bytes.NewReader(data))).To(Succeed())
+
+		Expect(backend.Move(context.Background(), "s3:bucket/backup.tmp", "s3:bucket/backup")).To(Succeed())
+		Expect(fake.objects).ToNot(HaveKey("bucket/backup.tmp"))
+		Expect(fake.objects).To(HaveKeyWithValue("bucket/backup", data))
+	})
+
+	It("should copy large objects in parts when moving them", func() {
+		defer func(size, partSize int64) { maxCopySize, copyPartSize = size, partSize }(maxCopySize, copyPartSize)
+		maxCopySize, copyPartSize = 1024, 400
+
+		data := randomData(1025)
+		Expect(backend.Upload(context.Background(), "s3:bucket/backup.tmp", bytes.NewReader(data))).To(Succeed())
+
+		Expect(backend.Move(context.Background(), "s3:bucket/backup.tmp", "s3:bucket/backup")).To(Succeed())
+		Expect(fake.objects).To(HaveKeyWithValue("bucket/backup", data))
+		Expect(fake.countRequests("partNumber")).To(Equal(3))
+	})
+
+	It("should not remove the source when the copy fails", func() {
+		err := backend.Move(context.Background(), "s3:bucket/missing", "s3:bucket/backup")
+		Expect(IsNotFound(err)).To(BeTrue())
+		Expect(fake.countRequests("DELETE")).To(Equal(0))
+	})
+
+	It("should list and delete objects", func() {
+		Expect(backend.Upload(context.Background(), "s3:bucket/trash/backup", strings.NewReader("data"))).To(Succeed())
+		Expect(backend.Upload(context.Background(), "s3:bucket/backup", strings.NewReader("data"))).To(Succeed())
+
+		objects, err := backend.List(context.Background(), "s3:bucket/trash")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(objects).To(HaveLen(1))
+		Expect(objects[0].Key).To(Equal("backup"))
+		Expect(objects[0].Size).To(Equal(int64(4)))
+
+		Expect(backend.Delete(context.Background(), "s3:bucket/trash/backup")).To(Succeed())
+		Expect(fake.objects).To(HaveLen(1))
+	})
+})
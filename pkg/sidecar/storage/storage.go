@@ -0,0 +1,211 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package storage uploads the backups to, and downloads them from, the object storages.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	logf "github.com/presslabs/controller-util/log"
+)
+
+var log = logf.Log.WithName("sidecar-storage")
+
+const (
+	// DefaultPartSize is the size of the parts of the multipart uploads
+	DefaultPartSize = 16 << 20
+	// MinPartSize is the smallest part size accepted by the object storages
+	MinPartSize = 5 << 20
+	// DefaultConcurrency is the number of parts uploaded in parallel
+	DefaultConcurrency = 4
+
+	// maxParts is the maximum number of parts of a multipart upload
+	maxParts = 10000
+)
+
+// ErrChecksumMismatch is returned when the checksum of the data stored, or read, differs from
+// the checksum of the data sent, or expected
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Backend stores objects in a bucket. The objects are addressed by rclone paths,
+// `<remote>:<bucket>/<key>`, where the remote is the provider, e.g. `s3:backups/backup.xbackup.gz`.
+type Backend interface {
+	// Upload stores the data read from r, until EOF, as the object at url
+	Upload(ctx context.Context, url string, r io.Reader) error
+	// Download returns the content of the object at url. The returned reader must be closed.
+	Download(ctx context.Context, url string) (io.ReadCloser, error)
+	// Move moves the object at src to dest, in the same bucket
+	Move(ctx context.Context, src, dest string) error
+	// List returns the objects under the prefix url, recursively
+	List(ctx context.Context, url string) ([]Object, error)
+	// Delete removes the object at url
+	Delete(ctx context.Context, url string) error
+}
+
+// Object is an object listed from a bucket
+type Object struct {
+	// Key is the key of the object relative to the listed prefix, e.g. backup/db.sql.gz
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Options configures the backends
+type Options struct {
+	// Native enables the native backends of the providers that have one
+	Native bool
+	// PartSize is the size of the parts of the native multipart uploads
+	PartSize int64
+	// Concurrency is the number of parts uploaded in parallel by the native backends
+	Concurrency int
+	// RcloneArgs are the rclone arguments used by the rclone backend
+	RcloneArgs []string
+}
+
+func (o Options) partSize() int64 {
+	if o.PartSize <= 0 {
+		return DefaultPartSize
+	}
+	if o.PartSize < MinPartSize {
+		return MinPartSize
+	}
+	return o.PartSize
+}
+
+func (o Options) concurrency() int {
+	if o.Concurrency <= 0 {
+		return DefaultConcurrency
+	}
+	return o.Concurrency
+}
+
+// New returns the backend for the objects at url. The native backend of the url provider is
+// used when enabled and configured, and rclone otherwise.
+func New(url string, opts Options) Backend {
+	if opts.Native {
+		remote, _, _, err := parseURL(url)
+		if err != nil {
+			log.Info("unknown object URL, using rclone", "url", url, "error", err)
+			return NewRclone(opts.RcloneArgs)
+		}
+
+		var backend Backend
+		switch remote {
+		case "s3":
+			backend, err = newS3FromEnv(opts)
+		case "gs":
+			backend, err = newGCSFromEnv(opts)
+		case "azure":
+			backend, err = newAzureFromEnv(opts)
+		}
+
+		if err != nil {
+			log.Info("native backend is not configured, using rclone", "remote", remote, "error", err)
+		} else if backend != nil {
+			return backend
+		}
+	}
+
+	return NewRclone(opts.RcloneArgs)
+}
+
+// parseURL splits an object url in the remote, the bucket and the key
+func parseURL(url string) (remote, bucket, key string, err error) {
+	url = strings.Replace(url, "://", ":", 1)
+
+	parts := strings.SplitN(url, ":", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return "", "", "", fmt.Errorf("missing remote in %q", url)
+	}
+	remote = parts[0]
+
+	parts = strings.SplitN(strings.TrimPrefix(parts[1], "/"), "/", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", "", fmt.Errorf("missing bucket or key in %q", url)
+	}
+
+	return remote, parts[0], parts[1], nil
+}
+
+// parsePrefix splits a prefix url, that may be the bucket root, in the remote, the bucket and the
+// prefix of the keys, which ends with a slash unless empty
+func parsePrefix(url string) (remote, bucket, prefix string, err error) {
+	remote, bucket, prefix, err = parseURL(strings.TrimSuffix(url, "/") + "/.")
+	if err != nil {
+		return "", "", "", err
+	}
+	return remote, bucket, strings.TrimSuffix(prefix, "."), nil
+}
+
+// Error is a failed operation on the object storage
+type Error struct {
+	// Op is the operation, e.g. upload
+	Op string
+	// URL is the object url
+	URL string
+	// StatusCode is the HTTP status code of the response, zero when the error is not returned
+	// by the object storage
+	StatusCode int
+	// Code is the error code returned by the object storage, e.g. NoSuchKey
+	Code string
+	// Message is the error message returned by the object storage
+	Message string
+	// Err is the cause of the error
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s failed", e.Op, e.URL)
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("%s: %d %s", msg, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if len(e.Code) > 0 {
+		msg = fmt.Sprintf("%s: %s", msg, e.Code)
+	}
+	if len(e.Message) > 0 {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %s", msg, e.Err)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// asError returns err as an Error, unless it is one
+func asError(op, url string, err error) error {
+	var e *Error
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+	return &Error{Op: op, URL: url, Err: err}
+}
+
+// IsNotFound returns true if the error is caused by a missing object or bucket
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
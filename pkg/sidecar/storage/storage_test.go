@@ -0,0 +1,65 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Storage backend selection", func() {
+	BeforeEach(func() {
+		os.Setenv("AWS_ACCESS_KEY_ID", "access")
+		os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("AWS_ACCESS_KEY_ID")
+		os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	})
+
+	It("should use rclone by default", func() {
+		Expect(New("s3:bucket/backup", Options{})).To(BeAssignableToTypeOf(&rclone{}))
+	})
+
+	It("should use the native backend when enabled", func() {
+		Expect(New("s3://bucket/backup", Options{Native: true})).To(BeAssignableToTypeOf(&s3{}))
+	})
+
+	It("should fall back to rclone when the native backend is not configured", func() {
+		os.Unsetenv("AWS_ACCESS_KEY_ID")
+		Expect(New("s3:bucket/backup", Options{Native: true})).To(BeAssignableToTypeOf(&rclone{}))
+		Expect(New("azure:container/backup", Options{Native: true})).To(BeAssignableToTypeOf(&rclone{}))
+	})
+
+	It("should fall back to rclone for the providers without a native backend", func() {
+		Expect(New("hdfs:dir/backup", Options{Native: true})).To(BeAssignableToTypeOf(&rclone{}))
+	})
+
+	It("should parse object urls", func() {
+		remote, bucket, key, err := parseURL("gs://bucket/path/to/backup.xbackup.gz")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(remote).To(Equal("gs"))
+		Expect(bucket).To(Equal("bucket"))
+		Expect(key).To(Equal("path/to/backup.xbackup.gz"))
+
+		_, _, _, err = parseURL("s3:bucket")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	orc "github.com/bitpoke/mysql-operator/pkg/orchestrator"
+)
+
+var (
+	// takeoverTimeout is how long the pre-stop hook waits for orchestrator to promote another
+	// node, after the master takeover is requested
+	takeoverTimeout = time.Minute
+	// takeoverPollInterval is how often the master is checked during the takeover
+	takeoverPollInterval = time.Second
+
+	// newOrcClient returns the orchestrator client, replaced in tests
+	newOrcClient = func(cfg *Config) orc.Interface {
+		return orc.NewFromURI(cfg.OrchestratorURI, orcRequestsTimeout)
+	}
+)
+
+const (
+	// orcRequestsTimeout is the timeout of the orchestrator requests other than the takeover
+	orcRequestsTimeout = 10 * time.Second
+	// preStopTimeoutMargin is the time given to the pre-stop request on top of the takeover
+	// timeout, for the orchestrator requests that precede the wait for the new master
+	preStopTimeoutMargin = 30 * time.Second
+)
+
+// RunPreStopCommand calls, from the pre-stop hook of the sidecar container, the pre-stop
+// endpoint of the sidecar server, which takes over the master
+func RunPreStopCommand(cfg *Config) error {
+	timeout := takeoverTimeout + preStopTimeoutMargin
+	client := &http.Client{Timeout: timeout}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", serverPort, serverPreStopEndpoint)
+	resp, err := client.Get(url)
+	if err != nil {
+		log.Info("pre-stop request failed", "url", url, "timeout", timeout, "error", err)
+		return fmt.Errorf("pre-stop request failed: %s", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Info("pre-stop master takeover failed", "status", resp.Status, "body", strings.TrimSpace(string(body)))
+		return fmt.Errorf("pre-stop failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	log.Info("pre-stop master takeover done")
+	return nil
+}
+
+// takeOverMaster asks orchestrator for a graceful master takeover if this node is the master
+// and has replicas, then waits until orchestrator reports another master
+func takeOverMaster(ctx context.Context, cfg *Config, client orc.Interface) error {
+	host := cfg.FQDNForServer(cfg.ServerID())
+	alias := cfg.OrchestratorClusterAlias
+	tlog := log.WithValues("host", host, "cluster", alias)
+
+	master, err := client.Master(alias)
+	if err != nil {
+		return fmt.Errorf("failed to get the master from orchestrator: %s", err)
+	}
+	if master.Key.Hostname != host {
+		tlog.Info("node is not the master, skipping the master takeover", "master", master.Key.Hostname)
+		return nil
+	}
+
+	instances, err := client.Cluster(alias)
+	if err != nil {
+		return fmt.Errorf("failed to get the cluster from orchestrator: %s", err)
+	}
+	if !hasReplicas(instances, host) {
+		tlog.Info("master has no replicas, skipping the master takeover")
+		return nil
+	}
+
+	tlog.Info("requesting a graceful master takeover")
+	if err = client.GracefulMasterTakeover(alias, orc.InstanceKey{}); err != nil {
+		return fmt.Errorf("graceful master takeover failed: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, takeoverTimeout)
+	defer cancel()
+
+	var newMaster string
+	err = wait.PollImmediateUntil(takeoverPollInterval, func() (bool, error) {
+		m, mErr := client.Master(alias)
+		if mErr != nil {
+			tlog.Info("failed to get the master from orchestrator", "error", mErr.Error())
+			return false, nil
+		}
+		newMaster = m.Key.Hostname
+		return newMaster != host, nil
+	}, ctx.Done())
+	if err != nil {
+		return fmt.Errorf("orchestrator still reports %s as master after the takeover: %s", host, err)
+	}
+
+	tlog.Info("master taken over", "master", newMaster)
+	return nil
+}
+
+// hasReplicas returns true if any of the instances replicates from the given host
+func hasReplicas(instances []orc.Instance, host string) bool {
+	for _, inst := range instances {
+		if inst.MasterKey.Hostname == host {
+			return true
+		}
+	}
+	return false
+}
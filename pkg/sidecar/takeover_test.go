@@ -0,0 +1,172 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	orc "github.com/bitpoke/mysql-operator/pkg/orchestrator"
+	fakeOrc "github.com/bitpoke/mysql-operator/pkg/orchestrator/fake"
+)
+
+// stuckOrcClient accepts the master takeover requests but never changes the master
+type stuckOrcClient struct {
+	*fakeOrc.OrcFakeClient
+}
+
+func (c *stuckOrcClient) GracefulMasterTakeover(clusterHint string, designated orc.InstanceKey) error {
+	return nil
+}
+
+var _ = Describe("Test pre-stop master takeover", func() {
+	var (
+		cfg       *Config
+		orcClient *fakeOrc.OrcFakeClient
+		srv       *server
+		alias     string
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			Hostname:                 "cluster-mysql-0",
+			ClusterName:              "cluster",
+			Namespace:                "default",
+			ServiceName:              "mysql",
+			MyServerIDOffset:         100,
+			OrchestratorClusterAlias: "cluster.default",
+		}
+		alias = cfg.OrchestratorClusterAlias
+
+		orcClient = fakeOrc.New()
+		orcClient.AddInstance(orc.Instance{
+			ClusterName: alias,
+			Key:         orc.InstanceKey{Hostname: cfg.FQDNForServer(100)},
+		})
+
+		srv = &server{cfg: cfg}
+		newOrcClient = func(*Config) orc.Interface { return orcClient }
+	})
+
+	AfterEach(func() {
+		newOrcClient = func(cfg *Config) orc.Interface {
+			return orc.NewFromURI(cfg.OrchestratorURI, orcRequestsTimeout)
+		}
+	})
+
+	// the pre-stop hooks call the endpoint from the pod itself
+	preStopRequest := func() *http.Request {
+		req := httptest.NewRequest("GET", serverPreStopEndpoint, nil)
+		req.RemoteAddr = "127.0.0.1:41234"
+		return req
+	}
+
+	addReplica := func() {
+		orcClient.AddInstance(orc.Instance{
+			ClusterName: alias,
+			Key:         orc.InstanceKey{Hostname: cfg.FQDNForServer(101)},
+			MasterKey:   orc.InstanceKey{Hostname: cfg.FQDNForServer(100)},
+			ReadOnly:    true,
+		})
+	}
+
+	It("should take over the master", func() {
+		addReplica()
+
+		rec := httptest.NewRecorder()
+		srv.preStopHandler(rec, preStopRequest())
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(orcClient.Takeovers).To(HaveLen(1))
+
+		master, err := orcClient.Master(alias)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(master.Key.Hostname).To(Equal(cfg.FQDNForServer(101)))
+
+		// the hooks of the other containers get the same result
+		rec = httptest.NewRecorder()
+		srv.preStopHandler(rec, preStopRequest())
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(orcClient.Takeovers).To(HaveLen(1))
+	})
+
+	It("should reject the requests from outside the pod", func() {
+		addReplica()
+
+		rec := httptest.NewRecorder()
+		srv.preStopHandler(rec, httptest.NewRequest("GET", serverPreStopEndpoint, nil))
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(orcClient.Takeovers).To(BeEmpty())
+	})
+
+	It("should retry a failed takeover", func() {
+		orcClient.MakeOrcUnreachable()
+
+		rec := httptest.NewRecorder()
+		srv.preStopHandler(rec, preStopRequest())
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+
+		// orchestrator is reachable again when the hook of the other container calls
+		reachable := fakeOrc.New()
+		reachable.AddInstance(orc.Instance{
+			ClusterName: alias,
+			Key:         orc.InstanceKey{Hostname: cfg.FQDNForServer(100)},
+		})
+		newOrcClient = func(*Config) orc.Interface { return reachable }
+
+		rec = httptest.NewRecorder()
+		srv.preStopHandler(rec, preStopRequest())
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should skip the takeover on replicas", func() {
+		addReplica()
+		cfg.Hostname = "cluster-mysql-1"
+
+		Expect(takeOverMaster(context.TODO(), cfg, orcClient)).To(Succeed())
+		Expect(orcClient.Takeovers).To(BeEmpty())
+	})
+
+	It("should skip the takeover when the master has no replicas", func() {
+		Expect(takeOverMaster(context.TODO(), cfg, orcClient)).To(Succeed())
+		Expect(orcClient.Takeovers).To(BeEmpty())
+	})
+
+	It("should fail when orchestrator is not reachable", func() {
+		orcClient.MakeOrcUnreachable()
+
+		rec := httptest.NewRecorder()
+		srv.preStopHandler(rec, preStopRequest())
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(rec.Body.String()).To(ContainSubstring("failed to get the master from orchestrator"))
+	})
+
+	It("should fail when the master doesn't change in time", func() {
+		addReplica()
+		defer func(timeout, interval time.Duration) {
+			takeoverTimeout, takeoverPollInterval = timeout, interval
+		}(takeoverTimeout, takeoverPollInterval)
+		takeoverTimeout, takeoverPollInterval = 50*time.Millisecond, 10*time.Millisecond
+
+		err := takeOverMaster(context.TODO(), cfg, &stuckOrcClient{orcClient})
+		Expect(err).To(MatchError(ContainSubstring("still reports")))
+	})
+})
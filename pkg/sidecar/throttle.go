@@ -0,0 +1,77 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// throttleMaxBurst is the most bytes written at once by a throttled writer
+const throttleMaxBurst = 1024 * 1024
+
+// throttledWriter limits the rate at which data is written to the underlying writer. The
+// writers that share the limiter share its rate.
+type throttledWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	limiter *rate.Limiter
+}
+
+// newLimiter returns a limiter of bytesPerSecond for the throttled writers
+func newLimiter(bytesPerSecond int64) *rate.Limiter {
+	burst := int(bytesPerSecond)
+	if bytesPerSecond > throttleMaxBurst {
+		burst = throttleMaxBurst
+	}
+
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+// newThrottledWriter returns a writer that writes to w at the rate allowed by the limiter. The
+// writes are aborted once ctx is done.
+func newThrottledWriter(ctx context.Context, w io.Writer, limiter *rate.Limiter) io.Writer {
+	return &throttledWriter{
+		ctx:     ctx,
+		w:       w,
+		limiter: limiter,
+	}
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := len(p) - written
+		if chunk > tw.limiter.Burst() {
+			chunk = tw.limiter.Burst()
+		}
+
+		if err := tw.limiter.WaitN(tw.ctx, chunk); err != nil {
+			return written, err
+		}
+
+		n, err := tw.w.Write(p[written : written+chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test stream throttling", func() {
+	It("should write at most the given rate", func() {
+		out := &bytes.Buffer{}
+		tw := newThrottledWriter(context.Background(), out, newLimiter(10*1024))
+
+		start := time.Now()
+		// the first burst is written right away, the rest at 10KiB/s
+		n, err := tw.Write(make([]byte, 15*1024))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(15 * 1024))
+		Expect(out.Len()).To(Equal(15 * 1024))
+		Expect(time.Since(start)).To(BeNumerically(">=", 400*time.Millisecond))
+	})
+
+	It("should stop writing when the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		tw := newThrottledWriter(ctx, &bytes.Buffer{}, newLimiter(1024))
+		_, err := tw.Write(make([]byte, 4096))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should throttle clones and backups independently", func() {
+		srv := &server{cfg: &Config{BackupBandwidthLimit: 1024, CloneBandwidthLimit: 4096}}
+
+		backupReq := httptest.NewRequest("GET", serverBackupEndpoint, nil)
+		Expect(srv.bandwidthLimit(backupReq)).To(Equal(int64(1024)))
+
+		cloneReq := httptest.NewRequest("GET", serverBackupEndpoint+"?"+streamPurposeParam+"="+clonePurpose, nil)
+		Expect(srv.bandwidthLimit(cloneReq)).To(Equal(int64(4096)))
+	})
+
+	It("should throttle each stream at the bandwidth limit of its purpose", func() {
+		cfg := &Config{BackupBandwidthLimit: 1024, CloneBandwidthLimit: 4096}
+		srv := &server{cfg: cfg}
+
+		cloneReq := httptest.NewRequest("GET", serverBackupEndpoint+"?"+streamPurposeParam+"="+clonePurpose, nil)
+		backupReq := httptest.NewRequest("GET", serverBackupEndpoint, nil)
+
+		Expect(srv.limiter(cloneReq).Limit()).To(BeNumerically("==", 4096))
+		Expect(srv.limiter(backupReq).Limit()).To(BeNumerically("==", 1024))
+
+		cfg.BackupBandwidthLimit = 2048
+		Expect(srv.limiter(backupReq).Limit()).To(BeNumerically("==", 2048))
+
+		cfg.BackupBandwidthLimit = 0
+		Expect(srv.limiter(backupReq)).To(BeNil())
+	})
+
+	It("should write at the shared rate from concurrent writers", func() {
+		limiter := newLimiter(10 * 1024)
+		start := time.Now()
+
+		done := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer GinkgoRecover()
+				_, err := newThrottledWriter(context.Background(), &bytes.Buffer{}, limiter).Write(make([]byte, 10*1024))
+				done <- err
+			}()
+		}
+		Expect(<-done).ToNot(HaveOccurred())
+		Expect(<-done).ToNot(HaveOccurred())
+
+		// the first burst is written right away, the other 10KiB at 10KiB/s
+		Expect(time.Since(start)).To(BeNumerically(">=", 900*time.Millisecond))
+	})
+})
@@ -18,9 +18,18 @@ package sidecar
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	// add mysql driver
 	_ "github.com/go-sql-driver/mysql"
@@ -101,3 +110,251 @@ func getGTIDFrom(reader io.Reader) (string, error) {
 
 	return gtid, nil
 }
+
+// readCheckpoints returns the from_lsn and to_lsn values from the
+// xtrabackup_checkpoints file found in the given directory
+func readCheckpoints(dir string) (fromLSN, toLSN int64, err error) {
+	file, err := os.Open(path.Join(dir, "xtrabackup_checkpoints"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer func() {
+		if err1 := file.Close(); err1 != nil {
+			log.Error(err1, "failed to close file")
+		}
+	}()
+
+	return getLSNsFrom(file)
+}
+
+// getLSNsFrom parses the content of a xtrabackup_checkpoints file
+func getLSNsFrom(reader io.Reader) (fromLSN, toLSN int64, err error) {
+	found := 0
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "from_lsn":
+			if fromLSN, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return 0, 0, err
+			}
+			found++
+		case "to_lsn":
+			if toLSN, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return 0, 0, err
+			}
+			found++
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return 0, 0, err
+	} else if found != 2 {
+		return 0, 0, fmt.Errorf("from_lsn or to_lsn not found")
+	}
+
+	return fromLSN, toLSN, nil
+}
+
+// readBackupInfo returns the GTID set and the MySQL server version of a backup from the
+// xtrabackup_binlog_info and xtrabackup_info files found in the given directory
+func readBackupInfo(dir string) (gtidSet, version string, err error) {
+	file, err := os.Open(path.Join(dir, "xtrabackup_info"))
+	if err != nil {
+		return "", "", err
+	}
+
+	defer func() {
+		if err1 := file.Close(); err1 != nil {
+			log.Error(err1, "failed to close file")
+		}
+	}()
+
+	if gtidSet, version, err = getBackupInfoFrom(file); err != nil {
+		return "", "", err
+	}
+
+	// xtrabackup_binlog_info is not always saved, but it's more accurate when it is
+	binlogInfo, err := os.Open(path.Join(dir, "xtrabackup_binlog_info"))
+	if os.IsNotExist(err) {
+		return gtidSet, version, nil
+	} else if err != nil {
+		return "", "", err
+	}
+
+	defer func() {
+		if err1 := binlogInfo.Close(); err1 != nil {
+			log.Error(err1, "failed to close file")
+		}
+	}()
+
+	if gtid, err := getGTIDFrom(binlogInfo); err == nil {
+		gtidSet = gtid
+	}
+
+	return gtidSet, version, nil
+}
+
+var (
+	// binlogPosGTIDRe matches the GTID set in the binlog_pos line of xtrabackup_info, e.g.:
+	// binlog_pos = filename 'mysql-bin.000002', position '191', GTID of the last change 'uuid:1-5'
+	// the GTID set may span multiple lines
+	binlogPosGTIDRe = regexp.MustCompile(`GTID of the last change '([^']*)'`)
+	serverVersionRe = regexp.MustCompile(`(?m)^server_version\s*=\s*(.*)$`)
+	serverUUIDRe    = regexp.MustCompile(`(?m)^server-uuid\s*=\s*(\S+)`)
+)
+
+// readServerUUID returns the UUID of the MySQL server from the auto.cnf file found in the
+// given data dir
+func readServerUUID(dir string) (string, error) {
+	file, err := os.Open(path.Join(dir, "auto.cnf"))
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err1 := file.Close(); err1 != nil {
+			log.Error(err1, "failed to close file")
+		}
+	}()
+
+	return getServerUUIDFrom(file)
+}
+
+// getServerUUIDFrom parses the content of an auto.cnf file
+func getServerUUIDFrom(reader io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	m := serverUUIDRe.FindSubmatch(data)
+	if m == nil {
+		return "", fmt.Errorf("server-uuid not found")
+	}
+	return string(m[1]), nil
+}
+
+// getBackupInfoFrom parses the content of a xtrabackup_info file
+func getBackupInfoFrom(reader io.Reader) (gtidSet, version string, err error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	if m := serverVersionRe.FindSubmatch(data); m != nil {
+		version = strings.TrimSpace(string(m[1]))
+	}
+	if m := binlogPosGTIDRe.FindSubmatch(data); m != nil {
+		gtidSet = strings.Join(strings.Fields(string(m[1])), "")
+	}
+
+	return gtidSet, version, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	atomic.AddInt64(&cw.n, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes written so far
+func (cw *countingWriter) Count() int64 {
+	return atomic.LoadInt64(&cw.n)
+}
+
+// dirSize returns the total size of the files from dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// timeoutError is returned when a command is stopped because it made no progress
+type timeoutError struct {
+	op      string
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s made no progress for %s", e.op, e.timeout)
+}
+
+// IsTimeout returns true if the error is caused by a command that was stopped because it made
+// no progress
+func IsTimeout(err error) bool {
+	var te *timeoutError
+	return errors.As(err, &te)
+}
+
+// checksumError is returned when a downloaded backup doesn't match the checksum computed when
+// it was uploaded
+type checksumError struct {
+	url      string
+	expected string
+	actual   string
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: expected sha256 %s, got %s", e.url, e.expected, e.actual)
+}
+
+// IsChecksumMismatch returns true if the error is caused by a backup whose content differs from
+// what was uploaded
+func IsChecksumMismatch(err error) bool {
+	var ce *checksumError
+	return errors.As(err, &ce)
+}
+
+// watchProgress calls onStall when the count of the writer doesn't change for timeout. The
+// returned stop function ends the watch and reports whether onStall was called.
+func watchProgress(cw *countingWriter, timeout time.Duration, onStall func()) (stop func() bool) {
+	done := make(chan struct{})
+	var stalled int32
+
+	go func() {
+		ticker := time.NewTicker(timeout / 10)
+		defer ticker.Stop()
+
+		last, lastChange := cw.Count(), time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if count := cw.Count(); count != last {
+					last, lastChange = count, now
+				} else if now.Sub(lastChange) >= timeout {
+					atomic.StoreInt32(&stalled, 1)
+					onStall()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		return atomic.LoadInt32(&stalled) == 1
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2018 Pressinfra SRL
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecar
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test upload progress watch", func() {
+	It("should stop an upload that makes no progress", func() {
+		stalled := make(chan struct{})
+		stop := watchProgress(&countingWriter{w: ioutil.Discard}, 50*time.Millisecond, func() {
+			close(stalled)
+		})
+
+		Eventually(stalled).Should(BeClosed())
+		Expect(stop()).To(BeTrue())
+	})
+
+	It("should not stop an upload that makes progress", func() {
+		cw := &countingWriter{w: ioutil.Discard}
+		stop := watchProgress(cw, 100*time.Millisecond, func() {})
+
+		for i := 0; i < 10; i++ {
+			_, _ = cw.Write([]byte("data"))
+			time.Sleep(20 * time.Millisecond)
+		}
+		Expect(stop()).To(BeFalse())
+	})
+
+	It("should recognize timeout errors", func() {
+		err := fmt.Errorf("dump database shop: %w", &timeoutError{op: "upload", timeout: time.Minute})
+		Expect(IsTimeout(err)).To(BeTrue())
+		Expect(IsTimeout(fmt.Errorf("upload failed"))).To(BeFalse())
+		Expect(IsTimeout(nil)).To(BeFalse())
+	})
+})
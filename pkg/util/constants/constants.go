@@ -29,6 +29,23 @@ const (
 	SidecarServerPort = 8080
 	// SidecarServerProbePath the probe path
 	SidecarServerProbePath = "/health"
+	// SidecarServerBackupProgressPath is the path on which the sidecar reports the progress of
+	// the backup it streams
+	SidecarServerBackupProgressPath = "/backup-progress"
+	// SidecarServerStreamPurposeParam is the query parameter that tells what a stream requested
+	// from the sidecar, or its progress, is used for
+	SidecarServerStreamPurposeParam = "purpose"
+	// SidecarServerBackupPurpose is the purpose of the streams requested by the backup jobs
+	SidecarServerBackupPurpose = "backup"
+	// SidecarServerPreStopPath is the path of the pre-stop hook that, on the master, takes over
+	// the master before MySQL is stopped
+	SidecarServerPreStopPath = "/pre-stop"
+	// SidecarServerSnapshotLockPath is the path on which the sidecar locks the node for a
+	// volume snapshot backup, reports and releases the lock
+	SidecarServerSnapshotLockPath = "/snapshot-lock"
+	// SidecarServerSnapshotLockBackupParam is the query parameter with the name of the backup
+	// for which the node is locked
+	SidecarServerSnapshotLockBackupParam = "backup"
 
 	// ExporterPort is the port that metrics will be exported
 	ExporterPort = 9125
@@ -75,9 +92,17 @@ const (
 	// script from mysql-operator-sidecar/docker-entrypoint.sh. /tmp/rclone.conf
 	RcloneConfigFile = "/tmp/rclone.conf"
 
-	// ShPreStop used in mysql container, if the pod to be deleted is master, then preStop would do GracefulMasterTakeover
-	// before mysql container is deleted.
-	ShPreStop = "pre-shutdown-ha.sh"
+	// BackupEncryptionKeysPath is the path where the secret with the backup encryption keys is
+	// mounted, one file for each key ID
+	BackupEncryptionKeysPath = "/var/run/backup-encryption"
+
+	// ReplicationSourceTLSPath is the path where the secret with the certificates used to
+	// replicate from the replication source of a standby cluster is mounted
+	ReplicationSourceTLSPath = "/var/run/replication-source-tls"
+
+	// BackupTimeoutExitCode is the exit code of the backup container when the backup was stopped
+	// because it made no progress
+	BackupTimeoutExitCode = 124
 )
 
 var (